@@ -14,6 +14,12 @@ const (
 	ITEM
 	INVENTORY
 	STATE
+	STEERING_BEHAVIOURS
+	PATH
+	GOAP
+	UTILITY
+	PERCEPTION
+	STATEMACHINE
 	GENERICTAGS // NOTE: this should always be the last one, so clients can start
 	// their consts at GENERICTAGS + 1 + iota
 )
@@ -1,28 +1,290 @@
 package sameriver
 
+import (
+	"fmt"
+)
+
+// Blackboard is shared state (and an event bus) for entities to coordinate
+// through: a world blackboard (see World.Blackboard()), a squad's, or an
+// entity's own (see Entity.Blackboard()).
+//
+// Blackboards are scoped by their Parent: Get() and Has() fall through to
+// the parent (and its parent, ...) for keys not set locally, so that an
+// entity's blackboard can shadow its squad's, which can shadow the
+// world's, while Set() always writes locally.
+//
+// Every change to an entry - Set(), Delete(), or its expiry - publishes a
+// "blackboard-changed" event on Events with a *BlackboardChange as data
+// (subscribe to the keys you want with Subscribe()). Changes are published
+// on the blackboard they're made in, not its children.
+//
+// Each key's changes are also counted (see Version()), for those who only
+// need to know whether something changed since they last looked, without
+// subscribing.
+//
+// Entries set with SetFor() expire after a time, by the blackboard's clock,
+// advanced by Update() (eg. remembered sightings of a threat, fading from
+// memory). The world calls Update() on its blackboards, those of entities
+// and squads, and any given to World.AddBlackboard(), as it updates.
 type Blackboard struct {
 	Name   string
+	Parent *Blackboard
 	state  map[string]any
 	Events *EventBus
+
+	t float64
+	// key -> when it expires, for entries set with SetFor()
+	expiries map[string]float64
+	// key -> how many times it's changed, and how many changes in all
+	versions map[string]uint64
+	version  uint64
+}
+
+// BlackboardChange is the data of a "blackboard-changed" event
+type BlackboardChange struct {
+	Blackboard *Blackboard
+	Key        string
+	// the value before (nil if there was none), and after (nil if deleted)
+	Old     any
+	New     any
+	HadOld  bool
+	Deleted bool
+	// if it was deleted by expiring
+	Expired bool
 }
 
 func NewBlackboard(name string) *Blackboard {
 	return &Blackboard{
-		Name:   name,
-		state:  make(map[string]any),
-		Events: NewEventBus("blackboard-" + name),
+		Name:     name,
+		state:    make(map[string]any),
+		Events:   NewEventBus("blackboard-" + name),
+		expiries: make(map[string]float64),
+		versions: make(map[string]uint64),
 	}
 }
 
+// SetParent sets the blackboard lookups fall through to
+func (b *Blackboard) SetParent(parent *Blackboard) {
+	for p := parent; p != nil; p = p.Parent {
+		if p == b {
+			panic(fmt.Sprintf("blackboard %s can't have %s as a parent: it would be its own ancestor", b.Name, parent.Name))
+		}
+	}
+	b.Parent = parent
+}
+
+// Has is whether k is set here or in an ancestor
 func (b *Blackboard) Has(k string) bool {
-	_, ok := b.state[k]
+	_, ok := b.Lookup(k)
 	return ok
 }
 
+// Get gives the value of k set nearest, here or in an ancestor (nil if
+// none)
 func (b *Blackboard) Get(k string) any {
+	v, _ := b.Lookup(k)
+	return v
+}
+
+// Lookup gives the value of k set nearest, here or in an ancestor, and
+// whether it was found
+func (b *Blackboard) Lookup(k string) (any, bool) {
+	for s := b; s != nil; s = s.Parent {
+		if v, ok := s.state[k]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// HasLocal is whether k is set here (not looking in ancestors)
+func (b *Blackboard) HasLocal(k string) bool {
+	_, ok := b.state[k]
+	return ok
+}
+
+// GetLocal gives the value of k set here (not looking in ancestors)
+func (b *Blackboard) GetLocal(k string) any {
 	return b.state[k]
 }
 
 func (b *Blackboard) Set(k string, v any) {
+	delete(b.expiries, k)
+	b.set(k, v)
+}
+
+// SetFor sets k to v for ttl_ms (by the clock advanced by Update()), after
+// which it's deleted
+func (b *Blackboard) SetFor(k string, v any, ttl_ms float64) {
+	b.expiries[k] = b.t + ttl_ms
+	b.set(k, v)
+}
+
+func (b *Blackboard) set(k string, v any) {
+	old, had := b.state[k]
 	b.state[k] = v
+	b.changed(k)
+	b.Events.Publish("blackboard-changed", &BlackboardChange{
+		Blackboard: b,
+		Key:        k,
+		Old:        old,
+		New:        v,
+		HadOld:     had,
+	})
+}
+
+// Delete removes k from this blackboard (uncovering any value an ancestor
+// has for it)
+func (b *Blackboard) Delete(k string) {
+	b.delete(k, false)
+}
+
+func (b *Blackboard) delete(k string, expired bool) {
+	old, had := b.state[k]
+	if !had {
+		return
+	}
+	delete(b.state, k)
+	delete(b.expiries, k)
+	b.changed(k)
+	b.Events.Publish("blackboard-changed", &BlackboardChange{
+		Blackboard: b,
+		Key:        k,
+		Old:        old,
+		HadOld:     true,
+		Deleted:    true,
+		Expired:    expired,
+	})
+}
+
+func (b *Blackboard) changed(k string) {
+	b.versions[k]++
+	b.version++
+}
+
+// Version counts the changes made here to keys (to any key, if none are
+// given); it differs from what it was earlier if and only if one of them
+// has changed since
+func (b *Blackboard) Version(keys ...string) uint64 {
+	if len(keys) == 0 {
+		return b.version
+	}
+	var v uint64
+	for _, k := range keys {
+		v += b.versions[k]
+	}
+	return v
+}
+
+// TTL gives how long k has left before it expires (false if it isn't set
+// to)
+func (b *Blackboard) TTL(k string) (float64, bool) {
+	until, ok := b.expiries[k]
+	if !ok {
+		return 0, false
+	}
+	return until - b.t, true
+}
+
+// Update advances the clock by which entries set with SetFor() expire,
+// deleting those which have
+func (b *Blackboard) Update(dt_ms float64) {
+	b.t += dt_ms
+	for k, until := range b.expiries {
+		if until <= b.t {
+			b.delete(k, true)
+		}
+	}
+}
+
+// Subscribe gives a channel receiving the "blackboard-changed" events of
+// keys (of all keys, if none are given)
+func (b *Blackboard) Subscribe(keys ...string) *EventChannel {
+	return b.Events.Subscribe(BlackboardChangeFilter(keys...))
+}
+
+// BlackboardChangeFilter filters "blackboard-changed" events to those of
+// keys (all, if none are given)
+func BlackboardChangeFilter(keys ...string) *EventFilter {
+	if len(keys) == 0 {
+		return SimpleEventFilter("blackboard-changed")
+	}
+	watched := make(map[string]bool)
+	for _, k := range keys {
+		watched[k] = true
+	}
+	return PredicateEventFilter("blackboard-changed", func(e Event) bool {
+		return watched[e.Data.(*BlackboardChange).Key]
+	})
+}
+
+// BBKey is a blackboard key whose values are of type T, so that they're
+// got and set without asserting their type at every use, eg.
+//
+//	var THREAT = NewBBKey[*Entity]("threat")
+//	...
+//	THREAT.Set(bb, bandit)
+//	if threat, ok := THREAT.Get(bb); ok { ... }
+type BBKey[T any] struct {
+	Name string
+}
+
+func NewBBKey[T any](name string) BBKey[T] {
+	return BBKey[T]{Name: name}
+}
+
+// Get gives the value of the key set nearest in b or its ancestors, and
+// whether there was one (of type T)
+func (k BBKey[T]) Get(b *Blackboard) (v T, ok bool) {
+	x, found := b.Lookup(k.Name)
+	if !found {
+		return v, false
+	}
+	v, ok = x.(T)
+	return v, ok
+}
+
+// GetOr gives the value of the key in b (or its ancestors), or def if
+// there's none
+func (k BBKey[T]) GetOr(b *Blackboard, def T) T {
+	if v, ok := k.Get(b); ok {
+		return v
+	}
+	return def
+}
+
+func (k BBKey[T]) Has(b *Blackboard) bool {
+	_, ok := k.Get(b)
+	return ok
+}
+
+func (k BBKey[T]) Set(b *Blackboard, v T) {
+	b.Set(k.Name, v)
+}
+
+func (k BBKey[T]) SetFor(b *Blackboard, v T, ttl_ms float64) {
+	b.SetFor(k.Name, v, ttl_ms)
+}
+
+func (k BBKey[T]) Delete(b *Blackboard) {
+	b.Delete(k.Name)
+}
+
+// Blackboard gives the entity's own blackboard (made when first asked
+// for, and dropped when the entity is despawned)
+func (e *Entity) Blackboard() *Blackboard {
+	if e.blackboard == nil {
+		e.blackboard = NewBlackboard(fmt.Sprintf("entity-%d", e.ID))
+		e.World.AddBlackboard(e.blackboard)
+	}
+	return e.blackboard
+}
+
+// dropBlackboard drops the entity's blackboard (the world no longer
+// advancing its clock)
+func (e *Entity) dropBlackboard() {
+	if e.blackboard != nil {
+		e.World.RemoveBlackboard(e.blackboard)
+		e.blackboard = nil
+	}
 }
@@ -5,6 +5,8 @@ import (
 
 	"math/rand"
 	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestBlackboardWorldEntities(t *testing.T) {
@@ -125,3 +127,172 @@ func TestBlackboardWorldEntities(t *testing.T) {
 		Logger.Printf("%d will be doing '%s'", e.ID, role)
 	}
 }
+
+func TestBlackboardTypedKeys(t *testing.T) {
+	bb := NewBlackboard("camp")
+	threat := NewBBKey[*Entity]("threat")
+	alarm := NewBBKey[int]("alarm")
+	if _, ok := threat.Get(bb); ok || threat.Has(bb) {
+		t.Fatal("threat shouldn't be set yet")
+	}
+	w := testingWorld()
+	bandit := testingSpawnSimple(w)
+	threat.Set(bb, bandit)
+	if got, ok := threat.Get(bb); !ok || got != bandit {
+		t.Fatal("should have got the bandit back")
+	}
+	if alarm.GetOr(bb, 3) != 3 {
+		t.Fatal("should have got the default for an unset key")
+	}
+	// a value of another type isn't got by the key
+	bb.Set("alarm", "loud")
+	if _, ok := alarm.Get(bb); ok {
+		t.Fatal("a string alarm shouldn't be got as an int")
+	}
+	alarm.Delete(bb)
+	if bb.Has("alarm") {
+		t.Fatal("alarm should have been deleted")
+	}
+}
+
+func TestBlackboardChangeEvents(t *testing.T) {
+	bb := NewBlackboard("camp")
+	threats := bb.Subscribe("threat")
+	all := bb.Subscribe()
+	bb.Set("threat", 1)
+	bb.Set("threat", 2)
+	bb.Set("fire", true)
+	bb.Delete("threat")
+	bb.Delete("nothing")
+	if len(threats.C) != 3 || len(all.C) != 4 {
+		t.Fatalf("expected 3 threat changes of 4, got %d of %d", len(threats.C), len(all.C))
+	}
+	first := (<-threats.C).Data.(*BlackboardChange)
+	if first.HadOld || first.New != 1 {
+		t.Fatal("the first change should have set threat from nothing to 1")
+	}
+	second := (<-threats.C).Data.(*BlackboardChange)
+	if !second.HadOld || second.Old != 1 || second.New != 2 {
+		t.Fatal("the second change should have been from 1 to 2")
+	}
+	deleted := (<-threats.C).Data.(*BlackboardChange)
+	if !deleted.Deleted || deleted.Expired || deleted.Old != 2 {
+		t.Fatal("the last change should have deleted threat")
+	}
+}
+
+func TestBlackboardTTL(t *testing.T) {
+	bb := NewBlackboard("memory")
+	changes := bb.Subscribe("sighting")
+	sighting := NewBBKey[Vec2D]("sighting")
+	sighting.SetFor(bb, Vec2D{10, 5}, 1000)
+	bb.Set("home", Vec2D{0, 0})
+	bb.Update(600)
+	if left, ok := bb.TTL("sighting"); !ok || left != 400 {
+		t.Fatalf("the sighting should have 400ms left, got %f", left)
+	}
+	if _, ok := bb.TTL("home"); ok {
+		t.Fatal("home shouldn't expire")
+	}
+	bb.Update(600)
+	if sighting.Has(bb) || !bb.Has("home") {
+		t.Fatal("only the sighting should have expired")
+	}
+	changes.DrainChannel()
+	// setting without a TTL keeps it
+	sighting.SetFor(bb, Vec2D{1, 1}, 100)
+	sighting.Set(bb, Vec2D{2, 2})
+	bb.Update(200)
+	if !sighting.Has(bb) {
+		t.Fatal("the sighting set since without a TTL shouldn't have expired")
+	}
+	// expiry is published
+	sighting.SetFor(bb, Vec2D{3, 3}, 100)
+	changes.DrainChannel()
+	bb.Update(100)
+	if len(changes.C) != 1 || !(<-changes.C).Data.(*BlackboardChange).Expired {
+		t.Fatal("the expiry should have been published")
+	}
+}
+
+func TestBlackboardTTLWorldUpdate(t *testing.T) {
+	w := testingWorld()
+	e := testingSpawnSimple(w)
+	village := w.Blackboard("village")
+	own := e.Blackboard()
+	changes := own.Subscribe("sighting")
+	// (a blackboard of our own, given to the world to advance)
+	camp := NewBlackboard("camp")
+	w.AddBlackboard(camp)
+	for _, bb := range []*Blackboard{village, own, camp} {
+		bb.SetFor("sighting", Vec2D{10, 5}, 20)
+		bb.Set("home", Vec2D{0, 0})
+	}
+	w.Update(FRAME_MS / 2)
+	time.Sleep(40 * time.Millisecond)
+	w.Update(FRAME_MS / 2)
+	for _, bb := range []*Blackboard{village, own, camp} {
+		if bb.Has("sighting") || !bb.Has("home") {
+			t.Fatalf("only the sighting should have expired from %s", bb.Name)
+		}
+	}
+	expired := false
+	for len(changes.C) > 0 {
+		expired = expired || (<-changes.C).Data.(*BlackboardChange).Expired
+	}
+	if !expired {
+		t.Fatal("the expiry should have been published")
+	}
+	// the clocks advance with the world, whatever becomes of its logics
+	// (a game may have its own named "blackboards")
+	w.AddWorldLogic("blackboards", func(dt_ms float64) {})
+	w.DeactivateAllWorldLogics()
+	village.SetFor("sighting", Vec2D{10, 5}, 20)
+	w.Update(FRAME_MS / 2)
+	time.Sleep(40 * time.Millisecond)
+	w.Update(FRAME_MS / 2)
+	if village.Has("sighting") {
+		t.Fatal("the sighting should have expired with the world logics deactivated")
+	}
+	// a despawned entity's blackboard is no longer advanced
+	w.Despawn(e)
+	if w.liveBlackboards[own] {
+		t.Fatal("the despawned entity's blackboard should have been dropped")
+	}
+}
+
+func TestBlackboardScoping(t *testing.T) {
+	w := testingWorld()
+	village := w.Blackboard("village")
+	farmers, _ := testingGOAPFarmers(w, 2)
+	squad := NewGOAPSquad(nil, farmers...)
+	squad.Blackboard.SetParent(village)
+	a, b := farmers[0].Entity, farmers[1].Entity
+
+	village.Set("threat", "wolves")
+	village.Set("curfew", 20)
+	squad.Blackboard.Set("threat", "bandits")
+	a.Blackboard().Set("curfew", 22)
+	if a.Blackboard().Get("threat") != "bandits" || b.Blackboard().Get("threat") != "bandits" {
+		t.Fatal("the squad's threat should shadow the village's")
+	}
+	if a.Blackboard().Get("curfew") != 22 || b.Blackboard().Get("curfew") != 20 {
+		t.Fatal("a's own curfew should shadow the village's, not b's")
+	}
+	if b.Blackboard().HasLocal("curfew") || b.Blackboard().GetLocal("threat") != nil {
+		t.Fatal("b has nothing set locally")
+	}
+	// deleting uncovers what's shadowed
+	squad.Blackboard.Delete("threat")
+	if a.Blackboard().Get("threat") != "wolves" {
+		t.Fatal("the village's threat should be uncovered")
+	}
+	assert.Panics(t, func() { village.SetParent(a.Blackboard()) })
+
+	// an entity's blackboard goes when it's despawned
+	w.Despawn(a)
+	respawned := w.Spawn(nil)
+	if respawned.Blackboard().Has("curfew") {
+		t.Fatal("a new entity shouldn't inherit a despawned one's blackboard")
+	}
+}
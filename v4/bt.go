@@ -8,6 +8,27 @@ type BTDecorator struct {
 	Impl func(self *BTNode) bool
 }
 
+// BTStatus is the result of ticking a node: still running, or finished in
+// success or failure
+type BTStatus int
+
+const (
+	BT_RUNNING BTStatus = iota
+	BT_SUCCESS
+	BT_FAILURE
+)
+
+func (s BTStatus) String() string {
+	switch s {
+	case BT_SUCCESS:
+		return "success"
+	case BT_FAILURE:
+		return "failure"
+	default:
+		return "running"
+	}
+}
+
 // BTNode: A struct that represents a node in the Behavior Tree, either an action
 // or a composite node.
 type BTNode struct {
@@ -24,8 +45,9 @@ type BTNode struct {
 	IsFailed func(self *BTNode) bool
 
 	Name string
-	// decorators are just strings that index a BTDecorator in the BTRunner's map.
-	// either plains strings or... TODO: a DSL?
+	// decorators are strings that index a BTDecorator in the BTRunner's map,
+	// either plain names ("planPlant") or calls of a BTDecoratorFactory with
+	// an argument, eg. an EFDSL expression ("If(State(hungry, 1))")
 	Decorators []string
 	// the runs counter from the behaviour tree of in which run we last ran
 	// all the decorators to success (prevent recalculation when a parent node
@@ -50,12 +72,26 @@ type BTNode struct {
 	CompletionPredicate func(self *BTNode) bool
 	WhenDone            func(self *BTNode)
 	WhenChildDone       func(self *BTNode)
+
+	// how a complete node finished (BT_RUNNING while it hasn't): Done()
+	// succeeds, Fail() fails
+	Status BTStatus
+	// like CompletedChildren, for children which finished with Fail()
+	FailedChildren int
+	// if non-nil, decides what a child finishing (child.Status) means for
+	// this node - whether it carries on, or finishes itself - in place of
+	// CompletionPredicate (see bt_nodes.go)
+	OnChildFinished func(self *BTNode, child *BTNode) BTStatus
+	// for a leaf, what it does when ticked by TickBT() (nil for a leaf
+	// finished by calling Done() or Fail() on it from elsewhere)
+	Tick func(self *BTNode, dt_ms float64) BTStatus
 }
 
 func (n *BTNode) SetChildren(children []*BTNode) {
 	n.Children = children
 	for _, ch := range children {
 		ch.Parent = n
+		ch.Tree = n.Tree
 		if ch.Init != nil {
 			ch.State = make(map[string]any)
 			ch.Init(ch)
@@ -67,6 +103,7 @@ func (n *BTNode) SetChildren(children []*BTNode) {
 func (n *BTNode) Done() {
 	// set flag
 	n.Complete = true
+	n.Status = BT_SUCCESS
 	// callback
 	if n.WhenDone != nil {
 		n.WhenDone(n)
@@ -79,6 +116,10 @@ func (n *BTNode) Done() {
 	// percolate up
 	if p != nil {
 		p.CompletedChildren++
+		if p.OnChildFinished != nil {
+			p.Finish(p.OnChildFinished(p, n))
+			return
+		}
 		// skip over those with nil CompletionPredicate up to the next
 		// parent that has a completion predicate
 		if p.CompletionPredicate != nil && p.CompletionPredicate(p) {
@@ -87,13 +128,64 @@ func (n *BTNode) Done() {
 	}
 }
 
+// Fail finishes the node, like Done(), but in failure. Unlike SetFailed(),
+// which fails a node for the current run only (eg. its decorators didn't
+// pass), this sticks until the node is reset. Its parent decides what it
+// means for itself by OnChildFinished, or if it has none, fails too.
+func (n *BTNode) Fail() {
+	n.Complete = true
+	n.Status = BT_FAILURE
+	if n.WhenDone != nil {
+		n.WhenDone(n)
+	}
+	p := n.Parent
+	if p == nil {
+		return
+	}
+	p.FailedChildren++
+	if p.OnChildFinished != nil {
+		p.Finish(p.OnChildFinished(p, n))
+		return
+	}
+	p.Fail()
+}
+
+// Finish calls Done() or Fail() according to status (doing nothing for
+// BT_RUNNING)
+func (n *BTNode) Finish(status BTStatus) {
+	switch status {
+	case BT_SUCCESS:
+		n.Done()
+	case BT_FAILURE:
+		n.Fail()
+	}
+}
+
+// Reset makes the node and those below it as though they'd never run,
+// re-running their Init()
+func (n *BTNode) Reset() {
+	n.Complete = false
+	n.Status = BT_RUNNING
+	n.CompletedChildren = 0
+	n.FailedChildren = 0
+	if n.State == nil {
+		n.State = make(map[string]any)
+	}
+	if n.Init != nil {
+		n.Init(n)
+	}
+	for _, ch := range n.Children {
+		ch.Reset()
+	}
+}
+
 func (n *BTNode) SetFailed() {
 	n.Failed = true
 	n.Tree.FailedNodeSet[n] = true
 	parent := n.Parent
 	// percolate failure up
 	for parent != nil {
-		if parent.IsFailed(parent) {
+		if parent.IsFailed != nil && parent.IsFailed(parent) {
 			parent.Failed = true
 			n.Tree.FailedNodeSet[parent] = true
 			parent = parent.Parent
@@ -117,8 +209,19 @@ type BehaviourTree struct {
 	Name          string
 	Root          *BTNode
 	FailedNodeSet map[*BTNode]bool
+	// the entity and runner of the current (or last) execution, for
+	// decorators and composites to use
+	Entity *Entity
+	runner *BTRunner
+	// the time (ms) the tree has been ticked for by TickBT()
+	t float64
 	// current state is the path that's active down to its lowest node, an action
 	state *BTExecState
+	// if set, records each tick of the tree (see BTTrace)
+	Trace *BTTrace
+	// whether TickBT() is running the tree (which then records its trace
+	// frame, rather than ExecuteBT())
+	ticking bool
 }
 
 func NewBehaviourTree(name string, root *BTNode) *BehaviourTree {
@@ -149,6 +252,18 @@ func NewBehaviourTree(name string, root *BTNode) *BehaviourTree {
 	return bt
 }
 
+// Reset clears the completion (and failure) of every node, re-running their
+// Init(), so that a tree which has completed can run again
+func (bt *BehaviourTree) Reset() {
+	bt.ResetFailed()
+	bt.Root.Reset()
+}
+
+// Time is how long (ms) the tree has been ticked for by TickBT()
+func (bt *BehaviourTree) Time() float64 {
+	return bt.t
+}
+
 func (bt *BehaviourTree) ResetFailed() {
 	for node := range bt.FailedNodeSet {
 		node.Failed = false
@@ -156,6 +271,12 @@ func (bt *BehaviourTree) ResetFailed() {
 	}
 }
 
+// how many times ExecuteBT() will descend afresh when nodes finish during the
+// descent, and how many actions TickBT() will tick in one call (so that
+// actions which finish instantly under a repeater can't hang the game)
+const BT_MAX_RESTARTS = 64
+const BT_MAX_TICKS = 64
+
 // stores the database of named trees and decorators needed to run a tree
 type BTRunner struct {
 	// if we reach a string node with no children, it is potentially just
@@ -165,16 +286,34 @@ type BTRunner struct {
 	// we can get simple reusability of subtrees
 	trees map[string]*BehaviourTree
 
-	// the runner has a set of decorators that it can honour - a decorator is
-	// just a string for now, but really, it should be a parsed DSL
-	decorators map[string]func(*BTNode) bool
+	// the runner has a set of decorators that it can honour, by name; those
+	// called with an argument are built by the factories and then kept here
+	// by their full string
+	decorators         map[string]func(*BTNode) bool
+	decoratorFactories map[string]func(arg string) func(*BTNode) bool
 }
 
 func NewBTRunner() *BTRunner {
-	return &BTRunner{
-		trees:      make(map[string]*BehaviourTree),
-		decorators: make(map[string]func(self *BTNode) bool),
+	btr := &BTRunner{
+		trees:              make(map[string]*BehaviourTree),
+		decorators:         make(map[string]func(self *BTNode) bool),
+		decoratorFactories: make(map[string]func(arg string) func(*BTNode) bool),
 	}
+	btr.RegisterDecoratorFactories(BTDecoratorFactoriesBase())
+	return btr
+}
+
+// RegisterTrees makes the trees available to be referenced as subtrees by
+// name (a node with no Selector named for a tree descends into it)
+func (btr *BTRunner) RegisterTrees(trees ...*BehaviourTree) {
+	for _, bt := range trees {
+		btr.trees[bt.Name] = bt
+	}
+}
+
+// Tree gives the tree registered by name (nil if none)
+func (btr *BTRunner) Tree(name string) *BehaviourTree {
+	return btr.trees[name]
 }
 
 func (btr *BTRunner) RegisterDecorators(decorators []BTDecorator) {
@@ -183,9 +322,34 @@ func (btr *BTRunner) RegisterDecorators(decorators []BTDecorator) {
 	}
 }
 
+func (btr *BTRunner) RegisterDecoratorFactories(factories []BTDecoratorFactory) {
+	for _, f := range factories {
+		btr.decoratorFactories[f.Name] = f.Impl
+	}
+}
+
+// decorator gives the decorator for a decorator string, building it from
+// its factory if it's a call like If(State(hungry, 1)) not yet seen
+func (btr *BTRunner) decorator(dstr string) (func(*BTNode) bool, bool) {
+	if dec, ok := btr.decorators[dstr]; ok {
+		return dec, true
+	}
+	name, arg, ok := parseBTDecoratorCall(dstr)
+	if !ok {
+		return nil, false
+	}
+	factory, ok := btr.decoratorFactories[name]
+	if !ok {
+		return nil, false
+	}
+	dec := factory(arg)
+	btr.decorators[dstr] = dec
+	return dec, true
+}
+
 func (btr *BTRunner) RunDecorators(node *BTNode) bool {
 	for _, dstr := range node.Decorators {
-		if dec, ok := btr.decorators[dstr]; ok {
+		if dec, ok := btr.decorator(dstr); ok {
 			// run the decorator (it can transform the node in any way,
 			// add children etc., write to blackboards, etc.)
 			// and if it returns false, it failed. Mark this node as
@@ -203,8 +367,20 @@ func (btr *BTRunner) RunDecorators(node *BTNode) bool {
 }
 
 func (btr *BTRunner) ExecuteBT(e *Entity, bt *BehaviourTree) *BTExecState {
+	bt.Trace.begin(e, bt)
+	state := btr.executeBT(e, bt)
+	bt.Trace.descended(state)
+	if !bt.ticking {
+		bt.Trace.end(btr, bt, btTreeStatus(bt))
+	}
+	return state
+}
+
+func (btr *BTRunner) executeBT(e *Entity, bt *BehaviourTree) *BTExecState {
 	bt.run++
 	bt.ResetFailed()
+	bt.Entity = e
+	bt.runner = btr
 	state := &BTExecState{}
 	if bt.Root == nil {
 		return state
@@ -217,11 +393,28 @@ func (btr *BTRunner) ExecuteBT(e *Entity, bt *BehaviourTree) *BTExecState {
 			state.Path += "." + s
 		}
 	}
+	// when a node finishes during the descent (a subtree it references
+	// finished, or it finished itself in its Selector, eg. a timeout), we
+	// descend afresh now that its finishing has percolated up (but not
+	// forever, if something keeps finishing and being reset)
+	restarts := 0
+	restart := func() bool {
+		restarts++
+		state.Path = ""
+		node = bt.Root
+		return restarts <= BT_MAX_RESTARTS
+	}
 	// go til we reach the bottom
 	for node != nil {
 		// every node we visit, is on the path
 		// how beautiful
 		dotPath(node.Name)
+		bt.Trace.visit(node)
+
+		if node.Failed {
+			// we came back down to something that failed this run
+			return nil
+		}
 
 		if node.Complete {
 			// when we reach something that's done, our path ends in a dot.
@@ -250,6 +443,12 @@ func (btr *BTRunner) ExecuteBT(e *Entity, bt *BehaviourTree) *BTExecState {
 		}
 		if node.Selector != nil {
 			childIndex := node.Selector(node)
+			if node.Complete {
+				if !restart() {
+					return nil
+				}
+				continue
+			}
 			if childIndex >= 0 && childIndex < len(node.Children) {
 				child := node.Children[childIndex]
 				node = child
@@ -259,6 +458,37 @@ func (btr *BTRunner) ExecuteBT(e *Entity, bt *BehaviourTree) *BTExecState {
 			}
 		} else {
 			if tree, ok := btr.trees[node.Name]; ok {
+				tree.Entity = e
+				tree.runner = btr
+				tree.t = bt.t
+				if tree.run != bt.run {
+					// (the subtree runs as part of this run)
+					tree.run = bt.run
+					tree.ResetFailed()
+				}
+				if tree.Root.Complete {
+					// the subtree has done its job; this node is done (as
+					// the subtree was), and the subtree is free to be run
+					// again
+					status := tree.Root.Status
+					tree.Reset()
+					node.Finish(status)
+					if !restart() {
+						return nil
+					}
+					continue
+				}
+				if len(tree.Root.Decorators) > 0 &&
+					tree.Root.decoratorsSucceededInRun != bt.run &&
+					!btr.RunDecorators(tree.Root) {
+					// the subtree failed, so this node has. Descend afresh
+					// so that (eg.) a fallback can try something else
+					node.SetFailed()
+					if !restart() {
+						return nil
+					}
+					continue
+				}
 				node = tree.Root
 				continue
 			} else {
@@ -270,3 +500,60 @@ func (btr *BTRunner) ExecuteBT(e *Entity, bt *BehaviourTree) *BTExecState {
 	bt.state = state
 	return bt.state
 }
+
+// TickBT runs the tree as a tri-state behaviour tree: it descends to an
+// action and ticks it, and if that finishes it (in success or failure),
+// descends again, until an action is running or the tree has finished,
+// giving the tree's status. A finished tree is reset, to start over on the
+// next tick. An action without Tick is left running until something calls
+// Done() or Fail() on it.
+func (btr *BTRunner) TickBT(e *Entity, bt *BehaviourTree, dt_ms float64) BTStatus {
+	bt.t += dt_ms
+	bt.Trace.begin(e, bt)
+	bt.ticking = true
+	status := btr.tickBT(e, bt, dt_ms)
+	bt.ticking = false
+	// (if the tree finished, its frame was ended before it was reset)
+	bt.Trace.end(btr, bt, status)
+	return status
+}
+
+func (btr *BTRunner) tickBT(e *Entity, bt *BehaviourTree, dt_ms float64) BTStatus {
+	finished := func() BTStatus {
+		status := bt.Root.Status
+		bt.Trace.end(btr, bt, status)
+		bt.Reset()
+		return status
+	}
+	for i := 0; i < BT_MAX_TICKS; i++ {
+		if bt.Root.Complete {
+			return finished()
+		}
+		state := btr.ExecuteBT(e, bt)
+		if bt.Root.Complete {
+			return finished()
+		}
+		if state == nil {
+			if bt.Root.Failed {
+				// (failed this run, by decorators)
+				bt.Trace.end(btr, bt, BT_FAILURE)
+				bt.Reset()
+				return BT_FAILURE
+			}
+			return BT_RUNNING
+		}
+		leaf := state.Action
+		if leaf.Complete || leaf.Tick == nil {
+			return BT_RUNNING
+		}
+		status := leaf.Tick(leaf, dt_ms)
+		bt.Trace.ticked(state, status)
+		// (actions after the first this tick take no time)
+		dt_ms = 0
+		if status == BT_RUNNING {
+			return BT_RUNNING
+		}
+		leaf.Finish(status)
+	}
+	return BT_RUNNING
+}
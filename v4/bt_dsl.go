@@ -0,0 +1,382 @@
+package sameriver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+/*
+Behaviour trees can be written as JSON rather than Go structs, and loaded
+into a BTRunner with LoadTreesFile() / LoadTreesJSON(). A file is a list of
+named trees:
+
+	[
+		{
+			"name": "villagerRoot",
+			"root": {
+				"fallback": [
+					{"subtree": "flee", "decorators": ["If(State(afraid, 1))"]},
+					{"sequence": ["getFood", "eat"], "decorators": ["If(State(hungry, 1))"]},
+					"wander"
+				]
+			}
+		},
+		{
+			"name": "flee",
+			"root": {
+				"sequence": ["lookAround", "run"],
+				"decorators": ["Find(HasTag(bandit); Closest(self))"]
+			}
+		}
+	]
+
+Each node is either a string, naming an action (or, if there's a tree
+registered by that name, a reference to it), or an object with one of
+
+	"sequence": [...]  run the children in order, failing if any fails
+	"fallback": [...]  (or "selector") run the first child whose decorators
+	                   pass, failing if all fail
+	"parallel": [...]  interleave the children, descending to the next
+	                   unfinished one each execution
+	"inverter": {...}  decorator nodes wrapping one node (see bt_nodes.go),
+	"repeater": {...}  the repeater and retry taking "times" and the timeout
+	"retry":    {...}  and cooldown "ms"
+	"timeout":  {...}
+	"cooldown": {...}
+	"subtree":  "name" a reference to a tree registered by name, checked
+	                   once the file is loaded
+	"action":   "name" an action (same as the plain string)
+	"condition": "expr" succeeds if the entity running the tree matches the
+	                   EFDSL predicate expr, else fails
+
+and optionally a "name" (composites default to "Sequence", "Fallback",
+"Parallel", etc.) and a list of "decorators". A parallel node may give its
+"success" and "failure" policies as "one" or "all" (by default, it succeeds
+when all its children have, and fails when one has).
+
+Decorators are either plain names of decorators registered with
+RegisterDecorators(), or calls of a factory registered with
+RegisterDecoratorFactories() with an argument, which for the base factories
+(If, Unless, Find) is an EFDSL expression resolved relative to the entity
+running the tree (see efdsl_parser.go). Calls are built when the tree is
+loaded, so that a malformed expression is caught then rather than mid-game.
+*/
+
+// BTDecoratorFactory builds a decorator from the argument it's called with
+// in a decorator string, eg. for "If(State(hungry, 1))", Name is "If" and
+// Impl is given "State(hungry, 1)"
+type BTDecoratorFactory struct {
+	Name string
+	Impl func(arg string) func(self *BTNode) bool
+}
+
+// splits a decorator string like If(State(hungry, 1)) into its name and
+// argument; ok is false if it isn't a call
+func parseBTDecoratorCall(dstr string) (name, arg string, ok bool) {
+	open := strings.Index(dstr, "(")
+	if open < 1 || !strings.HasSuffix(dstr, ")") {
+		return "", "", false
+	}
+	return strings.TrimSpace(dstr[:open]), strings.TrimSpace(dstr[open+1 : len(dstr)-1]), true
+}
+
+// parses an EFDSL expression given to a decorator, checking that the
+// predicates and sorts it calls exist (panicking otherwise, since this is
+// done as trees are loaded)
+func btEFDSLExpr(decorator, expr string) *Node {
+	parser := &EFDSLParser{}
+	ast, err := parser.Parse(expr)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to parse EFDSL expression %q of decorator %s: %s", expr, decorator, err))
+	}
+	var check func(n *Node, sort bool)
+	check = func(n *Node, sort bool) {
+		if n.Type == NodeFunction {
+			_, isPredicate := EFDSL.predicates[n.Value]
+			_, isSort := EFDSL.sorts[n.Value]
+			if (!sort && !isPredicate) || (sort && !isSort) {
+				panic(fmt.Sprintf("Unknown EFDSL function %s in expression %q of decorator %s",
+					n.Value, expr, decorator))
+			}
+			return
+		}
+		for _, ch := range n.Children {
+			check(ch, sort || n.Type == NodeSortExpr)
+		}
+	}
+	check(ast, false)
+	return ast
+}
+
+// gives a func telling whether the entity running the tree matches the EFDSL
+// predicate expr (given to a decorator or condition node named name)
+func btEFDSLMatcher(name, expr string) func(self *BTNode) bool {
+	ast := btEFDSLExpr(name, expr)
+	return func(self *BTNode) bool {
+		e := self.Tree.Entity
+		filter, _ := EFDSL.Evaluate(ast, &EntityResolver{e: e})
+		return filter(e)
+	}
+}
+
+// BTDecoratorFactoriesBase are the decorator factories every BTRunner has:
+//
+//	If(expr)     passes if the entity running the tree matches the EFDSL
+//	             predicate expr, eg. If(State(hungry, 1))
+//	Unless(expr) passes if it doesn't
+//	Find(expr)   passes if any entity matches the EFDSL expr, keeping the
+//	             first (by its sort, if any) in the node's State["found"],
+//	             eg. Find(HasTag(deer) && WithinDistance(self, 100); Closest(self))
+func BTDecoratorFactoriesBase() []BTDecoratorFactory {
+	matches := btEFDSLMatcher
+	return []BTDecoratorFactory{
+		{
+			Name: "If",
+			Impl: func(expr string) func(self *BTNode) bool {
+				return matches("If", expr)
+			},
+		},
+		{
+			Name: "Unless",
+			Impl: func(expr string) func(self *BTNode) bool {
+				match := matches("Unless", expr)
+				return func(self *BTNode) bool {
+					return !match(self)
+				}
+			},
+		},
+		{
+			Name: "Find",
+			Impl: func(expr string) func(self *BTNode) bool {
+				ast := btEFDSLExpr("Find", expr)
+				return func(self *BTNode) bool {
+					e := self.Tree.Entity
+					filter, sortf := EFDSL.Evaluate(ast, &EntityResolver{e: e})
+					found := e.World.FilterAllEntities(filter)
+					if len(found) == 0 {
+						delete(self.State, "found")
+						return false
+					}
+					if sortf != nil {
+						sort.Slice(found, sortf(found))
+					}
+					self.State["found"] = found[0]
+					return true
+				}
+			},
+		},
+	}
+}
+
+func (btr *BTRunner) LoadTreesFile(filename string) []*BehaviourTree {
+	jsonFile, err := os.Open(filename)
+	if err != nil {
+		panic(fmt.Sprintf("Trying to open %s - doesn't exist", filename))
+	}
+	defer jsonFile.Close()
+	contents, err := io.ReadAll(jsonFile)
+	if err != nil {
+		panic(err)
+	}
+	return btr.LoadTreesJSON(contents)
+}
+
+// LoadTreesJSON parses and registers the trees (see the format above),
+// panicking if any is malformed or references a subtree that isn't
+// registered once they're all loaded
+func (btr *BTRunner) LoadTreesJSON(jsonStr []byte) []*BehaviourTree {
+	var specs []map[string]any
+	err := json.Unmarshal(jsonStr, &specs)
+	if err != nil {
+		panic(err)
+	}
+	trees := make([]*BehaviourTree, 0, len(specs))
+	refs := make(map[string]string)
+	for ix, spec := range specs {
+		name, ok := spec["name"].(string)
+		if !ok {
+			panic(fmt.Sprintf("tree at index %d was missing \"name\" property", ix))
+		}
+		root, ok := spec["root"]
+		if !ok {
+			panic(fmt.Sprintf("tree %s was missing \"root\" property", name))
+		}
+		bt := NewBehaviourTree(name, btr.nodeFromSpec(name, root, refs))
+		btr.RegisterTrees(bt)
+		trees = append(trees, bt)
+	}
+	for ref, from := range refs {
+		if _, ok := btr.trees[ref]; !ok {
+			panic(fmt.Sprintf("tree %s references subtree %s, which isn't registered", from, ref))
+		}
+	}
+	return trees
+}
+
+// NewTreeFromSpec builds and registers a tree from a spec (as would be
+// parsed from JSON), eg.
+//
+//	btr.NewTreeFromSpec("eat", map[string]any{
+//		"sequence": []any{"getFood", "eat"},
+//	})
+func (btr *BTRunner) NewTreeFromSpec(name string, root any) *BehaviourTree {
+	refs := make(map[string]string)
+	bt := NewBehaviourTree(name, btr.nodeFromSpec(name, root, refs))
+	btr.RegisterTrees(bt)
+	for ref := range refs {
+		if _, ok := btr.trees[ref]; !ok {
+			panic(fmt.Sprintf("tree %s references subtree %s, which isn't registered", name, ref))
+		}
+	}
+	return bt
+}
+
+var btCompositeSpecs = map[string]struct {
+	name string
+	f    func(name string, children ...*BTNode) *BTNode
+}{
+	"sequence": {"Sequence", BTSequence},
+	"fallback": {"Fallback", BTFallback},
+	"selector": {"Fallback", BTFallback},
+	"parallel": {"Parallel", BTParallel},
+}
+
+var btDecoratorNodeNames = map[string]string{
+	"inverter": "Inverter",
+	"repeater": "Repeater",
+	"retry":    "Retry",
+	"timeout":  "Timeout",
+	"cooldown": "Cooldown",
+}
+
+var btParallelPolicies = map[string]BTParallelPolicy{
+	"one": BT_REQUIRE_ONE,
+	"all": BT_REQUIRE_ALL,
+}
+
+// builds a node from its spec, noting subtree references (by the tree
+// they're in) in refs so they can be checked once all trees are loaded
+func (btr *BTRunner) nodeFromSpec(treeName string, spec any, refs map[string]string) *BTNode {
+	switch s := spec.(type) {
+	case string:
+		return &BTNode{Name: s}
+	case map[string]any:
+		number := func(key string) float64 {
+			v, ok := s[key]
+			if !ok {
+				return 0
+			}
+			x, ok := v.(float64)
+			if !ok {
+				panic(fmt.Sprintf("\"%s\" in tree %s must be a number, got %v", key, treeName, v))
+			}
+			return x
+		}
+		policy := func(key string, def BTParallelPolicy) BTParallelPolicy {
+			v, ok := s[key]
+			if !ok {
+				return def
+			}
+			str, _ := v.(string)
+			p, ok := btParallelPolicies[str]
+			if !ok {
+				panic(fmt.Sprintf("\"%s\" in tree %s must be \"one\" or \"all\", got %v", key, treeName, v))
+			}
+			return p
+		}
+		var node *BTNode
+		for key, v := range s {
+			var child *BTNode
+			switch key {
+			case "name", "decorators", "times", "ms", "success", "failure":
+				continue
+			case "subtree", "action", "condition":
+				name, ok := v.(string)
+				if !ok {
+					panic(fmt.Sprintf("\"%s\" in tree %s must be a string, got %v", key, treeName, v))
+				}
+				switch key {
+				case "subtree":
+					refs[name] = treeName
+					child = &BTNode{Name: name}
+				case "action":
+					child = &BTNode{Name: name}
+				case "condition":
+					child = BTCondition(name, btEFDSLMatcher("condition", name))
+				}
+			case "inverter", "repeater", "retry", "timeout", "cooldown":
+				name := btDecoratorNodeNames[key]
+				decorated := btr.nodeFromSpec(treeName, v, refs)
+				switch key {
+				case "inverter":
+					child = BTInverter(name, decorated)
+				case "repeater":
+					child = BTRepeater(name, int(number("times")), decorated)
+				case "retry":
+					child = BTRetry(name, int(number("times")), decorated)
+				case "timeout":
+					child = BTTimeout(name, number("ms"), decorated)
+				case "cooldown":
+					child = BTCooldown(name, number("ms"), decorated)
+				}
+			default:
+				composite, ok := btCompositeSpecs[key]
+				if !ok {
+					panic(fmt.Sprintf("unknown node property \"%s\" in tree %s", key, treeName))
+				}
+				specs, ok := v.([]any)
+				if !ok {
+					panic(fmt.Sprintf("\"%s\" in tree %s must be a list of nodes, got %v", key, treeName, v))
+				}
+				children := make([]*BTNode, 0, len(specs))
+				for _, childSpec := range specs {
+					children = append(children, btr.nodeFromSpec(treeName, childSpec, refs))
+				}
+				if key == "parallel" {
+					child = BTParallelWithPolicy(composite.name,
+						policy("success", BT_REQUIRE_ALL), policy("failure", BT_REQUIRE_ONE),
+						children...)
+				} else {
+					child = composite.f(composite.name, children...)
+				}
+			}
+			if node != nil {
+				panic(fmt.Sprintf("node in tree %s has more than one of %s and %s", treeName, node.Name, child.Name))
+			}
+			node = child
+		}
+		if node == nil {
+			panic(fmt.Sprintf("node in tree %s has no kind (sequence, fallback, parallel, "+
+				"inverter, repeater, retry, timeout, cooldown, subtree, action, condition): %v",
+				treeName, s))
+		}
+		if name, ok := s["name"].(string); ok {
+			if _, isRef := s["subtree"]; isRef {
+				panic(fmt.Sprintf("subtree reference %s in tree %s can't be renamed %s", node.Name, treeName, name))
+			}
+			node.Name = name
+		}
+		if decorators, ok := s["decorators"].([]any); ok {
+			for _, d := range decorators {
+				dstr, ok := d.(string)
+				if !ok {
+					panic(fmt.Sprintf("decorator of %s in tree %s must be a string, got %v", node.Name, treeName, d))
+				}
+				// build calls now so that bad arguments are caught at load
+				if _, _, isCall := parseBTDecoratorCall(dstr); isCall {
+					if _, ok := btr.decorator(dstr); !ok {
+						panic(fmt.Sprintf("Unknown decorator %s of %s in tree %s", dstr, node.Name, treeName))
+					}
+				}
+				node.Decorators = append(node.Decorators, dstr)
+			}
+		}
+		return node
+	default:
+		panic(fmt.Sprintf("node in tree %s must be a string or an object, got %v", treeName, spec))
+	}
+}
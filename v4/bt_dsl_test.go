@@ -0,0 +1,146 @@
+package sameriver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testingVillagerTreesJSON = []byte(`[
+	{
+		"name": "villagerRoot",
+		"root": {
+			"fallback": [
+				{"subtree": "flee", "decorators": ["If(State(afraid, 1))"]},
+				{"sequence": ["getFood", "eat"], "decorators": ["If(State(hungry, 1))"]},
+				"wander"
+			]
+		}
+	},
+	{
+		"name": "flee",
+		"root": {
+			"sequence": ["lookAround", "run"],
+			"decorators": ["Find(HasTag(bandit); Closest(self))"]
+		}
+	}
+]`)
+
+func TestBTLoadTreesJSON(t *testing.T) {
+	w := testingWorld()
+	btr := NewBTRunner()
+	trees := btr.LoadTreesJSON(testingVillagerTreesJSON)
+	if len(trees) != 2 || btr.Tree("flee") != trees[1] {
+		t.Fatal("should have registered both trees")
+	}
+	root := btr.Tree("villagerRoot")
+	e := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION: Vec2D{0, 0},
+			BOX:      Vec2D{1, 1},
+			STATE: map[string]int{
+				"hungry": 1,
+				"afraid": 0,
+			},
+		},
+	})
+
+	expected := []string{
+		"Fallback.Sequence.getFood",
+		"Fallback.Sequence.eat",
+		"Fallback.",
+	}
+	for _, path := range expected {
+		result := btr.ExecuteBT(e, root)
+		if result == nil || result.Path != path {
+			t.Fatalf("expected path %s, got %v", path, result)
+		}
+		result.Action.Done()
+	}
+
+	// afraid, with bandits about, we flee through the subtree, which
+	// completes the referencing node when it's done
+	root.Reset()
+	e.GetIntMap(STATE).Set("afraid", 1)
+	far := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION: Vec2D{50, 0},
+			BOX:      Vec2D{1, 1},
+		},
+		"tags": []string{"bandit"},
+	})
+	near := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION: Vec2D{10, 0},
+			BOX:      Vec2D{1, 1},
+		},
+		"tags": []string{"bandit"},
+	})
+	expected = []string{
+		"Fallback.flee.Sequence.lookAround",
+		"Fallback.flee.Sequence.run",
+		"Fallback.",
+	}
+	for _, path := range expected {
+		result := btr.ExecuteBT(e, root)
+		if result == nil || result.Path != path {
+			t.Fatalf("expected path %s, got %v", path, result)
+		}
+		result.Action.Done()
+	}
+	if btr.Tree("flee").Root.State["found"] != near {
+		t.Fatal("Find() should have kept the closest bandit")
+	}
+	if btr.Tree("flee").Root.Complete {
+		t.Fatal("flee subtree should have been reset once done")
+	}
+
+	// afraid with no bandits, the flee subtree fails on its Find(), and we
+	// fall back to eating
+	root.Reset()
+	w.Despawn(far)
+	w.Despawn(near)
+	w.Update(FRAME_MS / 2)
+	result := btr.ExecuteBT(e, root)
+	if result == nil || result.Path != "Fallback.Sequence.getFood" {
+		t.Fatalf("should have fallen back to eating, got %v", result)
+	}
+}
+
+func TestBTParallel(t *testing.T) {
+	w := testingWorld()
+	btr := NewBTRunner()
+	bt := btr.NewTreeFromSpec("chores", map[string]any{
+		"name":     "chores",
+		"parallel": []any{"sweep", map[string]any{"action": "cook"}},
+	})
+	e := w.Spawn(nil)
+	paths := make([]string, 0)
+	for i := 0; i < 4; i++ {
+		result := btr.ExecuteBT(e, bt)
+		paths = append(paths, result.Path)
+		// cooking finishes the first time it's worked on, sweeping takes
+		// two goes
+		if result.Action.Name == "cook" || i > 0 {
+			result.Action.Done()
+		}
+	}
+	assert.Equal(t, []string{"chores.sweep", "chores.cook", "chores.sweep", "chores."}, paths)
+}
+
+func TestBTLoadTreesJSONInvalid(t *testing.T) {
+	invalid := map[string]string{
+		"missing subtree": `[{"name": "a", "root": {"subtree": "b"}}]`,
+		"unknown efdsl":   `[{"name": "a", "root": {"action": "x", "decorators": ["If(Fnord(1))"]}}]`,
+		"bad efdsl":       `[{"name": "a", "root": {"action": "x", "decorators": ["If(State(hungry, 1) &&)"]}}]`,
+		"unknown factory": `[{"name": "a", "root": {"action": "x", "decorators": ["Fnord(State(hungry, 1))"]}}]`,
+		"two kinds":       `[{"name": "a", "root": {"action": "x", "sequence": ["y"]}}]`,
+		"no kind":         `[{"name": "a", "root": {"decorators": []}}]`,
+		"no root":         `[{"name": "a"}]`,
+	}
+	for name, jsonStr := range invalid {
+		assert.Panics(t, func() {
+			NewBTRunner().LoadTreesJSON([]byte(jsonStr))
+		}, name)
+	}
+}
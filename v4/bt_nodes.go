@@ -0,0 +1,362 @@
+package sameriver
+
+import (
+	"math"
+)
+
+/*
+The standard behaviour tree nodes, with running/success/failure semantics:
+each finishes by Done() (success) or Fail() (failure), and decides what its
+children finishing means for itself through OnChildFinished. Run them with
+BTRunner.TickBT(), which ticks the leaves (see BTAction, BTCondition), or
+with ExecuteBT(), calling Done() / Fail() on the actions yourself.
+
+Composites:
+
+	BTSequence      runs its children in order; fails if any fails
+	BTFallback      (a "selector") runs its children in order until one
+	                succeeds; fails if they all fail
+	BTParallel      works on all its children at once, finishing by its
+	                success and failure policies
+
+Decorator nodes (with one child):
+
+	BTInverter      succeeds if its child fails and vice versa
+	BTRepeater      runs its child n times (forever, if n <= 0), failing
+	                if it does
+	BTRetry         runs its child until it succeeds, up to n times
+	                (forever, if n <= 0)
+	BTTimeout       fails if its child takes longer than ms
+	BTCooldown      fails if its child finished less than ms ago
+
+Leaves:
+
+	BTAction        ticks a func
+	BTCondition     succeeds or fails on a predicate, instantly
+
+Nodes can also still fail by their decorators (see BTRunner.RunDecorators()),
+which only fails them for the current run (SetFailed()): a fallback will try
+its next child, but the node may be tried again next run.
+*/
+
+// transiently failed if any child is (the child is the one to run next)
+func btAnyChildFailed(self *BTNode) bool {
+	for _, ch := range self.Children {
+		if ch.Failed {
+			return true
+		}
+	}
+	return false
+}
+
+// transiently failed if no child can run
+func btNoChildRunnable(self *BTNode) bool {
+	for _, ch := range self.Children {
+		if !ch.Failed && !ch.Complete {
+			return false
+		}
+	}
+	return true
+}
+
+// BTSequence runs its children in order, succeeding when they all have, and
+// failing if any fails
+func BTSequence(name string, children ...*BTNode) *BTNode {
+	return &BTNode{
+		Name:     name,
+		Children: children,
+		Selector: func(self *BTNode) int {
+			return self.CompletedChildren
+		},
+		IsFailed: btAnyChildFailed,
+		OnChildFinished: func(self *BTNode, child *BTNode) BTStatus {
+			if child.Status == BT_FAILURE {
+				return BT_FAILURE
+			}
+			if self.CompletedChildren == len(self.Children) {
+				return BT_SUCCESS
+			}
+			return BT_RUNNING
+		},
+	}
+}
+
+// BTFallback (a "selector", in the usual BT terms) runs the first of its
+// children whose decorators pass, succeeding when one does, and failing if
+// they all fail
+func BTFallback(name string, children ...*BTNode) *BTNode {
+	return &BTNode{
+		Name:     name,
+		Children: children,
+		Selector: func(self *BTNode) int {
+			for i, ch := range self.Children {
+				if ch.Failed || ch.Complete {
+					continue
+				}
+				if self.Tree.runner.RunDecorators(ch) {
+					return i
+				}
+			}
+			return -1
+		},
+		IsFailed: btNoChildRunnable,
+		OnChildFinished: func(self *BTNode, child *BTNode) BTStatus {
+			if child.Status == BT_SUCCESS {
+				return BT_SUCCESS
+			}
+			if self.FailedChildren == len(self.Children) {
+				return BT_FAILURE
+			}
+			return BT_RUNNING
+		},
+	}
+}
+
+// BTParallelPolicy is how many children of a parallel node must succeed (or
+// fail) for it to succeed (or fail)
+type BTParallelPolicy int
+
+const (
+	BT_REQUIRE_ONE BTParallelPolicy = iota
+	BT_REQUIRE_ALL
+)
+
+// BTParallel works on all of its children at once, succeeding when they all
+// have, and failing if any fails
+func BTParallel(name string, children ...*BTNode) *BTNode {
+	return BTParallelWithPolicy(name, BT_REQUIRE_ALL, BT_REQUIRE_ONE, children...)
+}
+
+// BTParallelWithPolicy works on all of its children at once: each execution
+// descends to the next of them (round-robin) not yet finished, so that their
+// actions are interleaved. It succeeds when one or all of its children have
+// (by success), or fails when one or all have failed (by failure), or if
+// they've all finished without either.
+func BTParallelWithPolicy(
+	name string,
+	success, failure BTParallelPolicy,
+	children ...*BTNode) *BTNode {
+
+	required := func(policy BTParallelPolicy, n int) int {
+		if policy == BT_REQUIRE_ONE {
+			return 1
+		}
+		return n
+	}
+	return &BTNode{
+		Name:     name,
+		Children: children,
+		Init: func(self *BTNode) {
+			self.State["next"] = 0
+		},
+		Selector: func(self *BTNode) int {
+			next := self.State["next"].(int)
+			for k := 0; k < len(self.Children); k++ {
+				i := (next + k) % len(self.Children)
+				ch := self.Children[i]
+				if !ch.Complete && !ch.Failed {
+					self.State["next"] = i + 1
+					return i
+				}
+			}
+			return -1
+		},
+		IsFailed: btNoChildRunnable,
+		OnChildFinished: func(self *BTNode, child *BTNode) BTStatus {
+			n := len(self.Children)
+			if self.CompletedChildren >= required(success, n) {
+				return BT_SUCCESS
+			}
+			if self.FailedChildren >= required(failure, n) {
+				return BT_FAILURE
+			}
+			if self.CompletedChildren+self.FailedChildren == n {
+				return BT_FAILURE
+			}
+			return BT_RUNNING
+		},
+	}
+}
+
+// a node with a single child, which it always descends to
+func btDecoratorNode(name string, child *BTNode) *BTNode {
+	return &BTNode{
+		Name:     name,
+		Children: []*BTNode{child},
+		Selector: func(self *BTNode) int {
+			return 0
+		},
+		IsFailed: btAnyChildFailed,
+	}
+}
+
+// BTInverter succeeds if its child fails, and fails if it succeeds
+func BTInverter(name string, child *BTNode) *BTNode {
+	n := btDecoratorNode(name, child)
+	n.OnChildFinished = func(self *BTNode, child *BTNode) BTStatus {
+		if child.Status == BT_SUCCESS {
+			return BT_FAILURE
+		}
+		return BT_SUCCESS
+	}
+	return n
+}
+
+// BTRepeater runs its child times times (forever, if times <= 0), succeeding
+// once it has, and failing if it fails
+func BTRepeater(name string, times int, child *BTNode) *BTNode {
+	n := btDecoratorNode(name, child)
+	n.Init = func(self *BTNode) {
+		self.State["count"] = 0
+	}
+	n.OnChildFinished = func(self *BTNode, child *BTNode) BTStatus {
+		if child.Status == BT_FAILURE {
+			return BT_FAILURE
+		}
+		count := self.State["count"].(int) + 1
+		self.State["count"] = count
+		if times > 0 && count >= times {
+			return BT_SUCCESS
+		}
+		child.Reset()
+		self.CompletedChildren = 0
+		return BT_RUNNING
+	}
+	return n
+}
+
+// BTRetry runs its child until it succeeds, up to times times (forever, if
+// times <= 0), failing if it never does
+func BTRetry(name string, times int, child *BTNode) *BTNode {
+	n := btDecoratorNode(name, child)
+	n.OnChildFinished = func(self *BTNode, child *BTNode) BTStatus {
+		if child.Status == BT_SUCCESS {
+			return BT_SUCCESS
+		}
+		if times > 0 && self.FailedChildren >= times {
+			return BT_FAILURE
+		}
+		// (FailedChildren counts the tries, since only the child is reset)
+		child.Reset()
+		return BT_RUNNING
+	}
+	return n
+}
+
+// BTTimeout fails if its child hasn't finished within ms of it first being
+// run (by the time of the tree, as ticked by TickBT()), otherwise finishing
+// as its child does
+func BTTimeout(name string, ms float64, child *BTNode) *BTNode {
+	n := btDecoratorNode(name, child)
+	n.Init = func(self *BTNode) {
+		self.State["start"] = -1.0
+	}
+	n.Selector = func(self *BTNode) int {
+		t := self.Tree.t
+		start := self.State["start"].(float64)
+		if start < 0 {
+			start = t
+			self.State["start"] = t
+		}
+		if t-start >= ms {
+			self.Fail()
+			return -1
+		}
+		return 0
+	}
+	n.OnChildFinished = func(self *BTNode, child *BTNode) BTStatus {
+		return child.Status
+	}
+	return n
+}
+
+// BTCooldown finishes as its child does, but then fails without running it
+// until ms have passed (by the time of the tree, as ticked by TickBT())
+func BTCooldown(name string, ms float64, child *BTNode) *BTNode {
+	n := btDecoratorNode(name, child)
+	// (kept outside State, since it must outlast the node being reset)
+	until := math.Inf(-1)
+	n.Selector = func(self *BTNode) int {
+		if self.Tree.t < until {
+			self.Fail()
+			return -1
+		}
+		return 0
+	}
+	n.OnChildFinished = func(self *BTNode, child *BTNode) BTStatus {
+		until = self.Tree.t + ms
+		return child.Status
+	}
+	return n
+}
+
+// BTAbortOnChange runs its child, failing (aborting the child) if any of
+// keys changes in bb while it runs (any key, if none are given); eg. to drop
+// what we're doing when a threat is spotted
+func BTAbortOnChange(name string, bb *Blackboard, keys []string, child *BTNode) *BTNode {
+	n := btDecoratorNode(name, child)
+	n.Init = func(self *BTNode) {
+		self.State["started"] = false
+	}
+	n.Selector = func(self *BTNode) int {
+		// (changes before we started running don't count)
+		if !self.State["started"].(bool) {
+			self.State["version"] = bb.Version(keys...)
+			self.State["started"] = true
+			return 0
+		}
+		if bb.Version(keys...) != self.State["version"].(uint64) {
+			self.Fail()
+			return -1
+		}
+		return 0
+	}
+	n.OnChildFinished = func(self *BTNode, child *BTNode) BTStatus {
+		return child.Status
+	}
+	return n
+}
+
+// BTAction is a leaf which runs tick each time it's ticked by TickBT() until
+// it finishes
+func BTAction(name string, tick func(self *BTNode, dt_ms float64) BTStatus) *BTNode {
+	return &BTNode{
+		Name: name,
+		Tick: tick,
+	}
+}
+
+// BTCondition is a leaf which succeeds if predicate holds when it's ticked,
+// and fails otherwise
+func BTCondition(name string, predicate func(self *BTNode) bool) *BTNode {
+	return &BTNode{
+		Name: name,
+		Tick: func(self *BTNode, dt_ms float64) BTStatus {
+			if predicate(self) {
+				return BT_SUCCESS
+			}
+			return BT_FAILURE
+		},
+	}
+}
+
+// BTFSM is a leaf which runs m for the tree's entity: starting it when the
+// leaf begins running, updating it each tick, and finishing as the machine
+// does on reaching a final state (see FSMState.Result)
+func BTFSM(name string, m *FSM) *BTNode {
+	return &BTNode{
+		Name: name,
+		Init: func(self *BTNode) {
+			self.State["started"] = false
+		},
+		Tick: func(self *BTNode, dt_ms float64) BTStatus {
+			if !self.State["started"].(bool) {
+				self.State["started"] = true
+				m.Start(self.Tree.Entity)
+				return m.Status
+			}
+			m.Update(dt_ms)
+			return m.Status
+		},
+	}
+}
@@ -0,0 +1,219 @@
+package sameriver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// a leaf which records its name in log when ticked and finishes with the
+// statuses given in turn (the last repeating), after running for ticks ticks
+func testingBTLeaf(log *[]string, name string, ticks int, statuses ...BTStatus) *BTNode {
+	return BTAction(name, func(self *BTNode, dt_ms float64) BTStatus {
+		*log = append(*log, name)
+		ran, _ := self.State["ran"].(int)
+		self.State["ran"] = ran + 1
+		if ran+1 < ticks {
+			return BT_RUNNING
+		}
+		self.State["ran"] = 0
+		finishes, _ := self.State["finishes"].(int)
+		self.State["finishes"] = finishes + 1
+		if finishes >= len(statuses) {
+			return statuses[len(statuses)-1]
+		}
+		return statuses[finishes]
+	})
+}
+
+func testingTickBT(btr *BTRunner, e *Entity, bt *BehaviourTree, n int) []BTStatus {
+	statuses := make([]BTStatus, 0, n)
+	for i := 0; i < n; i++ {
+		statuses = append(statuses, btr.TickBT(e, bt, FRAME_MS))
+	}
+	return statuses
+}
+
+func TestBTSequenceFallbackTick(t *testing.T) {
+	w := testingWorld()
+	e := w.Spawn(nil)
+	btr := NewBTRunner()
+	log := make([]string, 0)
+	bt := NewBehaviourTree("root", BTFallback("Fallback",
+		BTSequence("Sequence",
+			testingBTLeaf(&log, "walk", 2, BT_SUCCESS),
+			testingBTLeaf(&log, "open", 1, BT_FAILURE),
+		),
+		testingBTLeaf(&log, "climb", 1, BT_SUCCESS),
+	))
+	statuses := testingTickBT(btr, e, bt, 3)
+	// walk takes two ticks; the door won't open, so within the same tick
+	// we fall back to climbing in
+	assert.Equal(t, []BTStatus{BT_RUNNING, BT_SUCCESS, BT_RUNNING}, statuses)
+	assert.Equal(t, []string{"walk", "walk", "open", "climb", "walk"}, log)
+	if bt.Root.Complete {
+		t.Fatal("tree should have been reset once finished")
+	}
+}
+
+func TestBTParallelPolicy(t *testing.T) {
+	w := testingWorld()
+	e := w.Spawn(nil)
+	btr := NewBTRunner()
+	log := make([]string, 0)
+	all := NewBehaviourTree("all", BTParallel("Parallel",
+		testingBTLeaf(&log, "a", 2, BT_SUCCESS),
+		testingBTLeaf(&log, "b", 3, BT_SUCCESS),
+	))
+	statuses := testingTickBT(btr, e, all, 4)
+	// (a finishing moves on to b within the same tick)
+	assert.Equal(t, []string{"a", "b", "a", "b", "b"}, log)
+	assert.Equal(t, []BTStatus{BT_RUNNING, BT_RUNNING, BT_RUNNING, BT_SUCCESS}, statuses)
+
+	log = log[:0]
+	one := NewBehaviourTree("one", BTParallelWithPolicy("Parallel", BT_REQUIRE_ONE, BT_REQUIRE_ALL,
+		testingBTLeaf(&log, "a", 1, BT_FAILURE),
+		testingBTLeaf(&log, "b", 3, BT_SUCCESS),
+	))
+	statuses = testingTickBT(btr, e, one, 3)
+	assert.Equal(t, []BTStatus{BT_RUNNING, BT_RUNNING, BT_SUCCESS}, statuses)
+
+	log = log[:0]
+	failOne := NewBehaviourTree("failOne", BTParallel("Parallel",
+		testingBTLeaf(&log, "a", 2, BT_FAILURE),
+		testingBTLeaf(&log, "b", 3, BT_SUCCESS),
+	))
+	statuses = testingTickBT(btr, e, failOne, 3)
+	assert.Equal(t, []BTStatus{BT_RUNNING, BT_RUNNING, BT_FAILURE}, statuses)
+}
+
+func TestBTDecoratorNodes(t *testing.T) {
+	w := testingWorld()
+	e := w.Spawn(nil)
+	btr := NewBTRunner()
+	log := make([]string, 0)
+
+	inverter := NewBehaviourTree("inverter", BTInverter("Inverter",
+		testingBTLeaf(&log, "a", 1, BT_FAILURE)))
+	assert.Equal(t, BT_SUCCESS, btr.TickBT(e, inverter, FRAME_MS))
+
+	log = log[:0]
+	repeater := NewBehaviourTree("repeater", BTRepeater("Repeater", 3,
+		testingBTLeaf(&log, "a", 1, BT_SUCCESS)))
+	assert.Equal(t, BT_SUCCESS, btr.TickBT(e, repeater, FRAME_MS))
+	assert.Equal(t, []string{"a", "a", "a"}, log)
+
+	// an instant action repeated forever can't hang the tick
+	forever := NewBehaviourTree("forever", BTRepeater("Repeater", 0,
+		testingBTLeaf(&log, "a", 1, BT_SUCCESS)))
+	assert.Equal(t, BT_RUNNING, btr.TickBT(e, forever, FRAME_MS))
+
+	log = log[:0]
+	retry := NewBehaviourTree("retry", BTRetry("Retry", 3,
+		testingBTLeaf(&log, "a", 1, BT_FAILURE, BT_FAILURE, BT_SUCCESS)))
+	assert.Equal(t, BT_SUCCESS, btr.TickBT(e, retry, FRAME_MS))
+	assert.Equal(t, 3, len(log))
+	giveUp := NewBehaviourTree("giveUp", BTRetry("Retry", 2,
+		testingBTLeaf(&log, "a", 1, BT_FAILURE)))
+	assert.Equal(t, BT_FAILURE, btr.TickBT(e, giveUp, FRAME_MS))
+
+	timeout := NewBehaviourTree("timeout", BTTimeout("Timeout", 3*FRAME_MS,
+		testingBTLeaf(&log, "a", 10, BT_SUCCESS)))
+	statuses := testingTickBT(btr, e, timeout, 4)
+	assert.Equal(t, []BTStatus{BT_RUNNING, BT_RUNNING, BT_RUNNING, BT_FAILURE}, statuses)
+
+	log = log[:0]
+	cooldown := NewBehaviourTree("cooldown", BTFallback("Fallback",
+		BTCooldown("Cooldown", 3*FRAME_MS, testingBTLeaf(&log, "special", 1, BT_SUCCESS)),
+		testingBTLeaf(&log, "basic", 1, BT_SUCCESS),
+	))
+	testingTickBT(btr, e, cooldown, 5)
+	assert.Equal(t, []string{"special", "basic", "basic", "special", "basic"}, log)
+}
+
+func TestBTConditionJSON(t *testing.T) {
+	w := testingWorld()
+	btr := NewBTRunner()
+	log := make([]string, 0)
+	btr.LoadTreesJSON([]byte(`[
+		{
+			"name": "guard",
+			"root": {
+				"fallback": [
+					{"sequence": [
+						{"condition": "State(alarmed, 1)"},
+						{"action": "shout"}
+					]},
+					{"inverter": {"condition": "HasTag(asleep)"}, "name": "awake"}
+				]
+			}
+		}
+	]`))
+	bt := btr.Tree("guard")
+	bt.Root.Children[0].Children[1].Tick = func(self *BTNode, dt_ms float64) BTStatus {
+		log = append(log, "shout")
+		return BT_SUCCESS
+	}
+	e := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			STATE: map[string]int{"alarmed": 0},
+		},
+		"tags": []string{"asleep"},
+	})
+	assert.Equal(t, BT_FAILURE, btr.TickBT(e, bt, FRAME_MS))
+	e.GetIntMap(STATE).Set("alarmed", 1)
+	assert.Equal(t, BT_SUCCESS, btr.TickBT(e, bt, FRAME_MS))
+	assert.Equal(t, []string{"shout"}, log)
+	assert.Equal(t, "awake", bt.Root.Children[1].Name)
+}
+
+func TestBTAbortOnChange(t *testing.T) {
+	w := testingWorld()
+	e := w.Spawn(nil)
+	btr := NewBTRunner()
+	bb := e.Blackboard()
+	log := make([]string, 0)
+	bt := NewBehaviourTree("root", BTFallback("Fallback",
+		BTAbortOnChange("Watch", bb, []string{"threat"},
+			testingBTLeaf(&log, "forage", 5, BT_SUCCESS),
+		),
+		testingBTLeaf(&log, "flee", 1, BT_SUCCESS),
+	))
+	// (a change before the node runs doesn't count)
+	bb.Set("threat", 0)
+	statuses := testingTickBT(btr, e, bt, 2)
+	assert.Equal(t, []BTStatus{BT_RUNNING, BT_RUNNING}, statuses)
+	// nor does a change to another key
+	bb.Set("weather", "rain")
+	testingTickBT(btr, e, bt, 1)
+	bb.Set("threat", 1)
+	statuses = testingTickBT(btr, e, bt, 1)
+	assert.Equal(t, []BTStatus{BT_SUCCESS}, statuses)
+	assert.Equal(t, []string{"forage", "forage", "forage", "flee"}, log)
+}
+
+func TestBTAbortOnChangeIdle(t *testing.T) {
+	w := testingWorld()
+	e := w.Spawn(nil)
+	btr := NewBTRunner()
+	bb := e.Blackboard()
+	log := make([]string, 0)
+	bt := NewBehaviourTree("root", BTAbortOnChange("Watch", bb, []string{"perceived"},
+		testingBTLeaf(&log, "forage", 2, BT_SUCCESS),
+	))
+	// the idle node holds nothing for the changes to pile up in (the key
+	// set more times than a subscriber channel holds)
+	for i := 0; i <= EVENT_SUBSCRIBER_CHANNEL_CAPACITY; i++ {
+		bb.Set("perceived", i)
+	}
+	assert.Equal(t, 0, len(bb.Events.channels["blackboard-changed"]))
+	assert.Equal(t, int32(0), bb.Events.nHanging.Load())
+	statuses := testingTickBT(btr, e, bt, 2)
+	assert.Equal(t, []BTStatus{BT_RUNNING, BT_SUCCESS}, statuses)
+	// (and it still aborts on a change while it runs)
+	testingTickBT(btr, e, bt, 1)
+	bb.Set("perceived", -1)
+	statuses = testingTickBT(btr, e, bt, 1)
+	assert.Equal(t, []BTStatus{BT_FAILURE}, statuses)
+	assert.Equal(t, []string{"forage", "forage", "forage"}, log)
+}
@@ -0,0 +1,245 @@
+package sameriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BTTrace records the executions of a behaviour tree whose Trace it's set
+// as, one frame per TickBT() (or ExecuteBT(), called directly): the paths
+// descended, the actions ticked and what they gave, and a snapshot of every
+// node's status afterward, so that you can see why an agent is doing what
+// it's doing (or standing still). Export it with JSON(), or draw a frame
+// with its DOT() (graphviz).
+type BTTrace struct {
+	// how many frames are kept (the oldest being dropped); 0 keeps all
+	MaxFrames int
+	Frames    []*BTTraceFrame
+
+	// the frame being recorded, and the nodes visited in it
+	frame   *BTTraceFrame
+	visited map[*BTNode]bool
+	ticks   int
+}
+
+func NewBTTrace(maxFrames int) *BTTrace {
+	return &BTTrace{
+		MaxFrames: maxFrames,
+		Frames:    make([]*BTTraceFrame, 0),
+	}
+}
+
+// BTTraceFrame is the record of one tick of the tree
+type BTTraceFrame struct {
+	Tick   int
+	T      float64
+	Entity int
+	// the paths ExecuteBT() descended ("" where it failed)
+	Paths []string
+	// the actions ticked by TickBT()
+	Ticked []BTTraceTicked
+	// the status of the tree after the tick
+	Status BTStatus
+	// every node of the tree (and the subtrees it references), after the
+	// tick
+	Nodes []*BTTraceNode
+}
+
+type BTTraceTicked struct {
+	Node   string
+	Status BTStatus
+}
+
+// BTTraceNode is a node's state: its ID is the indices of the children
+// taken to reach it from the root ("0" being the root, "0.2" its third
+// child), and its status "success" or "failure" if it has finished,
+// "failed" if it failed by its decorators this run, "running" if it was
+// descended through, else "idle"
+type BTTraceNode struct {
+	ID     string
+	Parent string `json:",omitempty"`
+	Name   string
+	Status string
+	// the subtree, if it's the root of one referenced by name
+	Subtree string `json:",omitempty"`
+}
+
+func (s BTStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (t *BTTrace) Last() *BTTraceFrame {
+	if len(t.Frames) == 0 {
+		return nil
+	}
+	return t.Frames[len(t.Frames)-1]
+}
+
+func (t *BTTrace) JSON() ([]byte, error) {
+	return json.MarshalIndent(t, "", "\t")
+}
+
+// (all the recording methods below are no-ops on a nil trace, so that
+// untraced trees just call them)
+
+func (t *BTTrace) begin(e *Entity, bt *BehaviourTree) {
+	if t == nil || t.frame != nil {
+		return
+	}
+	t.ticks++
+	t.frame = &BTTraceFrame{
+		Tick:   t.ticks,
+		T:      bt.t,
+		Entity: e.ID,
+		Paths:  make([]string, 0),
+		Ticked: make([]BTTraceTicked, 0),
+	}
+	t.visited = make(map[*BTNode]bool)
+}
+
+func (t *BTTrace) visit(node *BTNode) {
+	if t == nil {
+		return
+	}
+	t.visited[node] = true
+}
+
+func (t *BTTrace) descended(state *BTExecState) {
+	if t == nil {
+		return
+	}
+	path := ""
+	if state != nil {
+		path = state.Path
+	}
+	t.frame.Paths = append(t.frame.Paths, path)
+}
+
+func (t *BTTrace) ticked(state *BTExecState, status BTStatus) {
+	if t == nil {
+		return
+	}
+	t.frame.Ticked = append(t.frame.Ticked, BTTraceTicked{
+		Node:   state.Path,
+		Status: status,
+	})
+}
+
+// ends the frame, snapshotting the tree (before it's reset, if it finished)
+func (t *BTTrace) end(btr *BTRunner, bt *BehaviourTree, status BTStatus) {
+	if t == nil || t.frame == nil {
+		return
+	}
+	t.frame.Status = status
+	t.frame.Nodes = btTraceSnapshot(btr, bt, t.visited)
+	t.Frames = append(t.Frames, t.frame)
+	if t.MaxFrames > 0 && len(t.Frames) > t.MaxFrames {
+		t.Frames = t.Frames[len(t.Frames)-t.MaxFrames:]
+	}
+	t.frame = nil
+	t.visited = nil
+}
+
+// the tree's status as it stands (outside of TickBT())
+func btTreeStatus(bt *BehaviourTree) BTStatus {
+	if bt.Root.Complete {
+		return bt.Root.Status
+	}
+	if bt.Root.Failed {
+		return BT_FAILURE
+	}
+	return BT_RUNNING
+}
+
+func btTraceSnapshot(btr *BTRunner, bt *BehaviourTree, visited map[*BTNode]bool) []*BTTraceNode {
+	nodes := make([]*BTTraceNode, 0)
+	// (guarding against subtrees referencing each other in a cycle)
+	expanding := make(map[string]bool)
+	var walk func(node *BTNode, id, parent, subtree string)
+	walk = func(node *BTNode, id, parent, subtree string) {
+		status := "idle"
+		switch {
+		case node.Complete:
+			status = node.Status.String()
+		case node.Failed:
+			status = "failed"
+		case visited[node]:
+			status = "running"
+		}
+		nodes = append(nodes, &BTTraceNode{
+			ID:      id,
+			Parent:  parent,
+			Name:    node.Name,
+			Status:  status,
+			Subtree: subtree,
+		})
+		if node.Selector == nil && btr != nil {
+			if tree, ok := btr.trees[node.Name]; ok && tree != bt && !expanding[node.Name] {
+				expanding[node.Name] = true
+				walk(tree.Root, id+".0", id, tree.Name)
+				expanding[node.Name] = false
+			}
+			return
+		}
+		for i, ch := range node.Children {
+			walk(ch, id+"."+strconv.Itoa(i), id, "")
+		}
+	}
+	walk(bt.Root, "0", "", "")
+	return nodes
+}
+
+var btTraceDOTColours = map[string]string{
+	"success": "palegreen",
+	"failure": "salmon",
+	"failed":  "lightpink",
+	"running": "khaki",
+	"idle":    "white",
+}
+
+// DOT renders the frame's snapshot of the tree as a graphviz digraph, the
+// nodes coloured by status
+func (f *BTTraceFrame) DOT() string {
+	var buf bytes.Buffer
+	buf.WriteString("digraph bt {\n")
+	buf.WriteString("\tnode [shape=box, style=filled, fontname=monospace];\n")
+	for _, n := range f.Nodes {
+		label := n.Name
+		if n.Subtree != "" {
+			label = fmt.Sprintf("%s\n(subtree %s)", n.Name, n.Subtree)
+		}
+		buf.WriteString(fmt.Sprintf("\t%s [label=%s, fillcolor=%s];\n",
+			dotQuote(n.ID), dotQuote(label), btTraceDOTColours[n.Status]))
+	}
+	for _, n := range f.Nodes {
+		if n.Parent != "" {
+			style := ""
+			if n.Subtree != "" {
+				style = " [style=dashed]"
+			}
+			buf.WriteString(fmt.Sprintf("\t%s -> %s%s;\n", dotQuote(n.Parent), dotQuote(n.ID), style))
+		}
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// DOT renders the tree as it stands as a graphviz digraph (see
+// BTTraceFrame.DOT()), expanding the subtrees it references by name
+func (btr *BTRunner) DOT(bt *BehaviourTree) string {
+	f := &BTTraceFrame{Nodes: btTraceSnapshot(btr, bt, nil)}
+	return f.DOT()
+}
+
+// String gives the frame's snapshot as an indented outline
+func (f *BTTraceFrame) String() string {
+	var buf bytes.Buffer
+	for _, n := range f.Nodes {
+		depth := strings.Count(n.ID, ".")
+		buf.WriteString(fmt.Sprintf("%s%s [%s]\n", strings.Repeat("  ", depth), n.Name, n.Status))
+	}
+	return buf.String()
+}
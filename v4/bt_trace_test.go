@@ -0,0 +1,99 @@
+package sameriver
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBTTrace(t *testing.T) {
+	w := testingWorld()
+	e := w.Spawn(nil)
+	btr := NewBTRunner()
+	log := make([]string, 0)
+	bt := NewBehaviourTree("root", BTFallback("Fallback",
+		BTSequence("Sequence",
+			testingBTLeaf(&log, "walk", 2, BT_SUCCESS),
+			testingBTLeaf(&log, "open", 1, BT_FAILURE),
+		),
+		testingBTLeaf(&log, "climb", 1, BT_SUCCESS),
+	))
+	bt.Trace = NewBTTrace(0)
+	testingTickBT(btr, e, bt, 2)
+	if len(bt.Trace.Frames) != 2 {
+		t.Fatalf("should have recorded a frame per tick, got %d", len(bt.Trace.Frames))
+	}
+
+	first := bt.Trace.Frames[0]
+	assert.Equal(t, BT_RUNNING, first.Status)
+	assert.Equal(t, []BTTraceTicked{{"Fallback.Sequence.walk", BT_RUNNING}}, first.Ticked)
+	statuses := make(map[string]string)
+	for _, n := range first.Nodes {
+		statuses[n.Name] = n.Status
+	}
+	assert.Equal(t, map[string]string{
+		"Fallback": "running", "Sequence": "running",
+		"walk": "running", "open": "idle", "climb": "idle",
+	}, statuses)
+
+	// the second tick walks, fails to open, and climbs, snapshotting the
+	// tree before it's reset
+	second := bt.Trace.Last()
+	assert.Equal(t, BT_SUCCESS, second.Status)
+	assert.Equal(t, []BTTraceTicked{
+		{"Fallback.Sequence.walk", BT_SUCCESS},
+		{"Fallback.Sequence.open", BT_FAILURE},
+		{"Fallback.climb", BT_SUCCESS},
+	}, second.Ticked)
+	statuses = make(map[string]string)
+	for _, n := range second.Nodes {
+		statuses[n.ID] = n.Status
+	}
+	assert.Equal(t, map[string]string{
+		"0": "success", "0.0": "failure", "0.0.0": "success",
+		"0.0.1": "failure", "0.1": "success",
+	}, statuses)
+
+	jsonBytes, err := bt.Trace.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(jsonBytes), `"Status": "success"`) {
+		t.Fatalf("statuses should be exported by name, got\n%s", jsonBytes)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(jsonBytes, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	dot := second.DOT()
+	if !strings.Contains(dot, `"0.1" [label="climb", fillcolor=palegreen];`) ||
+		!strings.Contains(dot, `"0.0" -> "0.0.1";`) {
+		t.Fatalf("unexpected DOT\n%s", dot)
+	}
+}
+
+func TestBTTraceSubtree(t *testing.T) {
+	w := testingWorld()
+	btr := NewBTRunner()
+	btr.LoadTreesJSON(testingVillagerTreesJSON)
+	root := btr.Tree("villagerRoot")
+	root.Trace = NewBTTrace(0)
+	e := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			STATE: map[string]int{"hungry": 1, "afraid": 0},
+		},
+	})
+	result := btr.ExecuteBT(e, root)
+	frame := root.Trace.Last()
+	assert.Equal(t, []string{result.Path}, frame.Paths)
+	// the flee subtree (failing its Find(), with no bandits about) is drawn
+	// under the node referencing it
+	dot := btr.DOT(root)
+	if !strings.Contains(dot, `"0.0" [label="flee", fillcolor=lightpink];`) ||
+		!strings.Contains(dot, `"0.0.0" [label="Sequence\n(subtree flee)"`) ||
+		!strings.Contains(dot, `"0.0" -> "0.0.0" [style=dashed];`) {
+		t.Fatalf("subtree should be expanded, got\n%s", dot)
+	}
+}
@@ -0,0 +1,101 @@
+// sameriver-goap-validate checks GOAP domain files (see sameriver.GOAPDomain):
+// that they're valid, and that they plan from each of their samples (or
+// those in a separate file given with -samples), printing the plans found.
+// It exits with status 1 if any domain is invalid or any sample fails.
+// Only JSON files are supported (convert YAML domains to JSON first).
+//
+//	sameriver-goap-validate [-samples samples.json] [-v] domain.json...
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dt-rush/sameriver/v4"
+)
+
+func main() {
+	samplesFile := flag.String("samples", "", "a JSON file of samples ({\"samples\": [...]}) to check instead of the domain's own")
+	verbose := flag.Bool("v", false, "show the engine's log output")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-samples samples.json] [-v] domain.json...\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "(only JSON domain and sample files are supported; convert YAML to JSON first)")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if !*verbose {
+		sameriver.Logger.SetOutput(io.Discard)
+	}
+	var samples json.RawMessage
+	if *samplesFile != "" {
+		contents, err := os.ReadFile(*samplesFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		var wrapper map[string]json.RawMessage
+		if err := json.Unmarshal(contents, &wrapper); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", *samplesFile, err)
+			os.Exit(2)
+		}
+		samples = wrapper["samples"]
+	}
+	ok := true
+	for _, filename := range flag.Args() {
+		ok = validate(filename, samples) && ok
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+func validate(filename string, samples json.RawMessage) bool {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	if samples != nil {
+		contents, err = withSamples(contents, samples)
+		if err != nil {
+			fmt.Printf("%s: %s\n", filename, err)
+			return false
+		}
+	}
+	d, err := sameriver.ParseGOAPDomainJSON(contents)
+	if err != nil {
+		fmt.Printf("%s: %s\n", filename, err)
+		return false
+	}
+	fmt.Printf("%s: %d actions, goals %s\n",
+		filename, len(d.Actions), strings.Join(d.GoalNames(), ", "))
+	ok := true
+	for _, result := range d.CheckSamples() {
+		if result.Err != nil {
+			ok = false
+			fmt.Printf("  FAIL %s: %s\n", result.Sample.Name, result.Err)
+			continue
+		}
+		fmt.Printf("  ok   %s: [%s] (cost %.2f)\n",
+			result.Sample.Name, strings.Join(result.Plan, ", "), result.Cost)
+	}
+	return ok
+}
+
+// replaces the samples of the domain in contents
+func withSamples(contents []byte, samples json.RawMessage) ([]byte, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(contents, &raw); err != nil {
+		return nil, err
+	}
+	raw["samples"] = samples
+	return json.Marshal(raw)
+}
@@ -51,7 +51,6 @@ type CollisionSystem struct {
 	collidableEntities *UpdatedEntityList
 	rateLimiterArray   CollisionRateLimiterArray
 	delay              time.Duration
-	sh                 *SpatialHasher
 	Events             *EventBus
 }
 
@@ -62,30 +61,6 @@ func NewCollisionSystem(delay time.Duration) *CollisionSystem {
 	}
 }
 
-func (s *CollisionSystem) checkEntities(entities []*Entity) {
-	// NOTE: we guard for despawns since the entities in the spatial hash
-	// table might have been despawned since the last time a spatial hash
-	// was computed (not every system is guaranteed to run every update loop,
-	// so maybe spatial hash didn't run but an entity or world logic did, to
-	// despawn one of the tokens still stored in the last-computed spatial hash
-	// table).
-	for ix := 0; ix < len(entities); ix++ {
-		i := entities[ix]
-		for jx := ix + 1; jx < len(entities); jx++ {
-			j := entities[jx]
-			// required that i.ID < j.ID for the rate limiter array
-			if j.ID < i.ID {
-				j, i = i, j
-			}
-			r := s.rateLimiterArray.GetRateLimiter(i.ID, j.ID)
-			if r.Load() == 0 &&
-				s.TestCollision(i, j) {
-				s.DoCollide(i, j)
-			}
-		}
-	}
-}
-
 func (s *CollisionSystem) DoCollide(i *Entity, j *Entity) {
 	s.rateLimiterArray.Do(i.ID, j.ID,
 		func() {
@@ -137,9 +112,6 @@ func (s *CollisionSystem) LinkWorld(w *World) {
 				s.rateLimiterArray.Reset(signal.Entity)
 			}
 		})
-
-	// TODO: parametrize grid
-	s.sh = NewSpatialHasher(10, 10, w)
 }
 
 // Iterates through the entities in the UpdatedEntityList using a handshake
@@ -154,25 +126,32 @@ func (s *CollisionSystem) LinkWorld(w *World) {
 // events for each possible collision [i][j] using the rate limiter at [i][j]
 // in rateLimiters, so if we already sent one within the timeout, we just move on.
 func (s *CollisionSystem) Update(dt_ms float64) {
-	s.sh.Update()
-	// NOTE: The ID's in collidableEntities are in sorted order,
+	s.w.RefreshSpatialIndex()
+	// NOTE: the world's spatial index gives pairs ordered i.ID < j.ID,
 	// so the rateLimiterArray access condition that i < j is respected
-	// check each possible collison between entities in the list by doing a
-	// handshake pattern
-	for x := 0; x < s.sh.GridX; x++ {
-		for y := 0; y < s.sh.GridY; y++ {
-			entities := s.sh.Entities(x, y)
-			s.checkEntities(entities)
-		}
+	s.w.SpatialIndex.CandidatePairs(s.checkPair)
+}
+
+func (s *CollisionSystem) checkPair(i *Entity, j *Entity) {
+	r := s.rateLimiterArray.GetRateLimiter(i.ID, j.ID)
+	if r.Load() == 0 &&
+		s.TestCollision(i, j) {
+		s.DoCollide(i, j)
 	}
 }
 
 // performs worse than regular single-threaded Update
+// (only parallelizes if the world's spatial index is a grid)
 func (s *CollisionSystem) UpdateParallel(dt_ms float64) {
-	s.sh.Update()
+	sh := s.w.SpatialHasher
+	if sh == nil {
+		s.Update(dt_ms)
+		return
+	}
+	s.w.RefreshSpatialIndex()
 
 	numWorkers := runtime.NumCPU()
-	stripeSize := s.sh.GridY / numWorkers
+	stripeSize := sh.GridY / numWorkers
 	var wg sync.WaitGroup
 	wg.Add(numWorkers)
 
@@ -180,15 +159,14 @@ func (s *CollisionSystem) UpdateParallel(dt_ms float64) {
 		startIndex := i * stripeSize
 		endIndex := (i + 1) * stripeSize
 		if i == numWorkers-1 {
-			endIndex = s.sh.GridY
+			endIndex = sh.GridY
 		}
 
 		go func(start, end int) {
 			defer wg.Done()
-			for x := 0; x < s.sh.GridX; x++ {
+			for x := 0; x < sh.GridX; x++ {
 				for y := start; y < end; y++ {
-					entities := s.sh.Entities(x, y)
-					s.checkEntities(entities)
+					sh.CellCandidatePairs(x, y, s.checkPair)
 				}
 			}
 		}(startIndex, endIndex)
@@ -26,3 +26,7 @@ const EVENT_SUBSCRIBER_CHANNEL_CAPACITY = 128
 const ADD_REMOVE_LOGIC_CHANNEL_CAPACITY = MAX_ENTITIES / 4
 
 const RUNTIME_LIMIT_SHARER_MAX_LOOPS = 8
+
+// how near GOAP world state vals need to be to count as equal (float vals
+// summed by effs accumulating rounding error)
+const GOAP_EPSILON = 1e-9
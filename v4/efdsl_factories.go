@@ -36,9 +36,11 @@ func (e *EFDSLEvaluator) Predicate(args ...any) func(args []string, resolver Ide
 		}
 
 		// check if type signature is user-defined
-		result := e.userPredicateSignatureAsserter(funcs[i], argsTyped)
-		if result != nil {
-			return result
+		if e.userPredicateSignatureAsserter != nil {
+			result := e.userPredicateSignatureAsserter(funcs[i], argsTyped)
+			if result != nil {
+				return result
+			}
 		}
 		// else, we handle a finite set of signatures
 		return e.predicateSignatureAssertSwitch(funcs[i], argsTyped)
@@ -66,9 +68,11 @@ func (e *EFDSLEvaluator) Sort(args ...any) func(args []string, resolver Identifi
 		}
 
 		// check if type signature is user-defined
-		result := e.userSortSignatureAsserter(funcs[i], argsTyped)
-		if result != nil {
-			return result
+		if e.userSortSignatureAsserter != nil {
+			result := e.userSortSignatureAsserter(funcs[i], argsTyped)
+			if result != nil {
+				return result
+			}
 		}
 		// else, we handle a finite set of signatures
 		return e.sortSignatureAssertSwitch(funcs[i], argsTyped)
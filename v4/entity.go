@@ -17,6 +17,7 @@ type Entity struct {
 	Logics            map[string]*LogicUnit
 	funcs             *FuncSet
 	mind              map[string]any
+	blackboard        *Blackboard
 }
 
 func (e *Entity) LogicUnitName(name string) string {
@@ -126,15 +127,19 @@ func (e *Entity) HasTags(tags ...string) bool {
 }
 
 func (e *Entity) HasComponent(name ComponentID) bool {
-	b, _ := e.ComponentBitArray.GetBit(uint64(e.World.em.components.ixs[name]))
+	// (a component not registered in the world is had by none)
+	ix, ok := e.World.em.components.ixs[name]
+	if !ok {
+		return false
+	}
+	b, _ := e.ComponentBitArray.GetBit(uint64(ix))
 	return b
 }
 
 func (e *Entity) HasComponents(names ...ComponentID) bool {
 	has := true
 	for _, name := range names {
-		b, _ := e.ComponentBitArray.GetBit(uint64(e.World.em.components.ixs[name]))
-		has = has && b
+		has = has && e.HasComponent(name)
 	}
 	return has
 }
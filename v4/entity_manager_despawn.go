@@ -20,6 +20,7 @@ func (m *EntityManager) Despawn(e *Entity) {
 		e.Despawned = true
 		m.entityIDAllocator.deallocate(e)
 		e.RemoveAllLogics()
+		e.dropBlackboard()
 		m.setActiveState(e, false)
 	}
 }
@@ -175,6 +175,7 @@ func (m *EntityManager) doSpawn(
 	e.funcs = NewFuncSet(closureFuncs)
 	// add mind
 	e.mind = mind
+	e.dropBlackboard()
 	// set entity active and notify entity is active
 	m.setActiveState(e, active)
 	// return Entity
@@ -185,6 +186,7 @@ func (m *EntityManager) ExpandEntityTables() {
 	n := len(m.entityIDAllocator.currentEntities) / 2
 	m.entityIDAllocator.expand(n)
 	m.components.expand(n)
+	m.w.SpatialIndex.Expand(n)
 	for _, s := range m.w.systems {
 		s.Expand(n)
 	}
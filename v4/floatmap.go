@@ -15,3 +15,16 @@ func (m *FloatMap) CopyOf() FloatMap {
 	}
 	return NewFloatMap(m2)
 }
+
+func (m *FloatMap) Set(k string, v float64) {
+	m.m[k] = v
+}
+
+func (m *FloatMap) Get(k string) float64 {
+	return m.m[k]
+}
+
+func (m *FloatMap) Has(k string) bool {
+	_, ok := m.m[k]
+	return ok
+}
@@ -0,0 +1,209 @@
+package sameriver
+
+import (
+	"container/heap"
+	"math"
+)
+
+// FlowField gives, for every cell of a NavGrid, the next cell to move to in
+// order to reach a target by the cheapest route. It's built from a Dijkstra
+// map (the cost to reach the target from every cell) in one pass, so any
+// number of entities heading to the same place can share it rather than
+// each searching for a path.
+type FlowField struct {
+	Grid   *NavGrid
+	Target Vec2D
+	goal   int
+	// the cost to reach the goal from each cell (+Inf if unreachable)
+	dist []float64
+	// the next cell on the way to the goal from each cell (-1 at the goal
+	// and where unreachable)
+	next []int
+	// the grid's version when the field was built
+	version int
+}
+
+// NewFlowField builds the flow field toward target, or returns nil if the
+// target isn't on the grid (if it's in a blocked cell, the nearest passable
+// cell is used as the goal)
+func NewFlowField(g *NavGrid, target Vec2D) *FlowField {
+	x, y, ok := g.CellOf(target)
+	if ok {
+		x, y, ok = g.nearestPassable(x, y, 2)
+	}
+	if !ok {
+		return nil
+	}
+	f := &FlowField{
+		Grid:    g,
+		Target:  target,
+		goal:    g.index(x, y),
+		dist:    make([]float64, g.Width*g.Height),
+		next:    make([]int, g.Width*g.Height),
+		version: g.version,
+	}
+	f.build()
+	return f
+}
+
+// build runs Dijkstra outward from the goal, pointing each cell at the
+// neighbour it was reached from
+func (f *FlowField) build() {
+	g := f.Grid
+	for i := range f.dist {
+		f.dist[i] = math.Inf(1)
+		f.next[i] = -1
+	}
+	// (a gridSearch is only used for its neighbours() and moveCost())
+	s := &gridSearch{g: g}
+	closed := make([]bool, len(f.dist))
+	open := make(gridOpenList, 0)
+	f.dist[f.goal] = 0
+	heap.Push(&open, gridOpenItem{f.goal, 0})
+	for open.Len() > 0 {
+		current := heap.Pop(&open).(gridOpenItem).cell
+		if closed[current] {
+			continue
+		}
+		closed[current] = true
+		x, y := s.xy(current)
+		for _, next := range s.neighbours(x, y) {
+			if closed[next] {
+				continue
+			}
+			d := f.dist[current] + s.moveCost(current, next)
+			if d < f.dist[next] {
+				f.dist[next] = d
+				f.next[next] = current
+				heap.Push(&open, gridOpenItem{next, d})
+			}
+		}
+	}
+}
+
+// Stale is whether the grid has changed since the field was built
+func (f *FlowField) Stale() bool {
+	return f.version != f.Grid.version
+}
+
+// CostAt is the cost to reach the target from pos (+Inf if unreachable or
+// off the grid)
+func (f *FlowField) CostAt(pos Vec2D) float64 {
+	x, y, ok := f.Grid.CellOf(pos)
+	if !ok {
+		return math.Inf(1)
+	}
+	return f.dist[f.Grid.index(x, y)]
+}
+
+// Reachable is whether the target can be reached from pos
+func (f *FlowField) Reachable(pos Vec2D) bool {
+	return !math.IsInf(f.CostAt(pos), 1)
+}
+
+// InGoal is whether pos is in the goal cell (from where one can head
+// straight for the target)
+func (f *FlowField) InGoal(pos Vec2D) bool {
+	x, y, ok := f.Grid.CellOf(pos)
+	return ok && f.Grid.index(x, y) == f.goal
+}
+
+// DirectionAt gives the unit vector in which to move from pos toward the
+// target: toward the center of the next cell along the field (so entities
+// are drawn to the middle of corridors rather than grazing corners), or
+// straight at the target in the goal cell. For positions in a blocked cell
+// (eg. pushed against a wall), it points to the nearest passable cell. It's
+// zero where the target is unreachable.
+func (f *FlowField) DirectionAt(pos Vec2D) Vec2D {
+	g := f.Grid
+	x, y, ok := g.CellOf(pos)
+	if !ok {
+		return Vec2D{0, 0}
+	}
+	if !g.Passable(x, y) {
+		nx, ny, ok := g.nearestPassable(x, y, 2)
+		if !ok || math.IsInf(f.dist[g.index(nx, ny)], 1) {
+			return Vec2D{0, 0}
+		}
+		return g.CellCenter(nx, ny).Sub(pos).Unit()
+	}
+	i := g.index(x, y)
+	if i == f.goal {
+		if pos == f.Target {
+			return Vec2D{0, 0}
+		}
+		return f.Target.Sub(pos).Unit()
+	}
+	if f.next[i] == -1 {
+		return Vec2D{0, 0}
+	}
+	return g.CellCenter(f.next[i]%g.Width, f.next[i]/g.Width).Sub(pos).Unit()
+}
+
+// FlowFieldCache keeps the flow fields built for a grid, keyed by the cell
+// of their target, rebuilding them when the grid changes
+type FlowFieldCache struct {
+	Grid *NavGrid
+	// the most fields kept; past this, the least recently used is evicted
+	// (0 for no limit)
+	MaxFields int
+	fields    map[int]*FlowField
+	lastUsed  map[int]int
+	tick      int
+}
+
+func NewFlowFieldCache(g *NavGrid, maxFields int) *FlowFieldCache {
+	return &FlowFieldCache{
+		Grid:      g,
+		MaxFields: maxFields,
+		fields:    make(map[int]*FlowField),
+		lastUsed:  make(map[int]int),
+	}
+}
+
+// Get gives the flow field toward target, building it if there's none for
+// its cell or the one there is stale. Returns nil if target is off the grid.
+func (c *FlowFieldCache) Get(target Vec2D) *FlowField {
+	x, y, ok := c.Grid.CellOf(target)
+	if !ok {
+		return nil
+	}
+	key := c.Grid.index(x, y)
+	c.tick++
+	if f, ok := c.fields[key]; ok && !f.Stale() {
+		c.lastUsed[key] = c.tick
+		return f
+	}
+	f := NewFlowField(c.Grid, target)
+	if f == nil {
+		return nil
+	}
+	c.fields[key] = f
+	c.lastUsed[key] = c.tick
+	if c.MaxFields > 0 && len(c.fields) > c.MaxFields {
+		c.evict()
+	}
+	return f
+}
+
+func (c *FlowFieldCache) evict() {
+	oldest, oldestTick := -1, math.MaxInt
+	for key, tick := range c.lastUsed {
+		if tick < oldestTick {
+			oldest, oldestTick = key, tick
+		}
+	}
+	delete(c.fields, oldest)
+	delete(c.lastUsed, oldest)
+}
+
+// Invalidate drops all cached fields
+func (c *FlowFieldCache) Invalidate() {
+	c.fields = make(map[int]*FlowField)
+	c.lastUsed = make(map[int]int)
+}
+
+// Len is the number of fields cached
+func (c *FlowFieldCache) Len() int {
+	return len(c.fields)
+}
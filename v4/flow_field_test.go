@@ -0,0 +1,135 @@
+package sameriver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlowFieldDirections(t *testing.T) {
+	g := testingWalledNavGrid()
+	target := Vec2D{9.5, 0.5}
+	f := NewFlowField(g, target)
+	// walk the field cell by cell from the far side of the wall
+	pos := Vec2D{0.5, 0.5}
+	for i := 0; i < 100 && !f.InGoal(pos); i++ {
+		dir := f.DirectionAt(pos)
+		if dir.Magnitude() == 0 {
+			t.Fatalf("field should have a direction at %v", pos)
+		}
+		// (from a cell's center, directions point to the next's center)
+		x, y, _ := g.CellOf(pos.Add(Vec2D{dir.X * 1.01, dir.Y * 1.01}))
+		if !g.Passable(x, y) {
+			t.Fatalf("field should lead around the wall, but led into %d,%d", x, y)
+		}
+		pos = g.CellCenter(x, y)
+	}
+	if !f.InGoal(pos) {
+		t.Fatal("following the field should reach the goal")
+	}
+	if f.CostAt(Vec2D{0.5, 0.5}) <= f.CostAt(Vec2D{4.5, 9.5}) {
+		t.Fatal("cost should decrease toward the target")
+	}
+	g.SetBlocked(5, 9, true)
+	if !f.Stale() {
+		t.Fatal("field should be stale once the grid changes")
+	}
+	f = NewFlowField(g, target)
+	if f.Reachable(Vec2D{0.5, 0.5}) || f.DirectionAt(Vec2D{0.5, 0.5}).Magnitude() != 0 {
+		t.Fatal("target should be unreachable across a closed wall")
+	}
+	if NewFlowField(g, Vec2D{-5, -5}) != nil {
+		t.Fatal("shouldn't build a field to a target off the grid")
+	}
+}
+
+func TestFlowFieldCache(t *testing.T) {
+	g := testingWalledNavGrid()
+	c := NewFlowFieldCache(g, 2)
+	a := c.Get(Vec2D{9.5, 0.5})
+	if c.Get(Vec2D{9.2, 0.7}) != a {
+		t.Fatal("targets in the same cell should share a field")
+	}
+	g.SetCost(0, 0, 2)
+	if c.Get(Vec2D{9.5, 0.5}) == a {
+		t.Fatal("stale field should have been rebuilt")
+	}
+	c.Get(Vec2D{0.5, 0.5})
+	c.Get(Vec2D{0.5, 9.5})
+	if c.Len() != 2 {
+		t.Fatalf("cache should evict past MaxFields, has %d", c.Len())
+	}
+	c.Invalidate()
+	if c.Len() != 0 {
+		t.Fatal("Invalidate() should drop all fields")
+	}
+}
+
+func TestFlowFieldSteering(t *testing.T) {
+	w := testingWorld()
+	ps := NewPathfindingSystem()
+	w.RegisterSystems(ps, NewSteeringSystem(), NewPhysicsSystem())
+	m := NewTileMap(10, 10, 10, 10)
+	walls := m.AddLayer("walls")
+	walls.SetSolid(true)
+	for y := 0; y < 9; y++ {
+		walls.SetTile(5, y, 1)
+	}
+	w.SetTileMap(m)
+	target := Vec2D{75, 15}
+	arrived := func(e *Entity) bool {
+		_, _, d := e.GetVec2D(POSITION).Distance(target)
+		return d < 15
+	}
+	crowd := make([]*Entity, 0)
+	for i := 0; i < 6; i++ {
+		e := testingSpawnSteeringBehaviours(w, Vec2D{20, 10 + float64(i)*12},
+			NewSteeringBehaviours(0).Add(1, NewFollowFlowField(target)))
+		*e.GetFloat64(MAXVELOCITY) = 0.5
+		crowd = append(crowd, e)
+	}
+	for i := 0; i < 2000; i++ {
+		all := true
+		for _, e := range crowd {
+			all = all && arrived(e)
+		}
+		if all {
+			break
+		}
+		w.Update(FRAME_MS / 2)
+		time.Sleep(100 * time.Microsecond)
+	}
+	for _, e := range crowd {
+		if !arrived(e) {
+			t.Fatalf("entity should have followed the field to %v, at %v",
+				target, *e.GetVec2D(POSITION))
+		}
+	}
+	if ps.FlowFields.Len() != 1 {
+		t.Fatalf("the crowd should share one flow field, got %d", ps.FlowFields.Len())
+	}
+}
+
+func TestPathfindingSystemStaticsRebuildGrid(t *testing.T) {
+	w := testingWorld()
+	ps := NewPathfindingSystem()
+	w.RegisterSystems(ps)
+	f := ps.FlowField(Vec2D{505, 505})
+	grid := ps.Grid
+	if !grid.Passable(30, 30) {
+		t.Fatal("grid should start open")
+	}
+	w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION: Vec2D{305, 305},
+			BOX:      Vec2D{10, 10},
+		},
+		"tags": []string{"static"},
+	})
+	w.Update(FRAME_MS / 2)
+	if ps.Grid == grid || ps.Grid.Passable(30, 30) {
+		t.Fatal("grid should have been rebuilt with the new static entity")
+	}
+	if ps.FlowField(Vec2D{505, 505}) == f {
+		t.Fatal("flow fields should have been rebuilt with the grid")
+	}
+}
@@ -0,0 +1,361 @@
+package sameriver
+
+import (
+	"fmt"
+)
+
+// FSMState is a state of an FSM, which may have substates (the machine is
+// then in one of them as well, starting in Initial, or the first added)
+type FSMState struct {
+	Name string
+	// its value in the machine's STATE key (see FSM)
+	ID       int
+	Parent   *FSMState
+	Children []*FSMState
+	Initial  *FSMState
+
+	// called when the state is entered, each update while it's active
+	// (outer states before inner), and when it's exited
+	Enter  func(ctx *FSMContext)
+	Update func(ctx *FSMContext, dt_ms float64)
+	Exit   func(ctx *FSMContext)
+
+	// for a final state, how the machine finishes on reaching it:
+	// BT_SUCCESS or BT_FAILURE (BT_RUNNING, the default, for others)
+	Result BTStatus
+
+	transitions []*FSMTransition
+}
+
+// FSMTransition goes From a state (or any of its substates) To another
+// when Guard holds (if set). A transition with AfterMs waits until the
+// machine has been in From that long; one with Event only fires when the
+// event is triggered (see FSM.Trigger()).
+type FSMTransition struct {
+	From    *FSMState
+	To      *FSMState
+	Guard   func(ctx *FSMContext) bool
+	AfterMs float64
+	Event   string
+}
+
+// FSMContext is given to the callbacks and guards of a state
+type FSMContext struct {
+	Machine *FSM
+	Entity  *Entity
+	// the state whose callback or transition this is
+	State *FSMState
+}
+
+// TimeInState is how long (ms) the machine has been in the context's state
+func (ctx *FSMContext) TimeInState() float64 {
+	return ctx.Machine.TimeIn(ctx.State)
+}
+
+// FSMTransitionEvent is the data of an "fsm-transition" event
+type FSMTransitionEvent struct {
+	Entity  *Entity
+	Machine *FSM
+	// the innermost states before (nil on starting) and after
+	From *FSMState
+	To   *FSMState
+	// the event which triggered it, if any
+	Event string
+	// if it was made by STATE being set from outside the machine
+	Forced bool
+}
+
+// FSM is a hierarchical finite state machine for an entity. Each state
+// may have substates, the machine being in one state at each level, and
+// the transitions of an outer state apply whichever of its substates the
+// machine is in (those of inner states are tried first).
+//
+// If Key is set, the ID of the innermost state the machine is in is
+// written to that key of the entity's STATE (whose valid interval is set to
+// the states' IDs), so that GOAP, the EFDSL, etc. can read it; and setting
+// the key from outside moves the machine to that state on its next
+// update.
+//
+// Every transition publishes an "fsm-transition" event on Events (set by
+// the FSMSystem if nil) with a *FSMTransitionEvent as data.
+type FSM struct {
+	Name   string
+	Key    string
+	Entity *Entity
+	Events *EventBus
+	// the top-level state to start in (the first added if nil)
+	Initial *FSMState
+	// BT_SUCCESS or BT_FAILURE once the machine has reached a final state
+	Status BTStatus
+
+	states    []*FSMState
+	stateMap  map[string]*FSMState
+	topLevel  []*FSMState
+	started   bool
+	t         float64
+	active    []*FSMState
+	enteredAt map[*FSMState]float64
+	// the value last written to Key
+	written int
+	// how many transitions have been made (to tell if a callback made one)
+	seq           int
+	transitioning bool
+}
+
+func NewFSM(name string, key string) *FSM {
+	return &FSM{
+		Name:      name,
+		Key:       key,
+		stateMap:  make(map[string]*FSMState),
+		enteredAt: make(map[*FSMState]float64),
+	}
+}
+
+// AddState adds a state named name, a substate of parent (or top-level if
+// nil)
+func (m *FSM) AddState(name string, parent *FSMState) *FSMState {
+	if _, ok := m.stateMap[name]; ok {
+		panic(fmt.Sprintf("FSM %s already has a state named %s", m.Name, name))
+	}
+	s := &FSMState{
+		Name:   name,
+		ID:     len(m.states),
+		Parent: parent,
+	}
+	m.states = append(m.states, s)
+	m.stateMap[name] = s
+	if parent == nil {
+		m.topLevel = append(m.topLevel, s)
+	} else {
+		if m.stateMap[parent.Name] != parent {
+			panic(fmt.Sprintf("parent %s of state %s isn't a state of FSM %s", parent.Name, name, m.Name))
+		}
+		parent.Children = append(parent.Children, s)
+	}
+	return s
+}
+
+// AddTransition adds a transition from one state to another when guard
+// holds (always, if nil); set AfterMs or Event on the transition given to
+// make it timed or triggered
+func (m *FSM) AddTransition(from, to *FSMState, guard func(ctx *FSMContext) bool) *FSMTransition {
+	if from == nil || to == nil || m.stateMap[from.Name] != from || m.stateMap[to.Name] != to {
+		panic(fmt.Sprintf("transition of FSM %s must be between its states", m.Name))
+	}
+	t := &FSMTransition{From: from, To: to, Guard: guard}
+	from.transitions = append(from.transitions, t)
+	return t
+}
+
+// State gives the state named name (nil if none)
+func (m *FSM) State(name string) *FSMState {
+	return m.stateMap[name]
+}
+
+// Current gives the innermost state the machine is in (nil if not started)
+func (m *FSM) Current() *FSMState {
+	if len(m.active) == 0 {
+		return nil
+	}
+	return m.active[len(m.active)-1]
+}
+
+// In is whether the machine is in s (or one of its substates)
+func (m *FSM) In(s *FSMState) bool {
+	_, ok := m.enteredAt[s]
+	return ok
+}
+
+// TimeIn is how long (ms) the machine has been in s (0 if it isn't)
+func (m *FSM) TimeIn(s *FSMState) float64 {
+	at, ok := m.enteredAt[s]
+	if !ok {
+		return 0
+	}
+	return m.t - at
+}
+
+// Started is whether Start() has been called
+func (m *FSM) Started() bool {
+	return m.started
+}
+
+// Start (re)starts the machine for e, exiting any states it was in and
+// entering Initial (or the first state added)
+func (m *FSM) Start(e *Entity) {
+	if len(m.topLevel) == 0 {
+		panic(fmt.Sprintf("FSM %s has no states to start in", m.Name))
+	}
+	m.exitTo(nil)
+	m.Entity = e
+	m.Status = BT_RUNNING
+	m.started = true
+	if m.hasKey() {
+		e.GetIntMap(STATE).SetValidInterval(m.Key, 0, len(m.states)-1)
+	}
+	initial := m.Initial
+	if initial == nil {
+		initial = m.topLevel[0]
+	}
+	m.enter(nil, initial, "", false)
+}
+
+// Update advances the machine's clock: moving to the state set in STATE
+// from outside (if any), running the Update() of the states it's in, then
+// taking the first transition (innermost state's first) whose time has
+// come and whose guard holds. A finished machine does nothing.
+func (m *FSM) Update(dt_ms float64) {
+	if !m.started || m.Status != BT_RUNNING {
+		return
+	}
+	m.t += dt_ms
+	if m.hasKey() {
+		v := m.Entity.GetIntMap(STATE).Get(m.Key)
+		if v != m.written && v >= 0 && v < len(m.states) {
+			m.transition(nil, m.states[v], "", true)
+			if m.Status != BT_RUNNING {
+				return
+			}
+		}
+	}
+	seq := m.seq
+	for _, s := range m.active {
+		if s.Update != nil {
+			s.Update(m.ctx(s), dt_ms)
+			// (an update may have triggered a transition)
+			if m.seq != seq {
+				return
+			}
+		}
+	}
+	for i := len(m.active) - 1; i >= 0; i-- {
+		s := m.active[i]
+		for _, t := range s.transitions {
+			if t.Event != "" || m.TimeIn(s) < t.AfterMs {
+				continue
+			}
+			if t.Guard == nil || t.Guard(m.ctx(s)) {
+				m.transition(s, t.To, "", false)
+				return
+			}
+		}
+	}
+}
+
+// Trigger fires the first transition on event (innermost state's first)
+// whose time has come and whose guard holds, giving whether one did
+func (m *FSM) Trigger(event string) bool {
+	if !m.started || m.Status != BT_RUNNING {
+		return false
+	}
+	if m.transitioning {
+		logWarning("FSM %s triggered %s while transitioning; ignored", m.Name, event)
+		return false
+	}
+	for i := len(m.active) - 1; i >= 0; i-- {
+		s := m.active[i]
+		for _, t := range s.transitions {
+			if t.Event != event || m.TimeIn(s) < t.AfterMs {
+				continue
+			}
+			if t.Guard == nil || t.Guard(m.ctx(s)) {
+				m.transition(s, t.To, event, false)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m *FSM) hasKey() bool {
+	return m.Key != "" && m.Entity != nil && m.Entity.HasComponent(STATE)
+}
+
+func (m *FSM) ctx(s *FSMState) *FSMContext {
+	return &FSMContext{Machine: m, Entity: m.Entity, State: s}
+}
+
+// transition goes from source (the state whose transition it is; the
+// current state if nil) to target, exiting the states below those they have in common,
+// and entering those down to target (then into its initial substates)
+func (m *FSM) transition(source, target *FSMState, event string, forced bool) {
+	from := m.Current()
+	// (the states kept are the common proper ancestors of source and
+	// target, so that a transition to or from an outer state exits and
+	// re-enters it)
+	if source == nil {
+		source = from
+	}
+	var keep *FSMState
+	for a := target.Parent; a != nil && keep == nil; a = a.Parent {
+		for b := source.Parent; b != nil; b = b.Parent {
+			if a == b {
+				keep = a
+				break
+			}
+		}
+	}
+	m.exitTo(keep)
+	m.enter(from, target, event, forced)
+}
+
+// exitTo exits the states the machine is in, innermost first, up to (not
+// including) keep
+func (m *FSM) exitTo(keep *FSMState) {
+	m.transitioning = true
+	for len(m.active) > 0 {
+		s := m.active[len(m.active)-1]
+		if s == keep {
+			break
+		}
+		if s.Exit != nil {
+			s.Exit(m.ctx(s))
+		}
+		m.active = m.active[:len(m.active)-1]
+		delete(m.enteredAt, s)
+	}
+	m.transitioning = false
+}
+
+// enter enters target (and its ancestors the machine isn't in), then its
+// initial substates down to the innermost
+func (m *FSM) enter(from, target *FSMState, event string, forced bool) {
+	m.transitioning = true
+	path := make([]*FSMState, 0)
+	for s := target; s != nil && !m.In(s); s = s.Parent {
+		path = append([]*FSMState{s}, path...)
+	}
+	for s := target; len(s.Children) > 0; {
+		if s.Initial != nil {
+			s = s.Initial
+		} else {
+			s = s.Children[0]
+		}
+		path = append(path, s)
+	}
+	for _, s := range path {
+		m.active = append(m.active, s)
+		m.enteredAt[s] = m.t
+		if s.Enter != nil {
+			s.Enter(m.ctx(s))
+		}
+	}
+	m.transitioning = false
+	m.seq++
+	to := m.Current()
+	if m.hasKey() {
+		m.written = to.ID
+		m.Entity.GetIntMap(STATE).Set(m.Key, to.ID)
+	}
+	m.Status = to.Result
+	if m.Events != nil {
+		m.Events.Publish("fsm-transition", &FSMTransitionEvent{
+			Entity:  m.Entity,
+			Machine: m,
+			From:    from,
+			To:      to,
+			Event:   event,
+			Forced:  forced,
+		})
+	}
+}
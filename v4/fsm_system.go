@@ -0,0 +1,51 @@
+package sameriver
+
+// FSMSystem updates the FSM in the STATEMACHINE component of each entity,
+// starting it for the entity if it hasn't been. Machines without Events
+// publish their "fsm-transition" events on the system's.
+type FSMSystem struct {
+	w           *World
+	fsmEntities *UpdatedEntityList
+	Events      *EventBus
+}
+
+func NewFSMSystem() *FSMSystem {
+	return &FSMSystem{
+		Events: NewEventBus("fsm"),
+	}
+}
+
+func (s *FSMSystem) GetComponentDeps() []any {
+	return []any{
+		STATEMACHINE, GENERIC, "STATEMACHINE",
+	}
+}
+
+func (s *FSMSystem) LinkWorld(w *World) {
+	s.w = w
+	s.fsmEntities = w.GetUpdatedEntityList(
+		EntityFilterFromComponentBitArray(
+			"fsm",
+			w.em.components.BitArrayFromIDs([]ComponentID{STATEMACHINE})))
+}
+
+func (s *FSMSystem) Update(dt_ms float64) {
+	for _, e := range s.fsmEntities.entities {
+		m, _ := e.GetGeneric(STATEMACHINE).(*FSM)
+		if m == nil {
+			continue
+		}
+		if m.Events == nil {
+			m.Events = s.Events
+		}
+		if !m.Started() || m.Entity != e {
+			m.Start(e)
+			continue
+		}
+		m.Update(dt_ms)
+	}
+}
+
+func (s *FSMSystem) Expand(n int) {
+	// nil?
+}
@@ -0,0 +1,191 @@
+package sameriver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// a guard which patrols (walking, then looking about, by turns) until
+// alerted, then chases until it loses its quarry
+func testingGuardFSM(log *[]string) *FSM {
+	m := NewFSM("guard", "mode")
+	logged := func(s *FSMState) {
+		s.Enter = func(ctx *FSMContext) {
+			*log = append(*log, "enter "+ctx.State.Name)
+		}
+		s.Exit = func(ctx *FSMContext) {
+			*log = append(*log, "exit "+ctx.State.Name)
+		}
+	}
+	patrol := m.AddState("patrol", nil)
+	walk := m.AddState("walk", patrol)
+	look := m.AddState("look", patrol)
+	chase := m.AddState("chase", nil)
+	for _, s := range []*FSMState{patrol, walk, look, chase} {
+		logged(s)
+	}
+	m.AddTransition(walk, look, nil).AfterMs = 1000
+	m.AddTransition(look, walk, nil).AfterMs = 500
+	m.AddTransition(patrol, chase, func(ctx *FSMContext) bool {
+		return ctx.Entity.GetIntMap(STATE).Get("alert") == 1
+	})
+	m.AddTransition(chase, patrol, nil).Event = "lost"
+	return m
+}
+
+func testingFSMEntity(w *World) *Entity {
+	return w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			STATE: map[string]int{"alert": 0},
+		},
+	})
+}
+
+func TestFSMHierarchy(t *testing.T) {
+	w := testingWorld()
+	e := testingFSMEntity(w)
+	log := make([]string, 0)
+	m := testingGuardFSM(&log)
+	m.Events = NewEventBus("guard")
+	ch := m.Events.Subscribe(SimpleEventFilter("fsm-transition"))
+	state := e.GetIntMap(STATE)
+
+	// starting enters the initial substate
+	m.Start(e)
+	assert.Equal(t, []string{"enter patrol", "enter walk"}, log)
+	assert.Equal(t, m.State("walk"), m.Current())
+	assert.True(t, m.In(m.State("patrol")))
+	assert.Equal(t, m.State("walk").ID, state.Get("mode"))
+	assert.False(t, state.ValCanBeSetTo("mode", 4))
+
+	// timed transitions between substates keep the outer state
+	log = log[:0]
+	m.Update(600)
+	assert.Equal(t, m.State("walk"), m.Current())
+	m.Update(600)
+	assert.Equal(t, []string{"exit walk", "enter look"}, log)
+	assert.Equal(t, m.State("look").ID, state.Get("mode"))
+	assert.Equal(t, 1200.0, m.TimeIn(m.State("patrol")))
+
+	// the outer state's guarded transition applies in any substate
+	log = log[:0]
+	state.Set("alert", 1)
+	m.Update(FRAME_MS)
+	assert.Equal(t, []string{"exit look", "exit patrol", "enter chase"}, log)
+	assert.Equal(t, m.State("chase").ID, state.Get("mode"))
+
+	// event transitions only fire when triggered
+	log = log[:0]
+	state.Set("alert", 0)
+	m.Update(FRAME_MS)
+	assert.Equal(t, m.State("chase"), m.Current())
+	assert.False(t, m.Trigger("spotted"))
+	assert.True(t, m.Trigger("lost"))
+	assert.Equal(t, []string{"exit chase", "enter patrol", "enter walk"}, log)
+
+	assert.Equal(t, 4, len(ch.C))
+	events := make([]*FSMTransitionEvent, 0)
+	for len(ch.C) > 0 {
+		events = append(events, (<-ch.C).Data.(*FSMTransitionEvent))
+	}
+	assert.Nil(t, events[0].From)
+	assert.Equal(t, m.State("look"), events[2].From)
+	assert.Equal(t, m.State("chase"), events[2].To)
+	assert.Equal(t, "lost", events[3].Event)
+}
+
+func TestFSMSetFromSTATE(t *testing.T) {
+	w := testingWorld()
+	e := testingFSMEntity(w)
+	log := make([]string, 0)
+	m := testingGuardFSM(&log)
+	m.Events = NewEventBus("guard")
+	ch := m.Events.Subscribe(SimpleEventFilter("fsm-transition"))
+	m.Start(e)
+	ch.DrainChannel()
+
+	// setting the key from outside moves the machine there
+	log = log[:0]
+	e.GetIntMap(STATE).Set("mode", m.State("look").ID)
+	m.Update(FRAME_MS)
+	assert.Equal(t, []string{"exit walk", "enter look"}, log)
+	assert.Equal(t, m.State("look"), m.Current())
+	assert.Equal(t, 1, len(ch.C))
+	assert.True(t, (<-ch.C).Data.(*FSMTransitionEvent).Forced)
+
+	// (an outer state is entered into its initial substate)
+	e.GetIntMap(STATE).Set("mode", m.State("chase").ID)
+	m.Update(FRAME_MS)
+	e.GetIntMap(STATE).Set("mode", m.State("patrol").ID)
+	m.Update(FRAME_MS)
+	assert.Equal(t, m.State("walk"), m.Current())
+	assert.Equal(t, m.State("walk").ID, e.GetIntMap(STATE).Get("mode"))
+
+	assert.Panics(t, func() { m.AddState("walk", nil) })
+	assert.Panics(t, func() { m.AddTransition(m.State("walk"), &FSMState{Name: "swim"}, nil) })
+}
+
+func TestFSMSystem(t *testing.T) {
+	w := testingWorld()
+	s := NewFSMSystem()
+	w.RegisterSystems(s)
+	e := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			STATE:        map[string]int{"alert": 0},
+			STATEMACHINE: nil,
+		},
+	})
+	log := make([]string, 0)
+	m := testingGuardFSM(&log)
+	e.SetGeneric(STATEMACHINE, m)
+	ch := s.Events.Subscribe(SimpleEventFilter("fsm-transition"))
+
+	s.Update(FRAME_MS)
+	assert.Equal(t, m.State("walk"), m.Current())
+	e.GetIntMap(STATE).Set("alert", 1)
+	s.Update(FRAME_MS)
+	assert.Equal(t, m.State("chase"), m.Current())
+	assert.Equal(t, 2, len(ch.C))
+	assert.Equal(t, e, (<-ch.C).Data.(*FSMTransitionEvent).Entity)
+}
+
+func TestBTFSM(t *testing.T) {
+	w := testingWorld()
+	e := testingFSMEntity(w)
+	btr := NewBTRunner()
+	log := make([]string, 0)
+	// a door to open: unlock, then push, failing if it's barred
+	m := NewFSM("door", "")
+	unlock := m.AddState("unlock", nil)
+	push := m.AddState("push", nil)
+	open := m.AddState("open", nil)
+	open.Result = BT_SUCCESS
+	barred := m.AddState("barred", nil)
+	barred.Result = BT_FAILURE
+	m.AddTransition(unlock, push, nil).AfterMs = 2 * FRAME_MS
+	m.AddTransition(push, barred, func(ctx *FSMContext) bool {
+		return ctx.Entity.GetIntMap(STATE).Get("alert") == 1
+	})
+	m.AddTransition(push, open, nil)
+	bt := NewBehaviourTree("root", BTFallback("Fallback",
+		BTSequence("Sequence",
+			BTFSM("OpenDoor", m),
+			testingBTLeaf(&log, "enter", 1, BT_SUCCESS),
+		),
+		testingBTLeaf(&log, "leave", 1, BT_SUCCESS),
+	))
+
+	statuses := testingTickBT(btr, e, bt, 4)
+	assert.Equal(t, []BTStatus{BT_RUNNING, BT_RUNNING, BT_RUNNING, BT_SUCCESS}, statuses)
+	assert.Equal(t, []string{"enter"}, log)
+	assert.Equal(t, BT_SUCCESS, m.Status)
+
+	// the leaf restarts the machine when it runs again
+	e.GetIntMap(STATE).Set("alert", 1)
+	log = log[:0]
+	statuses = testingTickBT(btr, e, bt, 4)
+	assert.Equal(t, []BTStatus{BT_RUNNING, BT_RUNNING, BT_RUNNING, BT_SUCCESS}, statuses)
+	assert.Equal(t, []string{"leave"}, log)
+	assert.Equal(t, barred, m.Current())
+}
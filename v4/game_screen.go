@@ -1,6 +1,8 @@
 package sameriver
 
 import (
+	"math"
+
 	"github.com/veandco/go-sdl2/sdl"
 )
 
@@ -14,10 +16,12 @@ func (s *GameScreen) ScreenSpaceY(y int) int {
 }
 
 // expects pos shifted to bottom-left corner
+// NOTE: floors rather than truncating, so that rects partly off the left or
+// bottom edge (negative coordinates) don't shift by a pixel
 func (s *GameScreen) ScreenSpaceRect(pos *Vec2D, box *Vec2D) *sdl.Rect {
 	return &sdl.Rect{
-		int32(pos.X),
-		int32(float64(s.H) - pos.Y - box.Y),
+		int32(math.Floor(pos.X)),
+		int32(math.Floor(float64(s.H) - pos.Y - box.Y)),
 		int32(box.X),
 		int32(box.Y),
 	}
@@ -64,6 +64,52 @@ func RectWithinRadiusOfPoint(pos, box Vec2D, d float64, point Vec2D) bool {
 	return dx*dx+dy*dy < d*d
 }
 
+// RayIntersectsRect tests a ray against a rect (pos in the center of the rect)
+// using the slab method. dir is expected to be a unit vector. Returns the
+// distance along the ray to the entry point and the outward normal of the face
+// that was hit. If the origin is inside the rect, t is 0 and the normal is the
+// zero vector.
+func RayIntersectsRect(origin, dir Vec2D, maxDist float64, pos, box Vec2D) (hit bool, t float64, normal Vec2D) {
+	min := pos.ShiftedCenterToBottomLeft(box)
+	max := min.Add(box)
+	tNear := math.Inf(-1)
+	tFar := math.Inf(1)
+	// check each axis' slab, narrowing [tNear, tFar]
+	slab := func(o, d, lo, hi float64, axisNormal Vec2D) bool {
+		if d == 0 {
+			// parallel to the slab; must already be within it
+			return o >= lo && o <= hi
+		}
+		t0 := (lo - o) / d
+		t1 := (hi - o) / d
+		n := axisNormal.Scale(-1)
+		if t0 > t1 {
+			t0, t1 = t1, t0
+			n = axisNormal
+		}
+		if t0 > tNear {
+			tNear = t0
+			normal = n
+		}
+		if t1 < tFar {
+			tFar = t1
+		}
+		return tNear <= tFar
+	}
+	if !slab(origin.X, dir.X, min.X, max.X, Vec2D{1, 0}) ||
+		!slab(origin.Y, dir.Y, min.Y, max.Y, Vec2D{0, 1}) {
+		return false, 0, Vec2D{0, 0}
+	}
+	if tFar < 0 || tNear > maxDist {
+		return false, 0, Vec2D{0, 0}
+	}
+	if tNear < 0 {
+		// origin is inside the rect
+		return true, 0, Vec2D{0, 0}
+	}
+	return true, tNear, normal
+}
+
 func RectDistance(iPos, iBox, jPos, jBox Vec2D) float64 {
 
 	// the result
@@ -118,3 +118,37 @@ func TestRectIntersectsRect(t *testing.T) {
 		}
 	}
 }
+
+func TestRayIntersectsRect(t *testing.T) {
+	// box centered at 10,0 with width 2: faces at x=9, x=11
+	pos := Vec2D{10, 0}
+	box := Vec2D{2, 2}
+	hit, d, normal := RayIntersectsRect(Vec2D{0, 0}, Vec2D{1, 0}, 100, pos, box)
+	if !hit || d != 9 || normal != (Vec2D{-1, 0}) {
+		t.Fatalf("ray along +x should hit left face at 9; got %v, %f, %v", hit, d, normal)
+	}
+	hit, d, normal = RayIntersectsRect(Vec2D{20, 0}, Vec2D{-1, 0}, 100, pos, box)
+	if !hit || d != 9 || normal != (Vec2D{1, 0}) {
+		t.Fatalf("ray along -x should hit right face at 9; got %v, %f, %v", hit, d, normal)
+	}
+	hit, _, _ = RayIntersectsRect(Vec2D{0, 0}, Vec2D{1, 0}, 5, pos, box)
+	if hit {
+		t.Fatal("ray should not reach rect beyond maxDist")
+	}
+	hit, _, _ = RayIntersectsRect(Vec2D{0, 0}, Vec2D{-1, 0}, 100, pos, box)
+	if hit {
+		t.Fatal("ray pointing away should not hit rect")
+	}
+	hit, _, _ = RayIntersectsRect(Vec2D{0, 5}, Vec2D{1, 0}, 100, pos, box)
+	if hit {
+		t.Fatal("parallel ray outside slab should not hit rect")
+	}
+	hit, d, normal = RayIntersectsRect(Vec2D{10, 0}, Vec2D{1, 0}, 100, pos, box)
+	if !hit || d != 0 || normal != (Vec2D{0, 0}) {
+		t.Fatalf("ray from inside should hit at 0 with zero normal; got %v, %f, %v", hit, d, normal)
+	}
+	hit, _, normal = RayIntersectsRect(Vec2D{10, -10}, Vec2D{0, 1}, 100, pos, box)
+	if !hit || normal != (Vec2D{0, -1}) {
+		t.Fatalf("ray along +y should hit bottom face; got %v, %v", hit, normal)
+	}
+}
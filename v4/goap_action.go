@@ -2,8 +2,7 @@ package sameriver
 
 import (
 	"fmt"
-
-	"strings"
+	"math"
 )
 
 type GOAPAction struct {
@@ -35,16 +34,16 @@ type GOAPAction struct {
 	// how many times we'll do the action
 	Count int
 
-	// the inherent cost of the action as an int or function
+	// the inherent cost of the action as an int, float64 or func() int
 	cost IntOrFunc
 
 	// preconditions for the action to be performed
 	pres *GOAPTemporalGoal
 
 	// functions that will check the numeric value of a varName (the string key) modally
-	preModalChecks map[string]func(ws *GOAPWorldState) int
+	preModalChecks map[string]func(ws *GOAPWorldState) float64
 	// functions that will set the varName (the string key) to a certain value modally
-	effModalSetters map[string]func(ws *GOAPWorldState, op string, x int)
+	effModalSetters map[string]func(ws *GOAPWorldState, op string, x float64)
 
 	// effects of this action on ws numerically (non-modal)
 	effs map[string]*GOAPEff
@@ -55,9 +54,9 @@ type GOAPAction struct {
 }
 
 type GOAPEff struct {
-	val int
+	val float64
 	op  string
-	f   func(count int, x int) int
+	f   func(count int, x float64) float64
 }
 
 func GOAPEffFunc(op string, val int) func(count int, x int) int {
@@ -68,11 +67,73 @@ func GOAPEffFunc(op string, val int) func(count int, x int) int {
 		return func(count int, x int) int { return x - count*val }
 	case "=":
 		return func(count int, x int) int { return val }
+	case "*":
+		return func(count int, x int) int { return x * int(math.Pow(float64(val), float64(count))) }
+	default:
+		panic("Got an unspecified op in GOAPEffFunc() [valid: +,-,=,*]")
+	}
+}
+
+// GOAPEffFloatFunc is GOAPEffFunc() for real-valued vars; "*" scales the
+// var by val (count times)
+func GOAPEffFloatFunc(op string, val float64) func(count int, x float64) float64 {
+	switch op {
+	case "+":
+		return func(count int, x float64) float64 { return float64(count)*val + x }
+	case "-":
+		return func(count int, x float64) float64 { return x - float64(count)*val }
+	case "=":
+		return func(count int, x float64) float64 { return val }
+	case "*":
+		return func(count int, x float64) float64 { return x * math.Pow(val, float64(count)) }
 	default:
-		panic("Got an unspecified op in GOAPEffFunc() [valid: +,-,=]")
+		panic("Got an unspecified op in GOAPEffFloatFunc() [valid: +,-,=,*]")
 	}
 }
 
+// the amount the modal setter of an eff's var is given for count of it (see
+// GOAPModalVal.set())
+func (eff *GOAPEff) modalAmount(count int) float64 {
+	switch eff.op {
+	case "+", "-":
+		return float64(count) * eff.val
+	case "*":
+		return math.Pow(eff.val, float64(count))
+	default:
+		return eff.val
+	}
+}
+
+// gives an effs spec as a map[string]float64: a map[string]int,
+// map[string]float64 or map[string]any of either
+func goapEffsSpec(name string, spec any) map[string]float64 {
+	result := make(map[string]float64)
+	switch m := spec.(type) {
+	case map[string]int:
+		for k, v := range m {
+			result[k] = float64(v)
+		}
+	case map[string]float64:
+		for k, v := range m {
+			result[k] = v
+		}
+	case map[string]any:
+		for k, v := range m {
+			switch x := v.(type) {
+			case int:
+				result[k] = float64(x)
+			case float64:
+				result[k] = x
+			default:
+				panic(fmt.Sprintf("eff %s of GOAP action %s should have an int or float64 val, got %T", k, name, v))
+			}
+		}
+	default:
+		panic(fmt.Sprintf("effs of GOAP action %s should be a map[string]int, map[string]float64 or map[string]any, got %T", name, spec))
+	}
+	return result
+}
+
 func NewGOAPAction(spec map[string]any) *GOAPAction {
 	name := spec["name"].(string)
 	node := spec["node"].(string)
@@ -84,9 +145,14 @@ func NewGOAPAction(spec map[string]any) *GOAPAction {
 	if !ok {
 		otherNodes = []string{}
 	}
-	cost := spec["cost"].(int)
+	cost := spec["cost"]
+	switch cost.(type) {
+	case int, float64, func() int:
+	default:
+		panic(fmt.Sprintf("cost of GOAP action %s should be an int, float64 or func() int, got %T", name, cost))
+	}
 	pres := spec["pres"]
-	effs := spec["effs"].(map[string]int)
+	effs := goapEffsSpec(name, spec["effs"])
 
 	a := &GOAPAction{
 		spec:            spec,
@@ -97,18 +163,17 @@ func NewGOAPAction(spec map[string]any) *GOAPAction {
 		Count:           1,
 		cost:            cost,
 		pres:            NewGOAPTemporalGoal(pres),
-		preModalChecks:  make(map[string]func(ws *GOAPWorldState) int),               // set by GOAPEvaluator
-		effModalSetters: make(map[string]func(ws *GOAPWorldState, op string, x int)), // set by GOAPEvaluator
+		preModalChecks:  make(map[string]func(ws *GOAPWorldState) float64),               // set by GOAPEvaluator
+		effModalSetters: make(map[string]func(ws *GOAPWorldState, op string, x float64)), // set by GOAPEvaluator
 		effs:            make(map[string]*GOAPEff),
 		ops:             make(map[string]string),
 	}
 	for spec, val := range effs {
-		split := strings.Split(spec, ",")
-		varName, op := split[0], split[1]
+		varName, op := splitGOAPVarOp(spec)
 		eff := &GOAPEff{
 			val: val,
 			op:  op,
-			f:   GOAPEffFunc(op, val),
+			f:   GOAPEffFloatFunc(op, val),
 		}
 		a.effs[varName] = eff
 		a.ops[varName] = op
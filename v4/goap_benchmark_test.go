@@ -502,6 +502,16 @@ BenchmarkGOAPFarmer2000-8   	    7519	    153100 ns/op
 ok  	github.com/dt-rush/sameriver/v4	13.348s
 */
 func BenchmarkGOAPFarmer2000(b *testing.B) {
+	benchmarkGOAPFarmer2000(b, nil)
+}
+
+// the same, the planner using a plan cache (so that every plan after the
+// first is a hit, as it would be for many farmers tilling the same way)
+func BenchmarkGOAPFarmer2000Cached(b *testing.B) {
+	benchmarkGOAPFarmer2000(b, NewGOAPPlanCache())
+}
+
+func benchmarkGOAPFarmer2000(b *testing.B, cache *GOAPPlanCache) {
 	//
 	// world init
 	//
@@ -742,6 +752,7 @@ func BenchmarkGOAPFarmer2000(b *testing.B) {
 	})
 	p.AddModalVals(oxInFieldModal, hasYokeModal, fieldTilledModal)
 	p.AddActions(leadOxToField, getYoke, yokeOxplow, oxplow)
+	p.Cache = cache
 
 	//
 	// bb workplan
@@ -0,0 +1,871 @@
+package sameriver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+/*
+GOAP domains: the actions, goals and entity selectors of a GOAP agent as
+data. Only JSON is supported (there's no YAML parser among our
+dependencies; convert YAML to JSON first):
+
+	{
+		"selectors": {
+			"tree": "HasTag(tree)"
+		},
+		"bind": {
+			"ox": "mind.ox"
+		},
+		"actions": [
+			{
+				"name": "chopTree",
+				"node": "tree",
+				"cost": 1,
+				"otherNodes": [],
+				"travelWithNode": false,
+				"pres": {"self.hasAxe,=": 1},
+				"effs": {"tree.chopped,=": 1, "self.hasWood,+": 1}
+			}
+		],
+		"goals": {
+			"getWood": {"self.hasWood,>=": 1}
+		},
+		"samples": [
+			{
+				"name": "chop with an axe",
+				"goal": "getWood",
+				"entity": {"position": [0, 0], "state": {"hasAxe": 1, "hasWood": 0}},
+				"world": [{"position": [0, 10], "box": [2, 2], "tags": ["tree"], "state": {"chopped": 0}}],
+				"start": {"self.hasWood": 0},
+				"expect": ["chopTree"]
+			},
+			{
+				"name": "no trees",
+				"goal": "getWood",
+				"entity": {"position": [0, 0], "state": {"hasAxe": 1, "hasWood": 0}},
+				"expectNoPlan": true
+			}
+		]
+	}
+
+selectors are the generic entity selectors (RegisterGenericEntitySelectors())
+as EFDSL predicate expressions, evaluated for the planning entity (self);
+bind are the bound selectors (BindEntitySelectors()) as blackboard
+references. methods (eg. ["hp"]) names the modal methods the var names use
+beyond the built-in ones (inventoryHas, in); being Go functions, they're
+given to the domain as ModalMethods after loading. An action's cost is any
+non-negative number (0 if omitted). Pres, effs and goals are as given to
+NewGOAPAction() and NewGOAPTemporalGoal(): an object of "varName,op": number
+(whole numbers being compared as ints), or [a, b] for the range ops "[]",
+"[)", "(]" and "()", or an array of such objects for temporal goals. The
+samples are start states the domain should plan from (see CheckSamples(),
+and the sameriver-goap-validate command).
+*/
+
+// GOAPDomain is a loaded GOAP domain (see the format above). Its actions
+// are kept as specs, since each planner needs its own GOAPActions; see
+// NewPlanner() and AddTo().
+type GOAPDomain struct {
+	Selectors map[string]string
+	Bind      map[string]string
+	// the names of the custom modal methods declared
+	Methods []string
+	Actions []map[string]any
+	Goals   map[string]any
+	Samples []*GOAPDomainSample
+	// the custom modal methods, registered on planners by AddTo() (set
+	// these after loading; the domain only declares their names)
+	ModalMethods []*GOAPModalMethod
+
+	selectorASTs map[string]*Node
+}
+
+// GOAPDomainSample is a start state to check that the domain plans from
+type GOAPDomainSample struct {
+	Name string
+	// the goal (by name) to plan for
+	Goal string
+	// the planning entity, and the other entities in the world, as
+	// {"position": [x, y], "box": [w, h], "state": {...}, "tags": [...]}
+	Entity map[string]any
+	World  []map[string]any
+	// the symbolic start state
+	Start map[string]float64
+	// if given, the names of the actions the plan should consist of
+	Expect []string
+	// if the domain should find no plan
+	ExpectNoPlan bool
+	MaxIter      int
+}
+
+// GOAPDomainProblem is a validation failure at a field of the domain, eg.
+// actions[2].effs["hasWood,+="]
+type GOAPDomainProblem struct {
+	Field string
+	Msg   string
+}
+
+// GOAPDomainError is every problem found validating a domain
+type GOAPDomainError struct {
+	Problems []GOAPDomainProblem
+}
+
+func (e *GOAPDomainError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = fmt.Sprintf("%s: %s", p.Field, p.Msg)
+	}
+	return fmt.Sprintf("invalid GOAP domain:\n\t%s", strings.Join(lines, "\n\t"))
+}
+
+// LoadGOAPDomainFile loads a domain from a JSON file (only JSON is
+// supported), panicking if it's invalid
+func LoadGOAPDomainFile(filename string) *GOAPDomain {
+	Logger.Printf("Loading GOAP domain from %s...", filename)
+	jsonFile, err := os.Open(filename)
+	if err != nil {
+		panic(fmt.Sprintf("Trying to open %s - doesn't exist", filename))
+	}
+	defer jsonFile.Close()
+	contents, err := io.ReadAll(jsonFile)
+	if err != nil {
+		panic(err)
+	}
+	d, err := ParseGOAPDomainJSON(contents)
+	if err != nil {
+		panic(fmt.Sprintf("%s: %s", filename, err))
+	}
+	return d
+}
+
+// ParseGOAPDomainJSON parses and validates a domain, giving a
+// *GOAPDomainError listing every problem found if it's invalid
+func ParseGOAPDomainJSON(jsonStr []byte) (*GOAPDomain, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(jsonStr, &raw); err != nil {
+		return nil, err
+	}
+	v := &goapDomainValidator{
+		d: &GOAPDomain{
+			Selectors:    make(map[string]string),
+			Bind:         make(map[string]string),
+			Methods:      make([]string, 0),
+			Actions:      make([]map[string]any, 0),
+			Goals:        make(map[string]any),
+			Samples:      make([]*GOAPDomainSample, 0),
+			selectorASTs: make(map[string]*Node),
+		},
+	}
+	v.domain(raw)
+	if len(v.problems) > 0 {
+		sort.SliceStable(v.problems, func(i, j int) bool {
+			return v.problems[i].Field < v.problems[j].Field
+		})
+		return nil, &GOAPDomainError{Problems: v.problems}
+	}
+	return v.d, nil
+}
+
+type goapDomainValidator struct {
+	d        *GOAPDomain
+	problems []GOAPDomainProblem
+}
+
+func (v *goapDomainValidator) problem(field, format string, args ...any) {
+	v.problems = append(v.problems, GOAPDomainProblem{
+		Field: field,
+		Msg:   fmt.Sprintf(format, args...),
+	})
+}
+
+// checks that obj has only the keys allowed
+func (v *goapDomainValidator) keys(field string, obj map[string]any, allowed ...string) {
+	for k := range obj {
+		found := false
+		for _, a := range allowed {
+			if k == a {
+				found = true
+			}
+		}
+		if !found {
+			v.problem(goapDomainField(field, k), "unknown field (expected one of %s)", strings.Join(allowed, ", "))
+		}
+	}
+}
+
+func goapDomainField(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+func goapDomainIndexField(parent string, i int) string {
+	return fmt.Sprintf("%s[%d]", parent, i)
+}
+
+func goapDomainKeyField(parent, key string) string {
+	return fmt.Sprintf("%s[%q]", parent, key)
+}
+
+func (v *goapDomainValidator) object(field string, x any) (map[string]any, bool) {
+	obj, ok := x.(map[string]any)
+	if !ok {
+		v.problem(field, "should be an object, got %s", goapDomainJSONType(x))
+	}
+	return obj, ok
+}
+
+func (v *goapDomainValidator) array(field string, x any) ([]any, bool) {
+	arr, ok := x.([]any)
+	if !ok {
+		v.problem(field, "should be an array, got %s", goapDomainJSONType(x))
+	}
+	return arr, ok
+}
+
+func (v *goapDomainValidator) str(field string, x any) (string, bool) {
+	s, ok := x.(string)
+	if !ok || s == "" {
+		v.problem(field, "should be a non-empty string, got %s", goapDomainJSONType(x))
+	}
+	return s, ok && s != ""
+}
+
+func (v *goapDomainValidator) integer(field string, x any) (int, bool) {
+	f, ok := x.(float64)
+	if !ok || f != math.Trunc(f) {
+		v.problem(field, "should be an integer, got %s", goapDomainJSONType(x))
+		return 0, false
+	}
+	return int(f), true
+}
+
+func (v *goapDomainValidator) float(field string, x any) (float64, bool) {
+	f, ok := x.(float64)
+	if !ok {
+		v.problem(field, "should be a number, got %s", goapDomainJSONType(x))
+		return 0, false
+	}
+	return f, true
+}
+
+// a JSON number, as an int if it's whole (ints being compared as whole
+// numbers in goals) else a float64
+func (v *goapDomainValidator) number(field string, x any) (any, bool) {
+	f, ok := x.(float64)
+	if !ok {
+		v.problem(field, "should be a number, got %s", goapDomainJSONType(x))
+		return 0, false
+	}
+	if f == math.Trunc(f) && math.Abs(f) < math.MaxInt32 {
+		return int(f), true
+	}
+	return f, true
+}
+
+func (v *goapDomainValidator) strings(field string, x any) ([]string, bool) {
+	arr, ok := v.array(field, x)
+	if !ok {
+		return nil, false
+	}
+	result := make([]string, 0, len(arr))
+	for i, el := range arr {
+		if s, ok := v.str(goapDomainIndexField(field, i), el); ok {
+			result = append(result, s)
+		}
+	}
+	return result, len(result) == len(arr)
+}
+
+func goapDomainJSONType(x any) string {
+	switch x := x.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "an object"
+	case []any:
+		return "an array"
+	case string:
+		return fmt.Sprintf("string %q", x)
+	case float64:
+		return fmt.Sprintf("number %v", x)
+	case bool:
+		return fmt.Sprintf("%v", x)
+	}
+	return fmt.Sprintf("%T", x)
+}
+
+func (v *goapDomainValidator) domain(raw map[string]any) {
+	v.keys("", raw, "selectors", "bind", "methods", "actions", "goals", "samples")
+	if selectors, ok := raw["selectors"]; ok {
+		v.selectors(selectors)
+	}
+	if bind, ok := raw["bind"]; ok {
+		v.bind(bind)
+	}
+	if methods, ok := raw["methods"]; ok {
+		v.methods(methods)
+	}
+	if actions, ok := raw["actions"]; ok {
+		v.actions(actions)
+	} else {
+		v.problem("actions", "missing")
+	}
+	if goals, ok := raw["goals"]; ok {
+		v.goals(goals)
+	}
+	if samples, ok := raw["samples"]; ok {
+		v.samples(samples)
+	}
+}
+
+func (v *goapDomainValidator) selectors(x any) {
+	obj, ok := v.object("selectors", x)
+	if !ok {
+		return
+	}
+	for node, exprX := range obj {
+		field := goapDomainKeyField("selectors", node)
+		expr, ok := v.str(field, exprX)
+		if !ok {
+			continue
+		}
+		ast, err := goapDomainSelectorAST(node, expr)
+		if err != nil {
+			v.problem(field, "%s", err)
+			continue
+		}
+		v.d.Selectors[node] = expr
+		v.d.selectorASTs[node] = ast
+	}
+}
+
+// parses and checks a selector's EFDSL expression (btEFDSLExpr() panics on
+// a bad one; we want it as a problem)
+func goapDomainSelectorAST(node, expr string) (ast *Node, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return btEFDSLExpr("selector "+node, expr), nil
+}
+
+func (v *goapDomainValidator) bind(x any) {
+	obj, ok := v.object("bind", x)
+	if !ok {
+		return
+	}
+	for node, refX := range obj {
+		field := goapDomainKeyField("bind", node)
+		ref, ok := v.str(field, refX)
+		if !ok {
+			continue
+		}
+		if len(strings.SplitN(ref, ".", 2)) != 2 {
+			v.problem(field, "should be a blackboard reference like mind.key, got %q", ref)
+			continue
+		}
+		v.d.Bind[node] = ref
+	}
+}
+
+func (v *goapDomainValidator) methods(x any) {
+	names, _ := v.strings("methods", x)
+	v.d.Methods = append(v.d.Methods, names...)
+}
+
+// whether method is a modal method a var may use
+func (v *goapDomainValidator) methodDeclared(method string) bool {
+	if GOAPBuiltinModalMethod(method) {
+		return true
+	}
+	for _, name := range v.d.Methods {
+		if name == method {
+			return true
+		}
+	}
+	return false
+}
+
+// whether node is one an action or var may use
+func (v *goapDomainValidator) nodeDeclared(node string) bool {
+	if node == "self" {
+		return true
+	}
+	_, generic := v.d.Selectors[node]
+	_, bound := v.d.Bind[node]
+	return generic || bound
+}
+
+func (v *goapDomainValidator) node(field, node string) {
+	if !v.nodeDeclared(node) {
+		v.problem(field, "node %q has no selector (declare it in selectors or bind, or use self)", node)
+	}
+}
+
+var goapDomainEffOps = []string{"+", "-", "=", "*"}
+var goapDomainGoalOps = []string{"<", "<=", "=", ">=", ">", "[]", "[)", "(]", "()"}
+
+// checks a "varName,op" key, giving its var name and op
+func (v *goapDomainValidator) varOp(field, key string, ops []string) (varName, op string, ok bool) {
+	spec := key
+	if strings.HasPrefix(spec, "EACH:") {
+		spec = strings.TrimPrefix(spec, "EACH:")
+	}
+	ix := strings.LastIndex(spec, ",")
+	if ix < 0 {
+		v.problem(field, "should be varName,op")
+		return "", "", false
+	}
+	varName, op = spec[:ix], spec[ix+1:]
+	valid := false
+	for _, o := range ops {
+		if op == o {
+			valid = true
+		}
+	}
+	if !valid {
+		v.problem(field, "unknown op %q [valid: %s]", op, strings.Join(ops, ","))
+		return "", "", false
+	}
+	return varName, op, v.varName(field, varName)
+}
+
+// checks the nodes and methods in a var name
+func (v *goapDomainValidator) varName(field, varName string) bool {
+	if varName == "" {
+		v.problem(field, "empty var name")
+		return false
+	}
+	if matches := METHOD_NOTATION_RE.FindStringSubmatch(varName); matches != nil {
+		if !v.methodDeclared(matches[2]) {
+			v.problem(field, "unknown modal method %s (declare it in methods)", matches[2])
+			return false
+		}
+		v.node(field, matches[1])
+		return true
+	}
+	if parts := strings.SplitN(varName, ".", 2); len(parts) == 2 {
+		v.node(field, parts[0])
+	}
+	return true
+}
+
+// checks an object of "varName,op": number (or [a, b] for range ops),
+// giving it as a map[string]any
+func (v *goapDomainValidator) varOpMap(field string, x any, ops []string) (map[string]any, bool) {
+	obj, ok := v.object(field, x)
+	if !ok {
+		return nil, false
+	}
+	result := make(map[string]any)
+	valid := true
+	for key, valX := range obj {
+		keyField := goapDomainKeyField(field, key)
+		_, op, okKey := v.varOp(keyField, key, ops)
+		var val any
+		okVal := false
+		if okKey && isNumericRangeOp(op) {
+			val, okVal = v.numberRange(keyField, valX)
+		} else {
+			val, okVal = v.number(keyField, valX)
+		}
+		if okKey && okVal {
+			result[key] = val
+		} else {
+			valid = false
+		}
+	}
+	return result, valid
+}
+
+// checks a range [a, b] (a <= b)
+func (v *goapDomainValidator) numberRange(field string, x any) ([]any, bool) {
+	arr, ok := x.([]any)
+	if !ok || len(arr) != 2 {
+		v.problem(field, "should be a range [a, b], got %s", goapDomainJSONType(x))
+		return nil, false
+	}
+	a, okA := v.number(field, arr[0])
+	b, okB := v.number(field, arr[1])
+	if !okA || !okB {
+		return nil, false
+	}
+	if arr[0].(float64) > arr[1].(float64) {
+		v.problem(field, "range [%v, %v] is empty", a, b)
+		return nil, false
+	}
+	return []any{a, b}, true
+}
+
+// checks a (possibly temporal) goal, giving it in the form
+// NewGOAPTemporalGoal() takes
+func (v *goapDomainValidator) goal(field string, x any) (any, bool) {
+	if x == nil {
+		return nil, true
+	}
+	if arr, isArr := x.([]any); isArr {
+		result := make([]any, 0, len(arr))
+		valid := true
+		for i, el := range arr {
+			m, ok := v.varOpMap(goapDomainIndexField(field, i), el, goapDomainGoalOps)
+			valid = valid && ok
+			result = append(result, m)
+		}
+		return result, valid
+	}
+	return v.varOpMap(field, x, goapDomainGoalOps)
+}
+
+func (v *goapDomainValidator) actions(x any) {
+	arr, ok := v.array("actions", x)
+	if !ok {
+		return
+	}
+	names := make(map[string]int)
+	for i, actionX := range arr {
+		field := goapDomainIndexField("actions", i)
+		obj, ok := v.object(field, actionX)
+		if !ok {
+			continue
+		}
+		v.keys(field, obj, "name", "node", "cost", "otherNodes", "travelWithNode", "pres", "effs")
+		spec := make(map[string]any)
+		valid := true
+		name, okName := v.str(goapDomainField(field, "name"), obj["name"])
+		if okName {
+			if j, dup := names[name]; dup {
+				v.problem(goapDomainField(field, "name"), "duplicate action %s (also actions[%d])", name, j)
+				valid = false
+			}
+			names[name] = i
+			spec["name"] = name
+		}
+		node, okNode := v.str(goapDomainField(field, "node"), obj["node"])
+		if okNode {
+			v.node(goapDomainField(field, "node"), node)
+			spec["node"] = node
+		}
+		valid = valid && okName && okNode
+		cost := 0.0
+		if costX, ok := obj["cost"]; ok {
+			var okCost bool
+			cost, okCost = v.float(goapDomainField(field, "cost"), costX)
+			if okCost && cost < 0 {
+				v.problem(goapDomainField(field, "cost"), "should not be negative")
+				okCost = false
+			}
+			valid = valid && okCost
+		}
+		spec["cost"] = cost
+		if otherX, ok := obj["otherNodes"]; ok {
+			otherField := goapDomainField(field, "otherNodes")
+			others, okOthers := v.strings(otherField, otherX)
+			for j, other := range others {
+				v.node(goapDomainIndexField(otherField, j), other)
+			}
+			spec["otherNodes"] = others
+			valid = valid && okOthers
+		}
+		if travelX, ok := obj["travelWithNode"]; ok {
+			travel, okTravel := travelX.(bool)
+			if !okTravel {
+				v.problem(goapDomainField(field, "travelWithNode"), "should be a bool, got %s", goapDomainJSONType(travelX))
+			}
+			spec["travelWithNode"] = travel
+			valid = valid && okTravel
+		}
+		pres, okPres := v.goal(goapDomainField(field, "pres"), obj["pres"])
+		spec["pres"] = pres
+		effsX, ok := obj["effs"]
+		if !ok {
+			v.problem(goapDomainField(field, "effs"), "missing")
+			continue
+		}
+		effs, okEffs := v.varOpMap(goapDomainField(field, "effs"), effsX, goapDomainEffOps)
+		if okEffs && len(effs) == 0 {
+			v.problem(goapDomainField(field, "effs"), "an action should have at least one eff")
+			okEffs = false
+		}
+		spec["effs"] = effs
+		if valid && okPres && okEffs {
+			v.d.Actions = append(v.d.Actions, spec)
+		}
+	}
+}
+
+func (v *goapDomainValidator) goals(x any) {
+	obj, ok := v.object("goals", x)
+	if !ok {
+		return
+	}
+	for name, goalX := range obj {
+		field := goapDomainKeyField("goals", name)
+		if goalX == nil {
+			v.problem(field, "should be an object or an array of objects")
+			continue
+		}
+		if goal, ok := v.goal(field, goalX); ok {
+			v.d.Goals[name] = goal
+		}
+	}
+}
+
+func (v *goapDomainValidator) samples(x any) {
+	arr, ok := v.array("samples", x)
+	if !ok {
+		return
+	}
+	for i, sampleX := range arr {
+		field := goapDomainIndexField("samples", i)
+		obj, ok := v.object(field, sampleX)
+		if !ok {
+			continue
+		}
+		v.keys(field, obj, "name", "goal", "entity", "world", "start", "expect", "expectNoPlan", "maxIter")
+		sample := &GOAPDomainSample{
+			Name:    fmt.Sprintf("sample %d", i),
+			World:   make([]map[string]any, 0),
+			Start:   make(map[string]float64),
+			MaxIter: 100,
+		}
+		valid := true
+		if nameX, ok := obj["name"]; ok {
+			sample.Name, ok = v.str(goapDomainField(field, "name"), nameX)
+			valid = valid && ok
+		}
+		goal, ok := v.str(goapDomainField(field, "goal"), obj["goal"])
+		if ok {
+			if _, exists := v.d.Goals[goal]; !exists {
+				v.problem(goapDomainField(field, "goal"), "no goal named %s", goal)
+				ok = false
+			}
+			sample.Goal = goal
+		}
+		valid = valid && ok
+		// (the entity defaults to one at the origin, with empty state)
+		entityX, ok := obj["entity"]
+		if !ok {
+			entityX = map[string]any{}
+		}
+		sample.Entity, ok = v.sampleEntity(goapDomainField(field, "entity"), entityX)
+		valid = valid && ok
+		if worldX, ok := obj["world"]; ok {
+			worldField := goapDomainField(field, "world")
+			if entities, ok := v.array(worldField, worldX); ok {
+				for j, entityX := range entities {
+					entity, ok := v.sampleEntity(goapDomainIndexField(worldField, j), entityX)
+					sample.World = append(sample.World, entity)
+					valid = valid && ok
+				}
+			} else {
+				valid = false
+			}
+		}
+		if startX, ok := obj["start"]; ok {
+			startField := goapDomainField(field, "start")
+			if start, ok := v.object(startField, startX); ok {
+				for varName, valX := range start {
+					varField := goapDomainKeyField(startField, varName)
+					okVar := v.varName(varField, varName)
+					val, okVal := valX.(float64)
+					if !okVal {
+						v.problem(varField, "should be a number, got %s", goapDomainJSONType(valX))
+					}
+					sample.Start[varName] = val
+					valid = valid && okVar && okVal
+				}
+			} else {
+				valid = false
+			}
+		}
+		if expectX, ok := obj["expect"]; ok {
+			sample.Expect, ok = v.strings(goapDomainField(field, "expect"), expectX)
+			valid = valid && ok
+		}
+		if noPlanX, ok := obj["expectNoPlan"]; ok {
+			sample.ExpectNoPlan, ok = noPlanX.(bool)
+			if !ok {
+				v.problem(goapDomainField(field, "expectNoPlan"), "should be a bool, got %s", goapDomainJSONType(noPlanX))
+			}
+			valid = valid && ok
+		}
+		if maxIterX, ok := obj["maxIter"]; ok {
+			sample.MaxIter, ok = v.integer(goapDomainField(field, "maxIter"), maxIterX)
+			valid = valid && ok
+		}
+		if valid {
+			v.d.Samples = append(v.d.Samples, sample)
+		}
+	}
+}
+
+// checks a sample entity, giving it as a spawn spec
+func (v *goapDomainValidator) sampleEntity(field string, x any) (map[string]any, bool) {
+	obj, ok := v.object(field, x)
+	if !ok {
+		return nil, false
+	}
+	v.keys(field, obj, "position", "box", "state", "tags")
+	components := map[ComponentID]any{
+		POSITION: Vec2D{0, 0},
+		BOX:      Vec2D{1, 1},
+		STATE:    map[string]int{},
+	}
+	spec := map[string]any{
+		"components": components,
+		"tags":       []string{},
+	}
+	valid := true
+	vec := func(key string, id ComponentID) {
+		x, ok := obj[key]
+		if !ok {
+			return
+		}
+		arr, ok := x.([]any)
+		if ok && len(arr) == 2 {
+			x, okX := arr[0].(float64)
+			y, okY := arr[1].(float64)
+			if okX && okY {
+				components[id] = Vec2D{x, y}
+				return
+			}
+		}
+		v.problem(goapDomainField(field, key), "should be [x, y], got %s", goapDomainJSONType(x))
+		valid = false
+	}
+	vec("position", POSITION)
+	vec("box", BOX)
+	if stateX, ok := obj["state"]; ok {
+		stateField := goapDomainField(field, "state")
+		if state, ok := v.object(stateField, stateX); ok {
+			intState := make(map[string]int)
+			for k, valX := range state {
+				val, ok := v.integer(goapDomainKeyField(stateField, k), valX)
+				intState[k] = val
+				valid = valid && ok
+			}
+			components[STATE] = intState
+		} else {
+			valid = false
+		}
+	}
+	if tagsX, ok := obj["tags"]; ok {
+		tags, ok := v.strings(goapDomainField(field, "tags"), tagsX)
+		spec["tags"] = tags
+		valid = valid && ok
+	}
+	return spec, valid
+}
+
+// AddTo sets up planner with the domain's modal methods, selectors and
+// (fresh copies of) its actions
+func (d *GOAPDomain) AddTo(p *GOAPPlanner) {
+	p.RegisterModalMethods(d.ModalMethods...)
+	selectors := make(map[string]func(*Entity) bool)
+	for node, ast := range d.selectorASTs {
+		ast := ast
+		selectors[node] = func(candidate *Entity) bool {
+			filter, _ := EFDSL.Evaluate(ast, &EntityResolver{e: p.e})
+			return filter(candidate)
+		}
+	}
+	p.RegisterGenericEntitySelectors(selectors)
+	if len(d.Bind) > 0 {
+		bind := make(map[string]any)
+		for node, ref := range d.Bind {
+			bind[node] = ref
+		}
+		p.BindEntitySelectors(bind)
+	}
+	for _, spec := range d.Actions {
+		p.AddActions(NewGOAPAction(spec))
+	}
+}
+
+// NewPlanner gives a planner for e with the domain added
+func (d *GOAPDomain) NewPlanner(e *Entity) *GOAPPlanner {
+	p := NewGOAPPlanner(e)
+	d.AddTo(p)
+	return p
+}
+
+// GOAPDomainSampleResult is the outcome of planning for a sample
+type GOAPDomainSampleResult struct {
+	Sample *GOAPDomainSample
+	// the actions planned (nil if no plan was found)
+	Plan []string
+	Cost float64
+	// why the sample failed (nil if it passed)
+	Err error
+}
+
+// CheckSamples plans for each of the domain's samples in a world of its
+// own, giving whether each found a plan (the one expected, if given)
+func (d *GOAPDomain) CheckSamples() []*GOAPDomainSampleResult {
+	results := make([]*GOAPDomainSampleResult, 0, len(d.Samples))
+	for _, sample := range d.Samples {
+		results = append(results, d.checkSample(sample))
+	}
+	return results
+}
+
+func (d *GOAPDomain) checkSample(sample *GOAPDomainSample) (result *GOAPDomainSampleResult) {
+	result = &GOAPDomainSampleResult{Sample: sample}
+	// (a domain that panics planning - eg. a modal method given bad params
+	// - fails the sample rather than the check)
+	defer func() {
+		if r := recover(); r != nil {
+			result.Err = fmt.Errorf("panicked planning: %v", r)
+		}
+	}()
+	w := NewWorld(map[string]any{
+		"width":  1024,
+		"height": 1024,
+	})
+	e := w.Spawn(sample.Entity)
+	for _, spec := range sample.World {
+		w.Spawn(spec)
+	}
+	p := d.NewPlanner(e)
+	start := NewGOAPWorldState(nil)
+	for varName, val := range sample.Start {
+		start.vals[varName] = val
+	}
+	path, ok := p.Plan(start, d.Goals[sample.Goal], sample.MaxIter)
+	if !ok {
+		if !sample.ExpectNoPlan {
+			result.Err = fmt.Errorf("%w %s", ErrGOAPNoPlan, sample.Goal)
+		}
+		return result
+	}
+	result.Plan = make([]string, len(path.path))
+	for i, a := range path.path {
+		result.Plan[i] = a.Name
+	}
+	result.Cost = path.cost
+	if sample.ExpectNoPlan {
+		result.Err = fmt.Errorf("expected no plan, got %v", result.Plan)
+	} else if sample.Expect != nil && strings.Join(result.Plan, ",") != strings.Join(sample.Expect, ",") {
+		result.Err = fmt.Errorf("expected plan %v, got %v", sample.Expect, result.Plan)
+	}
+	return result
+}
+
+// GoalNames gives the names of the domain's goals, sorted
+func (d *GOAPDomain) GoalNames() []string {
+	names := make([]string, 0, len(d.Goals))
+	for name := range d.Goals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,178 @@
+package sameriver
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGOAPDomainLoadFile(t *testing.T) {
+	d := LoadGOAPDomainFile("test_data/goap_domain.json")
+	assert.Equal(t, 2, len(d.Actions))
+	assert.Equal(t, []string{"getWood"}, d.GoalNames())
+	results := d.CheckSamples()
+	if len(results) != 3 {
+		t.Fatalf("should have checked 3 samples, got %d", len(results))
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			t.Fatalf("%s should have passed: %s", result.Sample.Name, result.Err)
+		}
+	}
+	assert.Equal(t, []string{"getAxe", "chopTree"}, results[1].Plan)
+	// with no trees about, the selector finds none
+	assert.Nil(t, results[2].Plan)
+
+	// a sample expecting the wrong plan fails
+	d.Samples[0].Expect = []string{"getAxe", "chopTree"}
+	if err := d.CheckSamples()[0].Err; err == nil {
+		t.Fatal("sample should have failed expecting the wrong plan")
+	}
+	d.Samples[2].ExpectNoPlan = false
+	if err := d.CheckSamples()[2].Err; !errors.Is(err, ErrGOAPNoPlan) {
+		t.Fatalf("sample should have failed to plan, got %v", err)
+	}
+}
+
+func TestGOAPDomainNewPlanner(t *testing.T) {
+	d := LoadGOAPDomainFile("test_data/goap_domain.json")
+	w := testingWorld()
+	e := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION: Vec2D{0, 0},
+			BOX:      Vec2D{1, 1},
+			STATE:    map[string]int{"hasAxe": 0, "hasWood": 0},
+		},
+	})
+	w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION: Vec2D{0, 10},
+			BOX:      Vec2D{2, 2},
+			STATE:    map[string]int{"chopped": 0},
+		},
+		"tags": []string{"tree"},
+	})
+	// each planner gets its own actions
+	p := d.NewPlanner(e)
+	q := d.NewPlanner(e)
+	if p.actions.set["chopTree"] == q.actions.set["chopTree"] {
+		t.Fatal("planners shouldn't share actions")
+	}
+	path, ok := p.Plan(NewGOAPWorldState(nil), d.Goals["getWood"], 50)
+	if !ok || len(path.path) != 2 {
+		t.Fatalf("should have planned to get an axe and chop, got %v", path)
+	}
+}
+
+func TestGOAPDomainValidation(t *testing.T) {
+	_, err := ParseGOAPDomainJSON([]byte(`{
+		"selectors": {"tree": "HasTag(tree) &&", "rock": "Fnord(1)"},
+		"actions": [
+			{"name": "chop", "node": "tree", "cost": -1.5, "effs": {"hasWood,+=": 1}},
+			{"name": "chop", "node": "axe", "effs": {"ox.hasWood,+": "one"}},
+			{"name": "sing", "node": "self", "effs": {}, "volume": 11},
+			{"name": "mine", "node": "self", "pres": [{"self.fnord(x),=": 1}], "effs": {"self.stone,+": 1}}
+		],
+		"goals": {"getWood": {"hasWood,>=": 1}},
+		"samples": [{"goal": "getStone", "entity": {"position": [0]}}]
+	}`))
+	var domainErr *GOAPDomainError
+	if !errors.As(err, &domainErr) {
+		t.Fatalf("should have given a GOAPDomainError, got %v", err)
+	}
+	fields := make([]string, 0)
+	for _, p := range domainErr.Problems {
+		fields = append(fields, p.Field)
+	}
+	assert.Equal(t, []string{
+		`actions[0].cost`,
+		`actions[0].effs["hasWood,+="]`,
+		`actions[0].node`,
+		`actions[1].effs["ox.hasWood,+"]`,
+		`actions[1].effs["ox.hasWood,+"]`,
+		`actions[1].name`,
+		`actions[1].node`,
+		`actions[2].effs`,
+		`actions[2].volume`,
+		`actions[3].pres[0]["self.fnord(x),="]`,
+		`samples[0].entity.position`,
+		`samples[0].goal`,
+		`selectors["rock"]`,
+		`selectors["tree"]`,
+	}, fields)
+	assert.Contains(t, err.Error(), `actions[0].effs["hasWood,+="]: unknown op "+="`)
+
+	assert.Panics(t, func() {
+		LoadGOAPDomainFile("test_data/nonexistent.json")
+	})
+}
+
+func TestGOAPDomainFloatsAndRanges(t *testing.T) {
+	d, err := ParseGOAPDomainJSON([]byte(`{
+		"actions": [
+			{"name": "eat", "node": "self", "cost": 0.5, "effs": {"hunger,-": 0.25}},
+			{"name": "rest", "node": "self", "cost": 1, "effs": {"energy,*": 2}}
+		],
+		"goals": {
+			"sated": {"hunger,[)": [0, 0.3]},
+			"rested": {"energy,>": 3}
+		},
+		"samples": [
+			{"goal": "sated", "start": {"hunger": 0.9}, "expect": ["eat"]},
+			{"goal": "rested", "start": {"energy": 1.5}, "expect": ["rest"]}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := d.CheckSamples()
+	for _, result := range results {
+		if result.Err != nil {
+			t.Fatalf("%s should have passed: %s", result.Sample.Name, result.Err)
+		}
+	}
+	assert.InDelta(t, 1.5, results[0].Cost, GOAP_EPSILON)
+	assert.InDelta(t, 2.0, results[1].Cost, GOAP_EPSILON)
+
+	_, err = ParseGOAPDomainJSON([]byte(`{
+		"actions": [{"name": "eat", "node": "self", "effs": {"hunger,-": 0.25}}],
+		"goals": {"empty": {"hunger,[]": [1, 0]}, "scalar": {"hunger,()": 1}}
+	}`))
+	var domainErr *GOAPDomainError
+	if !errors.As(err, &domainErr) {
+		t.Fatalf("should have given a GOAPDomainError, got %v", err)
+	}
+	assert.Equal(t, `goals["empty"]["hunger,[]"]`, domainErr.Problems[0].Field)
+	assert.Equal(t, `goals["scalar"]["hunger,()"]`, domainErr.Problems[1].Field)
+}
+
+func TestGOAPDomainModalMethods(t *testing.T) {
+	domain := `{
+		"methods": ["hp"],
+		"actions": [{"name": "heal", "node": "self", "cost": 1, "effs": {"self.hp(),+": 5}}],
+		"goals": {"healthy": {"self.hp(),>=": 10}},
+		"samples": [{"goal": "healthy", "entity": {"state": {"hp": 5}}, "expect": ["heal"]}]
+	}`
+	d, err := ParseGOAPDomainJSON([]byte(domain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the declared method is given to the planners once set
+	if err := d.CheckSamples()[0].Err; err == nil {
+		t.Fatal("the sample should have failed without hp given")
+	}
+	d.ModalMethods = []*GOAPModalMethod{testingGOAPModalHp}
+	if err := d.CheckSamples()[0].Err; err != nil {
+		t.Fatalf("the sample should have passed with hp given: %s", err)
+	}
+
+	// an undeclared one is a problem
+	_, err = ParseGOAPDomainJSON([]byte(strings.Replace(domain, `"methods": ["hp"],`, "", 1)))
+	var domainErr *GOAPDomainError
+	if !errors.As(err, &domainErr) {
+		t.Fatalf("should have given a GOAPDomainError, got %v", err)
+	}
+	assert.Contains(t, err.Error(), "unknown modal method hp")
+}
@@ -0,0 +1,844 @@
+package sameriver
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var ErrGOAPNoPlan = errors.New("no plan found for goal")
+var ErrGOAPTooManyReplans = errors.New("replanned too many times")
+var ErrGOAPPresNotMet = errors.New("action pres not met in the live world")
+var ErrGOAPEffsNotMet = errors.New("action effs not achieved in the live world")
+var ErrGOAPActionFailed = errors.New("action implementation failed")
+var ErrGOAPNodeDespawned = errors.New("bound node was despawned")
+var ErrGOAPGoalNotMet = errors.New("goal not met in the live world after plan")
+var ErrGOAPBlackboardChanged = errors.New("watched blackboard entry changed")
+
+type GOAPActionStatus int
+
+const (
+	GOAP_ACTION_RUNNING GOAPActionStatus = iota
+	GOAP_ACTION_SUCCEEDED
+	GOAP_ACTION_FAILED
+)
+
+// GOAPActionImpl is what actually performs a GOAPAction when a plan is
+// executed, registered in a GOAPActionRegistry under the action's name.
+// Either Tick is run every update until it stops returning
+// GOAP_ACTION_RUNNING, or, if Tree is set, a fresh behaviour tree from it is
+// run each update, its leaves being performed by the implementations
+// registered under their names, until it has nothing left to do. Actions
+// should produce their modal effects in the update they succeed, since the
+// effects are verified against the live world right then.
+type GOAPActionImpl struct {
+	// called when the action starts (optional)
+	Start func(ctx *GOAPActionContext)
+	// called every update while the action runs
+	Tick func(ctx *GOAPActionContext, dt_ms float64) GOAPActionStatus
+	// called if the action is interrupted before it finishes (optional)
+	Stop func(ctx *GOAPActionContext)
+	// builds the behaviour tree which performs the action (subtrees are
+	// looked up by name in the registry's BTRunner)
+	Tree func() *BehaviourTree
+}
+
+// GOAPActionContext is given to a GOAPActionImpl while it runs
+type GOAPActionContext struct {
+	Entity *Entity
+	Action *GOAPAction
+	// the entity bound to Action.Node when the plan was made
+	Node *Entity
+	// all the node bindings of the plan, by node name
+	Nodes map[string]*Entity
+	// scratch space for the implementation, fresh each run
+	State map[string]any
+	// ms the action has been running
+	Elapsed float64
+	// the leaf being performed, if the action is run by a behaviour tree
+	Leaf *BTNode
+}
+
+// GOAPActionRegistry maps GOAPAction names to their implementations
+type GOAPActionRegistry struct {
+	impls map[string]*GOAPActionImpl
+	// runner for actions implemented by behaviour trees; register shared
+	// subtrees in it
+	BT *BTRunner
+}
+
+func NewGOAPActionRegistry() *GOAPActionRegistry {
+	return &GOAPActionRegistry{
+		impls: make(map[string]*GOAPActionImpl),
+		BT:    NewBTRunner(),
+	}
+}
+
+func (r *GOAPActionRegistry) Register(name string, impl *GOAPActionImpl) {
+	r.impls[name] = impl
+}
+
+// RegisterTree registers an action performed by the behaviour trees that
+// tree builds
+func (r *GOAPActionRegistry) RegisterTree(name string, tree func() *BehaviourTree) {
+	r.impls[name] = &GOAPActionImpl{Tree: tree}
+}
+
+// RegisterSubtree makes tree available by name to the trees of actions
+func (r *GOAPActionRegistry) RegisterSubtree(tree *BehaviourTree) {
+	r.BT.trees[tree.Name] = tree
+}
+
+func (r *GOAPActionRegistry) Get(name string) *GOAPActionImpl {
+	impl, ok := r.impls[name]
+	if !ok {
+		panic(fmt.Sprintf("no implementation registered for GOAP action %s", name))
+	}
+	return impl
+}
+
+type GOAPExecutorStatus int
+
+const (
+	// no goal
+	GOAP_EXEC_IDLE GOAPExecutorStatus = iota
+	// a goal is set and will be planned for in the next update
+	GOAP_EXEC_PENDING
+	// a plan is being searched for (see GOAPPlanSession)
+	GOAP_EXEC_PLANNING
+	GOAP_EXEC_RUNNING
+	GOAP_EXEC_SUCCEEDED
+	GOAP_EXEC_FAILED
+)
+
+// GOAPExecutorEvent is the data of the events an executor publishes
+type GOAPExecutorEvent struct {
+	Entity   *Entity
+	Executor *GOAPExecutor
+	Plan     *GOAPPath
+	// the action concerned (nil for events about the whole plan)
+	Action *GOAPAction
+	// why the action or plan failed, or why we replanned
+	Err error
+}
+
+// a node which broke a plan, and until when the planner avoids it
+type goapNodeCooldown struct {
+	failures int
+	until    float64
+}
+
+// GOAPExecutor runs the plans its Planner makes for Goal, one action at a
+// time, via the implementations in Actions. It's put in an entity's GOAP
+// component to be updated by the GOAPSystem (or can be updated directly).
+//
+// Before each action starts (and, if MonitorPres, every update while it
+// runs) its pres are checked against the live world, using the node
+// bindings the plan was made with; when it succeeds, its modal effs are
+// checked likewise. If anything fails, the nodes the action was bound to are
+// put on a cooldown during which the planner won't select them (so that we
+// try another comparable node rather than the one which just broke the
+// plan), and we replan from the live world. A node which keeps failing is
+// cooled down for twice as long each time, up to MaxNodeCooldownMs, and is
+// forgiven once an action with it succeeds.
+//
+// If the Planner's Reservations is set, the nodes of a plan are claimed when
+// it's found (replanning if another agent claimed one first), renewed every
+// update, and released as soon as no remaining action needs them, or when
+// the plan ends.
+//
+// With ReplanOn(), we also replan when a blackboard entry we watch changes.
+//
+// If HTN is set, plans are made by it instead, Goal being the name of the
+// task it decomposes (see NewHTNExecutor()); the plan succeeding is the task
+// done, there being no goal state to check.
+//
+// Lifecycle events are published on Events: "goap-plan-started",
+// "goap-action-started", "goap-action-succeeded", "goap-action-failed",
+// "goap-replanned", "goap-plan-succeeded", "goap-plan-failed" and
+// "goap-plan-cancelled", each with a *GOAPExecutorEvent as data.
+type GOAPExecutor struct {
+	Entity  *Entity
+	Planner *GOAPPlanner
+	Actions *GOAPActionRegistry
+	// set by the GOAPSystem if nil
+	Events *EventBus
+
+	// the symbolic (non-modal) world state, planned from and updated with
+	// the effs of actions as they succeed
+	State *GOAPWorldState
+	Goal  any
+	// the most iterations a plan search may take
+	MaxIter int
+	// how many iterations of plan search each Update() runs (0 to plan to
+	// completion in one Update()); the GOAPSystem instead shares its
+	// PlanBudgetMs between the executors planning
+	PlanIterations int
+	// how many times we replan for a goal before giving up
+	MaxReplans int
+	// whether the running action's pres are checked every update
+	MonitorPres bool
+	// how long a node which broke a plan is avoided for the first time
+	NodeCooldownMs float64
+	// the longest a node is avoided for
+	MaxNodeCooldownMs float64
+	// the squad we plan in turn with, if any (see NewGOAPSquad())
+	Squad *GOAPSquad
+	// if set, plans by decomposing the task Goal names rather than
+	// searching (its GOAP should be our Planner)
+	HTN *HTNPlanner
+
+	Status GOAPExecutorStatus
+	Plan   *GOAPPath
+	// the index in the plan of the current action
+	Step int
+	// why we last failed (or replanned)
+	Err error
+
+	replans int
+	// the plan search running, and why it was started (nil for a new goal)
+	session      *GOAPPlanSession
+	replanReason error
+	// the node bindings of the plan
+	bindings map[string]*Entity
+	// the running action, its implementation, and its context
+	current *GOAPAction
+	impl    *GOAPActionImpl
+	ctx     *GOAPActionContext
+	// for tree-implemented actions: the tree, and the leaf running in it
+	tree     *BehaviourTree
+	leaf     *BTNode
+	leafImpl *GOAPActionImpl
+	leafCtx  *GOAPActionContext
+	// the live values of the current action's modal eff vars when it started
+	before map[string]float64
+	// the executor's clock, advanced by Update()
+	t         float64
+	cooldowns map[*Entity]*goapNodeCooldown
+	// the blackboard changes we replan on
+	watches []*EventChannel
+}
+
+func NewGOAPExecutor(e *Entity, planner *GOAPPlanner, actions *GOAPActionRegistry) *GOAPExecutor {
+	return &GOAPExecutor{
+		Entity:            e,
+		Planner:           planner,
+		Actions:           actions,
+		State:             NewGOAPWorldState(nil),
+		MaxIter:           500,
+		MaxReplans:        5,
+		MonitorPres:       true,
+		NodeCooldownMs:    5000,
+		MaxNodeCooldownMs: 60000,
+		cooldowns:         make(map[*Entity]*goapNodeCooldown),
+	}
+}
+
+// NewHTNExecutor makes an executor running the plans h decomposes, its
+// goals being task names
+func NewHTNExecutor(e *Entity, h *HTNPlanner, actions *GOAPActionRegistry) *GOAPExecutor {
+	x := NewGOAPExecutor(e, h.GOAP, actions)
+	x.HTN = h
+	return x
+}
+
+// SetGoal interrupts whatever we were doing and plans for goal (with ws as
+// the symbolic world state, or the current State if nil) in the next update
+func (x *GOAPExecutor) SetGoal(goal any, ws *GOAPWorldState) {
+	x.interrupt()
+	if ws != nil {
+		x.State = ws.CopyOf()
+	}
+	x.Goal = goal
+	x.Status = GOAP_EXEC_PENDING
+	x.Plan = nil
+	x.Err = nil
+	x.replans = 0
+	x.replanReason = nil
+}
+
+// Cancel interrupts the plan and drops the goal
+func (x *GOAPExecutor) Cancel() {
+	if x.Status == GOAP_EXEC_RUNNING || x.Status == GOAP_EXEC_PLANNING {
+		x.interrupt()
+		x.publish("goap-plan-cancelled", nil, nil)
+	}
+	x.releaseNodes()
+	x.Goal = nil
+	x.Status = GOAP_EXEC_IDLE
+}
+
+// ReplanOn makes us replan from the live world (interrupting the plan or
+// the plan search) whenever any of keys changes in b (any key, if none are
+// given), eg. when a threat is spotted; such replans don't count against
+// MaxReplans
+func (x *GOAPExecutor) ReplanOn(b *Blackboard, keys ...string) {
+	x.watches = append(x.watches, b.Subscribe(keys...))
+}
+
+// watchedChange gives the last change to the blackboard entries we watch
+// since we last looked (nil if none)
+func (x *GOAPExecutor) watchedChange() *BlackboardChange {
+	var change *BlackboardChange
+	for _, c := range x.watches {
+		for len(c.C) > 0 {
+			change = (<-c.C).Data.(*BlackboardChange)
+		}
+	}
+	return change
+}
+
+// Session is the plan search running (nil if none)
+func (x *GOAPExecutor) Session() *GOAPPlanSession {
+	return x.session
+}
+
+// CurrentAction is the action running (nil if none)
+func (x *GOAPExecutor) CurrentAction() *GOAPAction {
+	return x.current
+}
+
+// NodeCoolingDown is whether e is being avoided by the planner for having
+// broken a plan
+func (x *GOAPExecutor) NodeCoolingDown(e *Entity) bool {
+	c, ok := x.cooldowns[e]
+	return ok && c.until > x.t
+}
+
+func (x *GOAPExecutor) Update(dt_ms float64) {
+	x.advance(dt_ms)
+	if x.Status == GOAP_EXEC_PLANNING {
+		if x.PlanIterations > 0 {
+			x.stepPlanning(x.PlanIterations)
+		} else {
+			x.stepPlanning(math.MaxInt)
+		}
+	}
+}
+
+// advance moves the executor's clock and runs the plan, starting to plan if
+// a goal is pending (but doesn't step the plan search)
+func (x *GOAPExecutor) advance(dt_ms float64) {
+	x.t += dt_ms
+	change := x.watchedChange()
+	if change != nil && (x.Status == GOAP_EXEC_RUNNING || x.Status == GOAP_EXEC_PLANNING) {
+		x.interrupt()
+		x.Err = fmt.Errorf("%w: %s", ErrGOAPBlackboardChanged, change.Key)
+		x.startPlanning(x.Err)
+	}
+	switch x.Status {
+	case GOAP_EXEC_PENDING:
+		x.startPlanning(x.replanReason)
+	case GOAP_EXEC_RUNNING:
+		x.step(dt_ms)
+	}
+}
+
+func (x *GOAPExecutor) publish(eventType string, action *GOAPAction, err error) {
+	if x.Events == nil {
+		return
+	}
+	x.Events.Publish(eventType, &GOAPExecutorEvent{
+		Entity:   x.Entity,
+		Executor: x,
+		Plan:     x.Plan,
+		Action:   action,
+		Err:      err,
+	})
+}
+
+// startPlanning starts searching for a plan for the goal from the live
+// world, avoiding nodes cooling down; reason is why we're replanning (nil
+// for a new goal). In a squad, we wait (pending) for our turn.
+func (x *GOAPExecutor) startPlanning(reason error) {
+	x.releaseNodes()
+	x.replanReason = reason
+	if x.Squad != nil && !x.Squad.takeTurn(x) {
+		x.Status = GOAP_EXEC_PENDING
+		return
+	}
+	excluded := make(map[*Entity]bool)
+	for e, c := range x.cooldowns {
+		if e.Despawned {
+			delete(x.cooldowns, e)
+		} else if c.until > x.t {
+			excluded[e] = true
+		}
+	}
+	x.Planner.SetExcludedNodes(excluded)
+	if x.HTN != nil {
+		// (decomposition is quick, so done at once)
+		task, _ := x.Goal.(string)
+		plan, ok := x.HTN.Plan(x.State, task)
+		x.usePlan(plan, ok)
+		return
+	}
+	x.session = x.Planner.NewPlanSession(x.State, x.Goal, x.MaxIter)
+	x.Status = GOAP_EXEC_PLANNING
+}
+
+// stepPlanning runs up to n iterations of the plan search, starting the
+// plan if it's found
+func (x *GOAPExecutor) stepPlanning(n int) {
+	if x.session.Step(n) {
+		x.planned()
+	}
+}
+
+func (x *GOAPExecutor) planned() {
+	s := x.session
+	x.session = nil
+	plan, ok := s.Result()
+	x.usePlan(plan, ok)
+}
+
+// usePlan starts running plan, if one was found
+func (x *GOAPExecutor) usePlan(plan *GOAPPath, ok bool) {
+	x.Planner.SetExcludedNodes(nil)
+	if x.Squad != nil {
+		x.Squad.endTurn(x)
+	}
+	if !ok {
+		if x.HTN != nil {
+			x.fail(fmt.Errorf("%w: %v", ErrHTNNoDecomposition, x.Goal))
+		} else {
+			x.fail(fmt.Errorf("%w: %v", ErrGOAPNoPlan, x.Goal))
+		}
+		return
+	}
+	x.Plan = plan
+	x.Step = 0
+	// (bindings are inherited along the path, so the last state has them all)
+	x.bindings = make(map[string]*Entity)
+	for node, e := range plan.statesAlong[len(plan.statesAlong)-1].ModalEntities {
+		x.bindings[node] = e
+	}
+	// (another agent may have claimed a node while we were planning)
+	if err := x.claimNodes(); err != nil {
+		x.replan(err)
+		return
+	}
+	x.Status = GOAP_EXEC_RUNNING
+	if x.replanReason == nil {
+		x.publish("goap-plan-started", nil, nil)
+	} else {
+		x.publish("goap-replanned", nil, x.replanReason)
+	}
+}
+
+func (x *GOAPExecutor) replan(reason error) {
+	x.replans++
+	if x.replans > x.MaxReplans {
+		x.fail(fmt.Errorf("%w (%d): %v", ErrGOAPTooManyReplans, x.MaxReplans, reason))
+		return
+	}
+	x.Err = reason
+	x.startPlanning(reason)
+}
+
+func (x *GOAPExecutor) fail(err error) {
+	x.releaseNodes()
+	x.Status = GOAP_EXEC_FAILED
+	x.Err = err
+	x.publish("goap-plan-failed", nil, err)
+}
+
+func (x *GOAPExecutor) step(dt_ms float64) {
+	if x.current == nil {
+		if x.Step == len(x.Plan.path) {
+			x.finish()
+			return
+		}
+		if err := x.claimNodes(); err != nil {
+			x.actionFailed(err, nil)
+			return
+		}
+		if blamed, err := x.start(x.Plan.path[x.Step]); err != nil {
+			x.actionFailed(err, blamed)
+			return
+		}
+	}
+	a := x.current
+	if err := x.checkNodes(a); err != nil {
+		x.actionFailed(err, nil)
+		return
+	}
+	if err := x.claimNodes(); err != nil {
+		x.actionFailed(err, nil)
+		return
+	}
+	if x.MonitorPres && x.ctx.Elapsed > 0 {
+		if blamed, err := x.checkPres(a); err != nil {
+			x.actionFailed(err, blamed)
+			return
+		}
+	}
+	x.ctx.Elapsed += dt_ms
+	var status GOAPActionStatus
+	if x.tree != nil {
+		status = x.tickTree(dt_ms)
+	} else {
+		status = x.impl.Tick(x.ctx, dt_ms)
+	}
+	switch status {
+	case GOAP_ACTION_FAILED:
+		x.actionFailed(fmt.Errorf("%w: %s", ErrGOAPActionFailed, a.DisplayName()), x.nodesOf(a))
+	case GOAP_ACTION_SUCCEEDED:
+		if blamed, err := x.checkEffs(a); err != nil {
+			x.actionFailed(err, blamed)
+			return
+		}
+		x.actionSucceeded()
+	}
+}
+
+// start starts action a, if its pres are met
+func (x *GOAPExecutor) start(a *GOAPAction) (blamed []*Entity, err error) {
+	if err := x.checkNodes(a); err != nil {
+		return nil, err
+	}
+	if blamed, err := x.checkPres(a); err != nil {
+		return blamed, err
+	}
+	x.current = a
+	x.impl = x.Actions.Get(a.Name)
+	x.ctx = x.newContext(a)
+	x.before = make(map[string]float64)
+	for varName := range a.effs {
+		if val, ok := x.checkModal(varName); ok {
+			x.before[varName] = val
+		}
+	}
+	if x.impl.Tree != nil {
+		x.tree = x.impl.Tree()
+	}
+	if x.impl.Start != nil {
+		x.impl.Start(x.ctx)
+	}
+	x.publish("goap-action-started", a, nil)
+	return nil, nil
+}
+
+func (x *GOAPExecutor) newContext(a *GOAPAction) *GOAPActionContext {
+	return &GOAPActionContext{
+		Entity: x.Entity,
+		Action: a,
+		Node:   x.bindings[a.Node],
+		Nodes:  x.bindings,
+		State:  make(map[string]any),
+	}
+}
+
+// tickTree runs the current action's tree, performing the leaf it descends to
+func (x *GOAPExecutor) tickTree(dt_ms float64) GOAPActionStatus {
+	state := x.Actions.BT.ExecuteBT(x.Entity, x.tree)
+	// (the tree has nothing left to do once its root is complete)
+	if x.tree.Root.Complete {
+		if x.tree.Root.Status == BT_FAILURE {
+			return GOAP_ACTION_FAILED
+		}
+		return GOAP_ACTION_SUCCEEDED
+	}
+	if state == nil || state.Action == nil {
+		return GOAP_ACTION_FAILED
+	}
+	if state.Action != x.leaf {
+		x.stopLeaf()
+		x.leaf = state.Action
+		x.leafImpl = x.Actions.Get(x.leaf.Name)
+		x.leafCtx = x.newContext(x.current)
+		x.leafCtx.Leaf = x.leaf
+		if x.leafImpl.Start != nil {
+			x.leafImpl.Start(x.leafCtx)
+		}
+	}
+	x.leafCtx.Elapsed += dt_ms
+	switch x.leafImpl.Tick(x.leafCtx, dt_ms) {
+	case GOAP_ACTION_FAILED:
+		return GOAP_ACTION_FAILED
+	case GOAP_ACTION_SUCCEEDED:
+		x.leaf, x.leafImpl, x.leafCtx = nil, nil, nil
+		state.Action.Done()
+	}
+	return GOAP_ACTION_RUNNING
+}
+
+func (x *GOAPExecutor) stopLeaf() {
+	if x.leaf != nil && x.leafImpl.Stop != nil {
+		x.leafImpl.Stop(x.leafCtx)
+	}
+	x.leaf, x.leafImpl, x.leafCtx = nil, nil, nil
+}
+
+// interrupt stops the plan search or the running action, if any
+func (x *GOAPExecutor) interrupt() {
+	if x.session != nil {
+		x.session.Cancel()
+		x.session = nil
+		x.Planner.SetExcludedNodes(nil)
+		if x.Squad != nil {
+			x.Squad.endTurn(x)
+		}
+	}
+	if x.current == nil {
+		return
+	}
+	x.stopLeaf()
+	if x.impl.Stop != nil {
+		x.impl.Stop(x.ctx)
+	}
+	x.clearCurrent()
+}
+
+func (x *GOAPExecutor) clearCurrent() {
+	x.current, x.impl, x.ctx, x.tree, x.before = nil, nil, nil, nil, nil
+	x.leaf, x.leafImpl, x.leafCtx = nil, nil, nil
+}
+
+func (x *GOAPExecutor) actionSucceeded() {
+	a := x.current
+	for _, node := range x.nodesOf(a) {
+		delete(x.cooldowns, node)
+	}
+	// modal vars are read from the live world when planning, so only the
+	// symbolic ones are carried in State
+	for varName, eff := range a.effs {
+		if _, modal := x.Planner.modalVals[varName]; !modal {
+			x.State.vals[varName] = eff.f(a.Count, x.State.vals[varName])
+		}
+	}
+	x.clearCurrent()
+	x.Step++
+	x.publish("goap-action-succeeded", a, nil)
+}
+
+// actionFailed interrupts the action and replans, cooling down the nodes
+// blamed for the failure
+func (x *GOAPExecutor) actionFailed(err error, blamed []*Entity) {
+	a := x.Plan.path[x.Step]
+	x.interrupt()
+	for _, node := range blamed {
+		x.coolDown(node)
+	}
+	x.publish("goap-action-failed", a, err)
+	x.replan(err)
+}
+
+// coolDown makes the planner avoid node for a while, twice as long each
+// time it fails in a row
+func (x *GOAPExecutor) coolDown(node *Entity) {
+	c, ok := x.cooldowns[node]
+	if !ok {
+		c = &goapNodeCooldown{}
+		x.cooldowns[node] = c
+	}
+	c.failures++
+	cooldown := math.Min(
+		x.NodeCooldownMs*math.Pow(2, float64(c.failures-1)),
+		x.MaxNodeCooldownMs)
+	c.until = x.t + cooldown
+}
+
+// nodesOf gives the entities bound to a's nodes, other than ourselves
+func (x *GOAPExecutor) nodesOf(a *GOAPAction) []*Entity {
+	return x.boundNodes(append([]string{a.Node}, a.otherNodes...))
+}
+
+// nodesOfVars gives the entities bound to the nodes of the given modal
+// vars, other than ourselves
+func (x *GOAPExecutor) nodesOfVars(varNames []string) []*Entity {
+	names := make([]string, 0)
+	for _, varName := range varNames {
+		if modal, ok := x.Planner.modalVals[varName]; ok {
+			names = append(names, modal.nodes...)
+		}
+	}
+	return x.boundNodes(names)
+}
+
+func (x *GOAPExecutor) boundNodes(names []string) []*Entity {
+	nodes := make([]*Entity, 0, len(names))
+	seen := make(map[*Entity]bool)
+	for _, name := range names {
+		if e := x.bindings[name]; e != nil && e != x.Entity && !seen[e] {
+			seen[e] = true
+			nodes = append(nodes, e)
+		}
+	}
+	return nodes
+}
+
+// nodesNeededBy gives the entities bound to the nodes a is done with or
+// whose modal vars it looks at, other than ourselves
+func (x *GOAPExecutor) nodesNeededBy(a *GOAPAction) []*Entity {
+	names := append([]string{a.Node}, a.otherNodes...)
+	for _, g := range a.pres.temporalGoals {
+		for varName := range g.vars {
+			if modal, ok := x.Planner.modalVals[varName]; ok {
+				names = append(names, modal.nodes...)
+			}
+		}
+	}
+	for varName := range a.effs {
+		if modal, ok := x.Planner.modalVals[varName]; ok {
+			names = append(names, modal.nodes...)
+		}
+	}
+	return x.boundNodes(names)
+}
+
+// claimNodes claims (or renews our claims on) the nodes needed by the
+// plan's remaining actions, releasing those no longer needed
+func (x *GOAPExecutor) claimNodes() error {
+	r := x.Planner.Reservations
+	if r == nil {
+		return nil
+	}
+	needed := make(map[*Entity]bool)
+	for _, a := range x.Plan.path[x.Step:] {
+		for _, node := range x.nodesNeededBy(a) {
+			needed[node] = true
+		}
+	}
+	for _, e := range x.bindings {
+		if !needed[e] {
+			r.Release(x.Entity, e)
+		}
+	}
+	for node := range needed {
+		if !r.Claim(x.Entity, node) {
+			return fmt.Errorf("%w: %v", ErrGOAPNodeReserved, node)
+		}
+	}
+	return nil
+}
+
+// releaseNodes releases our claims on the plan's nodes
+func (x *GOAPExecutor) releaseNodes() {
+	r := x.Planner.Reservations
+	if r == nil {
+		return
+	}
+	for _, e := range x.bindings {
+		r.Release(x.Entity, e)
+	}
+}
+
+func (x *GOAPExecutor) checkNodes(a *GOAPAction) error {
+	for _, name := range append([]string{a.Node}, a.otherNodes...) {
+		if e := x.bindings[name]; e != nil && e.Despawned {
+			return fmt.Errorf("%w: %s", ErrGOAPNodeDespawned, name)
+		}
+	}
+	return nil
+}
+
+func (x *GOAPExecutor) finish() {
+	if !x.goalFulfilled() {
+		x.replan(ErrGOAPGoalNotMet)
+		return
+	}
+	x.releaseNodes()
+	x.Status = GOAP_EXEC_SUCCEEDED
+	x.publish("goap-plan-succeeded", nil, nil)
+}
+
+// liveState is a worldstate over the live world with the symbolic State's
+// vals and the plan's node bindings
+func (x *GOAPExecutor) liveState() *GOAPWorldState {
+	ws := x.State.CopyOf()
+	ws.w = x.Entity.World
+	ws.modal = make(map[string]any)
+	ws.ModalEntities = make(map[string]*Entity)
+	for node, e := range x.bindings {
+		ws.ModalEntities[node] = e
+	}
+	ws.ModalEntities["self"] = x.Entity
+	return ws
+}
+
+// checkModal evaluates a modal var against the live world, if it's modal
+// and its nodes are bound
+func (x *GOAPExecutor) checkModal(varName string) (float64, bool) {
+	modal, ok := x.Planner.modalVals[varName]
+	if !ok {
+		return 0, false
+	}
+	ws := x.liveState()
+	for _, node := range modal.nodes {
+		if ws.ModalEntities[node] == nil {
+			return 0, false
+		}
+	}
+	return modal.value(ws), true
+}
+
+// withLiveVals gives the live state with the vars of tg's goals set: modal
+// ones checked against the live world, and missing symbolic ones defaulting
+// to 0 as they do when planning
+func (x *GOAPExecutor) withLiveVals(tg *GOAPTemporalGoal) *GOAPWorldState {
+	ws := x.liveState()
+	for _, g := range tg.temporalGoals {
+		for varName := range g.vars {
+			if val, ok := x.checkModal(varName); ok {
+				ws.vals[varName] = val
+			} else if _, ok := ws.vals[varName]; !ok {
+				ws.vals[varName] = 0
+			}
+		}
+	}
+	return ws
+}
+
+// unmetPres gives the vars of a's pres which aren't met in the live world
+func (x *GOAPExecutor) unmetPres(a *GOAPAction) []string {
+	ws := x.withLiveVals(a.pres)
+	unmet := make([]string, 0)
+	for _, g := range a.pres.temporalGoals {
+		for varName := range g.remaining(ws).goalLeft {
+			unmet = append(unmet, varName)
+		}
+	}
+	return unmet
+}
+
+// checkPres gives an error blaming the nodes of the unmet pres of a, if any
+func (x *GOAPExecutor) checkPres(a *GOAPAction) (blamed []*Entity, err error) {
+	unmet := x.unmetPres(a)
+	if len(unmet) == 0 {
+		return nil, nil
+	}
+	return x.nodesOfVars(unmet),
+		fmt.Errorf("%w for %s: %v", ErrGOAPPresNotMet, a.DisplayName(), unmet)
+}
+
+// checkEffs gives an error blaming the nodes of the modal effs of a which
+// weren't achieved, if any
+func (x *GOAPExecutor) checkEffs(a *GOAPAction) (blamed []*Entity, err error) {
+	unmet := make([]string, 0)
+	for varName, before := range x.before {
+		want := a.effs[varName].f(a.Count, before)
+		if got, _ := x.checkModal(varName); math.Abs(got-want) > GOAP_EPSILON {
+			unmet = append(unmet, varName)
+		}
+	}
+	if len(unmet) == 0 {
+		return nil, nil
+	}
+	return x.nodesOfVars(unmet),
+		fmt.Errorf("%w for %s: %v", ErrGOAPEffsNotMet, a.DisplayName(), unmet)
+}
+
+func (x *GOAPExecutor) goalFulfilled() bool {
+	if x.HTN != nil {
+		return true
+	}
+	goal := NewGOAPTemporalGoal(x.Goal)
+	ws := x.withLiveVals(goal)
+	for _, g := range goal.temporalGoals {
+		if len(g.remaining(ws).goalLeft) != 0 {
+			return false
+		}
+	}
+	return true
+}
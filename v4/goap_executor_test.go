@@ -0,0 +1,314 @@
+package sameriver
+
+import (
+	"errors"
+	"testing"
+)
+
+// a villager and two trees (the nearer one rotten), with a planner which
+// can chop a tree and an executor for it in the villager's GOAP
+func testingGOAPExecutorWorld() (
+	w *World, s *GOAPSystem, rotten, sound *Entity, x *GOAPExecutor) {
+
+	w = testingWorld()
+	s = NewGOAPSystem()
+	w.RegisterSystems(s)
+	e := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION: Vec2D{0, 0},
+			BOX:      Vec2D{1, 1},
+			STATE: map[string]int{
+				"hasAxe": 1,
+			},
+			GOAP: nil,
+		},
+	})
+	spawnTree := func(pos Vec2D, tags []string) *Entity {
+		return w.Spawn(map[string]any{
+			"components": map[ComponentID]any{
+				POSITION: pos,
+				BOX:      Vec2D{2, 2},
+				STATE: map[string]int{
+					"chopped": 0,
+				},
+			},
+			"tags": append(tags, "tree"),
+		})
+	}
+	rotten = spawnTree(Vec2D{0, 10}, []string{"rotten"})
+	sound = spawnTree(Vec2D{0, 50}, nil)
+
+	chopTree := NewGOAPAction(map[string]any{
+		"name": "chopTree",
+		"node": "tree",
+		"cost": 1,
+		"pres": map[string]int{
+			"self.hasAxe,=": 1,
+		},
+		"effs": map[string]int{
+			"tree.chopped,=": 1,
+		},
+	})
+	getAxe := NewGOAPAction(map[string]any{
+		"name": "getAxe",
+		"node": "self",
+		"cost": 1,
+		"pres": nil,
+		"effs": map[string]int{
+			"self.hasAxe,=": 1,
+		},
+	})
+	p := NewGOAPPlanner(e)
+	p.RegisterGenericEntitySelectors(map[string]func(*Entity) bool{
+		"tree": func(candidate *Entity) bool {
+			return candidate.HasTag("tree")
+		},
+	})
+	p.AddActions(getAxe, chopTree)
+
+	actions := NewGOAPActionRegistry()
+	actions.Register("getAxe", &GOAPActionImpl{
+		Tick: func(ctx *GOAPActionContext, dt_ms float64) GOAPActionStatus {
+			ctx.Entity.GetIntMap(STATE).Set("hasAxe", 1)
+			return GOAP_ACTION_SUCCEEDED
+		},
+	})
+	actions.Register("chopTree", &GOAPActionImpl{
+		Tick: func(ctx *GOAPActionContext, dt_ms float64) GOAPActionStatus {
+			if ctx.Node.HasTag("rotten") {
+				return GOAP_ACTION_FAILED
+			}
+			if ctx.Elapsed < 50 {
+				return GOAP_ACTION_RUNNING
+			}
+			ctx.Node.GetIntMap(STATE).Set("chopped", 1)
+			return GOAP_ACTION_SUCCEEDED
+		},
+	})
+	x = NewGOAPExecutor(e, p, actions)
+	x.Events = s.Events
+	e.SetGeneric(GOAP, x)
+	return w, s, rotten, sound, x
+}
+
+var goapExecutorEventTypes = []string{
+	"goap-plan-started", "goap-action-started", "goap-action-succeeded",
+	"goap-action-failed", "goap-replanned", "goap-plan-succeeded",
+	"goap-plan-failed", "goap-plan-cancelled",
+}
+
+// updates x until it's done (or n times), counting the events it published
+// by type
+func testingRunGOAPExecutor(x *GOAPExecutor, n int) map[string]int {
+	channels := make(map[string]*EventChannel)
+	for _, eventType := range goapExecutorEventTypes {
+		channels[eventType] = x.Events.Subscribe(SimpleEventFilter(eventType))
+	}
+	for i := 0; i < n && x.Status != GOAP_EXEC_SUCCEEDED && x.Status != GOAP_EXEC_FAILED; i++ {
+		x.Update(FRAME_MS)
+	}
+	counts := make(map[string]int)
+	for eventType, ch := range channels {
+		counts[eventType] = len(ch.C)
+		x.Events.Unsubscribe(ch)
+	}
+	return counts
+}
+
+func TestGOAPExecutorReplanAvoidsFailedNode(t *testing.T) {
+	_, _, rotten, sound, x := testingGOAPExecutorWorld()
+	x.SetGoal(map[string]int{"tree.chopped,=": 1}, nil)
+	events := testingRunGOAPExecutor(x, 100)
+	if x.Status != GOAP_EXEC_SUCCEEDED {
+		t.Fatalf("plan should have succeeded, got status %d (%v)", x.Status, x.Err)
+	}
+	if sound.GetIntMap(STATE).Get("chopped") != 1 {
+		t.Fatal("should have chopped the sound tree")
+	}
+	if !x.NodeCoolingDown(rotten) || x.NodeCoolingDown(sound) {
+		t.Fatal("only the rotten tree should be cooling down")
+	}
+	expected := map[string]int{
+		"goap-plan-started":     1,
+		"goap-action-started":   2,
+		"goap-action-failed":    1,
+		"goap-replanned":        1,
+		"goap-action-succeeded": 1,
+		"goap-plan-succeeded":   1,
+	}
+	for eventType, n := range expected {
+		if events[eventType] != n {
+			t.Fatalf("expected events %v, got %v", expected, events)
+		}
+	}
+	// the cooldown doubles for a node that fails again, and wears off
+	x.coolDown(rotten)
+	if until := x.cooldowns[rotten].until - x.t; until != 2*x.NodeCooldownMs {
+		t.Fatalf("second cooldown should be twice as long, was %f", until)
+	}
+	x.Update(2 * x.NodeCooldownMs)
+	if x.NodeCoolingDown(rotten) {
+		t.Fatal("cooldown should have worn off")
+	}
+}
+
+func TestGOAPExecutorMonitorsPres(t *testing.T) {
+	w, _, rotten, _, x := testingGOAPExecutorWorld()
+	e := x.Entity
+	w.Despawn(rotten)
+	ch := x.Events.Subscribe(SimpleEventFilter("goap-action-failed"))
+	x.SetGoal(map[string]int{"tree.chopped,=": 1}, nil)
+	x.Update(FRAME_MS)
+	x.Update(FRAME_MS)
+	if x.CurrentAction() == nil || x.CurrentAction().Name != "chopTree" {
+		t.Fatal("should be chopping")
+	}
+	// lose the axe mid-chop: we should notice, replan, and get it back
+	e.GetIntMap(STATE).Set("hasAxe", 0)
+	testingRunGOAPExecutor(x, 100)
+	if x.Status != GOAP_EXEC_SUCCEEDED {
+		t.Fatalf("plan should have succeeded, got status %d (%v)", x.Status, x.Err)
+	}
+	if len(ch.C) != 1 || !errors.Is((<-ch.C).Data.(*GOAPExecutorEvent).Err, ErrGOAPPresNotMet) {
+		t.Fatal("chopTree should have failed once for its pres")
+	}
+	if x.Plan.path[0].Name != "getAxe" {
+		t.Fatalf("should have replanned to get the axe first, got %s", x.Plan)
+	}
+}
+
+func TestGOAPExecutorVerifiesEffs(t *testing.T) {
+	_, _, _, sound, x := testingGOAPExecutorWorld()
+	// claim success without chopping anything
+	x.Actions.Register("chopTree", &GOAPActionImpl{
+		Tick: func(ctx *GOAPActionContext, dt_ms float64) GOAPActionStatus {
+			return GOAP_ACTION_SUCCEEDED
+		},
+	})
+	x.SetGoal(map[string]int{"tree.chopped,=": 1}, nil)
+	testingRunGOAPExecutor(x, 100)
+	if x.Status != GOAP_EXEC_FAILED || !errors.Is(x.Err, ErrGOAPNoPlan) {
+		t.Fatalf("should have failed for lack of trees after both broke the plan, got %d (%v)",
+			x.Status, x.Err)
+	}
+	if !x.NodeCoolingDown(sound) {
+		t.Fatal("the sound tree should be cooling down too")
+	}
+}
+
+func TestGOAPExecutorBTAction(t *testing.T) {
+	w, s, rotten, sound, x := testingGOAPExecutorWorld()
+	w.Despawn(rotten)
+	x.Events = nil
+	steps := make([]string, 0)
+	leaf := func(name string) *GOAPActionImpl {
+		return &GOAPActionImpl{
+			Tick: func(ctx *GOAPActionContext, dt_ms float64) GOAPActionStatus {
+				steps = append(steps, name)
+				if name == "fell" {
+					ctx.Node.GetIntMap(STATE).Set("chopped", 1)
+				}
+				return GOAP_ACTION_SUCCEEDED
+			},
+		}
+	}
+	x.Actions.Register("swing", leaf("swing"))
+	x.Actions.Register("fell", leaf("fell"))
+	x.Actions.RegisterTree("chopTree", func() *BehaviourTree {
+		return NewBehaviourTree("chopTree", &BTNode{
+			Name: "Sequence",
+			Selector: func(self *BTNode) int {
+				return self.CompletedChildren
+			},
+			CompletionPredicate: func(self *BTNode) bool {
+				return self.CompletedChildren == len(self.Children)
+			},
+			Children: []*BTNode{
+				{Name: "swing"},
+				{Name: "swing"},
+				{Name: "fell"},
+			},
+		})
+	})
+	x.SetGoal(map[string]int{"tree.chopped,=": 1}, nil)
+	for i := 0; i < 20 && x.Status != GOAP_EXEC_SUCCEEDED; i++ {
+		w.Update(FRAME_MS / 2)
+	}
+	if x.Status != GOAP_EXEC_SUCCEEDED || sound.GetIntMap(STATE).Get("chopped") != 1 {
+		t.Fatalf("tree action should have chopped the tree, got status %d (%v)", x.Status, x.Err)
+	}
+	if len(steps) != 3 || steps[2] != "fell" {
+		t.Fatalf("should have run the tree's leaves in order, ran %v", steps)
+	}
+	if x.Events != s.Events {
+		t.Fatal("the system should have given the executor its event bus")
+	}
+}
+
+func TestGOAPExecutorBTActionFails(t *testing.T) {
+	w, _, rotten, _, x := testingGOAPExecutorWorld()
+	w.Despawn(rotten)
+	failed := x.Events.Subscribe(SimpleEventFilter("goap-action-failed"))
+	x.Actions.Register("fell", &GOAPActionImpl{
+		Tick: func(ctx *GOAPActionContext, dt_ms float64) GOAPActionStatus {
+			ctx.Node.GetIntMap(STATE).Set("chopped", 1)
+			return GOAP_ACTION_SUCCEEDED
+		},
+	})
+	// the tree fells the tree, but then finishes in failure (eg. the axe
+	// broke), which fails the action though its effs hold
+	x.Actions.RegisterTree("chopTree", func() *BehaviourTree {
+		return NewBehaviourTree("chopTree", &BTNode{
+			Name: "FellThenBreak",
+			Selector: func(self *BTNode) int {
+				if self.CompletedChildren == 1 {
+					self.Finish(BT_FAILURE)
+					return -1
+				}
+				return 0
+			},
+			Children: []*BTNode{
+				{Name: "fell"},
+			},
+		})
+	})
+	x.SetGoal(map[string]int{"tree.chopped,=": 1}, nil)
+	for i := 0; i < 20 && len(failed.C) == 0; i++ {
+		x.Update(FRAME_MS)
+	}
+	if len(failed.C) != 1 || (<-failed.C).Data.(*GOAPExecutorEvent).Action.Name != "chopTree" {
+		t.Fatal("the tree finishing in failure should have failed chopTree")
+	}
+}
+
+func TestGOAPExecutorReplanOn(t *testing.T) {
+	w, _, rotten, sound, x := testingGOAPExecutorWorld()
+	w.Despawn(rotten)
+	bb := w.Blackboard("village")
+	x.ReplanOn(bb, "threat")
+	replanned := x.Events.Subscribe(SimpleEventFilter("goap-replanned"))
+	x.SetGoal(map[string]int{"tree.chopped,=": 1}, nil)
+	x.Update(FRAME_MS)
+	x.Update(FRAME_MS)
+	if x.CurrentAction() == nil || x.CurrentAction().Name != "chopTree" {
+		t.Fatal("should be chopping")
+	}
+	// other keys don't interrupt us
+	bb.Set("weather", "rain")
+	x.Update(FRAME_MS)
+	if len(replanned.C) != 0 {
+		t.Fatal("shouldn't have replanned for the weather")
+	}
+	bb.Set("threat", 1)
+	x.Update(FRAME_MS)
+	if len(replanned.C) != 1 || !errors.Is((<-replanned.C).Data.(*GOAPExecutorEvent).Err, ErrGOAPBlackboardChanged) {
+		t.Fatal("should have replanned for the threat")
+	}
+	testingRunGOAPExecutor(x, 100)
+	if x.Status != GOAP_EXEC_SUCCEEDED || x.replans != 0 {
+		t.Fatalf("should have succeeded without counting a replan (%v)", x.Err)
+	}
+	if sound.GetIntMap(STATE).Get("chopped") != 1 {
+		t.Fatal("should have chopped the tree")
+	}
+}
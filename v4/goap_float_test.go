@@ -0,0 +1,285 @@
+package sameriver
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	NEEDS = GENERICTAGS + 16 + iota
+)
+
+var (
+	// node.need(k): the need k in node's NEEDS
+	testingGOAPModalNeed = &GOAPModalMethod{
+		Name: "need",
+		Impl: func(node string, params []string) GOAPModalMethodImpl {
+			return GOAPModalMethodImpl{
+				CheckFloat: func(ws *GOAPWorldState) float64 {
+					return ws.GetModal(ws.ModalEntities[node], NEEDS).(*FloatMap).Get(params[0])
+				},
+				SetFloat: func(ws *GOAPWorldState, op string, x float64) {
+					e := ws.ModalEntities[node]
+					needs := ws.GetModal(e, NEEDS).(*FloatMap).CopyOf()
+					needs.Set(params[0], GOAPEffFloatFunc(op, x)(1, needs.Get(params[0])))
+					ws.SetModal(e, NEEDS, &needs)
+				},
+			}
+		},
+	}
+)
+
+// plans for goal from start with the actions given, giving the plan's
+// action names and the val of varName at the end of it
+func testingGOAPFloatPlan(t *testing.T, start any, goal any, varName string, actions ...*GOAPAction) ([]string, float64) {
+	w := testingWorld()
+	e := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION: Vec2D{0, 0},
+			BOX:      Vec2D{1, 1},
+		},
+	})
+	p := NewGOAPPlanner(e)
+	p.RegisterModalMethods(testingGOAPModalNeed)
+	p.AddActions(actions...)
+	path, ok := p.Plan(NewGOAPWorldState(start), goal, 50)
+	if !ok {
+		t.Fatalf("should have found a plan for %v", goal)
+	}
+	names := make([]string, len(path.path))
+	for i, a := range path.path {
+		names[i] = a.DisplayName()
+	}
+	return names, path.statesAlong[len(path.path)].vals[varName]
+}
+
+func TestGOAPFloatGoal(t *testing.T) {
+	eat := NewGOAPAction(map[string]any{
+		"name": "eat",
+		"node": "self",
+		"cost": 1,
+		"pres": nil,
+		"effs": map[string]float64{"hunger,-": 0.25},
+	})
+	plan, hunger := testingGOAPFloatPlan(t,
+		map[string]float64{"hunger": 0.9},
+		map[string]float64{"hunger,<": 0.3},
+		"hunger", eat)
+	assert.Equal(t, []string{"eat(3)"}, plan)
+	assert.InDelta(t, 0.15, hunger, GOAP_EPSILON)
+
+	// a strict bound on a float is just that (0.4 - 0.1 isn't < 0.3)
+	plan, _ = testingGOAPFloatPlan(t,
+		map[string]float64{"hunger": 0.4},
+		map[string]float64{"hunger,<": 0.3},
+		"hunger", NewGOAPAction(map[string]any{
+			"name": "snack",
+			"node": "self",
+			"cost": 1,
+			"pres": nil,
+			"effs": map[string]float64{"hunger,-": 0.1},
+		}))
+	assert.Equal(t, []string{"snack(2)"}, plan)
+
+	// summing floats forgives rounding error (0.1 + 0.1 + 0.1 = 0.3)
+	plan, _ = testingGOAPFloatPlan(t,
+		nil,
+		map[string]float64{"fill,=": 0.3},
+		"fill", NewGOAPAction(map[string]any{
+			"name": "pour",
+			"node": "self",
+			"cost": 1,
+			"pres": nil,
+			"effs": map[string]float64{"fill,+": 0.1},
+		}))
+	assert.Equal(t, []string{"pour(3)"}, plan)
+}
+
+func TestGOAPRangeGoal(t *testing.T) {
+	stoke := NewGOAPAction(map[string]any{
+		"name": "stoke",
+		"node": "self",
+		"cost": 1,
+		"pres": nil,
+		"effs": map[string]int{"temp,+": 4},
+	})
+	plan, temp := testingGOAPFloatPlan(t,
+		map[string]int{"temp": 10},
+		map[string]any{"temp,[]": []float64{20.5, 25}},
+		"temp", stoke)
+	assert.Equal(t, []string{"stoke(3)"}, plan)
+	assert.Equal(t, 22.0, temp)
+
+	// an int range's open ends step by 1: (18, 22) is [19, 21]
+	plan, temp = testingGOAPFloatPlan(t,
+		map[string]int{"temp": 10},
+		map[string]any{"temp,()": []int{18, 22}},
+		"temp", NewGOAPAction(map[string]any{
+			"name": "warm",
+			"node": "self",
+			"cost": 1,
+			"pres": nil,
+			"effs": map[string]int{"temp,+": 3},
+		}))
+	assert.Equal(t, []string{"warm(3)"}, plan)
+	assert.Equal(t, 19.0, temp)
+
+	// coming down into the range from above
+	vent := NewGOAPAction(map[string]any{
+		"name": "vent",
+		"node": "self",
+		"cost": 1,
+		"pres": nil,
+		"effs": map[string]float64{"temp,-": 2.5},
+	})
+	plan, temp = testingGOAPFloatPlan(t,
+		map[string]int{"temp": 40},
+		map[string]any{"temp,[)": []int{20, 35}},
+		"temp", vent)
+	assert.Equal(t, []string{"vent(3)"}, plan)
+	assert.Equal(t, 32.5, temp)
+
+	g := newGOAPGoal(map[string]any{"x,(]": [2]float64{0, 1}})
+	assert.Equal(t, 0.0, g.remaining(NewGOAPWorldState(map[string]float64{"x": 1})).diffs["x"])
+	assert.Equal(t, 1, g.remaining(NewGOAPWorldState(map[string]float64{"x": 0})).nUnfulfilled)
+	assert.Panics(t, func() { newGOAPGoal(map[string]any{"x,[]": []int{3, 1}}) })
+	assert.Panics(t, func() { newGOAPGoal(map[string]any{"x,[]": 3}) })
+}
+
+func TestGOAPScalingEff(t *testing.T) {
+	invest := NewGOAPAction(map[string]any{
+		"name": "invest",
+		"node": "self",
+		"cost": 2,
+		"pres": nil,
+		"effs": map[string]float64{"gold,*": 1.5},
+	})
+	plan, gold := testingGOAPFloatPlan(t,
+		map[string]int{"gold": 10},
+		map[string]int{"gold,>=": 30},
+		"gold", invest)
+	assert.Equal(t, []string{"invest(3)"}, plan)
+	assert.Equal(t, 33.75, gold)
+
+	// an int modal var is set to the rounded product
+	w := testingWorld()
+	e := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION: Vec2D{0, 0},
+			BOX:      Vec2D{1, 1},
+			STATE:    map[string]int{"sheep": 3},
+		},
+	})
+	p := NewGOAPPlanner(e)
+	p.RegisterModalMethods(testingGOAPModalNeed)
+	p.AddActions(NewGOAPAction(map[string]any{
+		"name": "breed",
+		"node": "self",
+		"cost": 1,
+		"pres": nil,
+		"effs": map[string]int{"self.sheep,*": 2},
+	}))
+	path, ok := p.Plan(NewGOAPWorldState(nil), map[string]int{"self.sheep,>=": 10}, 50)
+	if !ok {
+		t.Fatal("should have found a plan")
+	}
+	assert.Equal(t, "breed(2)", path.path[0].DisplayName())
+	end := path.statesAlong[1]
+	assert.Equal(t, 12.0, end.vals["self.sheep"])
+	assert.Equal(t, 12, end.GetModal(e, STATE).(*IntMap).Get("sheep"))
+}
+
+func TestGOAPFloatModal(t *testing.T) {
+	w := testingWorld()
+	w.RegisterComponents([]any{
+		NEEDS, FLOATMAP, "NEEDS",
+	})
+	e := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION: Vec2D{0, 0},
+			BOX:      Vec2D{1, 1},
+			NEEDS:    map[string]float64{"thirst": 0.8},
+		},
+	})
+	w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION: Vec2D{20, 0},
+			BOX:      Vec2D{2, 2},
+		},
+		"tags": []string{"well"},
+	})
+	p := NewGOAPPlanner(e)
+	p.RegisterModalMethods(testingGOAPModalNeed)
+	p.RegisterGenericEntitySelectors(map[string]func(*Entity) bool{
+		"well": func(c *Entity) bool { return c.HasTag("well") },
+	})
+	p.AddActions(NewGOAPAction(map[string]any{
+		"name": "drink",
+		"node": "well",
+		"cost": 1,
+		"pres": nil,
+		"effs": map[string]float64{"self.need(thirst),*": 0.5},
+	}))
+	path, ok := p.Plan(NewGOAPWorldState(nil), map[string]any{"self.need(thirst),[]": []float64{0, 0.25}}, 50)
+	if !ok {
+		t.Fatal("should have found a plan")
+	}
+	assert.Equal(t, "drink(2)", path.path[0].DisplayName())
+	end := path.statesAlong[1]
+	assert.InDelta(t, 0.2, end.vals["self.need(thirst)"], GOAP_EPSILON)
+	assert.InDelta(t, 0.2, end.GetModal(e, NEEDS).(*FloatMap).Get("thirst"), GOAP_EPSILON)
+	// the travel to the well, and drinking twice
+	assert.InDelta(t, 20+2, path.cost, GOAP_EPSILON)
+}
+
+func TestGOAPHeuristicFloatDiffs(t *testing.T) {
+	w := testingWorld()
+	e := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION: Vec2D{0, 0},
+			BOX:      Vec2D{1, 1},
+		},
+	})
+	p := NewGOAPPlanner(e)
+	p.RegisterModalMethods(testingGOAPModalNeed)
+	p.AddActions(
+		NewGOAPAction(map[string]any{
+			"name": "nibble",
+			"node": "self",
+			"cost": 1,
+			"pres": nil,
+			"effs": map[string]float64{"food,+": 0.5},
+		}),
+		NewGOAPAction(map[string]any{
+			"name": "feast",
+			"node": "self",
+			"cost": 5,
+			"pres": nil,
+			"effs": map[string]float64{"food,=": 10},
+		}),
+		NewGOAPAction(map[string]any{
+			"name": "fast",
+			"node": "self",
+			"cost": 0,
+			"pres": nil,
+			"effs": map[string]float64{"food,-": 1},
+		}),
+	)
+	// nibbling by 2 needs 4 nibbles (cost 4), cheaper than feasting
+	assert.Equal(t, 4.0, p.varCostLowerBound("food", 2))
+	// by 20, feasting is cheaper
+	assert.Equal(t, 5.0, p.varCostLowerBound("food", 20))
+	// fasting is free, but only helps coming down
+	assert.Equal(t, 0.0, p.varCostLowerBound("food", -3))
+	assert.Equal(t, 0.0, p.varCostLowerBound("hunger", math.Inf(1)))
+
+	// and the search finds the cheapest
+	path, ok := p.Plan(NewGOAPWorldState(nil), map[string]float64{"food,>=": 2}, 50)
+	if !ok {
+		t.Fatal("should have found a plan")
+	}
+	assert.Equal(t, "nibble(4)", path.path[0].DisplayName())
+	assert.Equal(t, 4.0, path.cost)
+}
@@ -1,46 +1,152 @@
 package sameriver
 
 import (
+	"fmt"
 	"math"
 	"strings"
 )
 
 type GOAPGoal struct {
-	spec map[string]int
+	spec map[string]any
 	vars map[string]*NumericInterval
 }
 
-func newGOAPGoal(spec map[string]int) *GOAPGoal {
+// spec is a map of "varName,op" to the val to compare with (see
+// goapGoalSpec())
+func newGOAPGoal(spec any) *GOAPGoal {
+	specmap, ok := goapGoalSpec(spec)
+	if !ok {
+		panic(fmt.Sprintf("GOAP goal spec should be a map[string]int, map[string]float64 or map[string]any, got %T", spec))
+	}
 	g := &GOAPGoal{
-		spec: spec,
+		spec: specmap,
 		vars: make(map[string]*NumericInterval),
 	}
 	return g.Parametrized(1)
 }
 
+// gives a goal spec as a map[string]any: its vals are ints (compared as
+// whole numbers, so that "<" 3 means "<=" 2), float64s, or, for the range
+// ops "[]", "[)", "(]" and "()", pairs [a, b] of either
+func goapGoalSpec(spec any) (map[string]any, bool) {
+	result := make(map[string]any)
+	switch m := spec.(type) {
+	case map[string]int:
+		for k, v := range m {
+			result[k] = v
+		}
+	case map[string]float64:
+		for k, v := range m {
+			result[k] = v
+		}
+	case map[string]any:
+		for k, v := range m {
+			result[k] = v
+		}
+	default:
+		return nil, false
+	}
+	return result, true
+}
+
 func (g *GOAPGoal) Parametrized(n int) *GOAPGoal {
 	result := &GOAPGoal{
 		spec: g.spec,
 		vars: make(map[string]*NumericInterval),
 	}
 	for spec, val := range g.spec {
-		logGOAPDebug("        parametrizing %s:%d by %d", spec, val, n)
-		var split []string
+		logGOAPDebug("        parametrizing %s:%v by %d", spec, val, n)
+		varOp := spec
+		scale := 1
 		macroSplit := strings.Split(spec, ":")
 		// if there is a macro ("EACH")
 		if macroSplit[0] == "EACH" {
-			val *= n
-			split = strings.Split(macroSplit[1], ",")
-		} else {
-			split = strings.Split(spec, ",")
+			scale = n
+			varOp = macroSplit[1]
 		}
-		varName, op := split[0], split[1]
-		interval := MakeNumericInterval(op, val)
-		result.vars[varName] = interval
+		varName, op := splitGOAPVarOp(varOp)
+		result.vars[varName] = goapGoalInterval(spec, op, val, scale)
 	}
 	return result
 }
 
+// the interval that var must be in for the goal spec "varName,op": val,
+// val being scaled by n
+func goapGoalInterval(spec, op string, val any, n int) *NumericInterval {
+	if isNumericRangeOp(op) {
+		a, b, integral := goapGoalRange(spec, val)
+		a, b = a*float64(n), b*float64(n)
+		if integral {
+			if op[0] == '(' {
+				a++
+			}
+			if op[1] == ')' {
+				b--
+			}
+			return &NumericInterval{a, b}
+		}
+		return MakeNumericRange(op, a, b)
+	}
+	switch x := val.(type) {
+	case int:
+		return MakeNumericInterval(op, x*n)
+	case float64:
+		return MakeNumericIntervalFloat(op, x*float64(n))
+	}
+	panic(fmt.Sprintf("GOAP goal %s should have an int or float64 val, got %T", spec, val))
+}
+
+// the ends of a range goal's val, and whether they're both ints
+func goapGoalRange(spec string, val any) (a, b float64, integral bool) {
+	var ends []any
+	switch x := val.(type) {
+	case []int:
+		for _, end := range x {
+			ends = append(ends, end)
+		}
+	case []float64:
+		for _, end := range x {
+			ends = append(ends, end)
+		}
+	case [2]int:
+		ends = []any{x[0], x[1]}
+	case [2]float64:
+		ends = []any{x[0], x[1]}
+	case []any:
+		ends = x
+	}
+	if len(ends) != 2 {
+		panic(fmt.Sprintf("GOAP range goal %s should have a val [a, b], got %v", spec, val))
+	}
+	integral = true
+	vals := make([]float64, 2)
+	for i, end := range ends {
+		switch x := end.(type) {
+		case int:
+			vals[i] = float64(x)
+		case float64:
+			vals[i] = x
+			integral = false
+		default:
+			panic(fmt.Sprintf("GOAP range goal %s should have numeric ends, got %v", spec, val))
+		}
+	}
+	if vals[0] > vals[1] {
+		panic(fmt.Sprintf("GOAP range goal %s is empty: %v", spec, val))
+	}
+	return vals[0], vals[1], integral
+}
+
+// splits "varName,op" (at the last comma, since a var in method notation
+// may have several params, eg. "self.near(well, 5),=")
+func splitGOAPVarOp(spec string) (varName, op string) {
+	ix := strings.LastIndex(spec, ",")
+	if ix < 0 {
+		panic(fmt.Sprintf("GOAP var spec %s has no op (expected varName,op)", spec))
+	}
+	return spec[:ix], spec[ix+1:]
+}
+
 func (g *GOAPGoal) remaining(ws *GOAPWorldState) (result *GOAPGoalRemaining) {
 	result = &GOAPGoalRemaining{
 		goal:         g,
@@ -54,8 +160,12 @@ func (g *GOAPGoal) remaining(ws *GOAPWorldState) (result *GOAPGoalRemaining) {
 	}
 	for varName, interval := range g.vars {
 		if stateVal, ok := ws.vals[varName]; ok {
-			diff := interval.Diff(float64(stateVal))
-			logGOAPDebug("                diff for %s: %.0f", varName, diff)
+			diff := interval.Diff(stateVal)
+			// (forgiving the rounding error of float vals summed by effs)
+			if math.Abs(diff) < GOAP_EPSILON {
+				diff = 0
+			}
+			logGOAPDebug("                diff for %s: %g", varName, diff)
 			result.diffs[varName] = diff
 			if diff != 0 {
 				result.nUnfulfilled++
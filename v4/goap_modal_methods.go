@@ -0,0 +1,196 @@
+package sameriver
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// node.method(params), eg. "self.inventoryHas(yoke)", "ox.in(field)",
+// "self.hp()", "self.near(well, 5)"
+var METHOD_NOTATION_RE = regexp.MustCompile(`(\w+)\.(\w+)\(([^()]*)\)`)
+
+// GOAPModalMethod is a method usable in GOAP var names in the notation
+// node.method(params), whose value is checked against (and, as an eff, set
+// into) the modal state of the world as the planner considers actions.
+// Impl is given the node the method is called on and its params, and gives
+// the modal val's functions, which look up entities by node name in
+// ws.ModalEntities.
+//
+// Methods are registered on a planner, with
+// GOAPPlanner.RegisterModalMethods(); inventoryHas(archetype) and
+// in(otherNode) are built in to every planner. Register each method once
+// (eg. as a package var) and give the same one to every planner using it:
+// plans are shared among planners (see GOAPPlanCache) only if their methods
+// are the same ones.
+type GOAPModalMethod struct {
+	Name string
+	Impl func(node string, params []string) GOAPModalMethodImpl
+}
+
+// GOAPModalMethodImpl is a modal method bound to its node and params
+type GOAPModalMethodImpl struct {
+	// the nodes looked at besides the one the method is called on (which
+	// will be bound before Check or Set are called), eg. other for
+	// in(other)
+	Nodes []string
+	// the value of the var in ws
+	Check func(ws *GOAPWorldState) int
+	// modifies ws so that the var becomes (op) x, eg. "+" 2 (nil if the var
+	// can't be an eff)
+	Set func(ws *GOAPWorldState, op string, x int)
+	// for real-valued vars, given instead of Check and Set: the same, but
+	// SetFloat is also given "*" and the factor for effs scaling the var
+	CheckFloat func(ws *GOAPWorldState) float64
+	SetFloat   func(ws *GOAPWorldState, op string, x float64)
+}
+
+// the modal methods built in to every planner
+var goapBuiltinModalMethods = []*GOAPModalMethod{
+	{Name: "inventoryHas", Impl: goapModalInventoryHas},
+	{Name: "in", Impl: goapModalIn},
+}
+
+// GOAPBuiltinModalMethod is whether name is a modal method built in to
+// every planner
+func GOAPBuiltinModalMethod(name string) bool {
+	for _, m := range goapBuiltinModalMethods {
+		if m.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterModalMethods adds methods usable in the planner's var names
+// (replacing any of the same name, and remaking the modal vals of the
+// actions already added which use them)
+func (p *GOAPPlanner) RegisterModalMethods(methods ...*GOAPModalMethod) {
+	for _, m := range methods {
+		p.modalMethods[m.Name] = m
+		for varName := range p.modalVals {
+			if _, method, _ := p.parseParenthesesNotation(varName); method == m.Name {
+				p.modalVals[varName] = p.createModalValMethodNotation(varName)
+			}
+		}
+	}
+	p.actionsSig = ""
+}
+
+// splits params such as "well, 5" into ["well", "5"]
+func parseGOAPModalParams(params string) []string {
+	result := make([]string, 0)
+	if strings.TrimSpace(params) == "" {
+		return result
+	}
+	for _, param := range strings.Split(params, ",") {
+		result = append(result, strings.TrimSpace(param))
+	}
+	return result
+}
+
+func (p *GOAPPlanner) parseParenthesesNotation(valName string) (node, method string, params []string) {
+	matches := METHOD_NOTATION_RE.FindStringSubmatch(valName)
+	if len(matches) == 4 {
+		node = matches[1]
+		method = matches[2]
+		params = parseGOAPModalParams(matches[3])
+	}
+	return
+}
+
+func (p *GOAPPlanner) createModalValMethodNotation(varName string) GOAPModalVal {
+	node, method, params := p.parseParenthesesNotation(varName)
+	m, ok := p.modalMethods[method]
+	if !ok {
+		panic(fmt.Sprintf("method %s does not exist for modal vals (in %s)", method, varName))
+	}
+	impl := m.Impl(node, params)
+	if impl.Check == nil && impl.CheckFloat == nil {
+		panic(fmt.Sprintf("method %s gave neither Check nor CheckFloat (in %s)", method, varName))
+	}
+	return GOAPModalVal{
+		name:             varName,
+		nodes:            append([]string{node}, impl.Nodes...),
+		check:            impl.Check,
+		effModalSet:      impl.Set,
+		checkFloat:       impl.CheckFloat,
+		effModalSetFloat: impl.SetFloat,
+	}
+}
+
+func goapModalInventoryHas(node string, params []string) GOAPModalMethodImpl {
+	if len(params) != 1 {
+		panic(fmt.Sprintf("inventoryHas takes 1 param (an archetype), got %v", params))
+	}
+	archetype := params[0]
+	return GOAPModalMethodImpl{
+		Check: func(ws *GOAPWorldState) int {
+			inv := ws.GetModal(ws.ModalEntities[node], INVENTORY).(*Inventory)
+			count := inv.CountName(archetype)
+			return count
+		},
+		Set: func(ws *GOAPWorldState, op string, x int) {
+			e := ws.ModalEntities[node]
+			inv := ws.GetModal(e, INVENTORY).(*Inventory).CopyOf()
+			switch op {
+			case "-":
+				inv.DebitNName(x, archetype)
+			case "=":
+				if x == 0 {
+					inv.DebitAllName(archetype)
+				} else {
+					inv.SetCountName(x, archetype)
+				}
+			case "+":
+				count := inv.CountName(archetype)
+				if count == 0 {
+					items := e.World.systems["ItemSystem"].(*ItemSystem)
+					inv.Credit(items.CreateStackSimple(x, archetype))
+				} else {
+					inv.SetCountName(count+x, archetype)
+				}
+			}
+			ws.SetModal(e, INVENTORY, inv)
+		},
+	}
+}
+
+func goapModalIn(node string, params []string) GOAPModalMethodImpl {
+	if len(params) != 1 {
+		panic(fmt.Sprintf("in takes 1 param (a node), got %v", params))
+	}
+	other := params[0]
+	return GOAPModalMethodImpl{
+		Nodes: []string{other},
+		Check: func(ws *GOAPWorldState) int {
+			entity := ws.ModalEntities[node]
+			otherEntity := ws.ModalEntities[other]
+			entityPos := ws.GetModal(entity, POSITION).(*Vec2D)
+			if RectIntersectsRect(
+				*entityPos, *entity.GetVec2D(BOX),
+				*otherEntity.GetVec2D(POSITION), *otherEntity.GetVec2D(BOX)) {
+				return 1
+			} else {
+				return 0
+			}
+		},
+		Set: func(ws *GOAPWorldState, op string, x int) {
+			entity := ws.ModalEntities[node]
+			otherEntity := ws.ModalEntities[other]
+			if op == "=" {
+				switch x {
+				case 0:
+					// TODO: this should really be a call to some kind of sophisticated
+					// relocation function that avoids obstacles and makes sure there's a path
+					// to be able to get there via navmesh/grid
+					awayFromOther := otherEntity.GetVec2D(POSITION).Add(otherEntity.GetVec2D(BOX).Scale(1.1))
+					ws.SetModal(entity, POSITION, &awayFromOther)
+				case 1:
+					otherCenter := *otherEntity.GetVec2D(POSITION)
+					ws.SetModal(entity, POSITION, &otherCenter)
+				}
+			}
+		},
+	}
+}
@@ -0,0 +1,217 @@
+package sameriver
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	// node.hp(): the hp in node's STATE
+	testingGOAPModalHp = &GOAPModalMethod{
+		Name: "hp",
+		Impl: func(node string, params []string) GOAPModalMethodImpl {
+			return GOAPModalMethodImpl{
+				Check: func(ws *GOAPWorldState) int {
+					return ws.GetModal(ws.ModalEntities[node], STATE).(*IntMap).Get("hp")
+				},
+				Set: func(ws *GOAPWorldState, op string, x int) {
+					e := ws.ModalEntities[node]
+					state := ws.GetModal(e, STATE).(*IntMap).CopyOf()
+					state.Set("hp", GOAPEffFunc(op, x)(1, state.Get("hp")))
+					ws.SetModal(e, STATE, &state)
+				},
+			}
+		},
+	}
+	// node.near(other, r): whether node is within r of other
+	testingGOAPModalNear = &GOAPModalMethod{
+		Name: "near",
+		Impl: func(node string, params []string) GOAPModalMethodImpl {
+			other := params[0]
+			r, err := strconv.ParseFloat(params[1], 64)
+			if err != nil {
+				panic(fmt.Sprintf("near(other, r) needs a number for r: %s", err))
+			}
+			return GOAPModalMethodImpl{
+				Nodes: []string{other},
+				Check: func(ws *GOAPWorldState) int {
+					pos := ws.GetModal(ws.ModalEntities[node], POSITION).(*Vec2D)
+					otherPos := ws.GetModal(ws.ModalEntities[other], POSITION).(*Vec2D)
+					if pos.Sub(*otherPos).Magnitude() <= r {
+						return 1
+					}
+					return 0
+				},
+				Set: func(ws *GOAPWorldState, op string, x int) {
+					if op == "=" && x == 1 {
+						otherPos := *ws.GetModal(ws.ModalEntities[other], POSITION).(*Vec2D)
+						ws.SetModal(ws.ModalEntities[node], POSITION, &otherPos)
+					}
+				},
+			}
+		},
+	}
+	// node.tagged(t): whether node has tag t (which can't be an eff)
+	testingGOAPModalTagged = &GOAPModalMethod{
+		Name: "tagged",
+		Impl: func(node string, params []string) GOAPModalMethodImpl {
+			return GOAPModalMethodImpl{
+				Check: func(ws *GOAPWorldState) int {
+					if ws.ModalEntities[node].HasTag(params[0]) {
+						return 1
+					}
+					return 0
+				},
+			}
+		},
+	}
+)
+
+func TestGOAPModalMethodCustom(t *testing.T) {
+	w := testingWorld()
+	e := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION: Vec2D{0, 0},
+			BOX:      Vec2D{1, 1},
+			STATE:    map[string]int{"hp": 5},
+		},
+		"tags": []string{"thirsty"},
+	})
+	w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION: Vec2D{30, 0},
+			BOX:      Vec2D{2, 2},
+		},
+		"tags": []string{"well"},
+	})
+	p := NewGOAPPlanner(e)
+	p.RegisterModalMethods(testingGOAPModalHp, testingGOAPModalNear, testingGOAPModalTagged)
+	p.RegisterGenericEntitySelectors(map[string]func(*Entity) bool{
+		"well": func(c *Entity) bool { return c.HasTag("well") },
+	})
+	p.AddActions(
+		NewGOAPAction(map[string]any{
+			"name": "walkToWell",
+			"node": "well",
+			"cost": 1,
+			"pres": nil,
+			"effs": map[string]int{"self.near(well, 5),=": 1},
+		}),
+		NewGOAPAction(map[string]any{
+			"name": "drink",
+			"node": "well",
+			"cost": 1,
+			"pres": map[string]int{
+				"self.near(well, 5),=":   1,
+				"self.tagged(thirsty),=": 1,
+			},
+			"effs": map[string]int{"self.hp(),+": 5},
+		}),
+	)
+	start := NewGOAPWorldState(nil)
+	path, ok := p.Plan(start, map[string]int{"self.hp(),>=": 10}, 50)
+	if !ok {
+		t.Fatal("should have found a plan")
+	}
+	assert.Equal(t, "walkToWell", path.path[0].Name)
+	assert.Equal(t, "drink", path.path[1].Name)
+	end := path.statesAlong[len(path.path)]
+	assert.Equal(t, 10.0, end.vals["self.hp()"])
+	assert.Equal(t, 1.0, end.vals["self.near(well, 5)"])
+
+	// not thirsty, we won't drink
+	w.UntagEntity(e, "thirsty")
+	if _, ok := p.Plan(start, map[string]int{"self.hp(),>=": 10}, 50); ok {
+		t.Fatal("shouldn't drink when not thirsty")
+	}
+}
+
+func TestGOAPModalMethodInvalid(t *testing.T) {
+	w := testingWorld()
+	e := w.Spawn(nil)
+	p := NewGOAPPlanner(e)
+	p.RegisterModalMethods(testingGOAPModalHp, testingGOAPModalNear, testingGOAPModalTagged)
+	assert.Panics(t, func() {
+		p.AddActions(NewGOAPAction(map[string]any{
+			"name": "fnord",
+			"node": "self",
+			"cost": 1,
+			"pres": nil,
+			"effs": map[string]int{"self.fnord(x),=": 1},
+		}))
+	}, "unknown method")
+	assert.Panics(t, func() {
+		p.AddActions(NewGOAPAction(map[string]any{
+			"name": "tag",
+			"node": "self",
+			"cost": 1,
+			"pres": nil,
+			"effs": map[string]int{"self.tagged(happy),=": 1},
+		}))
+	}, "method without Set as an eff")
+}
+
+func TestGOAPModalMethodPerPlanner(t *testing.T) {
+	w := testingWorld()
+	e := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION: Vec2D{0, 0},
+			BOX:      Vec2D{1, 1},
+			STATE:    map[string]int{"hp": 5},
+		},
+	})
+	heal := func() *GOAPAction {
+		return NewGOAPAction(map[string]any{
+			"name": "heal",
+			"node": "self",
+			"cost": 1,
+			"pres": nil,
+			"effs": map[string]int{"self.hp(),+": 5},
+		})
+	}
+	goal := map[string]int{"self.hp(),>=": 20}
+	cache := NewGOAPPlanCache()
+	plan := func(p *GOAPPlanner) string {
+		path, ok := p.Plan(NewGOAPWorldState(nil), goal, 50)
+		if !ok {
+			t.Fatal("should have found a plan")
+		}
+		return GOAPPathToString(path)
+	}
+	p := NewGOAPPlanner(e)
+	q := NewGOAPPlanner(e)
+	for _, planner := range []*GOAPPlanner{p, q} {
+		planner.Cache = cache
+		planner.RegisterModalMethods(testingGOAPModalHp)
+		planner.AddActions(heal())
+	}
+	// planners given the same methods share plans
+	if plan(p) != plan(q) || cache.hits != 1 || p.actionsSig != q.actionsSig {
+		t.Fatalf("q should have got p's plan from the cache, got %v", cache.Stats())
+	}
+
+	// re-registering a method applies to the actions already added, and
+	// the plans made with the old one aren't used
+	q.RegisterModalMethods(&GOAPModalMethod{
+		Name: "hp",
+		Impl: func(node string, params []string) GOAPModalMethodImpl {
+			// (counting a blessing of 10)
+			impl := testingGOAPModalHp.Impl(node, params)
+			check := impl.Check
+			impl.Check = func(ws *GOAPWorldState) int {
+				return check(ws) + 10
+			}
+			return impl
+		},
+	})
+	if plan(q) == plan(p) || q.actionsSig == p.actionsSig {
+		t.Fatal("q should have planned with its own hp, under a key of its own")
+	}
+	// a planner without the method can't use it
+	assert.Panics(t, func() {
+		NewGOAPPlanner(e).AddActions(heal())
+	})
+}
@@ -7,7 +7,7 @@ import (
 
 type GOAPPath struct {
 	path []*GOAPAction
-	cost float64 // set by GOAPPath.inserted()
+	cost float64 // set in GOAPPlanner.computeCostAndRemainingsOfPath()
 	// states after each action, from start state at [0]
 	// til the end state after the last action
 	statesAlong []*GOAPWorldState // set in GOAPEvaluator.computeRemainingsOfPath()
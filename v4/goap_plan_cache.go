@@ -0,0 +1,223 @@
+package sameriver
+
+import (
+	"container/list"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+// GOAPPlanCache memoizes the plans found by the planners that share it (by
+// their Cache), so that many identical agents planning for the same goal
+// from much the same state don't each search for the plan.
+//
+// Plans are keyed on the planner's action set and modal methods, the goal,
+// and the start state abstracted to the vars the actions and goal refer to
+// (so that irrelevant vars don't split the cache). Adding actions or
+// registering modal methods on a planner changes its key, so plans made
+// with its old action set aren't used (and are evicted in time, the least
+// recently used going first once MaxEntries is reached).
+//
+// A cached plan is only the sequence of actions: on a hit it's evaluated
+// afresh for the planning agent - binding its nodes from where it stands -
+// and used only if it still fulfills the goal; if not, the entry is dropped
+// and the agent searches as usual. So a hit never gives an invalid plan,
+// though it may give one a search from this agent's position wouldn't have
+// preferred.
+type GOAPPlanCache struct {
+	// the most plans kept
+	MaxEntries int
+
+	entries map[string]*list.Element
+	lru     *list.List
+
+	hits      int
+	misses    int
+	stale     int
+	evictions int
+}
+
+type goapPlanCacheEntry struct {
+	key     string
+	actions []goapCachedAction
+}
+
+type goapCachedAction struct {
+	name  string
+	count int
+}
+
+func NewGOAPPlanCache() *GOAPPlanCache {
+	return &GOAPPlanCache{
+		MaxEntries: 1024,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// GOAPPlanCache gives the world's plan cache, shared by the planners of all
+// agents that use it
+func (w *World) GOAPPlanCache() *GOAPPlanCache {
+	if w.planCache == nil {
+		w.planCache = NewGOAPPlanCache()
+	}
+	return w.planCache
+}
+
+// Clear drops every cached plan
+func (c *GOAPPlanCache) Clear() {
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+func (c *GOAPPlanCache) Len() int {
+	return len(c.entries)
+}
+
+// HitRate is the fraction of lookups which gave a plan (0 if none yet)
+func (c *GOAPPlanCache) HitRate() float64 {
+	lookups := c.hits + c.misses + c.stale
+	if lookups == 0 {
+		return 0
+	}
+	return float64(c.hits) / float64(lookups)
+}
+
+// Stats gives the counts of lookups which hit, missed, or found a plan no
+// longer valid (stale), and of entries and evictions, for the world stats
+func (c *GOAPPlanCache) Stats() map[string]float64 {
+	return map[string]float64{
+		"hits":      float64(c.hits),
+		"misses":    float64(c.misses),
+		"stale":     float64(c.stale),
+		"hitRate":   c.HitRate(),
+		"entries":   float64(len(c.entries)),
+		"evictions": float64(c.evictions),
+	}
+}
+
+// lookup gives the plan cached under key evaluated for p from start, if
+// there is one and it fulfills the goal
+func (c *GOAPPlanCache) lookup(p *GOAPPlanner, key string, start *GOAPWorldState, goal *GOAPTemporalGoal) *GOAPPath {
+	el, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil
+	}
+	entry := el.Value.(*goapPlanCacheEntry)
+	path := p.cachedPath(entry.actions, start, goal)
+	if path == nil {
+		logGOAPDebug("cached plan no longer valid; dropping it")
+		c.stale++
+		c.remove(el)
+		return nil
+	}
+	c.hits++
+	c.lru.MoveToFront(el)
+	return path
+}
+
+func (c *GOAPPlanCache) store(key string, path *GOAPPath) {
+	actions := make([]goapCachedAction, len(path.path))
+	for i, a := range path.path {
+		actions[i] = goapCachedAction{name: a.Name, count: a.Count}
+	}
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*goapPlanCacheEntry).actions = actions
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&goapPlanCacheEntry{key: key, actions: actions})
+	for c.MaxEntries > 0 && len(c.entries) > c.MaxEntries {
+		c.remove(c.lru.Back())
+		c.evictions++
+	}
+}
+
+func (c *GOAPPlanCache) remove(el *list.Element) {
+	delete(c.entries, el.Value.(*goapPlanCacheEntry).key)
+	c.lru.Remove(el)
+}
+
+// cachedPath evaluates the actions of a cached plan from start, giving the
+// path if it's still valid
+func (p *GOAPPlanner) cachedPath(actions []goapCachedAction, start *GOAPWorldState, goal *GOAPTemporalGoal) *GOAPPath {
+	path := NewGOAPPath(nil)
+	for _, ca := range actions {
+		a, ok := p.actions.set[ca.name]
+		if !ok {
+			return nil
+		}
+		if ca.count != 1 {
+			a = a.Parametrized(ca.count)
+		}
+		path.path = append(path.path, a.CopyOf())
+	}
+	if err := p.computeCostAndRemainingsOfPath(path, start, goal); err != nil {
+		return nil
+	}
+	if path.remainings.NUnfulfilled() != 0 || !p.validateForward(path, start, goal) {
+		return nil
+	}
+	return path
+}
+
+// planCacheKey gives the key of a plan for goalSpec from start: the
+// signature of our actions, the goal, and start's vals of the vars which
+// the actions or goal refer to
+func (p *GOAPPlanner) planCacheKey(start *GOAPWorldState, goal *GOAPTemporalGoal, goalSpec any) string {
+	if p.actionsSig == "" {
+		p.computeActionsSig()
+	}
+	goalVars := make(map[string]bool)
+	for _, tg := range goal.temporalGoals {
+		for varName := range tg.vars {
+			goalVars[varName] = true
+		}
+	}
+	vals := make([]string, 0, len(start.vals))
+	for varName, val := range start.vals {
+		if p.actionVars[varName] || goalVars[varName] {
+			vals = append(vals, fmt.Sprintf("%s=%g", varName, val))
+		}
+	}
+	sort.Strings(vals)
+	return fmt.Sprintf("%s|%v|%s", p.actionsSig, goalSpec, strings.Join(vals, ","))
+}
+
+// computeActionsSig hashes the specs of our actions (fmt printing maps with
+// their keys sorted, planners given the same actions get the same
+// signature), and notes the vars they refer to
+func (p *GOAPPlanner) computeActionsSig() {
+	names := make([]string, 0, len(p.actions.set))
+	for name := range p.actions.set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := fnv.New64a()
+	p.actionVars = make(map[string]bool)
+	for _, name := range names {
+		a := p.actions.set[name]
+		fmt.Fprintf(h, "%s:%v;", name, a.spec)
+		for varName := range a.effs {
+			p.actionVars[varName] = true
+		}
+		for _, tg := range a.pres.temporalGoals {
+			for varName := range tg.vars {
+				p.actionVars[varName] = true
+			}
+		}
+	}
+	// (the same method names can mean different things to different
+	// planners, or to one after re-registering them)
+	methods := make([]string, 0, len(p.modalMethods))
+	for name := range p.modalMethods {
+		methods = append(methods, name)
+	}
+	sort.Strings(methods)
+	for _, name := range methods {
+		fmt.Fprintf(h, "%s():%p;", name, p.modalMethods[name])
+	}
+	p.actionsSig = fmt.Sprintf("%016x", h.Sum64())
+}
@@ -0,0 +1,159 @@
+package sameriver
+
+import (
+	"testing"
+)
+
+func TestGOAPPlanCacheAcrossAgents(t *testing.T) {
+	w := testingWorld()
+	farmers, _ := testingGOAPFarmers(w, 2)
+	cache := w.GOAPPlanCache()
+	goal := map[string]int{"tree.chopped,=": 1}
+	a, b := farmers[0].Planner, farmers[1].Planner
+	a.Cache = cache
+	b.Cache = cache
+	b.Trace = NewGOAPTrace(0)
+
+	pathA, ok := a.Plan(NewGOAPWorldState(nil), goal, 50)
+	if !ok {
+		t.Fatal("a should have found a plan")
+	}
+	pathB, ok := b.Plan(NewGOAPWorldState(nil), goal, 50)
+	if !ok {
+		t.Fatal("b should have found a plan")
+	}
+	if GOAPPathToString(pathA) != GOAPPathToString(pathB) {
+		t.Fatalf("b should have got a's plan, got %s", GOAPPathToString(pathB))
+	}
+	if cache.hits != 1 || cache.misses != 1 || cache.Len() != 1 {
+		t.Fatalf("expected 1 hit and 1 miss, got %v", cache.Stats())
+	}
+	if !b.Trace.Last().Cached || b.Trace.Last().Iterations != 0 {
+		t.Fatal("b's plan should have come from the cache without searching")
+	}
+	if cache.HitRate() != 0.5 {
+		t.Fatalf("hit rate should be 0.5, got %f", cache.HitRate())
+	}
+	if w.DumpStats()["goap-plan-cache"]["hits"] != 1 {
+		t.Fatal("the world stats should show the cache's hits")
+	}
+}
+
+func TestGOAPPlanCacheKey(t *testing.T) {
+	w := testingWorld()
+	e := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION: Vec2D{0, 0},
+			BOX:      Vec2D{1, 1},
+		},
+	})
+	eat := NewGOAPAction(map[string]any{
+		"name": "eat",
+		"node": "self",
+		"cost": 1,
+		"pres": nil,
+		"effs": map[string]int{"hunger,-": 2},
+	})
+	cache := NewGOAPPlanCache()
+	p := NewGOAPPlanner(e)
+	p.Cache = cache
+	p.AddActions(eat)
+	goal := map[string]int{"hunger,<=": 1}
+	plan := func(start map[string]int) string {
+		path, ok := p.Plan(NewGOAPWorldState(start), goal, 50)
+		if !ok {
+			t.Fatalf("should have found a plan from %v", start)
+		}
+		return path.path[0].DisplayName()
+	}
+
+	plan(map[string]int{"hunger": 5})
+	// a var neither the goal nor the actions refer to doesn't matter
+	if plan(map[string]int{"hunger": 5, "mood": 3}) != "eat(2)" || cache.hits != 1 {
+		t.Fatal("an irrelevant var shouldn't have missed the cache")
+	}
+	// a relevant one does
+	if plan(map[string]int{"hunger": 9}) != "eat(4)" || cache.misses != 2 {
+		t.Fatal("a different hunger should have missed the cache")
+	}
+	// as does a change to the action set
+	p.AddActions(NewGOAPAction(map[string]any{
+		"name": "feast",
+		"node": "self",
+		"cost": 1,
+		"pres": nil,
+		"effs": map[string]int{"hunger,=": 0},
+	}))
+	if plan(map[string]int{"hunger": 5}) != "feast" || cache.misses != 3 {
+		t.Fatal("adding an action should have missed the cache")
+	}
+
+	// a planner given the same actions shares the plans
+	q := NewGOAPPlanner(e)
+	q.Cache = cache
+	q.AddActions(eat)
+	if _, ok := q.Plan(NewGOAPWorldState(map[string]int{"hunger": 9}), goal, 50); !ok || cache.hits != 2 {
+		t.Fatal("a planner with the same actions should have hit the cache")
+	}
+
+	// the least recently used entries are evicted (of the 4, 2 go)
+	cache.MaxEntries = 2
+	p.Plan(NewGOAPWorldState(map[string]int{"hunger": 7}), goal, 50)
+	if cache.Len() != 2 || cache.evictions != 2 {
+		t.Fatalf("expected 2 entries after 2 evictions, got %v", cache.Stats())
+	}
+	cache.Clear()
+	if cache.Len() != 0 {
+		t.Fatal("the cache should be empty once cleared")
+	}
+}
+
+func TestGOAPPlanCacheStale(t *testing.T) {
+	w := testingWorld()
+	spawn := func(axe int) *Entity {
+		return w.Spawn(map[string]any{
+			"components": map[ComponentID]any{
+				POSITION: Vec2D{0, 0},
+				BOX:      Vec2D{1, 1},
+				STATE:    map[string]int{"axe": axe},
+			},
+		})
+	}
+	cache := NewGOAPPlanCache()
+	planner := func(e *Entity) *GOAPPlanner {
+		p := NewGOAPPlanner(e)
+		p.Cache = cache
+		p.AddActions(
+			NewGOAPAction(map[string]any{
+				"name": "getAxe",
+				"node": "self",
+				"cost": 1,
+				"pres": nil,
+				"effs": map[string]int{"self.axe,=": 1},
+			}),
+			NewGOAPAction(map[string]any{
+				"name": "chop",
+				"node": "self",
+				"cost": 1,
+				"pres": map[string]int{"self.axe,=": 1},
+				"effs": map[string]int{"wood,+": 1},
+			}),
+		)
+		return p
+	}
+	goal := map[string]int{"wood,>=": 1}
+	// the one with an axe just chops; the other, hitting that plan (whether
+	// it has an axe isn't in the key, not being in its start state), finds
+	// it invalid and searches
+	planner(spawn(1)).Plan(NewGOAPWorldState(nil), goal, 50)
+	path, ok := planner(spawn(0)).Plan(NewGOAPWorldState(nil), goal, 50)
+	if !ok || len(path.path) != 2 || path.path[0].Name != "getAxe" {
+		t.Fatal("the one without an axe should have planned to get one")
+	}
+	if cache.stale != 1 || cache.hits != 0 {
+		t.Fatalf("the cached plan should have been stale, got %v", cache.Stats())
+	}
+	if cache.Len() != 1 {
+		t.Fatal("the stale plan should have been replaced")
+	}
+}
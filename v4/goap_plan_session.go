@@ -0,0 +1,276 @@
+package sameriver
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/TwiN/go-color"
+)
+
+// GOAPPlanSession is a resumable search for a plan, so that planning can be
+// spread over many frames (stepped within a budget each tick) rather than
+// done in one Plan() call. At any time Best() gives the best path found so
+// far, even if it doesn't yet fulfill the goal.
+//
+// A planner has one session at a time (its node bindings are cached while a
+// session runs): starting another cancels the one running.
+type GOAPPlanSession struct {
+	p       *GOAPPlanner
+	start   *GOAPWorldState
+	goal    *GOAPTemporalGoal
+	maxIter int
+
+	// the search frontier, and the solutions found
+	pq       *GOAPPriorityQueue
+	resultPq *GOAPPriorityQueue
+	// used to keep track of which paths we've already seen since there's
+	// multiple ways to reach a path in the insertion-based logic we use
+	pathsSeen map[string]bool
+
+	iter      int
+	elapsed   float64
+	done      bool
+	cancelled bool
+	// the path explored so far with the fewest unfulfilled goals (the
+	// most recently explored among those, being the furthest along)
+	best            *GOAPPath
+	bestUnfulfilled int
+	solution        *GOAPPath
+	// the key the solution is cached under, if the planner has a cache, and
+	// whether the solution came from it
+	cacheKey string
+	cached   bool
+
+	// the record of the search, if the planner is traced
+	trace *GOAPSearchTrace
+}
+
+// NewPlanSession starts planning from start for goalSpec, to be stepped
+// with Step() or StepFor(); like Plan(), the search gives up after maxIter
+// iterations
+func (p *GOAPPlanner) NewPlanSession(
+	start *GOAPWorldState,
+	goalSpec any,
+	maxIter int) *GOAPPlanSession {
+
+	if p.session != nil {
+		p.session.Cancel()
+	}
+	s := &GOAPPlanSession{
+		p:               p,
+		maxIter:         maxIter,
+		pq:              &GOAPPriorityQueue{},
+		resultPq:        &GOAPPriorityQueue{},
+		pathsSeen:       make(map[string]bool),
+		bestUnfulfilled: math.MaxInt,
+	}
+	p.session = s
+
+	// we may be writing to this with modal vals as we explore and don't want
+	// to pollute the caller's state object
+	start = start.CopyOf()
+	start.w = p.e.World
+	p.setPositionInStartModalIfNotDefined(start)
+	start.ModalEntities["self"] = p.e
+	s.start = start
+
+	logGOAPDebug("Planning...")
+
+	// convert goal spec into GOAPTemporalGoal
+	s.goal = NewGOAPTemporalGoal(goalSpec)
+
+	// populate start state with any modal vals at start
+	for _, tg := range s.goal.temporalGoals {
+		for varName := range tg.vars {
+			p.setVarInStartIfNotDefined(start, varName)
+		}
+	}
+
+	if p.Trace != nil {
+		s.trace = p.Trace.newSearch(p.e, goalSpec, start)
+	}
+
+	if p.Cache != nil {
+		s.cacheKey = p.planCacheKey(start, s.goal, goalSpec)
+		if path := p.Cache.lookup(p, s.cacheKey, start, s.goal); path != nil {
+			logGOAPDebug("solution from cache: %s", GOAPPathToString(path))
+			s.solution = path
+			s.cached = true
+			s.done = true
+			s.release()
+			s.trace.finish(s)
+			return s
+		}
+	}
+
+	heap.Init(s.resultPq)
+	heap.Init(s.pq)
+
+	rootPath := NewGOAPPath(nil)
+	p.computeCostAndRemainingsOfPath(rootPath, start, s.goal)
+	rootPath.regionOffsets[0] = make([]int, len(s.goal.temporalGoals))
+	backtrackRoot := &GOAPPQueueItem{
+		path:  rootPath,
+		index: -1, // going to be set by Push()
+	}
+	heap.Push(s.pq, backtrackRoot)
+	s.trace.root(rootPath)
+	return s
+}
+
+// Step runs up to n iterations of the search (each either expanding a path
+// or checking a candidate solution), giving whether the search is done
+func (s *GOAPPlanSession) Step(n int) bool {
+	t0 := time.Now()
+	for i := 0; i < n && !s.done; i++ {
+		s.iterate()
+	}
+	s.elapsed += float64(time.Since(t0).Nanoseconds()) / 1.0e6
+	return s.done
+}
+
+// StepFor runs the search for up to budget_ms (always running at least one
+// iteration, so that the search progresses however small the budget),
+// giving whether it's done
+func (s *GOAPPlanSession) StepFor(budget_ms float64) bool {
+	t0 := time.Now()
+	for first := true; !s.done; first = false {
+		if !first && float64(time.Since(t0).Nanoseconds())/1.0e6 >= budget_ms {
+			break
+		}
+		s.iterate()
+	}
+	s.elapsed += float64(time.Since(t0).Nanoseconds()) / 1.0e6
+	return s.done
+}
+
+func (s *GOAPPlanSession) iterate() {
+	if s.iter >= s.maxIter || s.pq.Len() == 0 {
+		s.finish()
+		return
+	}
+	p := s.p
+
+	logGOAPDebug("=== iter ===")
+	here := heap.Pop(s.pq).(*GOAPPQueueItem)
+	nUnfulfilled := here.path.remainings.NUnfulfilled()
+	if DEBUG_GOAP {
+		logGOAPDebug(color.InRedOverGray("here:"))
+		logGOAPDebug(color.InWhiteOverBlue(color.InBold(GOAPPathToString(here.path))))
+		logGOAPDebug(color.InRedOverGray(fmt.Sprintf("(%d unfulfilled)", nUnfulfilled)))
+	}
+
+	if nUnfulfilled == 0 {
+		ok := p.validateForward(here.path, s.start, s.goal)
+		if !ok {
+			logGOAPDebug(">>>>>>> potential solution rejected")
+			s.trace.rejectSolution(here.path)
+			return
+		}
+
+		if DEBUG_GOAP {
+			logGOAPDebug(color.InGreenOverWhite(color.InBold(">>>>>>>>>>>>>>>>>>>>>>")))
+			logGOAPDebug(color.InGreenOverWhite(color.InBold(fmt.Sprintf("    SOLUTION: %s", GOAPPathToString(here.path)))))
+			logGOAPDebug(color.InGreenOverWhite(color.InBold(">>>>>>>>>>>>>>>>>>>>>>")))
+			logGOAPDebug(color.InGreenOverWhite(color.InBold(fmt.Sprintf("%d solutions found so far", s.resultPq.Len()+1))))
+		}
+		heap.Push(s.resultPq, here)
+	} else {
+		if nUnfulfilled <= s.bestUnfulfilled {
+			s.best = here.path
+			s.bestUnfulfilled = nUnfulfilled
+		}
+		s.trace.expand(s.iter, here.path)
+		p.traverseFulfillers(s.pq, s.start, here, s.goal, s.pathsSeen)
+		s.iter++
+	}
+}
+
+func (s *GOAPPlanSession) finish() {
+	s.done = true
+	s.release()
+	defer s.trace.finish(s)
+	if s.iter >= s.maxIter {
+		logGOAPDebug("Took %f ms to reach max iter (%d)", s.elapsed, s.iter)
+		logGOAPDebug("================================ REACHED MAX ITER")
+	}
+	if s.resultPq.Len() == 0 {
+		if s.pq.Len() == 0 {
+			logGOAPDebug("Took %f ms to exhaust pq without solution (%d iterations)", s.elapsed, s.iter)
+			logGOAPDebug("================================ EXHAUSTED PQ WITHOUT SOLUTION")
+		}
+		return
+	}
+	logGOAPDebug("Took %f ms to find %d solutions (%d iterations)", s.elapsed, s.resultPq.Len(), s.iter)
+	if s.pq.Len() == 0 {
+		logGOAPDebug("Exhausted pq")
+	}
+	s.solution = heap.Pop(s.resultPq).(*GOAPPQueueItem).path
+	if s.p.Cache != nil {
+		s.p.Cache.store(s.cacheKey, s.solution)
+	}
+	logGOAPDebug("solution (cost %.3f): %s", s.solution.cost, color.InWhiteOverBlue(GOAPPathToString(s.solution)))
+}
+
+// release frees the planner for another session
+func (s *GOAPPlanSession) release() {
+	if s.p.session != s {
+		return
+	}
+	s.p.session = nil
+	s.p.boundSelectorsFlipflop = false
+	// we especially must clear this between sessions
+	s.p.selectorResultCache = make(map[string]*Entity)
+}
+
+// Cancel stops the search; Result() will give no plan
+func (s *GOAPPlanSession) Cancel() {
+	if s.done {
+		return
+	}
+	s.cancelled = true
+	s.done = true
+	s.release()
+	s.trace.finish(s)
+}
+
+func (s *GOAPPlanSession) Done() bool {
+	return s.done
+}
+
+func (s *GOAPPlanSession) Cancelled() bool {
+	return s.cancelled
+}
+
+// Iterations is how many paths the search has expanded
+func (s *GOAPPlanSession) Iterations() int {
+	return s.iter
+}
+
+// Elapsed is the time (ms) spent stepping the search
+func (s *GOAPPlanSession) Elapsed() float64 {
+	return s.elapsed
+}
+
+// Result gives the cheapest plan found, once the search is done
+func (s *GOAPPlanSession) Result() (solution *GOAPPath, ok bool) {
+	if s.solution == nil || s.cancelled {
+		return nil, false
+	}
+	return s.solution, true
+}
+
+// Best gives the cheapest solution found so far, or if there's none yet,
+// the path explored which leaves the fewest goals unfulfilled (nil if
+// nothing's been explored); ok is whether it fulfills the goal
+func (s *GOAPPlanSession) Best() (path *GOAPPath, ok bool) {
+	if s.solution != nil {
+		return s.solution, true
+	}
+	if s.resultPq.Len() > 0 {
+		return (*s.resultPq)[0].path, true
+	}
+	return s.best, false
+}
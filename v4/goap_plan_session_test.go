@@ -0,0 +1,96 @@
+package sameriver
+
+import (
+	"testing"
+)
+
+func TestGOAPPlanSessionIncremental(t *testing.T) {
+	_, _, rotten, _, x := testingGOAPExecutorWorld()
+	p := x.Planner
+	x.Entity.World.Despawn(rotten)
+	x.Entity.GetIntMap(STATE).Set("hasAxe", 0)
+	goal := map[string]int{"tree.chopped,=": 1}
+
+	s := p.NewPlanSession(x.State, goal, 50)
+	steps := 0
+	for !s.Step(1) {
+		steps++
+		if best, _ := s.Best(); best == nil {
+			t.Fatal("should always have a best path once the search has stepped")
+		}
+	}
+	if steps < 2 {
+		t.Fatalf("search should have taken several steps, took %d", steps)
+	}
+	solution, ok := s.Result()
+	if !ok {
+		t.Fatal("session should have found a plan")
+	}
+	if best, ok := s.Best(); !ok || best != solution {
+		t.Fatal("Best() should give the solution once found")
+	}
+	oneShot, _ := p.Plan(x.State, goal, 50)
+	if solution.String() != oneShot.String() {
+		t.Fatalf("stepped plan %s should match Plan()'s %s", solution, oneShot)
+	}
+	// a partial path is given before the goal is fulfilled
+	s = p.NewPlanSession(x.State, goal, 50)
+	s.Step(2)
+	if best, ok := s.Best(); ok || best == nil || len(best.path) != 1 || best.path[0].Name != "chopTree" {
+		t.Fatalf("best partial path should be [chopTree], got %v", best)
+	}
+}
+
+func TestGOAPPlanSessionCancel(t *testing.T) {
+	_, _, _, _, x := testingGOAPExecutorWorld()
+	p := x.Planner
+	goal := map[string]int{"tree.chopped,=": 1}
+	s := p.NewPlanSession(x.State, goal, 50)
+	s.Step(1)
+	// starting another session cancels the one running
+	s2 := p.NewPlanSession(x.State, goal, 50)
+	if !s.Done() || !s.Cancelled() {
+		t.Fatal("first session should have been cancelled")
+	}
+	if _, ok := s.Result(); ok {
+		t.Fatal("a cancelled session has no result")
+	}
+	s2.StepFor(0)
+	s2.Cancel()
+	if !s2.Done() || s2.Step(1) != true {
+		t.Fatal("cancelled session should be done")
+	}
+	if len(p.selectorResultCache) != 0 || p.session != nil {
+		t.Fatal("cancelling should have freed the planner")
+	}
+}
+
+func TestGOAPSystemPlanBudget(t *testing.T) {
+	_, s, rotten, _, x := testingGOAPExecutorWorld()
+	x.Entity.World.Despawn(rotten)
+	x.Entity.GetIntMap(STATE).Set("hasAxe", 0)
+	s.PlanBudgetMs = 0
+	s.PlanIterationsPerStep = 1
+	x.SetGoal(map[string]int{"tree.chopped,=": 1}, nil)
+	s.Update(FRAME_MS)
+	if x.Status != GOAP_EXEC_PLANNING || x.Session().Iterations() != 1 {
+		t.Fatal("planning should have been stepped one iteration")
+	}
+	for i := 0; i < 10 && x.Status == GOAP_EXEC_PLANNING; i++ {
+		s.Update(FRAME_MS)
+	}
+	if x.Status != GOAP_EXEC_RUNNING || x.Plan.path[0].Name != "getAxe" {
+		t.Fatalf("should have planned across updates, got status %d (%v)", x.Status, x.Err)
+	}
+	// updating directly, PlanIterations bounds each update's search
+	x.PlanIterations = 1
+	x.SetGoal(map[string]int{"tree.chopped,=": 1}, nil)
+	x.Update(FRAME_MS)
+	if x.Status != GOAP_EXEC_PLANNING {
+		t.Fatal("one iteration shouldn't have been enough to plan")
+	}
+	x.Cancel()
+	if x.Session() != nil || x.Status != GOAP_EXEC_IDLE {
+		t.Fatal("cancelling should have dropped the plan search")
+	}
+}
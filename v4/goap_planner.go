@@ -5,9 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
-	"regexp"
 	"strings"
-	"time"
 
 	"github.com/TwiN/go-color"
 )
@@ -15,8 +13,6 @@ import (
 var ErrGOAPNoValidBindEntity = errors.New("no entity matched selector")
 var ErrGOAPModalVsSymbolicValueConflict = errors.New("modal value was not what the eff math said it should be after action was applied")
 
-var METHOD_NOTATION_RE = regexp.MustCompile(`(\w+)\.(\w+)\((\w+)\)`)
-
 type GOAPPlanner struct {
 	e *Entity
 
@@ -32,25 +28,57 @@ type GOAPPlanner struct {
 	boundSelectorsFlipflop bool
 	// selector result cache
 	selectorResultCache map[string]*Entity
+	// entities that won't be selected for any node (see SetExcludedNodes())
+	excludedNodes map[*Entity]bool
+	// if set, nodes claimed to capacity by other agents won't be selected
+	Reservations *GOAPReservations
+	// the plan session running, if any
+	session *GOAPPlanSession
+	// if set, plan searches are recorded into it
+	Trace *GOAPTrace
+	// if set, plans are looked up in and stored to it (see GOAPPlanCache)
+	Cache *GOAPPlanCache
+	// the signature of our actions keying the cache, and the vars they refer
+	// to (computed lazily, reset on AddActions())
+	actionsSig string
+	actionVars map[string]bool
+
+	//
+	// travel
+	//
+
+	// the cost per unit of distance travelled (modally) to and with the
+	// nodes of actions, added to their cost (1 by default; 0 ignores travel)
+	TravelCostPerUnit float64
+	// if set, measures the distance travelled between two points (eg.
+	// NavGridTravelDistance()), rather than in a straight line. It should
+	// never be less than the straight-line distance.
+	TravelDistance func(from, to Vec2D) float64
 
 	//
 	// GOAP tetris pieces to put together :)
 	//
 	modalVals map[string]GOAPModalVal
 	actions   *GOAPActionSet
+	// the methods usable in var names (see RegisterModalMethods())
+	modalMethods map[string]*GOAPModalMethod
 
 	// map of [varName](map[action]bool), the set of actions for affecting each varName
 	varActions map[string](map[*GOAPAction]bool)
 }
 
 func NewGOAPPlanner(e *Entity) *GOAPPlanner {
-	return &GOAPPlanner{
+	p := &GOAPPlanner{
 		e:                   e,
 		modalVals:           make(map[string]GOAPModalVal),
 		actions:             NewGOAPActionSet(),
 		varActions:          make(map[string](map[*GOAPAction]bool)),
 		selectorResultCache: make(map[string]*Entity),
+		TravelCostPerUnit:   1,
+		modalMethods:        make(map[string]*GOAPModalMethod),
 	}
+	p.RegisterModalMethods(goapBuiltinModalMethods...)
+	return p
 }
 
 //
@@ -82,13 +110,22 @@ func (p *GOAPPlanner) selectNode(ws *GOAPWorldState, node string) (ent *Entity)
 			p.selectorResultCache[node] = ent
 		}
 	}()
+	// (actions done to or by ourselves, eg. getting an axe, use the node
+	// "self", which is always bound to us)
+	if node == "self" {
+		return p.e
+	}
 	world := p.e.World
 	pos := ws.GetModal(p.e, POSITION).(*Vec2D)
 	box := p.e.GetVec2D(BOX)
 
 	// use a selector to find the node entity (ent)
 	trySelect := func(selector func(*Entity) bool) *Entity {
-		return world.ClosestEntityFilter(*pos, *box, selector)
+		return world.ClosestEntityFilter(*pos, *box, func(candidate *Entity) bool {
+			return !p.excludedNodes[candidate] &&
+				(p.Reservations == nil || p.Reservations.Available(p.e, candidate)) &&
+				selector(candidate)
+		})
 	}
 	var selector func(*Entity) bool
 	var okBound bool
@@ -177,6 +214,13 @@ func (p *GOAPPlanner) BindEntitySelectors(selectors map[string]any) {
 	}
 }
 
+// SetExcludedNodes sets the entities which won't be selected for any node in
+// subsequent Plan() calls, whether by bound or generic selectors (the
+// GOAPExecutor uses this to avoid nodes which recently broke a plan)
+func (p *GOAPPlanner) SetExcludedNodes(excluded map[*Entity]bool) {
+	p.excludedNodes = excluded
+}
+
 func (p *GOAPPlanner) selectorFromString(s string) func(*Entity) bool {
 	parts := strings.SplitN(s, ".", 2)
 	if len(parts) != 2 {
@@ -210,102 +254,25 @@ func (p *GOAPPlanner) createModalValDotNotation(node, stateKey string) GOAPModal
 		},
 		effModalSet: func(ws *GOAPWorldState, op string, x int) {
 			state := ws.GetModal(ws.ModalEntities[node], STATE).(*IntMap).CopyOf()
-			if op == "=" {
-				state.Set(stateKey, x)
-			}
+			state.Set(stateKey, GOAPEffFunc(op, x)(1, state.Get(stateKey)))
 			ws.SetModal(ws.ModalEntities[node], STATE, &state)
 		},
 	}
 }
 
-func (p *GOAPPlanner) parseParenthesesNotation(valName string) (node, method, param string) {
-	matches := METHOD_NOTATION_RE.FindStringSubmatch(valName)
-	if len(matches) == 4 {
-		node = matches[1]
-		method = matches[2]
-		param = matches[3]
+// the modal val for varName in method notation (eg. self.inventoryHas(yoke)),
+// created (see GOAPModalMethod) the first time it's asked for
+func (p *GOAPPlanner) methodNotationModal(varName string) (modal GOAPModalVal, ok bool) {
+	if modal, ok = p.modalVals[varName]; ok {
+		return modal, true
 	}
-	return
-}
-
-func (p *GOAPPlanner) createModalValInventoryHas(node, archetype string) GOAPModalVal {
-	items := p.e.World.systems["ItemSystem"].(*ItemSystem)
-	return GOAPModalVal{
-		name:  node + ".inventoryHas(" + archetype + ")",
-		nodes: []string{node},
-		check: func(ws *GOAPWorldState) int {
-			inv := ws.GetModal(ws.ModalEntities[node], INVENTORY).(*Inventory)
-			count := inv.CountName(archetype)
-			return count
-		},
-		effModalSet: func(ws *GOAPWorldState, op string, x int) {
-			inv := ws.GetModal(ws.ModalEntities[node], INVENTORY).(*Inventory).CopyOf()
-			switch op {
-			case "-":
-				inv.DebitNName(x, archetype)
-			case "=":
-				if x == 0 {
-					inv.DebitAllName(archetype)
-				} else {
-					inv.SetCountName(x, archetype)
-				}
-			case "+":
-				count := inv.CountName(archetype)
-				if count == 0 {
-					inv.Credit(items.CreateStackSimple(x, archetype))
-				} else {
-					inv.SetCountName(count+x, archetype)
-				}
-			}
-			ws.SetModal(ws.ModalEntities[node], INVENTORY, inv)
-		},
+	if !METHOD_NOTATION_RE.MatchString(varName) {
+		return modal, false
 	}
-}
-
-func (p *GOAPPlanner) createModalValIn(node, other string) GOAPModalVal {
-	return GOAPModalVal{
-		name:  fmt.Sprintf("%s.in(%s)", node, other),
-		nodes: []string{node, other},
-		check: func(ws *GOAPWorldState) int {
-			entity := ws.ModalEntities[node]
-			otherEntity := ws.ModalEntities[other]
-			entityPos := ws.GetModal(entity, POSITION).(*Vec2D)
-			if RectIntersectsRect(
-				*entityPos, *entity.GetVec2D(BOX),
-				*otherEntity.GetVec2D(POSITION), *otherEntity.GetVec2D(BOX)) {
-				return 1
-			} else {
-				return 0
-			}
-		},
-		effModalSet: func(ws *GOAPWorldState, op string, x int) {
-			entity := ws.ModalEntities[node]
-			otherEntity := ws.ModalEntities[other]
-			if op == "=" {
-				switch x {
-				case 0:
-					// TODO: this should really be a call to some kind of sophisticated
-					// relocation function that avoids obstacles and makes sure there's a path
-					// to be able to get there via navmesh/grid
-					awayFromOther := otherEntity.GetVec2D(POSITION).Add(otherEntity.GetVec2D(BOX).Scale(1.1))
-					ws.SetModal(entity, POSITION, &awayFromOther)
-				case 1:
-					otherCenter := *otherEntity.GetVec2D(POSITION)
-					ws.SetModal(entity, POSITION, &otherCenter)
-				}
-			}
-		},
-	}
-}
-
-func (p *GOAPPlanner) createModalValMethodNotation(node, method, param string) GOAPModalVal {
-	switch method {
-	case "inventoryHas":
-		return p.createModalValInventoryHas(node, param)
-	case "in":
-		return p.createModalValIn(node, param)
-	}
-	panic(fmt.Sprintf("method %s does not exist for modal vals", method))
+	logGOAPDebug("[][][]     adding modal val for %s", varName)
+	modal = p.createModalValMethodNotation(varName)
+	p.modalVals[varName] = modal
+	return modal, true
 }
 
 //
@@ -320,7 +287,7 @@ func (p *GOAPPlanner) AddModalVals(vals ...GOAPModalVal) {
 
 func (p *GOAPPlanner) checkModalInto(varName string, ws *GOAPWorldState) {
 	if _, ok := p.modalVals[varName]; ok {
-		ws.vals[varName] = p.modalVals[varName].check(ws)
+		ws.vals[varName] = p.modalVals[varName].value(ws)
 	}
 }
 
@@ -332,6 +299,7 @@ func (p *GOAPPlanner) actionAffectsVar(action *GOAPAction, varName string) {
 }
 
 func (p *GOAPPlanner) AddActions(actions ...*GOAPAction) {
+	p.actionsSig = ""
 	for _, action := range actions {
 		logGOAPDebug("[][][] adding action %s", action.DisplayName())
 		p.actions.Add(action)
@@ -341,16 +309,16 @@ func (p *GOAPPlanner) AddActions(actions ...*GOAPAction) {
 			// basic pre-added modal val (simple string, no dots)
 			if modal, ok := p.modalVals[varName]; ok {
 				logGOAPDebug("[][][]     adding modal setter for %s", varName)
-				action.effModalSetters[varName] = modal.effModalSet
+				action.effModalSetters[varName] = modal.set
 			} else {
 				// this modal doesn't exist yet - does it have a special notation?
 				// method notation? aka villager.hasInventory(bow)
-				if METHOD_NOTATION_RE.MatchString(varName) {
-					node, method, param := p.parseParenthesesNotation(varName)
+				if modal, ok := p.methodNotationModal(varName); ok {
+					if !modal.settable() {
+						panic(fmt.Sprintf("%s can't be an eff (of action %s): its modal method has no Set", varName, action.Name))
+					}
 					logGOAPDebug("[][][]     adding modal setter for %s", varName)
-					modal := p.createModalValMethodNotation(node, method, param)
-					p.modalVals[varName] = modal
-					action.effModalSetters[varName] = modal.effModalSet
+					action.effModalSetters[varName] = modal.set
 				} else if parts := strings.SplitN(varName, ".", 2); len(parts) == 2 {
 					// dot STATE intmap notation? aka field.tilled
 					node := parts[0]
@@ -359,18 +327,22 @@ func (p *GOAPPlanner) AddActions(actions ...*GOAPAction) {
 					// create modal val
 					modal := p.createModalValDotNotation(node, key)
 					p.modalVals[varName] = modal
-					action.effModalSetters[varName] = modal.effModalSet
+					action.effModalSetters[varName] = modal.set
 				}
 			}
 		}
 		// link up modal checks for pres matching modal varnames
 		for _, tg := range action.pres.temporalGoals {
 			for varName := range tg.vars {
+				// (vars in method notation are modal even if no action has
+				// them as an eff, eg. self.near(well, 5) becoming true as we
+				// travel)
+				p.methodNotationModal(varName)
 				if modal, ok := p.modalVals[varName]; ok {
 					// NOTE: this will pick up the generated special notation modals too
 					// since they were just added to p.modalVals
 					logGOAPDebug("[][][]     adding modal check for %s", varName)
-					action.preModalChecks[varName] = modal.check
+					action.preModalChecks[varName] = modal.value
 				}
 			}
 		}
@@ -391,7 +363,7 @@ func (p *GOAPPlanner) applyActionBasic(
 		op := action.ops[varName]
 		x := ws.vals[varName]
 		if DEBUG_GOAP {
-			logGOAPDebug("     %s       %d x %s%s%d(%d) ; = %d",
+			logGOAPDebug("     %s       %d x %s%s%g(%g) ; = %g",
 				color.InWhiteOverYellow(">>>"),
 				action.Count, varName, op, eff.val, x,
 				eff.f(action.Count, x))
@@ -415,41 +387,40 @@ func (p *GOAPPlanner) applyActionModal(a *GOAPAction, ws *GOAPWorldState) (newWS
 	}
 	node := ws.ModalEntities[a.Node]
 	nodePos := ws.GetModal(node, POSITION).(*Vec2D)
-	distToGetHere := nodePos.Sub(*beforePos).Magnitude()
+	travelToGetHere, err := p.travelCost(a, *beforePos, *nodePos)
+	if err != nil {
+		return nil, -1, err
+	}
 	// now we are at it
 	nowPos := *nodePos
 	ws.SetModal(p.e, POSITION, &nowPos)
-	logGOAPDebug("        distance to get to node for action %s: %f", a.Name, distToGetHere)
-	cost = distToGetHere
-	switch a.cost.(type) {
-	case int:
-		cost += float64(a.Count * a.cost.(int))
-	case func() int:
-		cost += float64(a.Count * a.cost.(func() int)())
-	}
+	logGOAPDebug("        travel cost to get to node for action %s: %f", a.Name, travelToGetHere)
+	cost = travelToGetHere + a.inherentCost()
 
 	// apply the modal state changes involved in this actions effs
 	newWS = p.applyActionBasic(a, ws, false)
 	for varName, eff := range a.effs {
 		op := a.ops[varName]
 		x := ws.vals[varName]
-		logGOAPDebug("    %s        applying %s::%d x %s%s%d(%d) ; = %d",
+		logGOAPDebug("    %s        applying %s::%d x %s%s%g(%g) ; = %g",
 			color.InPurpleOverWhite(" >>>modal "),
 			a.DisplayName(), a.Count, varName, op, eff.val, x,
 			eff.f(a.Count, x))
 		// do modal set
 		if setter, ok := a.effModalSetters[varName]; ok {
-			setter(newWS, op, a.Count*eff.val)
+			setter(newWS, op, eff.modalAmount(a.Count))
 		}
 	}
 
-	// re-check any modal vals
+	// re-check any modal vals (those the action has as effs must come out
+	// as the eff math said; others may have changed as a side-effect, eg. of
+	// our travelling to the node)
 	for varName := range newWS.vals {
 		if modalVal, ok := p.modalVals[varName]; ok {
 			logGOAPDebug("              re-checking modal val %s", varName)
 			supposedToBe := newWS.vals[varName]
-			newWS.vals[varName] = modalVal.check(newWS)
-			if newWS.vals[varName] != supposedToBe {
+			newWS.vals[varName] = modalVal.value(newWS)
+			if _, isEff := a.effs[varName]; isEff && math.Abs(newWS.vals[varName]-supposedToBe) > GOAP_EPSILON {
 				err := fmt.Errorf("%w for %s", ErrGOAPModalVsSymbolicValueConflict, varName)
 				logGOAPDebug(color.InPurpleOverWhite(fmt.Sprintf("%s", err)))
 				return nil, -1, err
@@ -467,9 +438,12 @@ func (p *GOAPPlanner) applyActionModal(a *GOAPAction, ws *GOAPWorldState) (newWS
 	}
 
 	afterPos := newWS.GetModal(p.e, POSITION).(*Vec2D)
-	distTravelled := nowPos.Sub(*afterPos).Magnitude()
-	logGOAPDebug("        distance travelled during action %s: %f", a.Name, distTravelled)
-	cost += distTravelled
+	travelDuring, err := p.travelCost(a, nowPos, *afterPos)
+	if err != nil {
+		return nil, -1, err
+	}
+	logGOAPDebug("        travel cost during action %s: %f", a.Name, travelDuring)
+	cost += travelDuring
 
 	return newWS, cost, nil
 }
@@ -490,16 +464,20 @@ func (p *GOAPPlanner) computeCostAndRemainingsOfPath(path *GOAPPath, start *GOAP
 				surface.surface[i],
 				tg.remaining(ws))
 		}
-		var cost float64
-		bindErr := p.bindEntities(append(a.otherNodes, a.Node), ws, false)
+		// (applied to a copy, so that each state along stays as it was
+		// before the action, and nodes are selected closest to where we'll
+		// be at the insertion point rather than at the end of the path)
+		next := ws.CopyOf()
+		bindErr := p.bindEntities(append(a.otherNodes, a.Node), next, false)
 		if bindErr != nil {
 			return bindErr
 		}
-		ws, cost, modalErr := p.applyActionModal(a, ws)
+		next, cost, modalErr := p.applyActionModal(a, next)
 		if modalErr != nil {
 			return modalErr
 		}
 		totalCost += cost
+		ws = next
 		path.statesAlong[i+1] = ws
 	}
 	for _, tg := range main.temporalGoals {
@@ -508,10 +486,11 @@ func (p *GOAPPlanner) computeCostAndRemainingsOfPath(path *GOAPPath, start *GOAP
 			tg.remaining(ws))
 	}
 	path.remainings = surface
-	// total distance travelled and inherent effort of actions modally
-	// we offset by +1 so that when NUnfulfilled == 0, we have a solution,
-	// and the path cost is just the distance + inherent effort cost computed modally
-	path.cost = totalCost * float64(path.remainings.NUnfulfilled()+1)
+	// the cost of travel and the inherent effort of the actions, computed
+	// modally (g), plus a lower bound on the cost of fulfilling what remains
+	// (h), so that the queue pops paths in A* order; a solution, with
+	// nothing remaining, costs just what it takes
+	path.cost = totalCost + p.remainingCostHeuristic(path)
 	logGOAPDebug("  --- ws after path: %v", ws.vals)
 	return nil
 }
@@ -575,21 +554,26 @@ func (p *GOAPPlanner) actionHelpsToInsert(
 				logGOAPDebug("      [ ] eff affects var: %s; is it satisfactory/closer?", effVarName)
 				// all other cases
 				stateAtPoint := path.statesAlong[insertionIx].vals[varName]
-				needToBeat := interval.Diff(float64(stateAtPoint))
-				actionDiff := interval.Diff(float64(eff.f(action.Count, stateAtPoint)))
+				needToBeat := interval.Diff(stateAtPoint)
+				actionDiff := interval.Diff(eff.f(action.Count, stateAtPoint))
 				if DEBUG_GOAP {
 					logGOAPDebug(path.String())
-					logGOAPDebug("            ws[%s] = %d (before)", varName, stateAtPoint)
-					logGOAPDebug("              needToBeat diff: %d", int(needToBeat))
-					logGOAPDebug("              actionDiff: %d", int(actionDiff))
+					logGOAPDebug("            ws[%s] = %g (before)", varName, stateAtPoint)
+					logGOAPDebug("              needToBeat diff: %g", needToBeat)
+					logGOAPDebug("              actionDiff: %g", actionDiff)
 				}
 				if math.Abs(actionDiff) < math.Abs(needToBeat) {
 					logGOAPDebug("      [X] eff closer")
 					// compute how many of this action we need
 					// if we had diff 0, we just need one
-					if actionDiff == 0 {
+					if math.Abs(actionDiff) < GOAP_EPSILON {
 						return 1, true
 					}
+					// (scaling, we need as many as bring the var to the
+					// near end of the interval)
+					if eff.op == "*" {
+						return goapScaleEffCount(stateAtPoint, stateAtPoint+needToBeat, eff.val), true
+					}
 					// but if diff is nonzero, we need some scale
 					// (note that diff is missing 1 val since we computed
 					// the diff after applying 1 of the action, so we do
@@ -601,7 +585,8 @@ func (p *GOAPPlanner) actionHelpsToInsert(
 						} else if eff.op == "+" {
 							diffMagnitude = needToBeat
 						}
-						scale := int(math.Ceil(diffMagnitude / float64(eff.val)))
+						// (forgiving rounding error, eg. 0.3 / 0.1)
+						scale := int(math.Ceil(diffMagnitude/eff.val - GOAP_EPSILON))
 						return scale, true
 					}
 				} else {
@@ -630,6 +615,19 @@ func (p *GOAPPlanner) actionHelpsToInsert(
 	return helpsGoal(goalToHelp.goalLeft)
 }
 
+// how many times x must be scaled by factor to reach target (at least once)
+func goapScaleEffCount(x, target, factor float64) int {
+	ratio := target / x
+	if x == 0 || ratio <= 0 || factor <= 0 || factor == 1 {
+		return 1
+	}
+	n := int(math.Ceil(math.Log(ratio)/math.Log(factor) - GOAP_EPSILON))
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
 func (p *GOAPPlanner) setPositionInStartModalIfNotDefined(start *GOAPWorldState) {
 	start.SetModal(p.e, POSITION, p.e.GetVec2D(POSITION))
 }
@@ -637,13 +635,14 @@ func (p *GOAPPlanner) setPositionInStartModalIfNotDefined(start *GOAPWorldState)
 func (p *GOAPPlanner) setVarInStartIfNotDefined(start *GOAPWorldState, varName string) (bindErr error) {
 	logGOAPDebug("[ ] setVarInStartIfNotDefined(%s)", varName)
 	if _, already := start.vals[varName]; !already {
+		p.methodNotationModal(varName)
 		if modal, isModal := p.modalVals[varName]; isModal {
 			bindErr = p.bindEntities(modal.nodes, start, true)
 			if bindErr != nil {
 				return bindErr
 			}
 			p.checkModalInto(varName, start)
-			logGOAPDebug(color.InPurple(fmt.Sprintf("[ ] start.vals[\"%s\"] = %d", varName, start.vals[varName])))
+			logGOAPDebug(color.InPurple(fmt.Sprintf("[ ] start.vals[\"%s\"] = %g", varName, start.vals[varName])))
 		} else {
 			// NOTE: vars that don't have modal check default to 0
 			logGOAPDebug(color.InYellow(fmt.Sprintf("[ ] %s not defined in GOAP start state, and no modal check exists. Defaulting to 0.", varName)))
@@ -678,6 +677,7 @@ func (p *GOAPPlanner) traverseFulfillers(
 	goal *GOAPTemporalGoal,
 	pathsSeen map[string]bool) {
 
+	trace := p.searchTrace()
 	if DEBUG_GOAP {
 		logGOAPDebug("traverse--------------------------")
 		logGOAPDebug(color.InRedOverGray("remaining:"))
@@ -746,6 +746,7 @@ func (p *GOAPPlanner) traverseFulfillers(
 					bindErr := p.trySelectNodes(here.path.statesAlong[insertionIx], append(action.otherNodes, action.Node))
 					if bindErr != nil {
 						logGOAPDebug(color.InBold(color.InYellow(fmt.Sprintf("although action %s affects var %s, it cannot select a node: %s", action.Name, varName, bindErr))))
+						trace.reject(action, varName, fmt.Sprintf("cannot select a node: %s", bindErr))
 						continue
 					}
 
@@ -773,6 +774,7 @@ func (p *GOAPPlanner) traverseFulfillers(
 						pathStr := newPath.String()
 						if _, ok := pathsSeen[pathStr]; ok {
 							logGOAPDebug(color.InBold(color.InWhiteOverCyan("path seen already")))
+							trace.reject(action, varName, "path seen already")
 							continue
 						}
 						// check any modal vals in the pres of action that aren't already
@@ -794,12 +796,14 @@ func (p *GOAPPlanner) traverseFulfillers(
 						}
 						if bindErrInPres != nil {
 							logGOAPDebug(color.InBold(color.InWhiteOverCyan(fmt.Sprintf("in pre of action %s, modal varName %s's modal resolution encountered bind failure: %s", toInsert.DisplayName(), bindErrVar, bindErrInPres))))
+							trace.reject(action, varName, fmt.Sprintf("pre %s cannot bind: %s", bindErrVar, bindErrInPres))
 							continue
 						}
 						// compute remainings of path from start to end goal
 						computeErr := p.computeCostAndRemainingsOfPath(newPath, start, goal)
 						if computeErr != nil {
 							logGOAPDebug(color.InBold(color.InWhiteOverCyan(fmt.Sprintf("err for action %s: %s", toInsert.DisplayName(), computeErr))))
+							trace.reject(action, varName, computeErr.Error())
 							continue
 						}
 
@@ -812,8 +816,10 @@ func (p *GOAPPlanner) traverseFulfillers(
 						}
 						pathsSeen[pathStr] = true
 						heap.Push(pq, &GOAPPQueueItem{path: newPath})
+						trace.push(here.path, newPath, toInsert)
 					} else {
 						logGOAPDebug("[_] %s not helpful", action.DisplayName())
+						trace.reject(action, varName, "not helpful")
 					}
 				}
 			}
@@ -822,120 +828,14 @@ func (p *GOAPPlanner) traverseFulfillers(
 	logGOAPDebug("--------------------------/traverse")
 }
 
+// Plan searches for the cheapest plan from start fulfilling goalSpec, all in
+// one call (see NewPlanSession() to spread the search across frames)
 func (p *GOAPPlanner) Plan(
 	start *GOAPWorldState,
 	goalSpec any,
 	maxIter int) (solution *GOAPPath, ok bool) {
 
-	defer func() {
-		p.boundSelectorsFlipflop = false
-		// we especially must clear this between Plan() calls
-		p.selectorResultCache = make(map[string]*Entity)
-	}()
-
-	// we may be writing to this with modal vals as we explore and don't want
-	// to pollute the caller's state object
-	start = start.CopyOf()
-	start.w = p.e.World
-	p.setPositionInStartModalIfNotDefined(start)
-	start.ModalEntities["self"] = p.e
-
-	logGOAPDebug("Planning...")
-
-	// convert goal spec into GOAPTemporalGoal
-	goal := NewGOAPTemporalGoal(goalSpec)
-
-	// populate start state with any modal vals at start
-	for _, tg := range goal.temporalGoals {
-		for varName := range tg.vars {
-			p.setVarInStartIfNotDefined(start, varName)
-		}
-	}
-
-	// used to return the solution with lowest cost among solutions found
-	resultPq := &GOAPPriorityQueue{}
-	heap.Init(resultPq)
-
-	// used to keep track of which paths we've already seen since there's multiple ways to
-	// reach a path in the insertion-based logic we use
-	pathsSeen := make(map[string]bool)
-
-	// used for the search
-	pq := &GOAPPriorityQueue{}
-	heap.Init(pq)
-
-	rootPath := NewGOAPPath(nil)
-	p.computeCostAndRemainingsOfPath(rootPath, start, goal)
-	rootPath.regionOffsets[0] = make([]int, len(goal.temporalGoals))
-	backtrackRoot := &GOAPPQueueItem{
-		path:  rootPath,
-		index: -1, // going to be set by Push()
-	}
-	heap.Push(pq, backtrackRoot)
-
-	iter := 0
-	// TODO: should we just pop out the *very first result*?
-	// why wait for 2 or exhausting the pq?
-	t0 := time.Now()
-	// remove resultPq.Len() < 2 to exhaust space/max iter
-	for iter < maxIter && pq.Len() > 0 {
-
-		logGOAPDebug("=== iter ===")
-		here := heap.Pop(pq).(*GOAPPQueueItem)
-		if DEBUG_GOAP {
-			logGOAPDebug(color.InRedOverGray("here:"))
-			logGOAPDebug(color.InWhiteOverBlue(color.InBold(GOAPPathToString(here.path))))
-			logGOAPDebug(color.InRedOverGray(fmt.Sprintf("(%d unfulfilled)",
-				here.path.remainings.NUnfulfilled())))
-		}
-
-		if here.path.remainings.NUnfulfilled() == 0 {
-			ok := p.validateForward(here.path, start, goal)
-			if !ok {
-				logGOAPDebug(">>>>>>> potential solution rejected")
-				continue
-			}
-
-			if DEBUG_GOAP {
-				logGOAPDebug(color.InGreenOverWhite(color.InBold(">>>>>>>>>>>>>>>>>>>>>>")))
-				logGOAPDebug(color.InGreenOverWhite(color.InBold(">>>>>>>>>>>>>>>>>>>>>>")))
-				logGOAPDebug(color.InGreenOverWhite(color.InBold(">>>>>>>>>>>>>>>>>>>>>>")))
-				logGOAPDebug(color.InGreenOverWhite(color.InBold(fmt.Sprintf("    SOLUTION: %s", GOAPPathToString(here.path)))))
-				logGOAPDebug(color.InGreenOverWhite(color.InBold(">>>>>>>>>>>>>>>>>>>>>>")))
-				logGOAPDebug(color.InGreenOverWhite(color.InBold(">>>>>>>>>>>>>>>>>>>>>>")))
-				logGOAPDebug(color.InGreenOverWhite(color.InBold(">>>>>>>>>>>>>>>>>>>>>>")))
-				logGOAPDebug(color.InGreenOverWhite(color.InBold(GOAPPathToString(here.path))))
-				logGOAPDebug(color.InGreenOverWhite(color.InBold(fmt.Sprintf("%d solutions found so far", resultPq.Len()+1))))
-			}
-			heap.Push(resultPq, here)
-		} else {
-			p.traverseFulfillers(pq, start, here, goal, pathsSeen)
-			iter++
-		}
-	}
-
-	dt := float64(time.Since(t0).Nanoseconds()) / 1.0e6
-	if iter >= maxIter {
-		logGOAPDebug("Took %f ms to reach max iter (%d)", dt, iter)
-		logGOAPDebug("================================ REACHED MAX ITER")
-	}
-	if pq.Len() == 0 && resultPq.Len() == 0 {
-		logGOAPDebug("Took %f ms to exhaust pq without solution (%d iterations)", dt, iter)
-		logGOAPDebug("================================ EXHAUSTED PQ WITHOUT SOLUTION")
-	}
-	if resultPq.Len() > 0 {
-		logGOAPDebug("Took %f ms to find %d solutions (%d iterations)", dt, resultPq.Len(), iter)
-		if pq.Len() == 0 {
-			logGOAPDebug("Exhausted pq")
-		}
-		results := make([]*GOAPPath, 0)
-		for resultPq.Len() > 0 {
-			pop := heap.Pop(resultPq).(*GOAPPQueueItem).path
-			results = append(results, pop)
-			logGOAPDebug("solution (cost %.3f): %s", pop.cost, color.InWhiteOverBlue(GOAPPathToString(pop)))
-		}
-		return results[0], true
-	} else {
-		return nil, false
-	}
+	s := p.NewPlanSession(start, goalSpec, maxIter)
+	s.Step(math.MaxInt)
+	return s.Result()
 }
@@ -27,7 +27,7 @@ func debugGOAPGoalToString(g *GOAPGoal) string {
 	}
 	msg := ""
 	for varName, interval := range g.vars {
-		varInterval := fmt.Sprintf("%s: [%.0f, %.0f]", varName, interval.A, interval.B)
+		varInterval := fmt.Sprintf("%s: [%g, %g]", varName, interval.A, interval.B)
 		msg = fmt.Sprintf("%s  %s", msg, color.InRedOverWhite(color.InBold(varInterval)))
 	}
 	return msg
@@ -42,7 +42,7 @@ func debugGOAPPrintGoalRemaining(g *GOAPGoalRemaining) {
 		return
 	}
 	for varName, interval := range g.goalLeft {
-		msg := fmt.Sprintf("    %s: [%.0f, %.0f]    ", varName, interval.A, interval.B)
+		msg := fmt.Sprintf("    %s: [%g, %g]    ", varName, interval.A, interval.B)
 
 		logGOAPDebug(color.InBlackOverBlack(strings.Repeat(" ", len(msg))))
 		logGOAPDebug(color.InBold(color.InRedOverBlack(msg)))
@@ -0,0 +1,215 @@
+package sameriver
+
+import (
+	"errors"
+)
+
+var ErrGOAPNodeReserved = errors.New("node reserved by another agent")
+
+// GOAPReservations is a world-level register of which agents have claimed
+// which entities as the nodes of their plans, so that many agents planning
+// at once don't all bind the same ox or tree and then collide executing.
+// Planners whose Reservations is set won't select a node that others have
+// claimed to capacity (1 by default; see SetCapacity()), and GOAPExecutors
+// claim the nodes of their plans when they start them, renewing the claims
+// while they run and releasing them when the plan ends (however it ends) or
+// no remaining action needs them.
+//
+// Claims expire after TTLMs unless renewed, so that an agent which stops
+// updating (or is despawned mid-plan) doesn't hold its nodes forever. The
+// clock is advanced by the GOAPSystem (or call Update() directly).
+type GOAPReservations struct {
+	// how long a claim lasts without being renewed (0: until released)
+	TTLMs float64
+
+	t float64
+	// node -> holder -> when the claim expires
+	claims   map[*Entity]map[*Entity]float64
+	capacity map[*Entity]int
+}
+
+func NewGOAPReservations() *GOAPReservations {
+	return &GOAPReservations{
+		TTLMs:    10000,
+		claims:   make(map[*Entity]map[*Entity]float64),
+		capacity: make(map[*Entity]int),
+	}
+}
+
+// GOAPReservations gives the world's reservations, shared by the planners
+// of all agents that use it
+func (w *World) GOAPReservations() *GOAPReservations {
+	if w.reservations == nil {
+		w.reservations = NewGOAPReservations()
+	}
+	return w.reservations
+}
+
+// Update advances the clock by which claims expire
+func (r *GOAPReservations) Update(dt_ms float64) {
+	r.t += dt_ms
+}
+
+// SetCapacity sets how many agents may hold node at once (eg. a well
+// several can draw from)
+func (r *GOAPReservations) SetCapacity(node *Entity, n int) {
+	r.capacity[node] = n
+}
+
+func (r *GOAPReservations) Capacity(node *Entity) int {
+	if n, ok := r.capacity[node]; ok {
+		return n
+	}
+	return 1
+}
+
+// Holders gives the agents with live claims on node
+func (r *GOAPReservations) Holders(node *Entity) []*Entity {
+	r.expire(node)
+	holders := make([]*Entity, 0, len(r.claims[node]))
+	for holder := range r.claims[node] {
+		holders = append(holders, holder)
+	}
+	return holders
+}
+
+// Available is whether holder holds node or could claim it
+func (r *GOAPReservations) Available(holder, node *Entity) bool {
+	r.expire(node)
+	held := r.claims[node]
+	if _, ok := held[holder]; ok {
+		return true
+	}
+	return len(held) < r.Capacity(node)
+}
+
+// Claim claims node for holder (or renews holder's claim), giving whether
+// holder now holds it
+func (r *GOAPReservations) Claim(holder, node *Entity) bool {
+	if !r.Available(holder, node) {
+		return false
+	}
+	held, ok := r.claims[node]
+	if !ok {
+		held = make(map[*Entity]float64)
+		r.claims[node] = held
+	}
+	held[holder] = r.expiry()
+	return true
+}
+
+// Release drops holder's claim on node
+func (r *GOAPReservations) Release(holder, node *Entity) {
+	held, ok := r.claims[node]
+	if !ok {
+		return
+	}
+	delete(held, holder)
+	if len(held) == 0 {
+		delete(r.claims, node)
+	}
+}
+
+// ReleaseAll drops all of holder's claims
+func (r *GOAPReservations) ReleaseAll(holder *Entity) {
+	for node := range r.claims {
+		r.Release(holder, node)
+	}
+}
+
+func (r *GOAPReservations) expiry() float64 {
+	if r.TTLMs == 0 {
+		return -1
+	}
+	return r.t + r.TTLMs
+}
+
+// drops the expired claims on node, and those of despawned holders
+func (r *GOAPReservations) expire(node *Entity) {
+	for holder, until := range r.claims[node] {
+		if holder.Despawned || (until >= 0 && until <= r.t) {
+			r.Release(holder, node)
+		}
+	}
+}
+
+// GOAPSquad is a group of agents given a shared goal, whose executors plan
+// one at a time (the next waiting until the last has found its plan and
+// claimed its nodes), so that with their planners consulting the same
+// Reservations, each binds nodes the others haven't. The plans are
+// de-conflicted rather than planned jointly: each member plans for the goal
+// on its own, against what the members before it have claimed.
+//
+// The squad has a Blackboard, the parent of its members' entity
+// blackboards, for them to share what they know (set its parent to scope it
+// under a world blackboard).
+type GOAPSquad struct {
+	Members      []*GOAPExecutor
+	Reservations *GOAPReservations
+	Blackboard   *Blackboard
+
+	// the member whose turn it is to plan
+	planning *GOAPExecutor
+}
+
+// NewGOAPSquad makes a squad of the executors given, pointing their
+// planners at r (the world's reservations if nil)
+func NewGOAPSquad(r *GOAPReservations, members ...*GOAPExecutor) *GOAPSquad {
+	if r == nil && len(members) > 0 {
+		r = members[0].Entity.World.GOAPReservations()
+	}
+	s := &GOAPSquad{
+		Members:      members,
+		Reservations: r,
+		Blackboard:   NewBlackboard("squad"),
+	}
+	for _, x := range members {
+		x.Squad = s
+		x.Planner.Reservations = r
+		x.Entity.Blackboard().SetParent(s.Blackboard)
+	}
+	if len(members) > 0 {
+		members[0].Entity.World.AddBlackboard(s.Blackboard)
+	}
+	return s
+}
+
+// SetGoal sets goal for every member (with ws as its symbolic state, or
+// the member's own State if nil)
+func (s *GOAPSquad) SetGoal(goal any, ws *GOAPWorldState) {
+	for _, x := range s.Members {
+		x.SetGoal(goal, ws)
+	}
+}
+
+// Done is whether every member's plan has ended; succeeded is how many
+// succeeded
+func (s *GOAPSquad) Done() (done bool, succeeded int) {
+	done = true
+	for _, x := range s.Members {
+		switch x.Status {
+		case GOAP_EXEC_SUCCEEDED:
+			succeeded++
+		case GOAP_EXEC_FAILED, GOAP_EXEC_IDLE:
+		default:
+			done = false
+		}
+	}
+	return done, succeeded
+}
+
+// takeTurn gives whether x may plan now, making it x's turn if no one
+// else's it is
+func (s *GOAPSquad) takeTurn(x *GOAPExecutor) bool {
+	if s.planning != nil && s.planning != x && s.planning.Status == GOAP_EXEC_PLANNING {
+		return false
+	}
+	s.planning = x
+	return true
+}
+
+func (s *GOAPSquad) endTurn(x *GOAPExecutor) {
+	if s.planning == x {
+		s.planning = nil
+	}
+}
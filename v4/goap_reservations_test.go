@@ -0,0 +1,187 @@
+package sameriver
+
+import (
+	"testing"
+)
+
+func TestGOAPReservations(t *testing.T) {
+	w := testingWorld()
+	spawn := func() *Entity {
+		return w.Spawn(map[string]any{
+			"components": map[ComponentID]any{
+				POSITION: Vec2D{0, 0},
+				BOX:      Vec2D{1, 1},
+			},
+		})
+	}
+	a, b, c := spawn(), spawn(), spawn()
+	ox, well := spawn(), spawn()
+
+	r := NewGOAPReservations()
+	r.TTLMs = 100
+	if !r.Claim(a, ox) || !r.Claim(a, ox) {
+		t.Fatal("a should be able to claim and renew the ox")
+	}
+	if r.Available(b, ox) || r.Claim(b, ox) {
+		t.Fatal("b shouldn't be able to claim the ox a holds")
+	}
+	r.SetCapacity(well, 2)
+	if !r.Claim(a, well) || !r.Claim(b, well) || r.Claim(c, well) {
+		t.Fatal("only two should be able to claim the well")
+	}
+	r.Release(a, well)
+	if !r.Claim(c, well) {
+		t.Fatal("c should be able to claim the well once a releases it")
+	}
+	r.ReleaseAll(c)
+	if len(r.Holders(well)) != 1 {
+		t.Fatal("only b should hold the well")
+	}
+	// claims expire unless renewed
+	r.Update(60)
+	r.Claim(a, ox)
+	r.Update(60)
+	if !r.Available(a, ox) || r.Available(c, ox) {
+		t.Fatal("a's renewed claim on the ox should stand")
+	}
+	if !r.Available(c, well) {
+		t.Fatal("b's claim on the well should have expired")
+	}
+	r.Update(60)
+	if !r.Claim(b, ox) {
+		t.Fatal("b should be able to claim the ox once a's claim expires")
+	}
+	// despawned holders' claims are dropped
+	w.Despawn(b)
+	w.Update(FRAME_MS / 2)
+	if !r.Claim(c, ox) {
+		t.Fatal("c should be able to claim the ox once b is despawned")
+	}
+}
+
+// n farmers and n trees, each farmer with a planner which can chop a tree
+// (the nearest one not otherwise excluded)
+func testingGOAPFarmers(w *World, n int) (farmers []*GOAPExecutor, trees []*Entity) {
+	chopTree := NewGOAPAction(map[string]any{
+		"name": "chopTree",
+		"node": "tree",
+		"cost": 1,
+		"pres": nil,
+		"effs": map[string]int{
+			"tree.chopped,=": 1,
+		},
+	})
+	actions := NewGOAPActionRegistry()
+	actions.Register("chopTree", &GOAPActionImpl{
+		Tick: func(ctx *GOAPActionContext, dt_ms float64) GOAPActionStatus {
+			if ctx.Elapsed < 50 {
+				return GOAP_ACTION_RUNNING
+			}
+			ctx.Node.GetIntMap(STATE).Set("chopped", 1)
+			return GOAP_ACTION_SUCCEEDED
+		},
+	})
+	for i := 0; i < n; i++ {
+		trees = append(trees, w.Spawn(map[string]any{
+			"components": map[ComponentID]any{
+				POSITION: Vec2D{float64(10 * i), 20},
+				BOX:      Vec2D{2, 2},
+				STATE: map[string]int{
+					"chopped": 0,
+				},
+			},
+			"tags": []string{"tree"},
+		}))
+	}
+	for i := 0; i < n; i++ {
+		e := w.Spawn(map[string]any{
+			"components": map[ComponentID]any{
+				POSITION: Vec2D{float64(i), 0},
+				BOX:      Vec2D{1, 1},
+				STATE:    map[string]int{},
+			},
+		})
+		p := NewGOAPPlanner(e)
+		p.RegisterGenericEntitySelectors(map[string]func(*Entity) bool{
+			"tree": func(candidate *Entity) bool {
+				return candidate.HasTag("tree") &&
+					candidate.GetIntMap(STATE).Get("chopped") == 0
+			},
+		})
+		p.AddActions(chopTree)
+		farmers = append(farmers, NewGOAPExecutor(e, p, actions))
+	}
+	return farmers, trees
+}
+
+func TestGOAPSquadDeconflictsNodes(t *testing.T) {
+	w := testingWorld()
+	farmers, trees := testingGOAPFarmers(w, 3)
+	squad := NewGOAPSquad(nil, farmers...)
+	squad.SetGoal(map[string]int{"tree.chopped,=": 1}, nil)
+	for i := 0; i < 100; i++ {
+		if done, _ := squad.Done(); done {
+			break
+		}
+		for _, x := range farmers {
+			x.Update(FRAME_MS)
+		}
+		w.GOAPReservations().Update(FRAME_MS)
+	}
+	if _, succeeded := squad.Done(); succeeded != 3 {
+		t.Fatalf("all 3 farmers should have succeeded, got %d", succeeded)
+	}
+	bound := make(map[*Entity]bool)
+	for _, x := range farmers {
+		bound[x.bindings["tree"]] = true
+		if x.replans != 0 {
+			t.Fatal("squad members shouldn't have had to replan")
+		}
+	}
+	if len(bound) != 3 {
+		t.Fatal("each farmer should have bound a different tree")
+	}
+	for _, tree := range trees {
+		if tree.GetIntMap(STATE).Get("chopped") != 1 {
+			t.Fatal("every tree should have been chopped")
+		}
+		if len(w.GOAPReservations().Holders(tree)) != 0 {
+			t.Fatal("claims should have been released when the plans ended")
+		}
+	}
+}
+
+func TestGOAPReservationConflictReplans(t *testing.T) {
+	w := testingWorld()
+	farmers, trees := testingGOAPFarmers(w, 2)
+	r := w.GOAPReservations()
+	for _, x := range farmers {
+		x.Planner.Reservations = r
+		x.SetGoal(map[string]int{"tree.chopped,=": 1}, nil)
+	}
+	// both start planning before either has claimed a tree, so both bind
+	// the nearest; the second to finish finds it claimed and replans
+	a, b := farmers[0], farmers[1]
+	a.PlanIterations = 1
+	b.PlanIterations = 1
+	b.Update(FRAME_MS)
+	a.Update(FRAME_MS)
+	if a.Status != GOAP_EXEC_PLANNING || b.Status != GOAP_EXEC_PLANNING {
+		t.Fatal("both should still be planning")
+	}
+	for i := 0; i < 100 && (a.Status != GOAP_EXEC_SUCCEEDED || b.Status != GOAP_EXEC_SUCCEEDED); i++ {
+		a.Update(FRAME_MS)
+		b.Update(FRAME_MS)
+	}
+	if a.Status != GOAP_EXEC_SUCCEEDED || b.Status != GOAP_EXEC_SUCCEEDED {
+		t.Fatalf("both should have succeeded (%v, %v)", a.Err, b.Err)
+	}
+	if b.replans != 1 || a.bindings["tree"] == b.bindings["tree"] {
+		t.Fatal("b should have replanned to bind the other tree")
+	}
+	for _, tree := range trees {
+		if tree.GetIntMap(STATE).Get("chopped") != 1 {
+			t.Fatal("both trees should have been chopped")
+		}
+	}
+}
@@ -1,5 +1,9 @@
 package sameriver
 
+import (
+	"math"
+)
+
 type IntOrFunc any
 
 // a state val which can *set* modal values in the worldstate as the
@@ -22,4 +26,35 @@ type GOAPModalVal struct {
 	// a func that is used when this state val appears in an eff, modifying
 	// modal state
 	effModalSet func(ws *GOAPWorldState, op string, x int)
+	// for real-valued vars, used instead of check and effModalSet
+	checkFloat       func(ws *GOAPWorldState) float64
+	effModalSetFloat func(ws *GOAPWorldState, op string, x float64)
+}
+
+// the val of the var in ws
+func (m GOAPModalVal) value(ws *GOAPWorldState) float64 {
+	if m.checkFloat != nil {
+		return m.checkFloat(ws)
+	}
+	return float64(m.check(ws))
+}
+
+// whether the var can be an eff
+func (m GOAPModalVal) settable() bool {
+	return m.effModalSetFloat != nil || m.effModalSet != nil
+}
+
+// modifies ws so that the var becomes (op) x: for "+" and "-", x is the
+// total amount added or taken, for "=" the val, and for "*" the factor
+// (an int var being set to the rounded product)
+func (m GOAPModalVal) set(ws *GOAPWorldState, op string, x float64) {
+	if m.effModalSetFloat != nil {
+		m.effModalSetFloat(ws, op, x)
+		return
+	}
+	if op == "*" {
+		op = "="
+		x *= m.value(ws)
+	}
+	m.effModalSet(ws, op, int(math.Round(x)))
 }
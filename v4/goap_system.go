@@ -0,0 +1,101 @@
+package sameriver
+
+import (
+	"time"
+)
+
+// GOAPSystem updates the GOAPExecutor in the GOAP component of each entity,
+// publishing their plan lifecycle events on Events (see GOAPExecutor).
+// Executors' plan searches are stepped a few iterations at a time,
+// round-robin, within PlanBudgetMs each Update(), so that many agents
+// planning at once share the frame's budget (the system being run by the
+// RuntimeLimitSharer like any other) rather than spiking it.
+type GOAPSystem struct {
+	w            *World
+	goapEntities *UpdatedEntityList
+	Events       *EventBus
+
+	// how long each Update() may spend planning
+	PlanBudgetMs float64
+	// how many iterations a plan search runs before we check the time and
+	// move on to the next executor
+	PlanIterationsPerStep int
+
+	// executors planning, stepped round-robin
+	planning []*GOAPExecutor
+	next     int
+}
+
+func NewGOAPSystem() *GOAPSystem {
+	return &GOAPSystem{
+		Events:                NewEventBus("goap"),
+		PlanBudgetMs:          1,
+		PlanIterationsPerStep: 4,
+		planning:              make([]*GOAPExecutor, 0),
+	}
+}
+
+func (s *GOAPSystem) GetComponentDeps() []any {
+	return []any{
+		GOAP, GENERIC, "GOAP",
+	}
+}
+
+func (s *GOAPSystem) LinkWorld(w *World) {
+	s.w = w
+	s.goapEntities = w.GetUpdatedEntityList(
+		EntityFilterFromComponentBitArray(
+			"goap",
+			w.em.components.BitArrayFromIDs([]ComponentID{GOAP})))
+}
+
+func (s *GOAPSystem) Update(dt_ms float64) {
+	if s.w.reservations != nil {
+		s.w.reservations.Update(dt_ms)
+	}
+	s.planning = s.planning[:0]
+	for _, e := range s.goapEntities.entities {
+		x := goapExecutorOf(e)
+		if x == nil {
+			continue
+		}
+		if x.Events == nil {
+			x.Events = s.Events
+		}
+		x.advance(dt_ms)
+		if x.Status == GOAP_EXEC_PLANNING {
+			s.planning = append(s.planning, x)
+		}
+	}
+	// (always take at least one step, so that planning progresses even if
+	// the budget is tiny)
+	t0 := time.Now()
+	for first := true; len(s.planning) > 0; first = false {
+		if !first && float64(time.Since(t0).Nanoseconds())/1e6 >= s.PlanBudgetMs {
+			break
+		}
+		if s.next >= len(s.planning) {
+			s.next = 0
+		}
+		x := s.planning[s.next]
+		x.stepPlanning(s.PlanIterationsPerStep)
+		if x.Status != GOAP_EXEC_PLANNING {
+			s.planning = append(s.planning[:s.next], s.planning[s.next+1:]...)
+		} else {
+			s.next++
+		}
+	}
+}
+
+// the entity's GOAP executor, or nil if it has none
+func goapExecutorOf(e *Entity) *GOAPExecutor {
+	if !e.HasComponent(GOAP) {
+		return nil
+	}
+	x, _ := e.GetGeneric(GOAP).(*GOAPExecutor)
+	return x
+}
+
+func (s *GOAPSystem) Expand(n int) {
+	// nil?
+}
@@ -49,13 +49,12 @@ type GOAPTemporalGoal struct {
 
 func NewGOAPTemporalGoal(spec any) *GOAPTemporalGoal {
 	tg := &GOAPTemporalGoal{}
-	if specmap, single := spec.(map[string]int); single {
-		tg.temporalGoals = []*GOAPGoal{newGOAPGoal(specmap)}
+	if _, single := goapGoalSpec(spec); single {
+		tg.temporalGoals = []*GOAPGoal{newGOAPGoal(spec)}
 	} else if specarr, temporal := spec.([]any); temporal {
 		tg.temporalGoals = make([]*GOAPGoal, 0)
 		for i := 0; i < len(specarr); i++ {
-			specmapi := specarr[i].(map[string]int)
-			tg.temporalGoals = append(tg.temporalGoals, newGOAPGoal(specmapi))
+			tg.temporalGoals = append(tg.temporalGoals, newGOAPGoal(specarr[i]))
 		}
 	} else {
 		tg.temporalGoals = []*GOAPGoal{}
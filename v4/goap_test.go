@@ -16,7 +16,7 @@ func printWorldState(ws *GOAPWorldState) {
 		return
 	}
 	for name, val := range ws.vals {
-		Logger.Printf("    %s: %d", name, val)
+		Logger.Printf("    %s: %g", name, val)
 	}
 }
 
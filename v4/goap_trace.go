@@ -0,0 +1,279 @@
+package sameriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// GOAPTrace records the plan searches of a planner whose Trace it's set as,
+// so that you can see why an agent did (or didn't) plan what it did: the
+// paths each search expanded, the paths it pushed for further exploration,
+// and the actions it rejected and why. Export a trace with JSON(), or draw a
+// search with its DOT() (graphviz).
+type GOAPTrace struct {
+	// how many searches are kept (the oldest being dropped); 0 keeps all
+	MaxSearches int
+	Searches    []*GOAPSearchTrace
+}
+
+func NewGOAPTrace(maxSearches int) *GOAPTrace {
+	return &GOAPTrace{
+		MaxSearches: maxSearches,
+		Searches:    make([]*GOAPSearchTrace, 0),
+	}
+}
+
+// Last gives the most recent search (nil if none)
+func (t *GOAPTrace) Last() *GOAPSearchTrace {
+	if len(t.Searches) == 0 {
+		return nil
+	}
+	return t.Searches[len(t.Searches)-1]
+}
+
+func (t *GOAPTrace) JSON() ([]byte, error) {
+	return json.MarshalIndent(t, "", "\t")
+}
+
+func (t *GOAPTrace) newSearch(e *Entity, goalSpec any, start *GOAPWorldState) *GOAPSearchTrace {
+	s := &GOAPSearchTrace{
+		Entity:     e.ID,
+		Goal:       fmt.Sprintf("%v", goalSpec),
+		Start:      make(map[string]float64),
+		Paths:      make([]*GOAPTracePath, 0),
+		Expansions: make([]*GOAPTraceExpansion, 0),
+		Result:     -1,
+		pathIDs:    make(map[*GOAPPath]int),
+	}
+	for k, v := range start.vals {
+		s.Start[k] = v
+	}
+	t.Searches = append(t.Searches, s)
+	if t.MaxSearches > 0 && len(t.Searches) > t.MaxSearches {
+		t.Searches = t.Searches[len(t.Searches)-t.MaxSearches:]
+	}
+	return s
+}
+
+// GOAPSearchTrace is the record of one plan search. Its paths are
+// referenced by their ID (their index in Paths).
+type GOAPSearchTrace struct {
+	Entity int
+	Goal   string
+	Start  map[string]float64
+
+	Paths      []*GOAPTracePath
+	Expansions []*GOAPTraceExpansion
+	// the solution found (-1 if none)
+	Result     int
+	Iterations int
+	Elapsed    float64
+	Cancelled  bool
+	// if the solution came from the planner's cache (no search being run)
+	Cached bool `json:",omitempty"`
+
+	pathIDs map[*GOAPPath]int
+}
+
+// GOAPTracePath is a path seen by the search
+type GOAPTracePath struct {
+	ID      int
+	Actions []string
+	Cost    float64
+	// how many goals were left unfulfilled by it
+	Unfulfilled int
+	// the path it was made from by inserting Inserted (-1 for the root)
+	Parent   int
+	Inserted string `json:",omitempty"`
+	// if it fulfilled the goal but failed forward validation
+	Rejected bool `json:",omitempty"`
+}
+
+// GOAPTraceExpansion is one iteration of the search: the path popped from
+// the queue, the paths it gave, and the actions rejected for it
+type GOAPTraceExpansion struct {
+	Iter     int
+	Path     int
+	Pushed   []int
+	Rejected []GOAPTraceRejection
+}
+
+// GOAPTraceRejection is an action the search couldn't insert into a path
+type GOAPTraceRejection struct {
+	Action string
+	// the var it was considered for
+	Var    string
+	Reason string
+}
+
+// the trace of the search running, if the planner is traced
+func (p *GOAPPlanner) searchTrace() *GOAPSearchTrace {
+	if p.session == nil {
+		return nil
+	}
+	return p.session.trace
+}
+
+// (all the recording methods below are no-ops on a nil trace, so that
+// untraced planners just call them)
+
+func (t *GOAPSearchTrace) pathID(path *GOAPPath, parent int, inserted string) int {
+	if id, ok := t.pathIDs[path]; ok {
+		return id
+	}
+	id := len(t.Paths)
+	actions := make([]string, len(path.path))
+	for i, a := range path.path {
+		actions[i] = a.DisplayName()
+	}
+	t.Paths = append(t.Paths, &GOAPTracePath{
+		ID:          id,
+		Actions:     actions,
+		Cost:        path.cost,
+		Unfulfilled: path.remainings.NUnfulfilled(),
+		Parent:      parent,
+		Inserted:    inserted,
+	})
+	t.pathIDs[path] = id
+	return id
+}
+
+func (t *GOAPSearchTrace) current() *GOAPTraceExpansion {
+	return t.Expansions[len(t.Expansions)-1]
+}
+
+func (t *GOAPSearchTrace) root(path *GOAPPath) {
+	if t == nil {
+		return
+	}
+	t.pathID(path, -1, "")
+}
+
+func (t *GOAPSearchTrace) expand(iter int, path *GOAPPath) {
+	if t == nil {
+		return
+	}
+	t.Expansions = append(t.Expansions, &GOAPTraceExpansion{
+		Iter:     iter,
+		Path:     t.pathID(path, -1, ""),
+		Pushed:   make([]int, 0),
+		Rejected: make([]GOAPTraceRejection, 0),
+	})
+}
+
+func (t *GOAPSearchTrace) push(from, path *GOAPPath, inserted *GOAPAction) {
+	if t == nil {
+		return
+	}
+	id := t.pathID(path, t.pathIDs[from], inserted.DisplayName())
+	x := t.current()
+	x.Pushed = append(x.Pushed, id)
+}
+
+func (t *GOAPSearchTrace) reject(action *GOAPAction, varName, reason string) {
+	if t == nil {
+		return
+	}
+	x := t.current()
+	x.Rejected = append(x.Rejected, GOAPTraceRejection{
+		Action: action.DisplayName(),
+		Var:    varName,
+		Reason: reason,
+	})
+}
+
+func (t *GOAPSearchTrace) rejectSolution(path *GOAPPath) {
+	if t == nil {
+		return
+	}
+	t.Paths[t.pathID(path, -1, "")].Rejected = true
+}
+
+func (t *GOAPSearchTrace) finish(s *GOAPPlanSession) {
+	if t == nil {
+		return
+	}
+	t.Iterations = s.iter
+	t.Elapsed = s.elapsed
+	t.Cancelled = s.cancelled
+	t.Cached = s.cached
+	if s.solution != nil {
+		t.Result = t.pathID(s.solution, -1, "")
+	}
+}
+
+func (t *GOAPSearchTrace) JSON() ([]byte, error) {
+	return json.MarshalIndent(t, "", "\t")
+}
+
+// DOT renders the search as a graphviz digraph of the paths seen, each
+// pointing to the paths made from it (labelled with the action inserted),
+// with the paths expanded in bold, the solution in green, and solutions
+// rejected by forward validation in red
+func (t *GOAPSearchTrace) DOT() string {
+	expanded := make(map[int]bool)
+	for _, x := range t.Expansions {
+		expanded[x.Path] = true
+	}
+	var buf bytes.Buffer
+	buf.WriteString("digraph goap {\n")
+	buf.WriteString("\tnode [shape=box, fontname=monospace];\n")
+	for _, p := range t.Paths {
+		attrs := []string{
+			fmt.Sprintf("label=%s", dotQuote(fmt.Sprintf("[%s]\ncost %.2f, %d unfulfilled",
+				strings.Join(p.Actions, ","), p.Cost, p.Unfulfilled))),
+		}
+		if expanded[p.ID] {
+			attrs = append(attrs, "style=bold")
+		}
+		if p.ID == t.Result {
+			attrs = append(attrs, "color=green", "penwidth=3")
+		} else if p.Rejected {
+			attrs = append(attrs, "color=red")
+		}
+		buf.WriteString(fmt.Sprintf("\tp%d [%s];\n", p.ID, strings.Join(attrs, ", ")))
+	}
+	for _, p := range t.Paths {
+		if p.Parent >= 0 {
+			buf.WriteString(fmt.Sprintf("\tp%d -> p%d [label=%s];\n",
+				p.Parent, p.ID, dotQuote(p.Inserted)))
+		}
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// DOT renders the plan as a graphviz digraph, from the start through each
+// action (with the node it's done at) to the goal
+func (p *GOAPPath) DOT() string {
+	var buf bytes.Buffer
+	buf.WriteString("digraph plan {\n")
+	buf.WriteString("\trankdir=LR;\n")
+	buf.WriteString("\tnode [shape=box, fontname=monospace];\n")
+	buf.WriteString("\tstart [shape=circle];\n")
+	buf.WriteString(fmt.Sprintf("\tgoal [shape=doublecircle, label=%s];\n",
+		dotQuote(fmt.Sprintf("goal\ncost %.2f", p.cost))))
+	prev := "start"
+	for i, a := range p.path {
+		label := a.DisplayName()
+		if a.Node != "" {
+			label += "\n@" + a.Node
+		}
+		buf.WriteString(fmt.Sprintf("\ta%d [label=%s];\n", i, dotQuote(label)))
+		buf.WriteString(fmt.Sprintf("\t%s -> a%d;\n", prev, i))
+		prev = fmt.Sprintf("a%d", i)
+	}
+	buf.WriteString(fmt.Sprintf("\t%s -> goal;\n", prev))
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// quotes s as a DOT string
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
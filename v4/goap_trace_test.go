@@ -0,0 +1,69 @@
+package sameriver
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestGOAPTrace(t *testing.T) {
+	w, _, rotten, sound, x := testingGOAPExecutorWorld()
+	p := x.Planner
+	p.Trace = NewGOAPTrace(1)
+	x.Entity.GetIntMap(STATE).Set("hasAxe", 0)
+	start := NewGOAPWorldState(map[string]int{"self.hasAxe": 0})
+	solution, ok := p.Plan(start, map[string]int{"tree.chopped,=": 1}, 50)
+	if !ok {
+		t.Fatal("should have found a plan")
+	}
+	search := p.Trace.Last()
+	if search == nil || search.Result < 0 || len(search.Expansions) == 0 {
+		t.Fatalf("should have traced the search, got %+v", search)
+	}
+	result := search.Paths[search.Result]
+	if strings.Join(result.Actions, ",") != "getAxe,chopTree" || result.Cost != solution.cost {
+		t.Fatalf("traced result should be the solution, got %+v", result)
+	}
+	// the solution was made from the path with chopTree alone, inserting
+	// getAxe
+	parent := search.Paths[result.Parent]
+	if strings.Join(parent.Actions, ",") != "chopTree" || result.Inserted != "getAxe" {
+		t.Fatalf("solution should have been made from [chopTree], got %+v", parent)
+	}
+	jsonBytes, err := p.Trace.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded GOAPTrace
+	if err := json.Unmarshal(jsonBytes, &decoded); err != nil || len(decoded.Searches) != 1 {
+		t.Fatalf("JSON should round-trip, got %v", err)
+	}
+	dot := search.DOT()
+	if !strings.HasPrefix(dot, "digraph goap {") || !strings.Contains(dot, "color=green") {
+		t.Fatalf("DOT should mark the solution, got\n%s", dot)
+	}
+	if !strings.Contains(solution.DOT(), `"chopTree\n@tree"`) {
+		t.Fatalf("plan DOT should show the node of chopTree, got\n%s", solution.DOT())
+	}
+
+	// with no trees about, chopTree is rejected for want of a node, and
+	// only the latest MaxSearches are kept
+	w.Despawn(rotten)
+	w.Despawn(sound)
+	w.Update(FRAME_MS / 2)
+	if _, ok := p.Plan(start, map[string]int{"tree.chopped,=": 1}, 50); ok {
+		t.Fatal("should have found no plan without trees")
+	}
+	if len(p.Trace.Searches) != 1 || p.Trace.Last() == search {
+		t.Fatal("should have kept only the latest search")
+	}
+	failed := p.Trace.Last()
+	if failed.Result != -1 || len(failed.Expansions) == 0 {
+		t.Fatalf("should have traced the failed search, got %+v", failed)
+	}
+	rejections := failed.Expansions[0].Rejected
+	if len(rejections) == 0 || rejections[0].Action != "chopTree" ||
+		!strings.HasPrefix(rejections[0].Reason, "cannot select a node") {
+		t.Fatalf("chopTree should have been rejected for its node, got %+v", rejections)
+	}
+}
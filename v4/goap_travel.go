@@ -0,0 +1,119 @@
+package sameriver
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var ErrGOAPNoRoute = errors.New("no route to node")
+
+// the cost of an action apart from travel: its inherent cost, by its count
+func (a *GOAPAction) inherentCost() float64 {
+	switch cost := a.cost.(type) {
+	case int:
+		return float64(a.Count * cost)
+	case float64:
+		return float64(a.Count) * cost
+	case func() int:
+		return float64(a.Count * cost())
+	}
+	return 0
+}
+
+// the distance travelled (modally) between two points, by the planner's
+// TravelDistance if set, else in a straight line
+func (p *GOAPPlanner) travelDistance(from, to Vec2D) float64 {
+	if p.TravelDistance != nil {
+		return p.TravelDistance(from, to)
+	}
+	return to.Sub(from).Magnitude()
+}
+
+// the cost of travelling (modally) from one point to another for action a,
+// by the planner's TravelCostPerUnit
+func (p *GOAPPlanner) travelCost(a *GOAPAction, from, to Vec2D) (float64, error) {
+	if p.TravelCostPerUnit == 0 || from == to {
+		return 0, nil
+	}
+	dist := p.travelDistance(from, to)
+	if math.IsInf(dist, 1) || math.IsNaN(dist) {
+		return 0, fmt.Errorf("%w for action %s at %v", ErrGOAPNoRoute, a.DisplayName(), to)
+	}
+	return dist * p.TravelCostPerUnit, nil
+}
+
+// the heuristic (h) estimate of the cost left to fulfill the path's
+// remainings: every var left unfulfilled needs more of the actions
+// affecting it, so the cheapest way of covering its diff with any one of
+// them (see varCostLowerBound()) for the var which needs the most expensive
+// is a lower bound (travel only ever adding cost, and one action possibly
+// fulfilling several vars), keeping the search admissible - the first
+// solution popped is the cheapest
+func (p *GOAPPlanner) remainingCostHeuristic(path *GOAPPath) float64 {
+	h := 0.0
+	for _, tgs := range path.remainings.surface {
+		for _, tg := range tgs {
+			for varName := range tg.goalLeft {
+				if cost := p.varCostLowerBound(varName, tg.diffs[varName]); cost > h {
+					h = cost
+				}
+			}
+		}
+	}
+	return h
+}
+
+// the least the actions affecting varName could cost to change it by diff:
+// an action setting or scaling it might do so in one go, but those adding
+// to it (or taking from it) must be done enough times to cover the diff,
+// so cost no less than their cost per unit of change by the diff. (the
+// inherent cost of a parametrized action is at least that of the action
+// once, by count)
+func (p *GOAPPlanner) varCostLowerBound(varName string, diff float64) float64 {
+	cheapest := math.Inf(1)
+	for action := range p.varActions[varName] {
+		cost := action.inherentCost() / float64(action.Count)
+		eff := action.effs[varName]
+		switch eff.op {
+		case "+", "-":
+			step := eff.val
+			if eff.op == "-" {
+				step = -step
+			}
+			// (adding doesn't help a var that needs taking from)
+			if step == 0 || (step > 0) != (diff > 0) {
+				continue
+			}
+			if !math.IsInf(diff, 0) {
+				cost *= math.Max(1, diff/step)
+			}
+		}
+		if cost < cheapest {
+			cheapest = cost
+		}
+	}
+	if math.IsInf(cheapest, 1) {
+		return 0
+	}
+	return cheapest
+}
+
+// NavGridTravelDistance gives a GOAPPlanner.TravelDistance measuring the
+// length of the path found on the grid between two points (+Inf if there's
+// none, failing any plan travelling there), rather than the straight-line
+// distance. Each search is synchronous, so mind the planning budget on
+// large grids.
+func NavGridTravelDistance(g *NavGrid) func(from, to Vec2D) float64 {
+	return func(from, to Vec2D) float64 {
+		path := g.FindPath(from, to, PATHFIND_AUTO)
+		if path == nil {
+			return math.Inf(1)
+		}
+		dist := 0.0
+		for i := 1; i < len(path); i++ {
+			dist += path[i].Sub(path[i-1]).Magnitude()
+		}
+		return dist
+	}
+}
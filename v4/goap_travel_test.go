@@ -0,0 +1,114 @@
+package sameriver
+
+import (
+	"errors"
+	"testing"
+)
+
+// a villager who can milk the nearby cow (hard work) or buy milk at the
+// distant market (easy, but a walk)
+func testingGOAPTravelPlanner() (w *World, p *GOAPPlanner, cow *Entity) {
+	w = testingWorld()
+	e := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION: Vec2D{2.5, 2.5},
+			BOX:      Vec2D{1, 1},
+			STATE:    map[string]int{"hasMilk": 0},
+		},
+	})
+	spawnAt := func(pos Vec2D, tag string) *Entity {
+		return w.Spawn(map[string]any{
+			"components": map[ComponentID]any{
+				POSITION: pos,
+				BOX:      Vec2D{1, 1},
+			},
+			"tags": []string{tag},
+		})
+	}
+	cow = spawnAt(Vec2D{12.5, 2.5}, "cow")
+	spawnAt(Vec2D{2.5, 40.5}, "market")
+	p = NewGOAPPlanner(e)
+	p.RegisterGenericEntitySelectors(map[string]func(*Entity) bool{
+		"cow":    func(c *Entity) bool { return c.HasTag("cow") },
+		"market": func(c *Entity) bool { return c.HasTag("market") },
+	})
+	p.AddActions(
+		NewGOAPAction(map[string]any{
+			"name": "milkCow",
+			"node": "cow",
+			"cost": 5,
+			"pres": nil,
+			"effs": map[string]int{"self.hasMilk,=": 1},
+		}),
+		NewGOAPAction(map[string]any{
+			"name": "buyMilk",
+			"node": "market",
+			"cost": 1,
+			"pres": nil,
+			"effs": map[string]int{"self.hasMilk,=": 1},
+		}),
+	)
+	return w, p, cow
+}
+
+func testingGOAPTravelPlan(t *testing.T, p *GOAPPlanner) *GOAPPath {
+	start := NewGOAPWorldState(map[string]int{"self.hasMilk": 0})
+	path, ok := p.Plan(start, map[string]int{"self.hasMilk,=": 1}, 50)
+	if !ok {
+		t.Fatal("should have found a plan")
+	}
+	return path
+}
+
+func TestGOAPTravelCost(t *testing.T) {
+	_, p, _ := testingGOAPTravelPlanner()
+	// the cow is 10 away, the market 38
+	path := testingGOAPTravelPlan(t, p)
+	if path.path[0].Name != "milkCow" || path.cost != 15 {
+		t.Fatalf("should have milked the nearby cow for 15, got %s", path)
+	}
+	// ignoring travel, the market is cheaper
+	p.TravelCostPerUnit = 0
+	path = testingGOAPTravelPlan(t, p)
+	if path.path[0].Name != "buyMilk" || path.cost != 1 {
+		t.Fatalf("should have bought milk ignoring travel, got %s", path)
+	}
+}
+
+func TestGOAPTravelCostNavGrid(t *testing.T) {
+	_, p, cow := testingGOAPTravelPlanner()
+	// a fence between us and the cow makes it a long way round
+	g := NewNavGrid(50, 50, Vec2D{1, 1}, Vec2D{0, 0})
+	for y := 0; y <= 20; y++ {
+		g.SetBlocked(7, y, true)
+	}
+	p.TravelDistance = NavGridTravelDistance(g)
+	path := testingGOAPTravelPlan(t, p)
+	if path.path[0].Name != "buyMilk" {
+		t.Fatalf("should have walked to the market rather than round the fence, got %s", path)
+	}
+	// with the cow fenced in, it can't be reached at all
+	for x := 7; x <= 20; x++ {
+		g.SetBlocked(x, 21, true)
+	}
+	for y := 0; y <= 21; y++ {
+		g.SetBlocked(20, y, true)
+	}
+	if _, err := p.travelCost(p.actions.set["milkCow"], Vec2D{2.5, 2.5}, *cow.GetVec2D(POSITION)); !errors.Is(err, ErrGOAPNoRoute) {
+		t.Fatalf("should have found no route to the cow, got %v", err)
+	}
+}
+
+func TestGOAPTravelHeuristicAdmissible(t *testing.T) {
+	_, p, _ := testingGOAPTravelPlanner()
+	root := NewGOAPPath(nil)
+	start := NewGOAPWorldState(map[string]int{"self.hasMilk": 0})
+	session := p.NewPlanSession(start, map[string]int{"self.hasMilk,=": 1}, 50)
+	p.computeCostAndRemainingsOfPath(root, session.start, session.goal)
+	h := p.remainingCostHeuristic(root)
+	session.Cancel()
+	solution := testingGOAPTravelPlan(t, p)
+	if h <= 0 || h > solution.cost {
+		t.Fatalf("heuristic %f should be positive and never exceed the real cost %f", h, solution.cost)
+	}
+}
@@ -8,14 +8,14 @@ import (
 type GOAPWorldState struct {
 	w *World
 	// TODO: export vals
-	vals map[string]int
+	vals map[string]float64
 	// TODO: change this to a map[int](map[string]any) [ID][component]
 	modal         map[string]any
 	ModalEntities map[string]*Entity
 }
 
 func (ws *GOAPWorldState) CopyOf() *GOAPWorldState {
-	copyvals := make(map[string]int)
+	copyvals := make(map[string]float64)
 	for k, v := range ws.vals {
 		copyvals[k] = v
 	}
@@ -36,17 +36,38 @@ func (ws *GOAPWorldState) CopyOf() *GOAPWorldState {
 	return copyWS
 }
 
-func NewGOAPWorldState(vals map[string]int) *GOAPWorldState {
+// NewGOAPWorldState makes a worldstate with the vals given, as a
+// map[string]int or map[string]float64 (or nil for none)
+func NewGOAPWorldState(vals any) *GOAPWorldState {
 	ws := &GOAPWorldState{
-		vals:  vals,
+		vals:  make(map[string]float64),
 		modal: make(map[string]any),
 	}
-	if vals == nil {
-		ws.vals = make(map[string]int)
+	switch m := vals.(type) {
+	case map[string]int:
+		for k, v := range m {
+			ws.vals[k] = float64(v)
+		}
+	case map[string]float64:
+		for k, v := range m {
+			ws.vals[k] = v
+		}
+	case nil:
+	default:
+		panic(fmt.Sprintf("GOAP worldstate vals should be a map[string]int or map[string]float64, got %T", vals))
 	}
 	return ws
 }
 
+// Get gives the val of varName (0 if it's not set)
+func (ws *GOAPWorldState) Get(varName string) float64 {
+	return ws.vals[varName]
+}
+
+func (ws *GOAPWorldState) Set(varName string, val float64) {
+	ws.vals[varName] = val
+}
+
 func (ws *GOAPWorldState) ecKey(e *Entity, name ComponentID) string {
 	return fmt.Sprintf("%d-%s", e.ID, ws.w.em.components.strings[name])
 }
@@ -0,0 +1,263 @@
+package sameriver
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrHTNNoDecomposition = errors.New("no decomposition of task")
+
+// HTNTask is a compound task of an HTNPlanner: the methods by which it can
+// be done, tried in order, the first whose pres hold (and whose subtasks
+// can all be done in turn) being used
+type HTNTask struct {
+	Name    string
+	Methods []*HTNMethod
+}
+
+// HTNMethod is one way of doing a compound task: its subtasks in order,
+// each either another compound task or (primitively) a GOAPAction of the
+// planner, by name
+type HTNMethod struct {
+	Name     string
+	pres     *GOAPTemporalGoal
+	Subtasks []string
+}
+
+// NewHTNTask makes a compound task from a spec such as
+//
+//	map[string]any{
+//		"name": "dailyRoutine",
+//		"methods": []map[string]any{
+//			{
+//				"name":     "workday",
+//				"pres":     map[string]int{"self.rested,=": 1},
+//				"subtasks": []string{"goToField", "tillField", "goHome"},
+//			},
+//			{
+//				"name":     "rest",
+//				"pres":     nil,
+//				"subtasks": []string{"sleep"},
+//			},
+//		},
+//	}
+//
+// method pres being goal specs, as for the pres of a GOAPAction
+func NewHTNTask(spec map[string]any) *HTNTask {
+	name := spec["name"].(string)
+	methodSpecs, ok := spec["methods"].([]map[string]any)
+	if !ok || len(methodSpecs) == 0 {
+		panic(fmt.Sprintf("HTN task %s needs methods ([]map[string]any)", name))
+	}
+	t := &HTNTask{
+		Name:    name,
+		Methods: make([]*HTNMethod, len(methodSpecs)),
+	}
+	for i, ms := range methodSpecs {
+		methodName, ok := ms["name"].(string)
+		if !ok {
+			methodName = fmt.Sprintf("%d", i)
+		}
+		subtasks, ok := ms["subtasks"].([]string)
+		if !ok {
+			panic(fmt.Sprintf("method %s of HTN task %s needs subtasks ([]string)", methodName, name))
+		}
+		t.Methods[i] = &HTNMethod{
+			Name:     methodName,
+			pres:     NewGOAPTemporalGoal(ms["pres"]),
+			Subtasks: subtasks,
+		}
+	}
+	return t
+}
+
+// HTNPlanner plans by decomposing a task into a sequence of GOAPActions,
+// forward from the start state, rather than searching backward from a goal
+// as the GOAPPlanner does; for scripted routines (daily schedules, crafting
+// recipes) where the designer knows the steps, and wants the agent to take
+// them predictably.
+//
+// It plans with a GOAPPlanner's actions, modal vals and entity selectors
+// (so primitive tasks are just the actions added to it, with their pres,
+// effs and nodes bound as they would be in a GOAP plan), and gives a
+// GOAPPath, so that its plans can be run by a GOAPExecutor (see
+// NewHTNExecutor()).
+//
+// When a method's subtasks can't all be done (an action's pres not holding
+// or its node not binding where the decomposition reaches it), the next
+// method is tried, backtracking as far as needed.
+type HTNPlanner struct {
+	GOAP *GOAPPlanner
+	// the deepest compound tasks may nest in a decomposition (guarding
+	// against recursive tasks that never bottom out; primitive tasks, however
+	// many a method has, don't count)
+	MaxDepth int
+
+	tasks map[string]*HTNTask
+	// the methods used by the last plan, as task:method, in the order they
+	// were chosen
+	Decomposition []string
+}
+
+func NewHTNPlanner(p *GOAPPlanner) *HTNPlanner {
+	return &HTNPlanner{
+		GOAP:     p,
+		MaxDepth: 100,
+		tasks:    make(map[string]*HTNTask),
+	}
+}
+
+func (h *HTNPlanner) AddTasks(tasks ...*HTNTask) {
+	for _, t := range tasks {
+		h.tasks[t.Name] = t
+	}
+}
+
+// a partial plan: the actions decomposed so far, with the states after
+// them, their total cost, and the methods chosen
+type htnDecomposition struct {
+	actions []*GOAPAction
+	states  []*GOAPWorldState
+	cost    float64
+	methods []string
+}
+
+// a task still to be done in a decomposition, and how deep it's nested
+// (the number of compound tasks it was expanded from)
+type htnPendingTask struct {
+	name  string
+	depth int
+}
+
+// Plan decomposes task from start, giving the plan found, if any
+func (h *HTNPlanner) Plan(start *GOAPWorldState, task string) (solution *GOAPPath, ok bool) {
+	p := h.GOAP
+	if p.session != nil {
+		p.session.Cancel()
+	}
+	// (node bindings are cached for the decomposition, as for a plan
+	// session)
+	p.selectorResultCache = make(map[string]*Entity)
+	defer func() {
+		p.boundSelectorsFlipflop = false
+		p.selectorResultCache = make(map[string]*Entity)
+	}()
+
+	start = start.CopyOf()
+	start.w = p.e.World
+	p.setPositionInStartModalIfNotDefined(start)
+	start.ModalEntities["self"] = p.e
+
+	logGOAPDebug("HTN planning %s...", task)
+	d, ok := h.decompose([]htnPendingTask{{name: task}}, start, &htnDecomposition{})
+	if !ok {
+		h.Decomposition = nil
+		logGOAPDebug("%s: %s", ErrHTNNoDecomposition, task)
+		return nil, false
+	}
+	h.Decomposition = d.methods
+	path := NewGOAPPath(d.actions)
+	path.statesAlong = append([]*GOAPWorldState{start}, d.states...)
+	path.cost = d.cost
+	logGOAPDebug("HTN plan (cost %.3f): %s", path.cost, GOAPPathToString(path))
+	return path, true
+}
+
+// decompose does tasks in turn from ws after d, giving the decomposition
+// with them all done, if they can be
+func (h *HTNPlanner) decompose(tasks []htnPendingTask, ws *GOAPWorldState, d *htnDecomposition) (*htnDecomposition, bool) {
+	if len(tasks) == 0 {
+		return d, true
+	}
+	name, depth, rest := tasks[0].name, tasks[0].depth, tasks[1:]
+
+	// compound
+	if t, ok := h.tasks[name]; ok {
+		if depth >= h.MaxDepth {
+			logWarning("HTN decomposition deeper than MaxDepth (%d) at %s; is a task recursing without end?", h.MaxDepth, name)
+			return nil, false
+		}
+		for _, m := range t.Methods {
+			withVals, ok := h.holds(m.pres, ws)
+			if !ok {
+				logGOAPDebug("  %s:%s pres not met", t.Name, m.Name)
+				continue
+			}
+			logGOAPDebug("  %s:%s", t.Name, m.Name)
+			subtasks := make([]htnPendingTask, 0, len(m.Subtasks)+len(rest))
+			for _, sub := range m.Subtasks {
+				subtasks = append(subtasks, htnPendingTask{name: sub, depth: depth + 1})
+			}
+			subtasks = append(subtasks, rest...)
+			chosen := &htnDecomposition{
+				actions: d.actions,
+				states:  d.states,
+				cost:    d.cost,
+				methods: append(append([]string{}, d.methods...), t.Name+":"+m.Name),
+			}
+			if result, ok := h.decompose(subtasks, withVals, chosen); ok {
+				return result, true
+			}
+		}
+		return nil, false
+	}
+
+	// primitive
+	action, ok := h.GOAP.actions.set[name]
+	if !ok {
+		panic(fmt.Sprintf("HTN task %s is neither a task nor an action of the planner", name))
+	}
+	a := action.CopyOf()
+	next := ws.CopyOf()
+	if err := h.GOAP.bindEntities(append(a.otherNodes, a.Node), next, false); err != nil {
+		logGOAPDebug("  %s: %s", a.Name, err)
+		return nil, false
+	}
+	next, ok = h.holds(a.pres, next)
+	if !ok {
+		logGOAPDebug("  %s pres not met", a.Name)
+		return nil, false
+	}
+	next, cost, err := h.GOAP.applyActionModal(a, next)
+	if err != nil {
+		logGOAPDebug("  %s: %s", a.Name, err)
+		return nil, false
+	}
+	done := &htnDecomposition{
+		actions: append(append([]*GOAPAction{}, d.actions...), a),
+		states:  append(append([]*GOAPWorldState{}, d.states...), next),
+		cost:    d.cost + cost,
+		methods: d.methods,
+	}
+	return h.decompose(rest, next, done)
+}
+
+// holds gives whether pres hold in ws, along with ws with the vars of pres
+// set: modal ones checked (binding their nodes), missing symbolic ones
+// defaulting to 0
+func (h *HTNPlanner) holds(pres *GOAPTemporalGoal, ws *GOAPWorldState) (*GOAPWorldState, bool) {
+	if len(pres.temporalGoals) == 0 {
+		return ws, true
+	}
+	p := h.GOAP
+	ws = ws.CopyOf()
+	for _, tg := range pres.temporalGoals {
+		for varName := range tg.vars {
+			p.methodNotationModal(varName)
+			if modal, ok := p.modalVals[varName]; ok {
+				if err := p.bindEntities(modal.nodes, ws, false); err != nil {
+					return nil, false
+				}
+				ws.vals[varName] = modal.value(ws)
+			} else if _, ok := ws.vals[varName]; !ok {
+				ws.vals[varName] = 0
+			}
+		}
+	}
+	for _, tg := range pres.temporalGoals {
+		if len(tg.remaining(ws).goalLeft) != 0 {
+			return nil, false
+		}
+	}
+	return ws, true
+}
@@ -0,0 +1,254 @@
+package sameriver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testingHTNPlanner(w *World) *HTNPlanner {
+	e := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION: Vec2D{0, 0},
+			BOX:      Vec2D{1, 1},
+		},
+	})
+	p := NewGOAPPlanner(e)
+	action := func(name string, pres any, effs map[string]int) *GOAPAction {
+		return NewGOAPAction(map[string]any{
+			"name": name,
+			"node": "self",
+			"cost": 1,
+			"pres": pres,
+			"effs": effs,
+		})
+	}
+	p.AddActions(
+		action("wake", nil, map[string]int{"awake,=": 1}),
+		action("eat", map[string]int{"awake,=": 1}, map[string]int{"hunger,=": 0}),
+		action("work", map[string]int{"hunger,<": 5}, map[string]int{"wood,+": 1}),
+		action("sleep", nil, map[string]int{"awake,=": 0}),
+	)
+	h := NewHTNPlanner(p)
+	h.AddTasks(
+		NewHTNTask(map[string]any{
+			"name": "day",
+			"methods": []map[string]any{
+				{
+					"name":     "restDay",
+					"pres":     map[string]int{"weekday,>=": 6},
+					"subtasks": []string{"sleep"},
+				},
+				{
+					"name":     "workDay",
+					"pres":     nil,
+					"subtasks": []string{"wake", "gather", "sleep"},
+				},
+			},
+		}),
+		// recursive: work until there's enough wood
+		NewHTNTask(map[string]any{
+			"name": "gather",
+			"methods": []map[string]any{
+				{
+					"name":     "enough",
+					"pres":     map[string]int{"wood,>=": 3},
+					"subtasks": []string{},
+				},
+				{
+					"name":     "more",
+					"pres":     nil,
+					"subtasks": []string{"work", "gather"},
+				},
+			},
+		}),
+	)
+	return h
+}
+
+func htnPlanNames(path *GOAPPath) []string {
+	names := make([]string, len(path.path))
+	for i, a := range path.path {
+		names[i] = a.DisplayName()
+	}
+	return names
+}
+
+func TestHTNPlannerDecomposes(t *testing.T) {
+	w := testingWorld()
+	h := testingHTNPlanner(w)
+
+	path, ok := h.Plan(NewGOAPWorldState(map[string]int{"weekday": 2, "wood": 1}), "day")
+	if !ok {
+		t.Fatal("should have decomposed day")
+	}
+	want := []string{"wake", "work", "work", "sleep"}
+	if got := htnPlanNames(path); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] || got[3] != want[3] {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if path.cost != 4 || path.statesAlong[4].vals["wood"] != 3 {
+		t.Fatalf("expected cost 4 ending with 3 wood, got %g and %v", path.cost, path.statesAlong[4].vals)
+	}
+	if len(h.Decomposition) != 4 || h.Decomposition[0] != "day:workDay" || h.Decomposition[3] != "gather:enough" {
+		t.Fatalf("unexpected decomposition %v", h.Decomposition)
+	}
+
+	// the first method whose pres hold is used
+	path, _ = h.Plan(NewGOAPWorldState(map[string]int{"weekday": 6}), "day")
+	if got := htnPlanNames(path); len(got) != 1 || got[0] != "sleep" {
+		t.Fatalf("should have rested, got %v", got)
+	}
+}
+
+func TestHTNPlannerBacktracks(t *testing.T) {
+	w := testingWorld()
+	h := testingHTNPlanner(w)
+	// hungry, working's pres fail partway into the first method; the
+	// second eats first
+	h.AddTasks(NewHTNTask(map[string]any{
+		"name": "shift",
+		"methods": []map[string]any{
+			{
+				"name":     "straightToWork",
+				"pres":     nil,
+				"subtasks": []string{"wake", "work"},
+			},
+			{
+				"name":     "breakfastFirst",
+				"pres":     nil,
+				"subtasks": []string{"wake", "eat", "work"},
+			},
+		},
+	}))
+	path, ok := h.Plan(NewGOAPWorldState(map[string]int{"hunger": 8}), "shift")
+	if !ok {
+		t.Fatal("should have decomposed shift")
+	}
+	if got := htnPlanNames(path); len(got) != 3 || got[1] != "eat" {
+		t.Fatalf("should have had breakfast first, got %v", got)
+	}
+	if len(h.Decomposition) != 1 || h.Decomposition[0] != "shift:breakfastFirst" {
+		t.Fatalf("unexpected decomposition %v", h.Decomposition)
+	}
+
+	// (with nothing to eat, there's no decomposition)
+	h.AddTasks(NewHTNTask(map[string]any{
+		"name": "shift",
+		"methods": []map[string]any{
+			{
+				"name":     "straightToWork",
+				"pres":     nil,
+				"subtasks": []string{"wake", "work"},
+			},
+		},
+	}))
+	if _, ok := h.Plan(NewGOAPWorldState(map[string]int{"hunger": 8}), "shift"); ok {
+		t.Fatal("shouldn't have decomposed shift while hungry")
+	}
+	// (a task that's neither is a mistake in the domain)
+	assert.Panics(t, func() { h.Plan(NewGOAPWorldState(nil), "fish") })
+}
+
+func TestHTNPlannerMaxDepth(t *testing.T) {
+	w := testingWorld()
+	h := testingHTNPlanner(w)
+	h.MaxDepth = 10
+	// gathering 20 wood recurses too deep
+	h.AddTasks(NewHTNTask(map[string]any{
+		"name": "gather",
+		"methods": []map[string]any{
+			{
+				"name":     "enough",
+				"pres":     map[string]int{"wood,>=": 20},
+				"subtasks": []string{},
+			},
+			{
+				"name":     "more",
+				"pres":     nil,
+				"subtasks": []string{"work", "gather"},
+			},
+		},
+	}))
+	if _, ok := h.Plan(NewGOAPWorldState(nil), "gather"); ok {
+		t.Fatal("shouldn't have decomposed deeper than MaxDepth")
+	}
+}
+
+func TestHTNPlannerLongFlatMethods(t *testing.T) {
+	w := testingWorld()
+	h := testingHTNPlanner(w)
+	// a long day's work, as actions, and as (shallow) chores
+	works := make([]string, 150)
+	chores := make([]string, 150)
+	for i := range works {
+		works[i] = "work"
+		chores[i] = "chore"
+	}
+	h.AddTasks(
+		NewHTNTask(map[string]any{
+			"name": "longDay",
+			"methods": []map[string]any{
+				{"name": "grind", "pres": nil, "subtasks": works},
+			},
+		}),
+		NewHTNTask(map[string]any{
+			"name": "choreDay",
+			"methods": []map[string]any{
+				{"name": "chores", "pres": nil, "subtasks": chores},
+			},
+		}),
+		NewHTNTask(map[string]any{
+			"name": "chore",
+			"methods": []map[string]any{
+				{"name": "work", "pres": nil, "subtasks": []string{"work"}},
+			},
+		}),
+	)
+	for _, task := range []string{"longDay", "choreDay"} {
+		path, ok := h.Plan(NewGOAPWorldState(nil), task)
+		if !ok {
+			t.Fatalf("%s nests no deeper than 2, so should have decomposed", task)
+		}
+		if len(path.path) != 150 || path.statesAlong[150].vals["wood"] != 150 {
+			t.Fatalf("%s should have worked 150 times, got %d", task, len(path.path))
+		}
+	}
+}
+
+func TestHTNExecutor(t *testing.T) {
+	w := testingWorld()
+	farmers, trees := testingGOAPFarmers(w, 2)
+	// a farmer which, by its routine, fells the nearest standing tree
+	farmer := farmers[1]
+	h := NewHTNPlanner(farmer.Planner)
+	h.AddTasks(NewHTNTask(map[string]any{
+		"name": "fellTree",
+		"methods": []map[string]any{
+			{
+				"name":     "chop",
+				"pres":     map[string]int{"tree.chopped,=": 0},
+				"subtasks": []string{"chopTree"},
+			},
+		},
+	}))
+	// (the first tree is already down)
+	trees[0].GetIntMap(STATE).Set("chopped", 1)
+	x := NewHTNExecutor(farmer.Entity, h, farmer.Actions)
+	x.SetGoal("fellTree", nil)
+	for i := 0; i < 100 && x.Status != GOAP_EXEC_SUCCEEDED && x.Status != GOAP_EXEC_FAILED; i++ {
+		x.Update(FRAME_MS)
+	}
+	if x.Status != GOAP_EXEC_SUCCEEDED {
+		t.Fatalf("the routine should have succeeded (%v)", x.Err)
+	}
+	if x.bindings["tree"] != trees[1] || trees[1].GetIntMap(STATE).Get("chopped") != 1 {
+		t.Fatal("the farmer should have felled the standing tree")
+	}
+
+	// with no tree standing, there's no way to do the routine
+	x.SetGoal("fellTree", nil)
+	x.Update(FRAME_MS)
+	if x.Status != GOAP_EXEC_FAILED {
+		t.Fatal("the routine should have failed with no tree standing")
+	}
+}
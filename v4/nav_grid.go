@@ -0,0 +1,288 @@
+package sameriver
+
+import (
+	"math"
+)
+
+// NavGrid is a grid of cells used for pathfinding, each either blocked or
+// passable with a cost to cross (1 is normal terrain). Cell (0, 0) has its
+// bottom-left corner at Origin.
+type NavGrid struct {
+	Width    int
+	Height   int
+	CellSize Vec2D
+	Origin   Vec2D
+	blocked  []bool
+	cost     []float64
+	// incremented on every change, so that things derived from the grid
+	// (eg. FlowFields) can tell when they're stale
+	version int
+}
+
+func NewNavGrid(width, height int, cellSize Vec2D, origin Vec2D) *NavGrid {
+	g := &NavGrid{
+		Width:    width,
+		Height:   height,
+		CellSize: cellSize,
+		Origin:   origin,
+		blocked:  make([]bool, width*height),
+		cost:     make([]float64, width*height),
+	}
+	for i := range g.cost {
+		g.cost[i] = 1
+	}
+	return g
+}
+
+// NewNavGridFromWorld builds a grid with cells of size cellSize covering the
+// world (or for unbounded worlds, its TileMap), blocking the cells overlapped
+// by solid tiles and by the entities for which static returns true (if
+// static is nil, entities tagged "static"), and taking costs from the
+// TileMap. Rebuild it (see PathfindingSystem.RebuildGrid()) when static
+// colliders change.
+func NewNavGridFromWorld(w *World, cellSize float64, static func(*Entity) bool) *NavGrid {
+	var extent AABB
+	switch {
+	case !w.Unbounded:
+		extent = AABB{Vec2D{0, 0}, Vec2D{w.Width, w.Height}}
+	case w.TileMap != nil:
+		m := w.TileMap
+		extent = AABB{m.Origin, m.Origin.Add(
+			Vec2D{float64(m.Width) * m.TileWidth, float64(m.Height) * m.TileHeight})}
+	default:
+		panic("can't derive a NavGrid for an unbounded world without a TileMap; build one with NewNavGrid()")
+	}
+	width := int(math.Ceil((extent.Max.X - extent.Min.X) / cellSize))
+	height := int(math.Ceil((extent.Max.Y - extent.Min.Y) / cellSize))
+	g := NewNavGrid(width, height, Vec2D{cellSize, cellSize}, extent.Min)
+	if m := w.TileMap; m != nil {
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				center := g.CellCenter(x, y)
+				if m.BoxCollides(center, g.CellSize) {
+					g.SetBlocked(x, y, true)
+					continue
+				}
+				g.SetCost(x, y, m.CostAt(center))
+			}
+		}
+	}
+	var statics []*Entity
+	if static == nil {
+		statics = w.EntitiesWithTags("static")
+	} else {
+		statics = w.FilterAllEntities(static)
+	}
+	for _, e := range statics {
+		if e.HasComponents(POSITION, BOX) {
+			g.BlockRect(*e.GetVec2D(POSITION), *e.GetVec2D(BOX))
+		}
+	}
+	return g
+}
+
+// InGrid is whether x, y is a cell of the grid
+func (g *NavGrid) InGrid(x, y int) bool {
+	return x >= 0 && x < g.Width && y >= 0 && y < g.Height
+}
+
+func (g *NavGrid) index(x, y int) int {
+	return y*g.Width + x
+}
+
+// Passable is whether x, y is in the grid and not blocked
+func (g *NavGrid) Passable(x, y int) bool {
+	return g.InGrid(x, y) && !g.blocked[g.index(x, y)]
+}
+
+func (g *NavGrid) SetBlocked(x, y int, blocked bool) {
+	if g.InGrid(x, y) {
+		g.blocked[g.index(x, y)] = blocked
+		g.version++
+	}
+}
+
+// Cost is the cost of crossing x, y (+Inf if not passable)
+func (g *NavGrid) Cost(x, y int) float64 {
+	if !g.Passable(x, y) {
+		return math.Inf(1)
+	}
+	return g.cost[g.index(x, y)]
+}
+
+// SetCost sets the cost of crossing x, y (an infinite cost blocks it)
+func (g *NavGrid) SetCost(x, y int, cost float64) {
+	if !g.InGrid(x, y) {
+		return
+	}
+	g.version++
+	if math.IsInf(cost, 1) {
+		g.blocked[g.index(x, y)] = true
+		return
+	}
+	g.cost[g.index(x, y)] = cost
+}
+
+// CellOf gives the cell containing pos, and whether it's in the grid
+func (g *NavGrid) CellOf(pos Vec2D) (x, y int, ok bool) {
+	x = int(math.Floor((pos.X - g.Origin.X) / g.CellSize.X))
+	y = int(math.Floor((pos.Y - g.Origin.Y) / g.CellSize.Y))
+	return x, y, g.InGrid(x, y)
+}
+
+// CellCenter gives the world position of the center of cell x, y
+func (g *NavGrid) CellCenter(x, y int) Vec2D {
+	return Vec2D{
+		g.Origin.X + (float64(x)+0.5)*g.CellSize.X,
+		g.Origin.Y + (float64(y)+0.5)*g.CellSize.Y,
+	}
+}
+
+// BlockRect blocks the cells which the rect (pos in the center) overlaps,
+// not counting cells it only touches at an edge
+func (g *NavGrid) BlockRect(pos, box Vec2D) {
+	aabb := AABBOfRect(pos, box)
+	x0 := maxi(0, int(math.Floor((aabb.Min.X-g.Origin.X)/g.CellSize.X)))
+	y0 := maxi(0, int(math.Floor((aabb.Min.Y-g.Origin.Y)/g.CellSize.Y)))
+	x1 := mini(g.Width-1, int(math.Ceil((aabb.Max.X-g.Origin.X)/g.CellSize.X))-1)
+	y1 := mini(g.Height-1, int(math.Ceil((aabb.Max.Y-g.Origin.Y)/g.CellSize.Y))-1)
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			g.blocked[g.index(x, y)] = true
+		}
+	}
+	g.version++
+}
+
+// uniformCost is whether every passable cell has the same cost (in which
+// case jump point search gives optimal paths)
+func (g *NavGrid) uniformCost() bool {
+	first := math.NaN()
+	for i, c := range g.cost {
+		if g.blocked[i] {
+			continue
+		}
+		if math.IsNaN(first) {
+			first = c
+		} else if c != first {
+			return false
+		}
+	}
+	return true
+}
+
+// minCost is the lowest cost of any passable cell (used to keep the A*
+// heuristic admissible when some terrain costs less than 1)
+func (g *NavGrid) minCost() float64 {
+	min := math.Inf(1)
+	for i, c := range g.cost {
+		if !g.blocked[i] && c < min {
+			min = c
+		}
+	}
+	if math.IsInf(min, 1) {
+		return 1
+	}
+	return min
+}
+
+// nearestPassable finds the closest passable cell to x, y within maxRing
+// rings of cells around it (for when an entity or a target sits in a
+// blocked cell)
+func (g *NavGrid) nearestPassable(x, y, maxRing int) (int, int, bool) {
+	if g.Passable(x, y) {
+		return x, y, true
+	}
+	for ring := 1; ring <= maxRing; ring++ {
+		bestX, bestY, best := 0, 0, math.Inf(1)
+		for dy := -ring; dy <= ring; dy++ {
+			for dx := -ring; dx <= ring; dx++ {
+				if maxi(absi(dx), absi(dy)) != ring || !g.Passable(x+dx, y+dy) {
+					continue
+				}
+				if d := float64(dx*dx + dy*dy); d < best {
+					bestX, bestY, best = x+dx, y+dy, d
+				}
+			}
+		}
+		if !math.IsInf(best, 1) {
+			return bestX, bestY, true
+		}
+	}
+	return 0, 0, false
+}
+
+// segmentClear is whether every cell along the segment is passable and costs
+// no more than limit
+func (g *NavGrid) segmentClear(a, b Vec2D, limit float64) bool {
+	if !g.pointClear(a, limit) || !g.pointClear(b, limit) {
+		return false
+	}
+	_, _, d := a.Distance(b)
+	if d == 0 {
+		return true
+	}
+	clear := true
+	walkCellsAlongRay(a.Sub(g.Origin), b.Sub(a), d,
+		g.CellSize, [2]int{0, 0}, [2]int{g.Width - 1, g.Height - 1},
+		func(x, y int, tEntry float64) bool {
+			clear = g.Cost(x, y) <= limit
+			return clear
+		})
+	return clear
+}
+
+func (g *NavGrid) pointClear(p Vec2D, limit float64) bool {
+	x, y, ok := g.CellOf(p)
+	return ok && g.Cost(x, y) <= limit
+}
+
+// LineOfSight is whether an entity of the given radius can move in a
+// straight line from a to b without entering a blocked cell or a cell
+// costlier than those at a and b (so that smoothing doesn't cut across
+// terrain the path went around). The radius is checked by also testing the
+// two segments offset to either side.
+func (g *NavGrid) LineOfSight(a, b Vec2D, radius float64) bool {
+	limit := math.Max(g.costAt(a), g.costAt(b))
+	if !g.segmentClear(a, b, limit) {
+		return false
+	}
+	if radius == 0 || a == b {
+		return true
+	}
+	offset := b.Sub(a).PerpendicularUnit().Scale(radius)
+	return g.segmentClear(a.Add(offset), b.Add(offset), limit) &&
+		g.segmentClear(a.Sub(offset), b.Sub(offset), limit)
+}
+
+func (g *NavGrid) costAt(p Vec2D) float64 {
+	x, y, ok := g.CellOf(p)
+	if !ok {
+		return math.Inf(1)
+	}
+	return g.Cost(x, y)
+}
+
+// SmoothPath removes the waypoints which can be skipped by moving in a
+// straight line (see LineOfSight()), keeping the first and last points
+func (g *NavGrid) SmoothPath(path []Vec2D, radius float64) []Vec2D {
+	if len(path) <= 2 {
+		return path
+	}
+	smoothed := []Vec2D{path[0]}
+	anchor := 0
+	for i := 2; i < len(path); i++ {
+		if !g.LineOfSight(path[anchor], path[i], radius) {
+			anchor = i - 1
+			smoothed = append(smoothed, path[anchor])
+		}
+	}
+	return append(smoothed, path[len(path)-1])
+}
+
+func absi(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,356 @@
+package sameriver
+
+import (
+	"container/heap"
+	"math"
+)
+
+// PathfindingAlgorithm selects how paths are searched for on a NavGrid
+type PathfindingAlgorithm int
+
+const (
+	// jump point search if every passable cell has the same cost, else A*
+	PATHFIND_AUTO PathfindingAlgorithm = iota
+	// A* over the 8 neighbours of each cell, weighing terrain cost
+	PATHFIND_ASTAR
+	// jump point search (only optimal when costs are uniform)
+	PATHFIND_JPS
+)
+
+// pathSearch is a search which can be run a number of node expansions at a
+// time, so that it can be spread across frames
+type pathSearch interface {
+	// step expands up to n nodes, returning whether the search has finished
+	step(n int) (done bool)
+	// the path found (nil if there is none), once step() has returned true
+	result() []Vec2D
+	// the number of nodes expanded so far
+	expanded() int
+}
+
+type gridOpenItem struct {
+	cell int
+	f    float64
+}
+
+// a min-heap on f; cells can be pushed more than once, and stale entries
+// are skipped when popped
+type gridOpenList []gridOpenItem
+
+func (l gridOpenList) Len() int           { return len(l) }
+func (l gridOpenList) Less(i, j int) bool { return l[i].f < l[j].f }
+func (l gridOpenList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l *gridOpenList) Push(x any)        { *l = append(*l, x.(gridOpenItem)) }
+func (l *gridOpenList) Pop() any {
+	old := *l
+	item := old[len(old)-1]
+	*l = old[:len(old)-1]
+	return item
+}
+
+// gridSearch is an A* (or jump point) search from one cell to another
+type gridSearch struct {
+	g        *NavGrid
+	jps      bool
+	from, to Vec2D
+	start    int
+	goal     int
+	// scales the straight-line heuristic so it never overestimates
+	hScale float64
+
+	open      gridOpenList
+	gScore    map[int]float64
+	parent    map[int]int
+	closed    map[int]bool
+	nExpanded int
+	finished  bool
+	path      []Vec2D
+}
+
+// newGridSearch starts a search for a path from one point to another. If
+// either point is in a blocked cell, the nearest passable cell (within 2
+// cells) is used instead; if there is none, the search finishes at once
+// with no path.
+func newGridSearch(g *NavGrid, from, to Vec2D, algorithm PathfindingAlgorithm) *gridSearch {
+	s := &gridSearch{
+		g:      g,
+		from:   from,
+		to:     to,
+		hScale: g.minCost(),
+		open:   make(gridOpenList, 0),
+		gScore: make(map[int]float64),
+		parent: make(map[int]int),
+		closed: make(map[int]bool),
+	}
+	switch algorithm {
+	case PATHFIND_AUTO:
+		s.jps = g.uniformCost()
+	case PATHFIND_JPS:
+		s.jps = true
+	}
+	sx, sy, sok := g.CellOf(from)
+	gx, gy, gok := g.CellOf(to)
+	if sok {
+		sx, sy, sok = g.nearestPassable(sx, sy, 2)
+	}
+	if gok {
+		gx, gy, gok = g.nearestPassable(gx, gy, 2)
+	}
+	if !sok || !gok {
+		s.finished = true
+		return s
+	}
+	s.start = g.index(sx, sy)
+	s.goal = g.index(gx, gy)
+	s.gScore[s.start] = 0
+	heap.Push(&s.open, gridOpenItem{s.start, s.h(s.start)})
+	return s
+}
+
+func (s *gridSearch) xy(cell int) (int, int) {
+	return cell % s.g.Width, cell / s.g.Width
+}
+
+func (s *gridSearch) center(cell int) Vec2D {
+	x, y := s.xy(cell)
+	return s.g.CellCenter(x, y)
+}
+
+func (s *gridSearch) h(cell int) float64 {
+	_, _, d := s.center(cell).Distance(s.center(s.goal))
+	return d * s.hScale
+}
+
+// moveCost is the cost of a straight move between two cells: the distance
+// weighed by the mean cost of the cells at either end (for jumps, all cells
+// along the way cost the same)
+func (s *gridSearch) moveCost(a, b int) float64 {
+	ax, ay := s.xy(a)
+	bx, by := s.xy(b)
+	_, _, d := s.center(a).Distance(s.center(b))
+	return d * (s.g.Cost(ax, ay) + s.g.Cost(bx, by)) / 2
+}
+
+func (s *gridSearch) step(n int) bool {
+	for i := 0; i < n && !s.finished; i++ {
+		if s.open.Len() == 0 {
+			s.finished = true
+			break
+		}
+		current := heap.Pop(&s.open).(gridOpenItem).cell
+		if s.closed[current] {
+			continue
+		}
+		s.closed[current] = true
+		s.nExpanded++
+		if current == s.goal {
+			s.reconstruct()
+			s.finished = true
+			break
+		}
+		for _, next := range s.successors(current) {
+			if s.closed[next] {
+				continue
+			}
+			g := s.gScore[current] + s.moveCost(current, next)
+			if old, ok := s.gScore[next]; ok && old <= g {
+				continue
+			}
+			s.gScore[next] = g
+			s.parent[next] = current
+			heap.Push(&s.open, gridOpenItem{next, g + s.h(next)})
+		}
+	}
+	return s.finished
+}
+
+func (s *gridSearch) result() []Vec2D {
+	return s.path
+}
+
+func (s *gridSearch) expanded() int {
+	return s.nExpanded
+}
+
+func (s *gridSearch) reconstruct() {
+	cells := []int{s.goal}
+	for c := s.goal; c != s.start; {
+		c = s.parent[c]
+		cells = append(cells, c)
+	}
+	path := make([]Vec2D, 0, len(cells)+1)
+	path = append(path, s.from)
+	// (skip the start and goal cells' centers; we begin at from and end at
+	// to, which lie in them)
+	for i := len(cells) - 2; i >= 1; i-- {
+		path = append(path, s.center(cells[i]))
+	}
+	s.path = append(path, s.to)
+}
+
+func (s *gridSearch) successors(cell int) []int {
+	x, y := s.xy(cell)
+	if !s.jps {
+		return s.neighbours(x, y)
+	}
+	parent, hasParent := s.parent[cell]
+	if !hasParent {
+		return s.jumpAll(x, y, s.neighbours(x, y))
+	}
+	px, py := s.xy(parent)
+	return s.jumpAll(x, y, s.prunedNeighbours(x, y, signi(x-px), signi(y-py)))
+}
+
+// neighbours gives the passable cells around x, y, moving diagonally only if
+// both cells beside the diagonal are passable (so paths don't cut corners)
+func (s *gridSearch) neighbours(x, y int) []int {
+	g := s.g
+	result := make([]int, 0, 8)
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			if dx == 0 && dy == 0 || !g.Passable(x+dx, y+dy) {
+				continue
+			}
+			if dx != 0 && dy != 0 && !(g.Passable(x+dx, y) && g.Passable(x, y+dy)) {
+				continue
+			}
+			result = append(result, g.index(x+dx, y+dy))
+		}
+	}
+	return result
+}
+
+// prunedNeighbours gives the natural and forced neighbours of x, y when
+// arriving in direction dx, dy (jump point search, with no corner cutting)
+func (s *gridSearch) prunedNeighbours(x, y, dx, dy int) []int {
+	g := s.g
+	result := make([]int, 0, 5)
+	add := func(nx, ny int) {
+		result = append(result, g.index(nx, ny))
+	}
+	switch {
+	case dx != 0 && dy != 0:
+		vertical := g.Passable(x, y+dy)
+		horizontal := g.Passable(x+dx, y)
+		if vertical {
+			add(x, y+dy)
+		}
+		if horizontal {
+			add(x+dx, y)
+		}
+		if vertical && horizontal && g.Passable(x+dx, y+dy) {
+			add(x+dx, y+dy)
+		}
+	case dx != 0:
+		next := g.Passable(x+dx, y)
+		above := g.Passable(x, y+1)
+		below := g.Passable(x, y-1)
+		if next {
+			add(x+dx, y)
+			if above && g.Passable(x+dx, y+1) {
+				add(x+dx, y+1)
+			}
+			if below && g.Passable(x+dx, y-1) {
+				add(x+dx, y-1)
+			}
+		}
+		if above {
+			add(x, y+1)
+		}
+		if below {
+			add(x, y-1)
+		}
+	default:
+		next := g.Passable(x, y+dy)
+		right := g.Passable(x+1, y)
+		left := g.Passable(x-1, y)
+		if next {
+			add(x, y+dy)
+			if right && g.Passable(x+1, y+dy) {
+				add(x+1, y+dy)
+			}
+			if left && g.Passable(x-1, y+dy) {
+				add(x-1, y+dy)
+			}
+		}
+		if right {
+			add(x+1, y)
+		}
+		if left {
+			add(x-1, y)
+		}
+	}
+	return result
+}
+
+// jumpAll jumps from x, y toward each neighbour, giving the jump points found
+func (s *gridSearch) jumpAll(x, y int, neighbours []int) []int {
+	result := make([]int, 0, len(neighbours))
+	for _, n := range neighbours {
+		nx, ny := s.xy(n)
+		if jx, jy, ok := s.jump(nx, ny, nx-x, ny-y); ok {
+			result = append(result, s.g.index(jx, jy))
+		}
+	}
+	return result
+}
+
+// jump moves from x, y in direction dx, dy until reaching the goal, a cell
+// with a forced neighbour (a jump point), or an obstacle
+func (s *gridSearch) jump(x, y, dx, dy int) (int, int, bool) {
+	g := s.g
+	gx, gy := s.xy(s.goal)
+	for {
+		if !g.Passable(x, y) {
+			return 0, 0, false
+		}
+		if x == gx && y == gy {
+			return x, y, true
+		}
+		switch {
+		case dx != 0 && dy != 0:
+			if _, _, ok := s.jump(x+dx, y, dx, 0); ok {
+				return x, y, true
+			}
+			if _, _, ok := s.jump(x, y+dy, 0, dy); ok {
+				return x, y, true
+			}
+		case dx != 0:
+			if (g.Passable(x, y-1) && !g.Passable(x-dx, y-1)) ||
+				(g.Passable(x, y+1) && !g.Passable(x-dx, y+1)) {
+				return x, y, true
+			}
+		default:
+			if (g.Passable(x-1, y) && !g.Passable(x-1, y-dy)) ||
+				(g.Passable(x+1, y) && !g.Passable(x+1, y-dy)) {
+				return x, y, true
+			}
+		}
+		// diagonal moves need both cells beside the diagonal to be open
+		if !g.Passable(x+dx, y) || !g.Passable(x, y+dy) {
+			return 0, 0, false
+		}
+		x, y = x+dx, y+dy
+	}
+}
+
+func signi(x int) int {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return 0
+}
+
+// FindPath searches synchronously for a path between two points on the
+// grid, returning nil if there is none. The path begins at from and ends at
+// to, passing through the centers of the cells in between (see SmoothPath()
+// to straighten it).
+func (g *NavGrid) FindPath(from, to Vec2D, algorithm PathfindingAlgorithm) []Vec2D {
+	s := newGridSearch(g, from, to, algorithm)
+	for !s.step(math.MaxInt) {
+	}
+	return s.result()
+}
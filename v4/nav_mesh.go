@@ -0,0 +1,293 @@
+package sameriver
+
+import (
+	"container/heap"
+	"math"
+)
+
+// NavMesh is a set of convex polygons covering the walkable area, adjacent
+// where they share an edge. Paths are searched for over the polygons and
+// straightened through the shared edges (portals) with the funnel
+// algorithm, so they hug corners rather than passing through cell centers.
+type NavMesh struct {
+	Polygons []*NavPolygon
+}
+
+type NavPolygon struct {
+	// in counter-clockwise order
+	Vertices []Vec2D
+	Centroid Vec2D
+	// the polygons sharing an edge with this one
+	Neighbours []*NavPolygon
+	// Portals[i] is the edge shared with Neighbours[i], as the points on
+	// the right and left when passing through it into the neighbour
+	Portals [][2]Vec2D
+	index   int
+}
+
+// NewNavMesh builds a NavMesh from convex polygons (given in either
+// winding order), linking polygons which share an edge (two vertices
+// within a small epsilon)
+func NewNavMesh(polygons [][]Vec2D) *NavMesh {
+	m := &NavMesh{Polygons: make([]*NavPolygon, len(polygons))}
+	for i, vertices := range polygons {
+		if len(vertices) < 3 {
+			panic("NavMesh polygons need at least 3 vertices")
+		}
+		p := &NavPolygon{
+			Vertices: append([]Vec2D{}, vertices...),
+			index:    i,
+		}
+		if polygonArea(p.Vertices) < 0 {
+			for a, b := 0, len(p.Vertices)-1; a < b; a, b = a+1, b-1 {
+				p.Vertices[a], p.Vertices[b] = p.Vertices[b], p.Vertices[a]
+			}
+		}
+		for _, v := range p.Vertices {
+			p.Centroid = p.Centroid.Add(v)
+		}
+		p.Centroid = p.Centroid.Scale(1 / float64(len(p.Vertices)))
+		m.Polygons[i] = p
+	}
+	for i, p := range m.Polygons {
+		for _, q := range m.Polygons[i+1:] {
+			if right, left, ok := sharedEdge(p, q); ok {
+				p.Neighbours = append(p.Neighbours, q)
+				p.Portals = append(p.Portals, [2]Vec2D{right, left})
+				// (q traverses the edge the other way)
+				q.Neighbours = append(q.Neighbours, p)
+				q.Portals = append(q.Portals, [2]Vec2D{left, right})
+			}
+		}
+	}
+	return m
+}
+
+// twice the signed area (positive if counter-clockwise)
+func polygonArea(vertices []Vec2D) float64 {
+	area := 0.0
+	for i, v := range vertices {
+		area += v.ScalarCross(vertices[(i+1)%len(vertices)])
+	}
+	return area
+}
+
+const navMeshEpsilon = 1e-6
+
+func navPointsEqual(a, b Vec2D) bool {
+	return math.Abs(a.X-b.X) < navMeshEpsilon && math.Abs(a.Y-b.Y) < navMeshEpsilon
+}
+
+// sharedEdge finds an edge of p which q also has, giving its endpoints as
+// seen passing from p into q (with p counter-clockwise, an edge a->b has
+// the inside of p on its left, so crossing it outward a is on the right)
+func sharedEdge(p, q *NavPolygon) (right, left Vec2D, ok bool) {
+	for i, a := range p.Vertices {
+		b := p.Vertices[(i+1)%len(p.Vertices)]
+		for j, c := range q.Vertices {
+			d := q.Vertices[(j+1)%len(q.Vertices)]
+			if navPointsEqual(a, d) && navPointsEqual(b, c) {
+				return a, b, true
+			}
+		}
+	}
+	return Vec2D{}, Vec2D{}, false
+}
+
+// Contains is whether the point is inside (or on the edge of) the polygon
+func (p *NavPolygon) Contains(pt Vec2D) bool {
+	for i, a := range p.Vertices {
+		b := p.Vertices[(i+1)%len(p.Vertices)]
+		if b.Sub(a).ScalarCross(pt.Sub(a)) < -navMeshEpsilon {
+			return false
+		}
+	}
+	return true
+}
+
+// PolygonOf gives the polygon containing pt, or nil if it's off the mesh
+func (m *NavMesh) PolygonOf(pt Vec2D) *NavPolygon {
+	for _, p := range m.Polygons {
+		if p.Contains(pt) {
+			return p
+		}
+	}
+	return nil
+}
+
+// navMeshSearch is an A* search over the polygons of a NavMesh, between
+// their centroids (polygon counts are small, so it's expanded quickly)
+type navMeshSearch struct {
+	m         *NavMesh
+	from, to  Vec2D
+	start     *NavPolygon
+	goal      *NavPolygon
+	open      gridOpenList
+	gScore    map[int]float64
+	parent    map[int]int
+	closed    map[int]bool
+	nExpanded int
+	finished  bool
+	path      []Vec2D
+}
+
+func newNavMeshSearch(m *NavMesh, from, to Vec2D) *navMeshSearch {
+	s := &navMeshSearch{
+		m:      m,
+		from:   from,
+		to:     to,
+		start:  m.PolygonOf(from),
+		goal:   m.PolygonOf(to),
+		open:   make(gridOpenList, 0),
+		gScore: make(map[int]float64),
+		parent: make(map[int]int),
+		closed: make(map[int]bool),
+	}
+	if s.start == nil || s.goal == nil {
+		s.finished = true
+		return s
+	}
+	s.gScore[s.start.index] = 0
+	heap.Push(&s.open, gridOpenItem{s.start.index, 0})
+	return s
+}
+
+// the point a polygon is entered at during the search, for costs
+func (s *navMeshSearch) point(p *NavPolygon) Vec2D {
+	switch p {
+	case s.start:
+		return s.from
+	case s.goal:
+		return s.to
+	}
+	return p.Centroid
+}
+
+func (s *navMeshSearch) step(n int) bool {
+	for i := 0; i < n && !s.finished; i++ {
+		if s.open.Len() == 0 {
+			s.finished = true
+			break
+		}
+		current := heap.Pop(&s.open).(gridOpenItem).cell
+		if s.closed[current] {
+			continue
+		}
+		s.closed[current] = true
+		s.nExpanded++
+		if current == s.goal.index {
+			s.reconstruct()
+			s.finished = true
+			break
+		}
+		p := s.m.Polygons[current]
+		for _, q := range p.Neighbours {
+			if s.closed[q.index] {
+				continue
+			}
+			_, _, d := s.point(p).Distance(s.point(q))
+			g := s.gScore[current] + d
+			if old, ok := s.gScore[q.index]; ok && old <= g {
+				continue
+			}
+			s.gScore[q.index] = g
+			s.parent[q.index] = current
+			_, _, h := s.point(q).Distance(s.to)
+			heap.Push(&s.open, gridOpenItem{q.index, g + h})
+		}
+	}
+	return s.finished
+}
+
+func (s *navMeshSearch) result() []Vec2D {
+	return s.path
+}
+
+func (s *navMeshSearch) expanded() int {
+	return s.nExpanded
+}
+
+func (s *navMeshSearch) reconstruct() {
+	corridor := []*NavPolygon{s.goal}
+	for c := s.goal.index; c != s.start.index; {
+		c = s.parent[c]
+		corridor = append(corridor, s.m.Polygons[c])
+	}
+	for a, b := 0, len(corridor)-1; a < b; a, b = a+1, b-1 {
+		corridor[a], corridor[b] = corridor[b], corridor[a]
+	}
+	// the portals crossed along the corridor, bracketed by the start and end
+	// points as degenerate portals
+	portals := [][2]Vec2D{{s.from, s.from}}
+	for i := 0; i+1 < len(corridor); i++ {
+		p, q := corridor[i], corridor[i+1]
+		for j, n := range p.Neighbours {
+			if n == q {
+				portals = append(portals, p.Portals[j])
+				break
+			}
+		}
+	}
+	portals = append(portals, [2]Vec2D{s.to, s.to})
+	s.path = funnel(portals)
+}
+
+// funnel straightens a path through a sequence of portals (right, left
+// pairs) using the "simple stupid funnel algorithm": the funnel from the
+// apex is narrowed by each portal, and when one side crosses the other, the
+// crossed side's point becomes a corner of the path and the new apex
+func funnel(portals [][2]Vec2D) []Vec2D {
+	apex := portals[0][0]
+	right, left := portals[0][0], portals[0][1]
+	apexIx, rightIx, leftIx := 0, 0, 0
+	path := []Vec2D{apex}
+	// > 0 if c is to the left of the ray a->b
+	side := func(a, b, c Vec2D) float64 {
+		return b.Sub(a).ScalarCross(c.Sub(a))
+	}
+	for i := 1; i < len(portals); i++ {
+		r, l := portals[i][0], portals[i][1]
+		// narrow the right side
+		if side(apex, right, r) >= 0 {
+			if navPointsEqual(apex, right) || side(apex, left, r) < 0 {
+				right, rightIx = r, i
+			} else {
+				// right crossed over left; left is a corner
+				apex, apexIx = left, leftIx
+				path = append(path, apex)
+				right, left = apex, apex
+				rightIx, leftIx = apexIx, apexIx
+				i = apexIx
+				continue
+			}
+		}
+		// narrow the left side
+		if side(apex, left, l) <= 0 {
+			if navPointsEqual(apex, left) || side(apex, right, l) > 0 {
+				left, leftIx = l, i
+			} else {
+				// left crossed over right; right is a corner
+				apex, apexIx = right, rightIx
+				path = append(path, apex)
+				right, left = apex, apex
+				rightIx, leftIx = apexIx, apexIx
+				i = apexIx
+				continue
+			}
+		}
+	}
+	end := portals[len(portals)-1][0]
+	if !navPointsEqual(path[len(path)-1], end) {
+		path = append(path, end)
+	}
+	return path
+}
+
+// FindPath searches synchronously for a path between two points on the
+// mesh, returning nil if either is off the mesh or they aren't connected
+func (m *NavMesh) FindPath(from, to Vec2D) []Vec2D {
+	s := newNavMeshSearch(m, from, to)
+	for !s.step(math.MaxInt) {
+	}
+	return s.result()
+}
@@ -2,6 +2,7 @@ package sameriver
 
 import (
 	"math"
+	"strings"
 )
 
 type NumericInterval struct {
@@ -35,17 +36,59 @@ func MakeNumericInterval(op string, val int) *NumericInterval {
 		return &NumericInterval{float64(val), math.Inf(+1)}
 	case ">":
 		return &NumericInterval{float64(val + 1), math.Inf(+1)}
-		/*
-			case ">;<":
-				// TODO
-			case ">=;<":
-				// TODO
-			case ">;<=":
-				// TODO
-			case ">=;<=":
-				// TODO
-		*/
 	default:
 		panic("Got undefined op in GOAPGoalFunc() [valid: >=,>,=,<,<=]")
 	}
 }
+
+// MakeNumericIntervalFloat is MakeNumericInterval() for a real-valued var:
+// the strict ops exclude val itself rather than stepping by 1 (by a margin
+// of twice GOAP_EPSILON, so that vals within rounding error of val, which
+// the planner forgives, are still excluded)
+func MakeNumericIntervalFloat(op string, val float64) *NumericInterval {
+	switch op {
+	case "<":
+		return &NumericInterval{math.Inf(-1), val - 2*GOAP_EPSILON}
+	case "<=":
+		return &NumericInterval{math.Inf(-1), val}
+	case "=":
+		return &NumericInterval{val, val}
+	case ">=":
+		return &NumericInterval{val, math.Inf(+1)}
+	case ">":
+		return &NumericInterval{val + 2*GOAP_EPSILON, math.Inf(+1)}
+	default:
+		panic("Got undefined op in MakeNumericIntervalFloat() [valid: >=,>,=,<,<=]")
+	}
+}
+
+// MakeNumericRange gives the range between a and b, the op being the
+// brackets closing it: "[]" includes both ends, "()" excludes both, and
+// "[)", "(]" one or the other (see MakeNumericIntervalFloat() on excluding
+// an end)
+func MakeNumericRange(op string, a, b float64) *NumericInterval {
+	if len(op) != 2 {
+		panic("Got undefined op in MakeNumericRange() [valid: [],[),(],()]")
+	}
+	i := &NumericInterval{a, b}
+	switch op[0] {
+	case '[':
+	case '(':
+		i.A = a + 2*GOAP_EPSILON
+	default:
+		panic("Got undefined op in MakeNumericRange() [valid: [],[),(],()]")
+	}
+	switch op[1] {
+	case ']':
+	case ')':
+		i.B = b - 2*GOAP_EPSILON
+	default:
+		panic("Got undefined op in MakeNumericRange() [valid: [],[),(],()]")
+	}
+	return i
+}
+
+// whether op closes a range (see MakeNumericRange())
+func isNumericRangeOp(op string) bool {
+	return len(op) == 2 && strings.ContainsRune("[(", rune(op[0])) && strings.ContainsRune("])", rune(op[1]))
+}
@@ -0,0 +1,328 @@
+package sameriver
+
+import (
+	"math"
+)
+
+// ORCAAvoidance is an optional stage of the SteeringSystem (see
+// SteeringSystem.Avoidance) which, after steering has set each entity's
+// velocity, adjusts it as little as possible so that it won't collide with
+// its neighbours within TimeHorizon ms, using optimal reciprocal collision
+// avoidance (van den Berg et al., as in RVO2). Agents which are both
+// avoiding each take half the responsibility for a pair, so they pass
+// smoothly instead of meeting head-on and being stopped by the
+// PhysicsSystem undoing their moves.
+//
+// Agents are treated as circles of radius half the larger side of their BOX
+// (plus Padding). Neighbours come from the world's spatial index; those
+// which don't avoid (eg. static entities, or those not steered) are avoided
+// with full responsibility. Solid tiles aren't considered.
+type ORCAAvoidance struct {
+	// how far ahead (ms) collisions are avoided; longer is safer but makes
+	// agents swerve earlier
+	TimeHorizon float64
+	// how far from an agent's box its neighbours are sought
+	NeighbourDistance float64
+	// the most (nearest) neighbours considered per agent
+	MaxNeighbours int
+	// added to each agent's radius
+	Padding float64
+	// which entities are avoided (nil for all with a BOX)
+	Filter func(*Entity) bool
+}
+
+func NewORCAAvoidance() *ORCAAvoidance {
+	return &ORCAAvoidance{
+		TimeHorizon:       100,
+		NeighbourDistance: 40,
+		MaxNeighbours:     10,
+		Padding:           0.5,
+	}
+}
+
+// a half-plane of permitted velocities: those to the left of the line
+// through point in direction
+type orcaLine struct {
+	point     Vec2D
+	direction Vec2D
+}
+
+const orcaEpsilon = 1e-9
+
+func (a *ORCAAvoidance) radius(e *Entity) float64 {
+	box := e.GetVec2D(BOX)
+	return maxf(box.X, box.Y)/2 + a.Padding
+}
+
+// avoid replaces the velocities of the agents (which steering has just set,
+// and which are taken as their preferred velocities) with collision-free
+// ones. dt_ms is the time step, used to resolve agents already overlapping.
+func (a *ORCAAvoidance) avoid(agents []*Entity, dt_ms float64) {
+	if dt_ms <= 0 {
+		return
+	}
+	avoiding := make(map[*Entity]bool, len(agents))
+	preferred := make(map[*Entity]Vec2D, len(agents))
+	for _, e := range agents {
+		if e.HasComponent(BOX) {
+			avoiding[e] = true
+			preferred[e] = *e.GetVec2D(VELOCITY)
+		}
+	}
+	velocities := make([]Vec2D, len(agents))
+	for i, e := range agents {
+		if !avoiding[e] {
+			continue
+		}
+		lines := a.lines(e, avoiding, preferred, dt_ms)
+		maxSpeed := *e.GetFloat64(MAXVELOCITY)
+		velocities[i] = solveORCA(lines, maxSpeed, preferred[e])
+	}
+	for i, e := range agents {
+		if avoiding[e] {
+			*e.GetVec2D(VELOCITY) = velocities[i]
+		}
+	}
+}
+
+// lines computes the ORCA half-planes for e induced by its neighbours
+func (a *ORCAAvoidance) lines(
+	e *Entity, avoiding map[*Entity]bool, preferred map[*Entity]Vec2D, dt_ms float64) []orcaLine {
+
+	pos := *e.GetVec2D(POSITION)
+	vel := preferred[e]
+	radius := a.radius(e)
+	neighbours := nearestEntities(e, a.neighbours(e), a.MaxNeighbours)
+	lines := make([]orcaLine, 0, len(neighbours))
+	invTau := 1 / a.TimeHorizon
+	for _, other := range neighbours {
+		otherVel := Vec2D{0, 0}
+		responsibility := 1.0
+		if avoiding[other] {
+			otherVel = preferred[other]
+			responsibility = 0.5
+		} else if other.HasComponent(VELOCITY) {
+			otherVel = *other.GetVec2D(VELOCITY)
+		}
+		relPos := other.GetVec2D(POSITION).Sub(pos)
+		relVel := vel.Sub(otherVel)
+		distSq := relPos.Dot(relPos)
+		combinedRadius := radius + a.radius(other)
+		combinedRadiusSq := combinedRadius * combinedRadius
+
+		var line orcaLine
+		var u Vec2D
+		if distSq > combinedRadiusSq {
+			// no collision yet; w is from the center of the cut-off circle
+			// of the velocity obstacle to the relative velocity
+			w := relVel.Sub(relPos.Scale(invTau))
+			wLengthSq := w.Dot(w)
+			dot1 := w.Dot(relPos)
+			if dot1 < 0 && dot1*dot1 > combinedRadiusSq*wLengthSq {
+				// project on the cut-off circle
+				wLength := math.Sqrt(wLengthSq)
+				unitW := w.Scale(1 / wLength)
+				line.direction = Vec2D{unitW.Y, -unitW.X}
+				u = unitW.Scale(combinedRadius*invTau - wLength)
+			} else {
+				// project on the legs of the cone
+				leg := math.Sqrt(distSq - combinedRadiusSq)
+				if relPos.ScalarCross(w) > 0 {
+					// left leg
+					line.direction = Vec2D{
+						relPos.X*leg - relPos.Y*combinedRadius,
+						relPos.X*combinedRadius + relPos.Y*leg,
+					}.Scale(1 / distSq)
+				} else {
+					// right leg
+					line.direction = Vec2D{
+						relPos.X*leg + relPos.Y*combinedRadius,
+						-relPos.X*combinedRadius + relPos.Y*leg,
+					}.Scale(-1 / distSq)
+				}
+				dot2 := relVel.Dot(line.direction)
+				u = line.direction.Scale(dot2).Sub(relVel)
+			}
+		} else {
+			// already overlapping; get apart within this time step
+			invTimeStep := 1 / dt_ms
+			w := relVel.Sub(relPos.Scale(invTimeStep))
+			wLength := w.Magnitude()
+			if wLength < orcaEpsilon {
+				// (exactly coincident; push apart in any direction)
+				w, wLength = Vec2D{1, 0}, 1
+			}
+			unitW := w.Scale(1 / wLength)
+			line.direction = Vec2D{unitW.Y, -unitW.X}
+			u = unitW.Scale(combinedRadius*invTimeStep - wLength)
+		}
+		line.point = vel.Add(u.Scale(responsibility))
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func (a *ORCAAvoidance) neighbours(e *Entity) []*Entity {
+	w := e.World
+	return w.EntitiesWithinDistanceFilter(
+		*e.GetVec2D(POSITION), *e.GetVec2D(BOX), a.NeighbourDistance,
+		func(other *Entity) bool {
+			return other != e && other.Active && other.HasComponent(BOX) &&
+				(a.Filter == nil || a.Filter(other))
+		})
+}
+
+// nearestEntities keeps the n entities nearest e (all if n <= 0)
+func nearestEntities(e *Entity, entities []*Entity, n int) []*Entity {
+	if n <= 0 || len(entities) <= n {
+		return entities
+	}
+	pos := *e.GetVec2D(POSITION)
+	distSq := func(x *Entity) float64 {
+		d := x.GetVec2D(POSITION).Sub(pos)
+		return d.Dot(d)
+	}
+	// (partial selection sort; n is small)
+	for i := 0; i < n; i++ {
+		min := i
+		for j := i + 1; j < len(entities); j++ {
+			if distSq(entities[j]) < distSq(entities[min]) {
+				min = j
+			}
+		}
+		entities[i], entities[min] = entities[min], entities[i]
+	}
+	return entities[:n]
+}
+
+// solveORCA finds the velocity closest to preferred within the disc of
+// radius maxSpeed which satisfies all the lines, or if there is none, the
+// one which least violates them
+func solveORCA(lines []orcaLine, maxSpeed float64, preferred Vec2D) Vec2D {
+	var result Vec2D
+	lineFail := linearProgram2(lines, maxSpeed, preferred, false, &result)
+	if lineFail < len(lines) {
+		linearProgram3(lines, lineFail, maxSpeed, &result)
+	}
+	return result
+}
+
+// linearProgram1 finds the point on line lineNo (within the disc and
+// satisfying the lines before it) closest to optVelocity, or furthest in
+// its direction if directionOpt
+func linearProgram1(
+	lines []orcaLine, lineNo int, radius float64, optVelocity Vec2D,
+	directionOpt bool, result *Vec2D) bool {
+
+	line := lines[lineNo]
+	dot := line.point.Dot(line.direction)
+	discriminant := dot*dot + radius*radius - line.point.Dot(line.point)
+	if discriminant < 0 {
+		// the line doesn't cross the disc
+		return false
+	}
+	sqrtDiscriminant := math.Sqrt(discriminant)
+	tLeft := -dot - sqrtDiscriminant
+	tRight := -dot + sqrtDiscriminant
+	for i := 0; i < lineNo; i++ {
+		denominator := line.direction.ScalarCross(lines[i].direction)
+		numerator := lines[i].direction.ScalarCross(line.point.Sub(lines[i].point))
+		if math.Abs(denominator) <= orcaEpsilon {
+			// parallel lines
+			if numerator < 0 {
+				return false
+			}
+			continue
+		}
+		t := numerator / denominator
+		if denominator >= 0 {
+			tRight = math.Min(tRight, t)
+		} else {
+			tLeft = math.Max(tLeft, t)
+		}
+		if tLeft > tRight {
+			return false
+		}
+	}
+	var t float64
+	if directionOpt {
+		if optVelocity.Dot(line.direction) > 0 {
+			t = tRight
+		} else {
+			t = tLeft
+		}
+	} else {
+		t = line.direction.Dot(optVelocity.Sub(line.point))
+		t = math.Max(tLeft, math.Min(tRight, t))
+	}
+	*result = line.point.Add(line.direction.Scale(t))
+	return true
+}
+
+// linearProgram2 finds the velocity closest to optVelocity within the disc
+// satisfying all the lines, returning len(lines) on success or the index of
+// the line which couldn't be satisfied
+func linearProgram2(
+	lines []orcaLine, radius float64, optVelocity Vec2D,
+	directionOpt bool, result *Vec2D) int {
+
+	switch {
+	case directionOpt:
+		// (optVelocity is a unit direction)
+		*result = optVelocity.Scale(radius)
+	case optVelocity.Dot(optVelocity) > radius*radius:
+		*result = optVelocity.Unit().Scale(radius)
+	default:
+		*result = optVelocity
+	}
+	for i := range lines {
+		if lines[i].direction.ScalarCross(lines[i].point.Sub(*result)) > 0 {
+			// result violates line i
+			previous := *result
+			if !linearProgram1(lines, i, radius, optVelocity, directionOpt, result) {
+				*result = previous
+				return i
+			}
+		}
+	}
+	return len(lines)
+}
+
+// linearProgram3 is used when the lines can't all be satisfied (agents are
+// packed too densely); it finds the velocity minimising the greatest
+// violation of the lines from beginLine on
+func linearProgram3(lines []orcaLine, beginLine int, radius float64, result *Vec2D) {
+	distance := 0.0
+	for i := beginLine; i < len(lines); i++ {
+		if lines[i].direction.ScalarCross(lines[i].point.Sub(*result)) <= distance {
+			continue
+		}
+		// result violates line i by more than the current distance
+		projLines := make([]orcaLine, 0, i)
+		for j := 0; j < i; j++ {
+			var line orcaLine
+			determinant := lines[i].direction.ScalarCross(lines[j].direction)
+			if math.Abs(determinant) <= orcaEpsilon {
+				if lines[i].direction.Dot(lines[j].direction) > 0 {
+					// same direction
+					continue
+				}
+				// opposite direction
+				line.point = lines[i].point.Add(lines[j].point).Scale(0.5)
+			} else {
+				t := lines[j].direction.ScalarCross(lines[i].point.Sub(lines[j].point)) / determinant
+				line.point = lines[i].point.Add(lines[i].direction.Scale(t))
+			}
+			line.direction = lines[j].direction.Sub(lines[i].direction).Unit()
+			projLines = append(projLines, line)
+		}
+		previous := *result
+		optDirection := Vec2D{-lines[i].direction.Y, lines[i].direction.X}
+		if linearProgram2(projLines, radius, optDirection, true, result) < len(projLines) {
+			// shouldn't happen in principle (the result is by definition
+			// already in the feasible region), but can due to floating point
+			*result = previous
+		}
+		distance = lines[i].direction.ScalarCross(lines[i].point.Sub(*result))
+	}
+}
@@ -0,0 +1,101 @@
+package sameriver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestORCALinearProgram(t *testing.T) {
+	// permitted: velocities with y >= 0
+	lines := []orcaLine{{point: Vec2D{0, 0}, direction: Vec2D{1, 0}}}
+	v := solveORCA(lines, 2, Vec2D{1, -1})
+	if v.Y < -1e-9 || v.X < 0.99 || v.X > 1.01 {
+		t.Fatalf("should have projected onto the line, got %v", v)
+	}
+	v = solveORCA(lines, 2, Vec2D{0, 5})
+	if v.Magnitude() > 2+1e-9 {
+		t.Fatalf("should have been limited to the max speed, got %v", v)
+	}
+	// infeasible: y >= 1 and y <= -1; should split the difference
+	lines = append(lines[:0],
+		orcaLine{point: Vec2D{0, 1}, direction: Vec2D{1, 0}},
+		orcaLine{point: Vec2D{0, -1}, direction: Vec2D{-1, 0}})
+	v = solveORCA(lines, 2, Vec2D{0, 0})
+	if v.Y < -1e-9 || v.Y > 1e-9 {
+		t.Fatalf("should have minimised the greatest violation, got %v", v)
+	}
+}
+
+// spawns agents which Arrive at their MOVEMENTTARGET, and runs the world
+// until they've all arrived (or for at most maxUpdates), giving whether they
+// did
+func runAvoidanceScenario(avoidance *ORCAAvoidance, m *TileMap,
+	starts, targets []Vec2D, maxUpdates int) bool {
+
+	w := testingWorld()
+	ss := NewSteeringSystem()
+	ss.Avoidance = avoidance
+	w.RegisterSystems(ss, NewPhysicsSystem())
+	if m != nil {
+		w.SetTileMap(m)
+	}
+	agents := make([]*Entity, len(starts))
+	for i := range starts {
+		agents[i] = testingSpawnSteeringBehaviours(w, starts[i], nil)
+		*agents[i].GetFloat64(MAXVELOCITY) = 0.3
+		*agents[i].GetVec2D(MOVEMENTTARGET) = targets[i]
+	}
+	arrived := func() bool {
+		for i, e := range agents {
+			if _, _, d := e.GetVec2D(POSITION).Distance(targets[i]); d > 3 {
+				return false
+			}
+		}
+		return true
+	}
+	for i := 0; i < maxUpdates && !arrived(); i++ {
+		w.Update(FRAME_MS / 2)
+		time.Sleep(100 * time.Microsecond)
+	}
+	return arrived()
+}
+
+func TestORCAAvoidanceCrossing(t *testing.T) {
+	// four agents crossing through the same point from the compass points
+	c := Vec2D{500, 500}
+	starts := []Vec2D{
+		c.Add(Vec2D{-40, 0}), c.Add(Vec2D{40, 0}),
+		c.Add(Vec2D{0, -40}), c.Add(Vec2D{0, 40}),
+	}
+	targets := []Vec2D{starts[1], starts[0], starts[3], starts[2]}
+	if !runAvoidanceScenario(NewORCAAvoidance(), nil, starts, targets, 1500) {
+		t.Fatal("agents crossing should have avoided each other and arrived")
+	}
+	// (without avoidance, the head-on pair jams)
+	if runAvoidanceScenario(nil, nil, starts[:2], targets[:2], 200) {
+		t.Fatal("agents meeting head-on without avoidance should have jammed")
+	}
+}
+
+func TestORCAAvoidanceCorridor(t *testing.T) {
+	// a corridor 20 wide between walls at y=100 and y=120, with three agents
+	// heading each way in single file
+	m := NewTileMap(100, 100, 10, 10)
+	walls := m.AddLayer("walls")
+	walls.SetSolid(true)
+	for x := 0; x < 100; x++ {
+		walls.SetTile(x, 9, 1)
+		walls.SetTile(x, 12, 1)
+	}
+	starts := make([]Vec2D, 0)
+	targets := make([]Vec2D, 0)
+	for i := 0; i < 3; i++ {
+		east := Vec2D{100 + float64(i)*15, 110}
+		west := Vec2D{270 + float64(i)*15, 110}
+		starts = append(starts, east, west)
+		targets = append(targets, west, east)
+	}
+	if !runAvoidanceScenario(NewORCAAvoidance(), m, starts, targets, 1500) {
+		t.Fatal("agents passing in the corridor should have avoided each other and arrived")
+	}
+}
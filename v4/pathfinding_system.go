@@ -0,0 +1,283 @@
+package sameriver
+
+import (
+	"time"
+)
+
+type PathRequestStatus int
+
+const (
+	PATH_PENDING PathRequestStatus = iota
+	PATH_FOUND
+	PATH_NOT_FOUND
+	PATH_CANCELLED
+)
+
+// PathRequest is a search for a path for an entity, processed over however
+// many updates of the PathfindingSystem it takes
+type PathRequest struct {
+	Entity *Entity
+	From   Vec2D
+	To     Vec2D
+	Status PathRequestStatus
+	// the (smoothed) path from From to To, once found
+	Path   []Vec2D
+	search pathSearch
+}
+
+func (r *PathRequest) Done() bool {
+	return r.Status != PATH_PENDING
+}
+
+// PathfindingSystem finds paths for entities around static obstacles, on a
+// NavGrid derived from the world's TileMap and static entities, or on a
+// NavMesh if one is set. Requests are searched a few node expansions at a
+// time within BudgetMs each Update(), and since Update() is run by the
+// RuntimeLimitSharer like any system, searching shares the frame's budget
+// with everything else rather than stalling it. Found paths are put in the
+// entity's PATH component (if it has one) as a FollowPath, which the
+// SteeringSystem follows waypoint-by-waypoint, and published on Events as
+// "path-found" or "path-not-found" with the *PathRequest as data.
+//
+// For many entities heading to the same place, FlowField() gives a cached
+// flow field over the Grid instead (see FollowFlowField). A Grid built from
+// the world is rebuilt, and its flow fields with it, when entities tagged
+// "static" are spawned or despawned.
+type PathfindingSystem struct {
+	w      *World
+	Events *EventBus
+
+	// the grid searched; built with NewNavGridFromWorld() on first use if
+	// nil (see RebuildGrid())
+	Grid *NavGrid
+	// flow fields over the Grid (see FlowField())
+	FlowFields *FlowFieldCache
+	// the most flow fields kept in FlowFields
+	MaxFlowFields int
+	// cell size used when building Grid
+	CellSize float64
+	// if set, paths are searched for on the NavMesh instead of the Grid
+	NavMesh *NavMesh
+	// which search to use on the Grid
+	Algorithm PathfindingAlgorithm
+	// whether grid paths are straightened (see NavGrid.SmoothPath())
+	Smooth bool
+	// the WaypointRadius of the FollowPath put in PATH
+	WaypointRadius float64
+	// how long each Update() may spend searching
+	BudgetMs float64
+	// how many nodes a request expands before we check the time and move on
+	// to the next request
+	ExpansionsPerStep int
+	// requests which expand more nodes than this fail (0 for no limit)
+	MaxExpansions int
+
+	// pending requests, searched round-robin
+	requests []*PathRequest
+	next     int
+	byEntity map[*Entity]*PathRequest
+
+	// the Grid as last built by RebuildGrid() (a Grid set by the user isn't
+	// rebuilt when statics change)
+	derivedGrid *NavGrid
+	// set when an entity tagged "static" is spawned or despawned
+	staticsChanged bool
+}
+
+func NewPathfindingSystem() *PathfindingSystem {
+	return &PathfindingSystem{
+		Events:            NewEventBus("pathfinding"),
+		CellSize:          10,
+		Algorithm:         PATHFIND_AUTO,
+		Smooth:            true,
+		WaypointRadius:    5,
+		MaxFlowFields:     32,
+		BudgetMs:          1,
+		ExpansionsPerStep: 64,
+		requests:          make([]*PathRequest, 0),
+		byEntity:          make(map[*Entity]*PathRequest),
+	}
+}
+
+func (p *PathfindingSystem) GetComponentDeps() []any {
+	return []any{
+		POSITION, VEC2D, "POSITION",
+		BOX, VEC2D, "BOX",
+		PATH, GENERIC, "PATH",
+	}
+}
+
+func (p *PathfindingSystem) LinkWorld(w *World) {
+	p.w = w
+	w.UpdatedEntitiesWithTag("static").AddCallback(func(EntitySignal) {
+		p.staticsChanged = true
+	})
+}
+
+// RebuildGrid rebuilds the Grid from the world, dropping all flow fields
+// (call it when the TileMap changes; spawning and despawning static
+// entities triggers it automatically)
+func (p *PathfindingSystem) RebuildGrid() {
+	p.Grid = NewNavGridFromWorld(p.w, p.CellSize, nil)
+	p.derivedGrid = p.Grid
+	p.FlowFields = NewFlowFieldCache(p.Grid, p.MaxFlowFields)
+}
+
+// FlowField gives the flow field toward target over the Grid, from
+// FlowFields if one was already built for the target's cell, or nil if
+// target is off the grid
+func (p *PathfindingSystem) FlowField(target Vec2D) *FlowField {
+	if p.Grid == nil {
+		p.RebuildGrid()
+	}
+	if p.FlowFields == nil || p.FlowFields.Grid != p.Grid {
+		p.FlowFields = NewFlowFieldCache(p.Grid, p.MaxFlowFields)
+	}
+	return p.FlowFields.Get(target)
+}
+
+func (p *PathfindingSystem) newSearch(from, to Vec2D) pathSearch {
+	if p.NavMesh != nil {
+		return newNavMeshSearch(p.NavMesh, from, to)
+	}
+	if p.Grid == nil {
+		p.RebuildGrid()
+	}
+	return newGridSearch(p.Grid, from, to, p.Algorithm)
+}
+
+// RequestPath queues a search for a path from the entity's position to the
+// given point, replacing any pending request for the entity
+func (p *PathfindingSystem) RequestPath(e *Entity, to Vec2D) *PathRequest {
+	p.Cancel(e)
+	from := *e.GetVec2D(POSITION)
+	r := &PathRequest{
+		Entity: e,
+		From:   from,
+		To:     to,
+		Status: PATH_PENDING,
+		search: p.newSearch(from, to),
+	}
+	p.requests = append(p.requests, r)
+	p.byEntity[e] = r
+	return r
+}
+
+// Cancel cancels the entity's pending request, if any
+func (p *PathfindingSystem) Cancel(e *Entity) {
+	if r, ok := p.byEntity[e]; ok {
+		r.Status = PATH_CANCELLED
+		p.remove(r)
+	}
+}
+
+// Pending gives the entity's pending request, or nil
+func (p *PathfindingSystem) Pending(e *Entity) *PathRequest {
+	return p.byEntity[e]
+}
+
+func (p *PathfindingSystem) remove(r *PathRequest) {
+	for i, x := range p.requests {
+		if x == r {
+			p.requests = append(p.requests[:i], p.requests[i+1:]...)
+			if p.next > i {
+				p.next--
+			}
+			break
+		}
+	}
+	if p.byEntity[r.Entity] == r {
+		delete(p.byEntity, r.Entity)
+	}
+}
+
+// FindPath searches synchronously for a (smoothed, for an entity of the
+// given radius) path between two points, returning nil if there is none
+func (p *PathfindingSystem) FindPath(from, to Vec2D, radius float64) []Vec2D {
+	s := p.newSearch(from, to)
+	for !s.step(p.ExpansionsPerStep) {
+	}
+	return p.smooth(s.result(), radius)
+}
+
+func (p *PathfindingSystem) smooth(path []Vec2D, radius float64) []Vec2D {
+	// (navmesh paths are already straightened by the funnel)
+	if path == nil || !p.Smooth || p.NavMesh != nil {
+		return path
+	}
+	return p.Grid.SmoothPath(path, radius)
+}
+
+func (p *PathfindingSystem) Update(dt_ms float64) {
+	t0 := time.Now()
+	if p.staticsChanged {
+		p.staticsChanged = false
+		if p.Grid != nil && p.Grid == p.derivedGrid {
+			p.RebuildGrid()
+		}
+	}
+	// (always take at least one step, so that searches progress even if
+	// the budget is tiny)
+	for first := true; len(p.requests) > 0; first = false {
+		if !first && float64(time.Since(t0).Nanoseconds())/1e6 >= p.BudgetMs {
+			break
+		}
+		if p.next >= len(p.requests) {
+			p.next = 0
+		}
+		r := p.requests[p.next]
+		if r.Entity.Despawned {
+			r.Status = PATH_CANCELLED
+			p.remove(r)
+			continue
+		}
+		done := r.search.step(p.ExpansionsPerStep)
+		if !done && p.MaxExpansions > 0 && r.search.expanded() >= p.MaxExpansions {
+			done = true
+		}
+		if done {
+			p.remove(r)
+			p.complete(r)
+		} else {
+			p.next++
+		}
+	}
+}
+
+func (p *PathfindingSystem) complete(r *PathRequest) {
+	path := r.search.result()
+	r.search = nil
+	if path == nil {
+		r.Status = PATH_NOT_FOUND
+		p.Events.Publish("path-not-found", r)
+		return
+	}
+	radius := 0.0
+	if r.Entity.HasComponent(BOX) {
+		box := r.Entity.GetVec2D(BOX)
+		radius = maxf(box.X, box.Y) / 2
+	}
+	r.Path = p.smooth(path, radius)
+	r.Status = PATH_FOUND
+	if r.Entity.HasComponent(PATH) {
+		if fp := pathOf(r.Entity); fp != nil {
+			fp.SetPath(r.Path)
+		} else {
+			r.Entity.SetGeneric(PATH, NewFollowPath(r.Path, p.WaypointRadius))
+		}
+	}
+	p.Events.Publish("path-found", r)
+}
+
+// the entity's PATH, or nil if it has none
+func pathOf(e *Entity) *FollowPath {
+	if !e.HasComponent(PATH) {
+		return nil
+	}
+	fp, _ := e.GetGeneric(PATH).(*FollowPath)
+	return fp
+}
+
+func (p *PathfindingSystem) Expand(n int) {
+	// nil?
+}
@@ -0,0 +1,264 @@
+package sameriver
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// a 10x10 grid of unit cells with a wall at x=5 from y=0 to y=8, leaving a
+// gap at the top
+func testingWalledNavGrid() *NavGrid {
+	g := NewNavGrid(10, 10, Vec2D{1, 1}, Vec2D{0, 0})
+	for y := 0; y < 9; y++ {
+		g.SetBlocked(5, y, true)
+	}
+	return g
+}
+
+func pathLength(path []Vec2D) float64 {
+	length := 0.0
+	for i := 1; i < len(path); i++ {
+		_, _, d := path[i-1].Distance(path[i])
+		length += d
+	}
+	return length
+}
+
+func checkPathClear(t *testing.T, g *NavGrid, path []Vec2D) {
+	for i := 1; i < len(path); i++ {
+		if !g.segmentClear(path[i-1], path[i], math.Inf(1)) {
+			t.Fatalf("path segment %v -> %v crosses a blocked cell", path[i-1], path[i])
+		}
+	}
+}
+
+func TestNavGridFindPath(t *testing.T) {
+	g := testingWalledNavGrid()
+	from, to := Vec2D{0.5, 0.5}, Vec2D{9.5, 0.5}
+	astar := g.FindPath(from, to, PATHFIND_ASTAR)
+	jps := g.FindPath(from, to, PATHFIND_JPS)
+	for _, path := range [][]Vec2D{astar, jps} {
+		if path == nil {
+			t.Fatal("should have found a path through the gap")
+		}
+		if path[0] != from || path[len(path)-1] != to {
+			t.Fatalf("path should run from %v to %v, got %v", from, to, path)
+		}
+		checkPathClear(t, g, path)
+		over := false
+		for _, p := range path {
+			over = over || p.Y > 9
+		}
+		if !over {
+			t.Fatalf("path should pass through the gap at the top: %v", path)
+		}
+	}
+	if math.Abs(pathLength(astar)-pathLength(jps)) > 1e-9 {
+		t.Fatalf("A* and JPS paths should be the same length, got %f and %f",
+			pathLength(astar), pathLength(jps))
+	}
+	if len(jps) >= len(astar) {
+		t.Fatalf("JPS should give only jump points: %v vs %v", jps, astar)
+	}
+}
+
+func TestNavGridNoPath(t *testing.T) {
+	g := testingWalledNavGrid()
+	g.SetBlocked(5, 9, true)
+	if path := g.FindPath(Vec2D{0.5, 0.5}, Vec2D{9.5, 0.5}, PATHFIND_AUTO); path != nil {
+		t.Fatalf("should have found no path across a closed wall, got %v", path)
+	}
+}
+
+func TestNavGridTerrainCost(t *testing.T) {
+	// a strip of mud along y=5, with a way around at x=9
+	g := NewNavGrid(10, 10, Vec2D{1, 1}, Vec2D{0, 0})
+	for x := 0; x < 9; x++ {
+		g.SetCost(x, 5, 20)
+	}
+	if g.uniformCost() {
+		t.Fatal("grid with mud shouldn't have uniform cost")
+	}
+	path := g.FindPath(Vec2D{0.5, 0.5}, Vec2D{0.5, 9.5}, PATHFIND_AUTO)
+	for _, p := range path {
+		x, y, _ := g.CellOf(p)
+		if g.Cost(x, y) > 1 {
+			t.Fatalf("path should go around the mud, but passed %v: %v", p, path)
+		}
+	}
+	smoothed := g.SmoothPath(path, 0)
+	for i := 1; i < len(smoothed); i++ {
+		a, b := smoothed[i-1], smoothed[i]
+		for f := 0.0; f <= 1; f += 0.05 {
+			x, y, _ := g.CellOf(a.Add(b.Sub(a).Scale(f)))
+			if g.Cost(x, y) > 1 {
+				t.Fatalf("smoothing shouldn't cut through the mud: %v", smoothed)
+			}
+		}
+	}
+}
+
+func TestNavGridSmoothPath(t *testing.T) {
+	g := NewNavGrid(10, 10, Vec2D{1, 1}, Vec2D{0, 0})
+	path := g.FindPath(Vec2D{0.5, 0.5}, Vec2D{9.5, 3.5}, PATHFIND_ASTAR)
+	smoothed := g.SmoothPath(path, 0.4)
+	if len(smoothed) != 2 {
+		t.Fatalf("path on an open grid should smooth to a straight line, got %v", smoothed)
+	}
+	g = testingWalledNavGrid()
+	smoothed = g.SmoothPath(g.FindPath(Vec2D{0.5, 0.5}, Vec2D{9.5, 0.5}, PATHFIND_ASTAR), 0.4)
+	if len(smoothed) < 3 {
+		t.Fatalf("path around a wall should keep its corners, got %v", smoothed)
+	}
+	for i := 1; i < len(smoothed); i++ {
+		if !g.LineOfSight(smoothed[i-1], smoothed[i], 0.4) {
+			t.Fatalf("smoothed segment %v -> %v isn't clear", smoothed[i-1], smoothed[i])
+		}
+	}
+}
+
+func TestNavGridFromWorld(t *testing.T) {
+	w := NewWorld(map[string]any{
+		"width":  100,
+		"height": 100,
+	})
+	m := NewTileMap(10, 10, 10, 10)
+	walls := m.AddLayer("walls")
+	walls.SetSolid(true)
+	walls.SetTile(2, 3, 1)
+	m.AddLayer("ground").SetTile(4, 4, 2)
+	m.SetTileProperties(2, TileProperties{Cost: 3})
+	w.SetTileMap(m)
+	rock := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION: Vec2D{75, 75},
+			BOX:      Vec2D{10, 10},
+		},
+		"tags": []string{"static"},
+	})
+	_ = rock
+	g := NewNavGridFromWorld(w, 5, nil)
+	if g.Width != 20 || g.Height != 20 {
+		t.Fatalf("grid should cover the world, was %dx%d", g.Width, g.Height)
+	}
+	if g.Passable(4, 6) || g.Passable(5, 7) {
+		t.Fatal("cells under the solid tile should be blocked")
+	}
+	if g.Passable(14, 14) || g.Passable(15, 15) || !g.Passable(13, 13) || !g.Passable(16, 16) {
+		t.Fatal("exactly the cells under the static entity should be blocked")
+	}
+	if g.Cost(8, 8) != 3 || g.Cost(0, 0) != 1 {
+		t.Fatal("cell costs should come from the tilemap")
+	}
+}
+
+func TestNavMeshFindPath(t *testing.T) {
+	// an L of three squares, turning the corner at (10, 10)
+	m := NewNavMesh([][]Vec2D{
+		{{0, 0}, {10, 0}, {10, 10}, {0, 10}},
+		{{10, 0}, {20, 0}, {20, 10}, {10, 10}},
+		// (clockwise; should be rewound)
+		{{10, 10}, {10, 20}, {20, 20}, {20, 10}},
+	})
+	if len(m.Polygons[1].Neighbours) != 2 || len(m.Polygons[0].Neighbours) != 1 {
+		t.Fatal("polygons sharing edges should be linked")
+	}
+	if m.PolygonOf(Vec2D{5, 15}) != nil {
+		t.Fatal("point outside the mesh shouldn't be in a polygon")
+	}
+	path := m.FindPath(Vec2D{1, 5}, Vec2D{15, 19})
+	if len(path) != 3 || !navPointsEqual(path[1], Vec2D{10, 10}) {
+		t.Fatalf("path should turn at the inner corner (10, 10), got %v", path)
+	}
+	// straight through, no corners
+	path = m.FindPath(Vec2D{1, 5}, Vec2D{19, 5})
+	if len(path) != 2 {
+		t.Fatalf("straight path should have no corners, got %v", path)
+	}
+	if m.FindPath(Vec2D{1, 5}, Vec2D{5, 15}) != nil {
+		t.Fatal("shouldn't find a path to a point off the mesh")
+	}
+}
+
+func TestPathfindingSystem(t *testing.T) {
+	w := testingWorld()
+	ps := NewPathfindingSystem()
+	// search only a few nodes at a time, so the search is spread across
+	// updates
+	ps.ExpansionsPerStep = 1
+	ps.BudgetMs = 0
+	ps.Algorithm = PATHFIND_ASTAR
+	w.RegisterSystems(ps, NewSteeringSystem(), NewPhysicsSystem())
+	m := NewTileMap(10, 10, 10, 10)
+	walls := m.AddLayer("walls")
+	walls.SetSolid(true)
+	for y := 0; y < 9; y++ {
+		walls.SetTile(5, y, 1)
+	}
+	w.SetTileMap(m)
+	e := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION:     Vec2D{25, 15},
+			VELOCITY:     Vec2D{0, 0},
+			ACCELERATION: Vec2D{0, 0},
+			MAXVELOCITY:  0.5,
+			STEER:        Vec2D{0, 0},
+			MASS:         1.0,
+			BOX:          Vec2D{2, 2},
+			PATH:         (*FollowPath)(nil),
+		}})
+	found := ps.Events.Subscribe(SimpleEventFilter("path-found"))
+	target := Vec2D{75, 15}
+	r := ps.RequestPath(e, target)
+	ps.Update(FRAME_MS / 2)
+	if r.Done() || r.search.expanded() != 1 {
+		t.Fatal("with no budget, each update should expand one node")
+	}
+	for i := 0; i < 1000 && !r.Done(); i++ {
+		w.Update(FRAME_MS / 2)
+	}
+	if r.Status != PATH_FOUND {
+		t.Fatalf("should have found a path, status %d", r.Status)
+	}
+	select {
+	case ev := <-found.C:
+		if ev.Data.(*PathRequest) != r {
+			t.Fatal("path-found event should carry the request")
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("path-found should have been published")
+	}
+	path := pathOf(e)
+	if path == nil || len(path.Path) < 3 {
+		t.Fatalf("PATH should have been set to a path around the wall, got %v", path)
+	}
+	for i := 0; i < 2000 && !path.Done(); i++ {
+		w.Update(FRAME_MS / 2)
+		time.Sleep(100 * time.Microsecond)
+	}
+	pos := *e.GetVec2D(POSITION)
+	if _, _, d := pos.Distance(target); d > 10 {
+		t.Fatalf("entity should have followed the path to %v, at %v", target, pos)
+	}
+}
+
+func TestPathfindingSystemCancel(t *testing.T) {
+	w := testingWorld()
+	ps := NewPathfindingSystem()
+	w.RegisterSystems(ps)
+	e := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION: Vec2D{5, 5},
+			BOX:      Vec2D{1, 1},
+		}})
+	r := ps.RequestPath(e, Vec2D{500, 500})
+	r2 := ps.RequestPath(e, Vec2D{600, 600})
+	if r.Status != PATH_CANCELLED || ps.Pending(e) != r2 {
+		t.Fatal("a new request should replace the pending one")
+	}
+	ps.Cancel(e)
+	if r2.Status != PATH_CANCELLED || ps.Pending(e) != nil {
+		t.Fatal("should have cancelled the request")
+	}
+}
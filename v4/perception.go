@@ -0,0 +1,220 @@
+package sameriver
+
+import (
+	"math"
+	"sort"
+)
+
+// BB_PERCEIVED is the key, in a perceiving entity's blackboard, of what it
+// remembers perceiving (most confident first); it's set whenever an entity
+// is perceived anew or forgotten, so watch it (eg. with
+// GOAPExecutor.ReplanOn() or BTAbortOnChange()) to react to what comes and
+// goes. The entries are updated in place as perception goes on.
+var BB_PERCEIVED = NewBBKey[[]*PerceivedEntity]("perceived")
+
+// PerceptionSense is how an entity was perceived
+type PerceptionSense int
+
+const (
+	PERCEIVED_SIGHT PerceptionSense = iota
+	PERCEIVED_HEARING
+)
+
+// VisionSensor sees entities within Range, in a cone Angle wide (radians;
+// 2π sees all round) about the perceiver's facing, whose centre isn't
+// occluded from the perceiver's: by solid tiles of the world's TileMap, or
+// by entities which Occludes says block sight
+type VisionSensor struct {
+	Range float64
+	Angle float64
+	// (nil: no entity blocks sight)
+	Occludes func(*Entity) bool
+}
+
+// HearingSensor hears sounds (see World.EmitSound()) within Radius times
+// their loudness. What's only heard is perceived with Confidence, and
+// remembered at where the sound was made.
+type HearingSensor struct {
+	Radius     float64
+	Confidence float64
+}
+
+// PerceivedEntity is the memory of an entity perceived
+type PerceivedEntity struct {
+	Entity *Entity
+	// where it was when last perceived
+	LastPosition Vec2D
+	// how sure we are of it, from 1 on sight, decaying once out of sight
+	Confidence float64
+	// how it was last perceived, and ms since
+	Sense   PerceptionSense
+	SinceMs float64
+	// whether it's in sight now
+	Visible bool
+
+	// perceived this update (so not yet aged)
+	fresh bool
+}
+
+// Perceiver is what an entity perceives with, and its memory of what it's
+// perceived, put in its PERCEPTION component to be updated by the
+// PerceptionSystem
+type Perceiver struct {
+	Vision  *VisionSensor
+	Hearing *HearingSensor
+	// which entities are worth perceiving (nil: all)
+	Filter func(*Entity) bool
+	// the direction the vision cone points, following VELOCITY while the
+	// entity moves (set it for those which don't)
+	Facing Vec2D
+	// confidence lost per second once an entity is out of sight, and the
+	// confidence below which it's forgotten
+	DecayPerSec float64
+	ForgetBelow float64
+
+	memory map[*Entity]*PerceivedEntity
+}
+
+func NewPerceiver(vision *VisionSensor, hearing *HearingSensor) *Perceiver {
+	if hearing != nil && hearing.Confidence == 0 {
+		hearing.Confidence = 0.5
+	}
+	return &Perceiver{
+		Vision:      vision,
+		Hearing:     hearing,
+		Facing:      Vec2D{1, 0},
+		DecayPerSec: 0.1,
+		ForgetBelow: 0.05,
+		memory:      make(map[*Entity]*PerceivedEntity),
+	}
+}
+
+// Memory gives what's remembered of e, if anything
+func (p *Perceiver) Memory(e *Entity) (*PerceivedEntity, bool) {
+	m, ok := p.memory[e]
+	return m, ok
+}
+
+// Remembered gives the memories of entities passing filter (all, if nil),
+// most confident first
+func (p *Perceiver) Remembered(filter func(*Entity) bool) []*PerceivedEntity {
+	result := make([]*PerceivedEntity, 0, len(p.memory))
+	for e, m := range p.memory {
+		if filter == nil || filter(e) {
+			result = append(result, m)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Confidence != result[j].Confidence {
+			return result[i].Confidence > result[j].Confidence
+		}
+		return result[i].Entity.ID < result[j].Entity.ID
+	})
+	return result
+}
+
+// Visible gives the entities in sight now
+func (p *Perceiver) Visible() []*Entity {
+	visible := make([]*Entity, 0)
+	for _, m := range p.Remembered(nil) {
+		if m.Visible {
+			visible = append(visible, m.Entity)
+		}
+	}
+	return visible
+}
+
+// Sees is whether target would be seen by e (with this perceiver) now
+func (p *Perceiver) Sees(e, target *Entity) bool {
+	if p.Vision == nil || target == e || target.Despawned {
+		return false
+	}
+	pos := *e.GetVec2D(POSITION)
+	targetPos := *target.GetVec2D(POSITION)
+	if RectDistance(pos, *e.GetVec2D(BOX), targetPos, *target.GetVec2D(BOX)) > p.Vision.Range {
+		return false
+	}
+	toTarget := targetPos.Sub(pos)
+	if p.Vision.Angle < 2*math.Pi && toTarget.Magnitude() > 0 &&
+		p.Facing.AngleBetween(toTarget) > p.Vision.Angle/2 {
+		return false
+	}
+	return !p.occluded(e, target, pos, targetPos)
+}
+
+// whether the line of sight from e at pos to target at targetPos is blocked
+func (p *Perceiver) occluded(e, target *Entity, pos, targetPos Vec2D) bool {
+	w := e.World
+	if w.TileMap != nil {
+		toTarget := targetPos.Sub(pos)
+		if hit, _, _, _, _ := w.TileMap.RaycastSolid(pos, toTarget, toTarget.Magnitude()); hit {
+			return true
+		}
+	}
+	if p.Vision.Occludes == nil {
+		return false
+	}
+	return len(w.SegmentCast(pos, targetPos, func(o *Entity) bool {
+		return o != e && o != target && p.Vision.Occludes(o)
+	})) > 0
+}
+
+// perceive remembers target as perceived now at pos, giving whether it's
+// newly remembered
+func (p *Perceiver) perceive(target *Entity, pos Vec2D, sense PerceptionSense, confidence float64) bool {
+	m, ok := p.memory[target]
+	if !ok {
+		m = &PerceivedEntity{Entity: target}
+		p.memory[target] = m
+	}
+	// (hearing what's in sight, or was better perceived, adds nothing)
+	if sense == PERCEIVED_HEARING && ok && (m.Visible || m.Confidence > confidence) {
+		return false
+	}
+	m.LastPosition = pos
+	m.Confidence = confidence
+	m.Sense = sense
+	m.SinceMs = 0
+	m.Visible = sense == PERCEIVED_SIGHT
+	m.fresh = true
+	return !ok
+}
+
+// decay ages the memories of what isn't in sight, forgetting those
+// despawned or no longer confident enough, and giving what was forgotten
+func (p *Perceiver) decay(dt_ms float64) (forgotten []*PerceivedEntity) {
+	for e, m := range p.memory {
+		if !m.Visible && !m.fresh {
+			m.SinceMs += dt_ms
+			m.Confidence -= p.DecayPerSec * dt_ms / 1000
+		}
+		m.fresh = false
+		if e.Despawned || m.Confidence < p.ForgetBelow {
+			delete(p.memory, e)
+			forgotten = append(forgotten, m)
+		}
+	}
+	return forgotten
+}
+
+// Sound is the data of a "sound" event on the world's Events
+type Sound struct {
+	// what made the sound (remembered by those who hear it)
+	Source   *Entity
+	Position Vec2D
+	// scales how far the sound carries (1: to the full hearing radius)
+	Loudness float64
+	// eg. "footsteps", "scream"
+	Kind string
+}
+
+// EmitSound publishes a sound made by source at its position, to be heard
+// by the perceivers in range
+func (w *World) EmitSound(source *Entity, loudness float64, kind string) {
+	w.Events.Publish("sound", &Sound{
+		Source:   source,
+		Position: *source.GetVec2D(POSITION),
+		Loudness: loudness,
+		Kind:     kind,
+	})
+}
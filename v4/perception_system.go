@@ -0,0 +1,120 @@
+package sameriver
+
+// PerceptionEvent is the data of the "entity-perceived" and
+// "entity-forgotten" events
+type PerceptionEvent struct {
+	// who perceived (or forgot)
+	Entity    *Entity
+	Perceived *PerceivedEntity
+}
+
+// PerceptionSystem updates the Perceiver in the PERCEPTION component of each
+// entity: what its vision sees is remembered with full confidence, what it
+// hears (sounds published on the world's Events, see World.EmitSound())
+// with its hearing's, and what's out of sight is remembered with decaying
+// confidence until forgotten. When an entity is perceived anew or
+// forgotten, the perceiver's memories are set as BB_PERCEIVED in its
+// entity's blackboard, and "entity-perceived" or "entity-forgotten" is
+// published on Events, with a *PerceptionEvent as data.
+type PerceptionSystem struct {
+	w                  *World
+	perceptionEntities *UpdatedEntityList
+	sounds             *EventChannel
+	Events             *EventBus
+}
+
+func NewPerceptionSystem() *PerceptionSystem {
+	return &PerceptionSystem{
+		Events: NewEventBus("perception"),
+	}
+}
+
+func (s *PerceptionSystem) GetComponentDeps() []any {
+	return []any{
+		PERCEPTION, GENERIC, "PERCEPTION",
+	}
+}
+
+func (s *PerceptionSystem) LinkWorld(w *World) {
+	s.w = w
+	s.perceptionEntities = w.GetUpdatedEntityList(
+		EntityFilterFromComponentBitArray(
+			"perception",
+			w.em.components.BitArrayFromIDs([]ComponentID{PERCEPTION})))
+	s.sounds = w.Events.Subscribe(SimpleEventFilter("sound"))
+}
+
+func (s *PerceptionSystem) Update(dt_ms float64) {
+	sounds := make([]*Sound, 0, len(s.sounds.C))
+	for len(s.sounds.C) > 0 {
+		sounds = append(sounds, (<-s.sounds.C).Data.(*Sound))
+	}
+	for _, e := range s.perceptionEntities.entities {
+		p := perceiverOf(e)
+		if p == nil {
+			continue
+		}
+		s.perceive(e, p, sounds, dt_ms)
+	}
+}
+
+func (s *PerceptionSystem) perceive(e *Entity, p *Perceiver, sounds []*Sound, dt_ms float64) {
+	if e.HasComponent(VELOCITY) {
+		if v := *e.GetVec2D(VELOCITY); v.Magnitude() > 0 {
+			p.Facing = v.Unit()
+		}
+	}
+	perceivable := func(o *Entity) bool {
+		return o != e && (p.Filter == nil || p.Filter(o))
+	}
+	changed := false
+	perceived := func(o *Entity, pos Vec2D, sense PerceptionSense, confidence float64) {
+		if p.perceive(o, pos, sense, confidence) {
+			changed = true
+			s.Events.Publish("entity-perceived", &PerceptionEvent{Entity: e, Perceived: p.memory[o]})
+		}
+	}
+	// (what was in sight must be seen again to stay so)
+	for _, m := range p.memory {
+		m.Visible = false
+	}
+	if p.Vision != nil {
+		pos := *e.GetVec2D(POSITION)
+		box := *e.GetVec2D(BOX)
+		for _, o := range s.w.EntitiesWithinDistanceFilter(pos, box, p.Vision.Range, perceivable) {
+			if p.Sees(e, o) {
+				perceived(o, *o.GetVec2D(POSITION), PERCEIVED_SIGHT, 1)
+			}
+		}
+	}
+	if p.Hearing != nil {
+		pos := *e.GetVec2D(POSITION)
+		for _, sound := range sounds {
+			if sound.Source == nil || !perceivable(sound.Source) {
+				continue
+			}
+			if _, _, d := pos.Distance(sound.Position); d <= p.Hearing.Radius*sound.Loudness {
+				perceived(sound.Source, sound.Position, PERCEIVED_HEARING, p.Hearing.Confidence)
+			}
+		}
+	}
+	for _, m := range p.decay(dt_ms) {
+		changed = true
+		s.Events.Publish("entity-forgotten", &PerceptionEvent{Entity: e, Perceived: m})
+	}
+	if changed {
+		BB_PERCEIVED.Set(e.Blackboard(), p.Remembered(nil))
+	}
+}
+
+func perceiverOf(e *Entity) *Perceiver {
+	if !e.HasComponent(PERCEPTION) {
+		return nil
+	}
+	p, _ := e.GetGeneric(PERCEPTION).(*Perceiver)
+	return p
+}
+
+func (s *PerceptionSystem) Expand(n int) {
+	// nil?
+}
@@ -0,0 +1,149 @@
+package sameriver
+
+import (
+	"math"
+	"testing"
+)
+
+func testingPerceptionWorld() (*World, *PerceptionSystem) {
+	w := testingWorld()
+	s := NewPerceptionSystem()
+	w.RegisterSystems(s)
+	return w, s
+}
+
+func testingPerceiver(w *World, pos Vec2D, p *Perceiver) *Entity {
+	e := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION:   pos,
+			BOX:        Vec2D{2, 2},
+			PERCEPTION: nil,
+		},
+	})
+	e.SetGeneric(PERCEPTION, p)
+	return e
+}
+
+func testingPerceived(w *World, pos Vec2D, tags ...string) *Entity {
+	return w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION: pos,
+			BOX:      Vec2D{2, 2},
+		},
+		"tags": tags,
+	})
+}
+
+func TestPerceptionVision(t *testing.T) {
+	w, s := testingPerceptionWorld()
+	p := NewPerceiver(&VisionSensor{
+		Range: 50,
+		Angle: math.Pi / 2,
+		Occludes: func(o *Entity) bool {
+			return o.HasTag("wall")
+		},
+	}, nil)
+	e := testingPerceiver(w, Vec2D{100, 100}, p)
+	ahead := testingPerceived(w, Vec2D{130, 105})
+	behind := testingPerceived(w, Vec2D{70, 100})
+	far := testingPerceived(w, Vec2D{200, 100})
+	hidden := testingPerceived(w, Vec2D{100, 140})
+	// (facing up, the wall is between e and hidden)
+	testingPerceived(w, Vec2D{100, 120}, "wall")
+	ch := s.Events.Subscribe(SimpleEventFilter("entity-perceived"))
+
+	w.UpdateSpatialIndex()
+	s.Update(FRAME_MS)
+	if !p.Sees(e, ahead) || p.Sees(e, behind) || p.Sees(e, far) {
+		t.Fatal("should see only what's in range in front")
+	}
+	if visible := p.Visible(); len(visible) != 1 || visible[0] != ahead {
+		t.Fatalf("should have seen only ahead, got %v", visible)
+	}
+	m, ok := p.Memory(ahead)
+	if !ok || m.Confidence != 1 || m.Sense != PERCEIVED_SIGHT || m.LastPosition != (Vec2D{130, 105}) {
+		t.Fatalf("unexpected memory of ahead %+v", m)
+	}
+	if len(ch.C) != 1 || (<-ch.C).Data.(*PerceptionEvent).Perceived.Entity != ahead {
+		t.Fatal("should have published ahead being perceived")
+	}
+	if perceived, _ := BB_PERCEIVED.Get(e.Blackboard()); len(perceived) != 1 || perceived[0].Entity != ahead {
+		t.Fatal("should have set what's perceived in the blackboard")
+	}
+
+	// turned to face the wall, what's behind it stays hidden
+	p.Facing = Vec2D{0, 1}
+	if p.Sees(e, hidden) {
+		t.Fatal("shouldn't see through the wall")
+	}
+	p.Vision.Occludes = nil
+	if !p.Sees(e, hidden) {
+		t.Fatal("should see past what doesn't occlude")
+	}
+}
+
+func TestPerceptionMemoryDecays(t *testing.T) {
+	w, s := testingPerceptionWorld()
+	p := NewPerceiver(&VisionSensor{Range: 50, Angle: 2 * math.Pi}, nil)
+	p.DecayPerSec = 0.5
+	p.ForgetBelow = 0.1
+	e := testingPerceiver(w, Vec2D{100, 100}, p)
+	other := testingPerceived(w, Vec2D{120, 100})
+	ch := s.Events.Subscribe(SimpleEventFilter("entity-forgotten"))
+
+	w.UpdateSpatialIndex()
+	s.Update(FRAME_MS)
+	// it walks away out of sight
+	*other.GetVec2D(POSITION) = Vec2D{300, 100}
+	w.UpdateSpatialIndex()
+	s.Update(1000)
+	m, ok := p.Memory(other)
+	if !ok || m.Visible || m.LastPosition != (Vec2D{120, 100}) || m.SinceMs != 1000 {
+		t.Fatalf("should remember where it was last seen, got %+v", m)
+	}
+	if math.Abs(m.Confidence-0.5) > 1e-9 {
+		t.Fatalf("confidence should have decayed to 0.5, got %g", m.Confidence)
+	}
+	s.Update(1000)
+	if _, ok := p.Memory(other); ok {
+		t.Fatal("should have forgotten it")
+	}
+	if len(ch.C) != 1 || (<-ch.C).Data.(*PerceptionEvent).Entity != e {
+		t.Fatal("should have published it being forgotten")
+	}
+	if perceived, ok := BB_PERCEIVED.Get(e.Blackboard()); !ok || len(perceived) != 0 {
+		t.Fatal("should have cleared what's perceived in the blackboard")
+	}
+}
+
+func TestPerceptionHearing(t *testing.T) {
+	w, s := testingPerceptionWorld()
+	p := NewPerceiver(nil, &HearingSensor{Radius: 100})
+	testingPerceiver(w, Vec2D{100, 100}, p)
+	near := testingPerceived(w, Vec2D{160, 100})
+	far := testingPerceived(w, Vec2D{300, 100})
+
+	w.EmitSound(near, 1, "footsteps")
+	// (too quiet to carry this far)
+	w.EmitSound(far, 1.5, "footsteps")
+	s.Update(FRAME_MS)
+	m, ok := p.Memory(near)
+	if !ok || m.Sense != PERCEIVED_HEARING || m.Confidence != 0.5 || m.Visible {
+		t.Fatalf("should have heard near, got %+v", m)
+	}
+	if _, ok := p.Memory(far); ok {
+		t.Fatal("shouldn't have heard far")
+	}
+
+	// where a sound was made is remembered
+	*near.GetVec2D(POSITION) = Vec2D{150, 150}
+	w.EmitSound(near, 1, "scream")
+	w.EmitSound(far, 3, "scream")
+	s.Update(FRAME_MS)
+	if m, _ := p.Memory(near); m.LastPosition != (Vec2D{150, 150}) || m.SinceMs != 0 {
+		t.Fatalf("should remember where near was heard, got %+v", m)
+	}
+	if remembered := p.Remembered(nil); len(remembered) != 2 {
+		t.Fatalf("should have heard both, got %d", len(remembered))
+	}
+}
@@ -10,7 +10,10 @@ type PhysicsSystem struct {
 	granularity     int
 	w               *World
 	physicsEntities *UpdatedEntityList
-	h               *SpatialHasher
+	// entities which left the world with BORDER_DESPAWN, despawned after
+	// the parallel update
+	outOfBounds      []*Entity
+	outOfBoundsMutex sync.Mutex
 }
 
 func NewPhysicsSystem() *PhysicsSystem {
@@ -41,25 +44,33 @@ func (p *PhysicsSystem) LinkWorld(w *World) {
 		EntityFilterFromComponentBitArray(
 			"physical",
 			w.em.components.BitArrayFromIDs([]ComponentID{POSITION, VELOCITY, ACCELERATION, BOX, MASS})))
-	p.h = NewSpatialHasher(10, 10, w)
 }
 
 func (p *PhysicsSystem) Update(dt_ms float64) {
-	p.h.Update()
+	// collisions are checked against the world's spatial index, which
+	// reflects positions as of the start of this Update(); once we're done
+	// moving things, mark it stale so the next reader refreshes it
+	p.w.RefreshSpatialIndex()
+	defer p.w.MarkSpatialIndexStale()
 	sum_dt := 0.0
 	for i := 0; i < p.granularity; i++ {
 		p.ParallelUpdate(dt_ms / float64(p.granularity))
 		sum_dt += dt_ms / float64(p.granularity)
 	}
+	for _, e := range p.outOfBounds {
+		p.w.Despawn(e)
+	}
+	p.outOfBounds = p.outOfBounds[:0]
 }
 
 func (p *PhysicsSystem) physics(e *Entity, dt_ms float64) {
 
 	// the logic is simpler to read that way
+	// NOTE: we work on a bottom-left copy and write the center back once,
+	// since other workers may be reading this entity's position
 	pos := e.GetVec2D(POSITION)
 	box := e.GetVec2D(BOX)
-	pos.ShiftCenterToBottomLeft(*box)
-	defer pos.ShiftBottomLeftToCenter(*box)
+	bl := pos.ShiftedCenterToBottomLeft(*box)
 
 	// calculate velocity
 	acc := e.GetVec2D(ACCELERATION)
@@ -69,51 +80,43 @@ func (p *PhysicsSystem) physics(e *Entity, dt_ms float64) {
 	dx := vel.X * dt_ms
 	dy := vel.Y * dt_ms
 
-	// motion in x
-	// max out on world border in x
-	if pos.X+dx < 0 || pos.X+box.X+dx > float64(p.w.Width) {
-		dx = 0
-	} else {
-		// otherwise move in x freely
-		pos.X += dx
-	}
-
-	// motion in y
-	// max out on world border in y
-	if pos.Y+dy < 0 || pos.Y+box.Y+dy > float64(p.w.Height) {
-		dy = 0
-	} else {
-		// otherwise move in y freely
-		pos.Y += dy
+	if p.w.Border == BORDER_CLAMP {
+		// motion in x
+		// max out on world border in x
+		if bl.X+dx < 0 || bl.X+box.X+dx > float64(p.w.Width) {
+			dx = 0
+		}
+		// motion in y
+		// max out on world border in y
+		if bl.Y+dy < 0 || bl.Y+box.Y+dy > float64(p.w.Height) {
+			dy = 0
+		}
 	}
+	// otherwise move freely
+	bl.X += dx
+	bl.Y += dy
 
-	// check collisions using spatial hasher
+	// check collisions with solid tiles, and with entities using the
+	// world's spatial index
 	// TODO: really we should check / resolve all collisions after applying dx,dy
-	testCollision := func(i *Entity, j *Entity) bool {
-		iPos := i.GetVec2D(POSITION)
-		iBox := i.GetVec2D(BOX)
-		jPos := j.GetVec2D(POSITION)
-		jBox := j.GetVec2D(BOX)
-		return RectIntersectsRect(*iPos, *iBox, *jPos, *jBox)
+	moved := bl.ShiftedBottomLeftToCenter(*box)
+	collided := (p.w.TileMap != nil && p.w.TileMap.BoxCollides(moved, *box)) ||
+		len(p.w.SpatialIndex.EntitiesOverlappingBoxFilter(moved, *box,
+			func(other *Entity) bool { return other != e })) > 0
+	// undo the action if a collision occurs
+	if !collided {
+		*pos = moved
 	}
-	cellX0, cellX1, cellY0, cellY1 := p.h.CellRangeOfRect(*pos, *box)
-	collided := false
-	for y := cellY0; y <= cellY1 && !collided; y++ {
-		for x := cellX0; x <= cellX1 && !collided; x++ {
-			if x < 0 || x >= p.h.GridX || y < 0 || y >= p.h.GridY {
-				continue
-			}
-			entities := p.h.Entities(x, y)
-			for i := 0; i < len(entities) && !collided; i++ {
-				other := entities[i]
-				if other != e && testCollision(e, other) {
-					// undo the action if a collision occurs
-					pos.X -= dx
-					pos.Y -= dy
-					collided = true
-					break
-				}
-			}
+
+	switch p.w.Border {
+	case BORDER_WRAP:
+		// NOTE: collisions aren't checked across the seam
+		*pos = p.w.WrapPosition(*pos)
+	case BORDER_DESPAWN:
+		if p.w.OutOfBounds(*pos, *box) && !e.Despawned {
+			p.outOfBoundsMutex.Lock()
+			p.outOfBounds = append(p.outOfBounds, e)
+			p.outOfBoundsMutex.Unlock()
 		}
 	}
 }
@@ -145,3 +145,54 @@ func TestPhysicsSystemBounds(t *testing.T) {
 		}
 	}
 }
+
+func testingPhysicsBorderWorld(border string) (*World, *Entity) {
+	w := NewWorld(map[string]any{
+		"width":  100,
+		"height": 100,
+		"border": border,
+	})
+	w.RegisterSystems(NewPhysicsSystem())
+	e := testingSpawnPhysics(w)
+	*e.GetVec2D(POSITION) = Vec2D{95, 50}
+	*e.GetVec2D(VELOCITY) = Vec2D{1, 0}
+	return w, e
+}
+
+func TestPhysicsSystemBorderWrap(t *testing.T) {
+	w, e := testingPhysicsBorderWorld("wrap")
+	pos := e.GetVec2D(POSITION)
+	for i := 0; i < 16 && pos.X > 50; i++ {
+		w.Update(FRAME_MS / 2)
+		time.Sleep(FRAME_DURATION)
+	}
+	if pos.X > 50 || pos.X < 0 {
+		t.Fatalf("entity should have wrapped around to the left edge, at %v", *pos)
+	}
+}
+
+func TestPhysicsSystemBorderDespawn(t *testing.T) {
+	w, e := testingPhysicsBorderWorld("despawn")
+	for i := 0; i < 16 && !e.Despawned; i++ {
+		w.Update(FRAME_MS / 2)
+		time.Sleep(FRAME_DURATION)
+	}
+	if !e.Despawned {
+		t.Fatalf("entity should have despawned after leaving the world, at %v",
+			*e.GetVec2D(POSITION))
+	}
+}
+
+func TestPhysicsSystemBorderNone(t *testing.T) {
+	w, e := testingPhysicsBorderWorld("none")
+	*e.GetVec2D(VELOCITY) = Vec2D{-1, -1}
+	*e.GetVec2D(POSITION) = Vec2D{5, 5}
+	pos := e.GetVec2D(POSITION)
+	for i := 0; i < 16 && pos.Y > -5; i++ {
+		w.Update(FRAME_MS / 2)
+		time.Sleep(FRAME_DURATION)
+	}
+	if pos.X > -5 || pos.Y > -5 || e.Despawned {
+		t.Fatalf("entity should move freely into negative coordinates, at %v", *pos)
+	}
+}
@@ -481,16 +481,14 @@ func (r *RuntimeLimiter) removeLogicImmediately(l *LogicUnit) {
 
 	// delete from logicUnits by replacing the last element into its spot,
 	// updating the indexes entry for that element
-	removeFromLogicSlice := func(ls []*LogicUnit, i int) {
-		lastIndex := len(ls) - 1
-		if len(r.logicUnits) > 1 {
-			r.logicUnits[i] = r.logicUnits[lastIndex]
-		}
-		r.logicUnits = r.logicUnits[:lastIndex]
-	}
-	// remove from logicUnits
-	removeFromLogicSlice(r.logicUnits, index)
-	if len(r.logicUnits) != 0 {
+	lastIndex := len(r.logicUnits) - 1
+	r.logicUnits[index] = r.logicUnits[lastIndex]
+	r.logicUnits = r.logicUnits[:lastIndex]
+	// (ascendingHotness must stay sorted, so is shifted down instead)
+	removeFromHotness := func(i int) {
+		r.ascendingHotness = append(r.ascendingHotness[:i], r.ascendingHotness[i+1:]...)
+	}
+	if index < len(r.logicUnits) {
 		// update indexes for last-now-here element
 		nowAtIndex := r.logicUnits[index]
 		r.indexes[nowAtIndex] = index
@@ -506,7 +504,7 @@ func (r *RuntimeLimiter) removeLogicImmediately(l *LogicUnit) {
 		// we don't need to iterate from lowest index with common hotness
 		// to find it now
 		if r.ascendingHotness[mid] == l {
-			removeFromLogicSlice(r.ascendingHotness, mid)
+			removeFromHotness(mid)
 			lucky = true
 			break
 		}
@@ -522,7 +520,7 @@ func (r *RuntimeLimiter) removeLogicImmediately(l *LogicUnit) {
 	if !lucky {
 		for i := lowestIx; i < len(r.ascendingHotness); i++ {
 			if r.ascendingHotness[i] == l {
-				removeFromLogicSlice(r.ascendingHotness, i)
+				removeFromHotness(i)
 				break
 			}
 		}
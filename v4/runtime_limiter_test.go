@@ -269,6 +269,48 @@ func TestRuntimeLimiterRemove(t *testing.T) {
 	}
 }
 
+func TestRuntimeLimiterRemoveOneOfMany(t *testing.T) {
+	r := NewRuntimeLimiter()
+	ran := make(map[string]int)
+	logics := make([]*LogicUnit, 0)
+	for i := 0; i < 4; i++ {
+		name := fmt.Sprintf("logic-%d", i)
+		logic := &LogicUnit{
+			name:        name,
+			worldID:     i,
+			f:           func(dt_ms float64) { ran[name]++ },
+			active:      true,
+			runSchedule: nil}
+		logics = append(logics, logic)
+		r.Add(logic)
+	}
+	r.Run(FRAME_MS, 0)
+	r.Remove(logics[1])
+	r.Run(FRAME_MS, 0)
+	// the others are kept, each where its index says
+	if len(r.logicUnits) != 3 || len(r.ascendingHotness) != 3 {
+		t.Fatalf("should have kept the other 3 logics, got %d and %d",
+			len(r.logicUnits), len(r.ascendingHotness))
+	}
+	for _, l := range []*LogicUnit{logics[0], logics[2], logics[3]} {
+		if r.logicUnits[r.indexes[l]] != l {
+			t.Fatalf("%s isn't at its index", l.name)
+		}
+	}
+	for i := 1; i < len(r.ascendingHotness); i++ {
+		if r.ascendingHotness[i-1].hotness > r.ascendingHotness[i].hotness {
+			t.Fatal("ascendingHotness should have stayed sorted")
+		}
+	}
+	ran = make(map[string]int)
+	for i := 0; i < 8; i++ {
+		r.Run(FRAME_MS, 0)
+	}
+	if ran["logic-1"] != 0 || ran["logic-0"] == 0 || ran["logic-3"] == 0 {
+		t.Fatalf("only the removed logic should have stopped running, got %v", ran)
+	}
+}
+
 func TestRuntimeLimiterInsertAppending(t *testing.T) {
 	r := NewRuntimeLimiter()
 	for i := 0; i < 32; i++ {
@@ -0,0 +1,508 @@
+package sameriver
+
+// DynamicAABBTree is a SpatialIndex storing entities as the leaves of a
+// balanced binary tree of bounding boxes (a BVH), after the dynamic tree
+// described by Erin Catto for Box2D.
+//
+// Each leaf stores a "fat" AABB, extended past the entity's box by
+// FatMargin * the larger of the box's dimensions on each side. When an
+// entity moves, it's only reinserted if its box leaves its fat AABB, so
+// entities jittering in place or moving slowly cost nothing to update.
+// (NOTE: zero-size boxes get no margin, and so are reinserted whenever they
+// move)
+//
+// Insertion picks the sibling which minimizes the growth in perimeter of
+// the tree's boxes, and the tree is kept balanced with AVL-style rotations.
+type DynamicAABBTree struct {
+	// SpatialEntities is an UpdatedEntityList of entities who have position
+	// and hitbox components
+	SpatialEntities *UpdatedEntityList
+	FatMargin       float64
+	// node storage; nodes refer to each other by index into this slice
+	nodes    []aabbTreeNode
+	root     int
+	freeList int
+	// the leaf node of each entity (by ID), or aabbTreeNull
+	leaves []int
+}
+
+const aabbTreeNull = -1
+
+type aabbTreeNode struct {
+	aabb AABB
+	// for nodes on the free list, parent is used as the next pointer
+	parent int
+	child1 int
+	child2 int
+	// leaf = 0, free = -1
+	height int
+	entity *Entity
+}
+
+func (n *aabbTreeNode) isLeaf() bool {
+	return n.child1 == aabbTreeNull
+}
+
+func NewDynamicAABBTree(w *World) *DynamicAABBTree {
+	t := &DynamicAABBTree{
+		FatMargin: 0.25,
+		nodes:     make([]aabbTreeNode, 0),
+		root:      aabbTreeNull,
+		freeList:  aabbTreeNull,
+		leaves:    make([]int, w.MaxEntities()),
+	}
+	for i := range t.leaves {
+		t.leaves[i] = aabbTreeNull
+	}
+	t.SpatialEntities = spatialEntitiesList(w)
+	// when an entity leaves the list (despawn / deactivate), take it out of
+	// the tree
+	t.SpatialEntities.AddCallback(func(signal EntitySignal) {
+		if signal.SignalType == ENTITY_REMOVE {
+			t.remove(signal.Entity)
+		}
+	})
+	return t
+}
+
+func (t *DynamicAABBTree) allocateNode() int {
+	if t.freeList == aabbTreeNull {
+		t.nodes = append(t.nodes, aabbTreeNode{})
+		t.freeList = len(t.nodes) - 1
+		t.nodes[t.freeList].parent = aabbTreeNull
+	}
+	id := t.freeList
+	t.freeList = t.nodes[id].parent
+	t.nodes[id] = aabbTreeNode{
+		parent: aabbTreeNull,
+		child1: aabbTreeNull,
+		child2: aabbTreeNull,
+		height: 0,
+	}
+	return id
+}
+
+func (t *DynamicAABBTree) freeNode(id int) {
+	t.nodes[id] = aabbTreeNode{
+		parent: t.freeList,
+		child1: aabbTreeNull,
+		child2: aabbTreeNull,
+		height: -1,
+	}
+	t.freeList = id
+}
+
+func (t *DynamicAABBTree) fatten(aabb AABB) AABB {
+	size := aabb.Size()
+	return aabb.Expanded(t.FatMargin * maxf(size.X, size.Y))
+}
+
+// Update inserts new entities and reinserts those which have moved outside
+// their fat AABB
+func (t *DynamicAABBTree) Update() {
+	for _, e := range t.SpatialEntities.entities {
+		aabb := entityAABB(e)
+		leaf := t.leaves[e.ID]
+		if leaf == aabbTreeNull {
+			leaf = t.allocateNode()
+			t.nodes[leaf].aabb = t.fatten(aabb)
+			t.nodes[leaf].entity = e
+			t.insertLeaf(leaf)
+			t.leaves[e.ID] = leaf
+			continue
+		}
+		if t.nodes[leaf].aabb.Contains(aabb) {
+			continue
+		}
+		t.removeLeaf(leaf)
+		t.nodes[leaf].aabb = t.fatten(aabb)
+		t.insertLeaf(leaf)
+	}
+}
+
+func (t *DynamicAABBTree) remove(e *Entity) {
+	leaf := t.leaves[e.ID]
+	if leaf == aabbTreeNull {
+		return
+	}
+	t.removeLeaf(leaf)
+	t.freeNode(leaf)
+	t.leaves[e.ID] = aabbTreeNull
+}
+
+func (t *DynamicAABBTree) insertLeaf(leaf int) {
+	if t.root == aabbTreeNull {
+		t.root = leaf
+		t.nodes[leaf].parent = aabbTreeNull
+		return
+	}
+	// find the best sibling for the leaf, descending into whichever child
+	// would grow the least
+	leafAABB := t.nodes[leaf].aabb
+	index := t.root
+	for !t.nodes[index].isLeaf() {
+		node := &t.nodes[index]
+		child1, child2 := node.child1, node.child2
+		perimeter := node.aabb.Perimeter()
+		combinedPerimeter := node.aabb.Union(leafAABB).Perimeter()
+		// cost of creating a new parent for this node and the new leaf
+		cost := 2 * combinedPerimeter
+		// minimum cost of pushing the leaf further down the tree
+		inheritanceCost := 2 * (combinedPerimeter - perimeter)
+		descendCost := func(child int) float64 {
+			c := &t.nodes[child]
+			if c.isLeaf() {
+				return leafAABB.Union(c.aabb).Perimeter() + inheritanceCost
+			}
+			return leafAABB.Union(c.aabb).Perimeter() - c.aabb.Perimeter() + inheritanceCost
+		}
+		cost1 := descendCost(child1)
+		cost2 := descendCost(child2)
+		if cost < cost1 && cost < cost2 {
+			break
+		}
+		if cost1 < cost2 {
+			index = child1
+		} else {
+			index = child2
+		}
+	}
+	sibling := index
+
+	// create a new parent for the sibling and the leaf
+	// (NOTE: allocateNode may reallocate t.nodes, so we don't hold pointers
+	// across it)
+	oldParent := t.nodes[sibling].parent
+	newParent := t.allocateNode()
+	t.nodes[newParent].parent = oldParent
+	t.nodes[newParent].aabb = leafAABB.Union(t.nodes[sibling].aabb)
+	t.nodes[newParent].height = t.nodes[sibling].height + 1
+	if oldParent != aabbTreeNull {
+		if t.nodes[oldParent].child1 == sibling {
+			t.nodes[oldParent].child1 = newParent
+		} else {
+			t.nodes[oldParent].child2 = newParent
+		}
+	} else {
+		t.root = newParent
+	}
+	t.nodes[newParent].child1 = sibling
+	t.nodes[newParent].child2 = leaf
+	t.nodes[sibling].parent = newParent
+	t.nodes[leaf].parent = newParent
+
+	t.refit(t.nodes[leaf].parent)
+}
+
+func (t *DynamicAABBTree) removeLeaf(leaf int) {
+	if leaf == t.root {
+		t.root = aabbTreeNull
+		return
+	}
+	parent := t.nodes[leaf].parent
+	grandParent := t.nodes[parent].parent
+	sibling := t.nodes[parent].child1
+	if sibling == leaf {
+		sibling = t.nodes[parent].child2
+	}
+	if grandParent != aabbTreeNull {
+		// connect the sibling to the grandparent, discarding the parent
+		if t.nodes[grandParent].child1 == parent {
+			t.nodes[grandParent].child1 = sibling
+		} else {
+			t.nodes[grandParent].child2 = sibling
+		}
+		t.nodes[sibling].parent = grandParent
+		t.freeNode(parent)
+		t.refit(grandParent)
+	} else {
+		t.root = sibling
+		t.nodes[sibling].parent = aabbTreeNull
+		t.freeNode(parent)
+	}
+	t.nodes[leaf].parent = aabbTreeNull
+}
+
+// refit walks from index to the root, rebalancing and recomputing heights
+// and boxes
+func (t *DynamicAABBTree) refit(index int) {
+	for index != aabbTreeNull {
+		index = t.balance(index)
+		node := &t.nodes[index]
+		c1 := &t.nodes[node.child1]
+		c2 := &t.nodes[node.child2]
+		node.height = 1 + maxi(c1.height, c2.height)
+		node.aabb = c1.aabb.Union(c2.aabb)
+		index = node.parent
+	}
+}
+
+// balance performs a left or right rotation if node iA is imbalanced,
+// returning the index of the node now at iA's position
+func (t *DynamicAABBTree) balance(iA int) int {
+	A := &t.nodes[iA]
+	if A.isLeaf() || A.height < 2 {
+		return iA
+	}
+	iB, iC := A.child1, A.child2
+	B, C := &t.nodes[iB], &t.nodes[iC]
+	balance := C.height - B.height
+
+	// replace A with the promoted node in A's parent
+	promote := func(iX int) {
+		X := &t.nodes[iX]
+		X.parent = A.parent
+		A.parent = iX
+		if X.parent != aabbTreeNull {
+			if t.nodes[X.parent].child1 == iA {
+				t.nodes[X.parent].child1 = iX
+			} else {
+				t.nodes[X.parent].child2 = iX
+			}
+		} else {
+			t.root = iX
+		}
+	}
+
+	// rotate C up
+	if balance > 1 {
+		iF, iG := C.child1, C.child2
+		F, G := &t.nodes[iF], &t.nodes[iG]
+		C.child1 = iA
+		promote(iC)
+		if F.height > G.height {
+			C.child2 = iF
+			A.child2 = iG
+			G.parent = iA
+			A.aabb = B.aabb.Union(G.aabb)
+			C.aabb = A.aabb.Union(F.aabb)
+			A.height = 1 + maxi(B.height, G.height)
+			C.height = 1 + maxi(A.height, F.height)
+		} else {
+			C.child2 = iG
+			A.child2 = iF
+			F.parent = iA
+			A.aabb = B.aabb.Union(F.aabb)
+			C.aabb = A.aabb.Union(G.aabb)
+			A.height = 1 + maxi(B.height, F.height)
+			C.height = 1 + maxi(A.height, G.height)
+		}
+		return iC
+	}
+
+	// rotate B up
+	if balance < -1 {
+		iD, iE := B.child1, B.child2
+		D, E := &t.nodes[iD], &t.nodes[iE]
+		B.child1 = iA
+		promote(iB)
+		if D.height > E.height {
+			B.child2 = iD
+			A.child1 = iE
+			E.parent = iA
+			A.aabb = C.aabb.Union(E.aabb)
+			B.aabb = A.aabb.Union(D.aabb)
+			A.height = 1 + maxi(C.height, E.height)
+			B.height = 1 + maxi(A.height, D.height)
+		} else {
+			B.child2 = iE
+			A.child1 = iD
+			D.parent = iA
+			A.aabb = C.aabb.Union(D.aabb)
+			B.aabb = A.aabb.Union(E.aabb)
+			A.height = 1 + maxi(C.height, D.height)
+			B.height = 1 + maxi(A.height, E.height)
+		}
+		return iB
+	}
+
+	return iA
+}
+
+// Height returns the height of the tree (0 if empty or a single leaf)
+func (t *DynamicAABBTree) Height() int {
+	if t.root == aabbTreeNull {
+		return 0
+	}
+	return t.nodes[t.root].height
+}
+
+// query calls visit for each entity whose fat AABB overlaps q
+func (t *DynamicAABBTree) query(q AABB, visit func(e *Entity)) {
+	if t.root == aabbTreeNull {
+		return
+	}
+	stack := make([]int, 0, 64)
+	stack = append(stack, t.root)
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		node := &t.nodes[id]
+		if !node.aabb.Overlaps(q) {
+			continue
+		}
+		if node.isLeaf() {
+			visit(node.entity)
+		} else {
+			stack = append(stack, node.child1, node.child2)
+		}
+	}
+}
+
+func (t *DynamicAABBTree) EntitiesWithinDistanceApprox(pos, box Vec2D, d float64) []*Entity {
+	return t.EntitiesWithinDistanceApproxFilter(pos, box, d,
+		func(e *Entity) bool { return true })
+}
+
+// EntitiesWithinDistanceApproxFilter returns the entities whose box overlaps
+// the query box extended d on each side (overestimates diagonally)
+func (t *DynamicAABBTree) EntitiesWithinDistanceApproxFilter(
+	pos, box Vec2D, d float64, predicate func(*Entity) bool) []*Entity {
+	results := make([]*Entity, 0)
+	q := distanceQueryAABB(pos, box, d)
+	t.query(q, func(e *Entity) {
+		if predicate(e) && entityAABB(e).Overlaps(q) {
+			results = append(results, e)
+		}
+	})
+	return results
+}
+
+func (t *DynamicAABBTree) EntitiesWithinDistance(pos, box Vec2D, d float64) []*Entity {
+	return t.EntitiesWithinDistanceFilter(pos, box, d,
+		func(e *Entity) bool { return true })
+}
+
+func (t *DynamicAABBTree) EntitiesWithinDistanceFilter(
+	pos, box Vec2D, d float64, predicate func(*Entity) bool) []*Entity {
+	candidates := t.EntitiesWithinDistanceApprox(pos, box, d)
+	return filterWithinDistance(candidates, pos, box, d, predicate)
+}
+
+func (t *DynamicAABBTree) EntitiesOverlappingBox(pos, box Vec2D) []*Entity {
+	return t.EntitiesOverlappingBoxFilter(pos, box,
+		func(e *Entity) bool { return true })
+}
+
+func (t *DynamicAABBTree) EntitiesOverlappingBoxFilter(
+	pos, box Vec2D, predicate func(*Entity) bool) []*Entity {
+	results := make([]*Entity, 0)
+	t.query(AABBOfRect(pos, box), func(e *Entity) {
+		if predicate(e) &&
+			RectIntersectsRect(pos, box, *e.GetVec2D(POSITION), *e.GetVec2D(BOX)) {
+			results = append(results, e)
+		}
+	})
+	return results
+}
+
+func (t *DynamicAABBTree) EntitiesOverlappingCircle(center Vec2D, radius float64) []*Entity {
+	return t.EntitiesOverlappingCircleFilter(center, radius,
+		func(e *Entity) bool { return true })
+}
+
+func (t *DynamicAABBTree) EntitiesOverlappingCircleFilter(
+	center Vec2D, radius float64, predicate func(*Entity) bool) []*Entity {
+	results := make([]*Entity, 0)
+	t.query(distanceQueryAABB(center, Vec2D{0, 0}, radius), func(e *Entity) {
+		if predicate(e) &&
+			RectWithinRadiusOfPoint(*e.GetVec2D(POSITION), *e.GetVec2D(BOX), radius, center) {
+			results = append(results, e)
+		}
+	})
+	return results
+}
+
+// raycast visits the leaves whose fat AABB the ray passes through within
+// maxDist, skipping any subtree whose entry point is farther than cutoff()
+func (t *DynamicAABBTree) raycast(
+	origin, dir Vec2D, maxDist float64,
+	cutoff func() float64, visit func(e *Entity)) {
+	if t.root == aabbTreeNull {
+		return
+	}
+	stack := make([]int, 0, 64)
+	stack = append(stack, t.root)
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		node := &t.nodes[id]
+		if hit, tEntry := node.aabb.RayHit(origin, dir, maxDist); !hit || tEntry > cutoff() {
+			continue
+		}
+		if node.isLeaf() {
+			visit(node.entity)
+		} else {
+			stack = append(stack, node.child1, node.child2)
+		}
+	}
+}
+
+func (t *DynamicAABBTree) Raycast(
+	origin, dir Vec2D, maxDist float64, filter func(*Entity) bool) []RaycastHit {
+	hits := make([]RaycastHit, 0)
+	if dir.Magnitude() == 0 {
+		return hits
+	}
+	dir = dir.Unit()
+	t.raycast(origin, dir, maxDist,
+		func() float64 { return maxDist },
+		func(e *Entity) {
+			if hit, ok := rayTestEntity(origin, dir, maxDist, e, filter); ok {
+				hits = append(hits, hit)
+			}
+		})
+	sortRaycastHits(hits)
+	return hits
+}
+
+func (t *DynamicAABBTree) RaycastFirst(
+	origin, dir Vec2D, maxDist float64, filter func(*Entity) bool) (RaycastHit, bool) {
+	var closest RaycastHit
+	found := false
+	if dir.Magnitude() == 0 {
+		return closest, false
+	}
+	dir = dir.Unit()
+	t.raycast(origin, dir, maxDist,
+		func() float64 {
+			if found {
+				return closest.Distance
+			}
+			return maxDist
+		},
+		func(e *Entity) {
+			hit, ok := rayTestEntity(origin, dir, maxDist, e, filter)
+			if ok && (!found || hit.Distance < closest.Distance) {
+				closest = hit
+				found = true
+			}
+		})
+	return closest, found
+}
+
+func (t *DynamicAABBTree) SegmentCast(from, to Vec2D, filter func(*Entity) bool) []RaycastHit {
+	_, _, d := from.Distance(to)
+	return t.Raycast(from, to.Sub(from), d, filter)
+}
+
+// CandidatePairs visits each pair of entities where one's box overlaps the
+// other's fat AABB
+func (t *DynamicAABBTree) CandidatePairs(visit func(i, j *Entity)) {
+	for _, e := range t.SpatialEntities.entities {
+		if t.leaves[e.ID] == aabbTreeNull {
+			continue
+		}
+		t.query(entityAABB(e), func(other *Entity) {
+			if other.ID > e.ID {
+				visit(e, other)
+			}
+		})
+	}
+}
+
+func (t *DynamicAABBTree) Expand(n int) {
+	for i := 0; i < n; i++ {
+		t.leaves = append(t.leaves, aabbTreeNull)
+	}
+}
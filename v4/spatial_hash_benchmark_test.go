@@ -96,3 +96,90 @@ func BenchmarkSpatialHashEntitiesWithinDistance(b *testing.B) {
 			30.0)
 	}
 }
+
+// spawn entities either uniformly, or clustered into a few dense "towns"
+// with the rest scattered sparsely through the "wilderness"
+func benchmarkSpatialIndexWorld(kind string, clustered bool) *World {
+	w := NewWorld(map[string]any{
+		"width":        1000,
+		"height":       1000,
+		"spatialIndex": kind,
+	})
+	towns := []Vec2D{{150, 200}, {700, 300}, {400, 800}}
+	for i := 0; i < 1024; i++ {
+		var pos Vec2D
+		if clustered && i%10 != 0 {
+			town := towns[i%len(towns)]
+			pos = town.Add(Vec2D{40*rand.Float64() - 20, 40*rand.Float64() - 20})
+		} else {
+			pos = Vec2D{1000 * rand.Float64(), 1000 * rand.Float64()}
+		}
+		testingSpawnSpatial(w, pos, Vec2D{5, 5})
+	}
+	w.SpatialIndex.Update()
+	return w
+}
+
+// moves a tenth of the entities a small amount, as in a typical frame
+func benchmarkSpatialIndexJitter(w *World, entities []*Entity) {
+	for i := 0; i < len(entities); i += 10 {
+		entities[i].GetVec2D(POSITION).Inc(Vec2D{rand.Float64() - 0.5, rand.Float64() - 0.5})
+	}
+}
+
+func BenchmarkSpatialIndexUpdate(b *testing.B) {
+	for _, clustered := range []bool{false, true} {
+		for _, kind := range spatialIndexKinds {
+			name := kind + "/uniform"
+			if clustered {
+				name = kind + "/clustered"
+			}
+			b.Run(name, func(b *testing.B) {
+				w := benchmarkSpatialIndexWorld(kind, clustered)
+				entities := w.FilterAllEntities(AllEntityPredicate)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					benchmarkSpatialIndexJitter(w, entities)
+					w.SpatialIndex.Update()
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkSpatialIndexEntitiesWithinDistance(b *testing.B) {
+	for _, clustered := range []bool{false, true} {
+		for _, kind := range spatialIndexKinds {
+			name := kind + "/uniform"
+			if clustered {
+				name = kind + "/clustered"
+			}
+			b.Run(name, func(b *testing.B) {
+				w := benchmarkSpatialIndexWorld(kind, clustered)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					// query from inside a town
+					w.EntitiesWithinDistance(Vec2D{150, 200}, Vec2D{5, 5}, 30.0)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkSpatialIndexRaycast(b *testing.B) {
+	for _, clustered := range []bool{false, true} {
+		for _, kind := range spatialIndexKinds {
+			name := kind + "/uniform"
+			if clustered {
+				name = kind + "/clustered"
+			}
+			b.Run(name, func(b *testing.B) {
+				w := benchmarkSpatialIndexWorld(kind, clustered)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					w.RaycastFirst(Vec2D{0, 0}, Vec2D{1, 1}, 1500, nil)
+				}
+			})
+		}
+	}
+}
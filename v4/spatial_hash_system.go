@@ -1,7 +1,12 @@
 package sameriver
 
-// used to compute the spatial hash tables given a list of entities
+// SpatialHashSystem sets the world's shared spatial index to a gridX x gridY
+// grid (see World.SpatialIndex), and refreshes it when it has gone stale. The
+// world already updates its index at the start of every World.Update(), so
+// this system is only needed to choose the grid size at registration time or
+// to expose the grid as Hasher
 type SpatialHashSystem struct {
+	w      *World
 	gridX  int
 	gridY  int
 	Hasher *SpatialHasher
@@ -22,14 +27,26 @@ func (s *SpatialHashSystem) GetComponentDeps() []any {
 }
 
 func (s *SpatialHashSystem) LinkWorld(w *World) {
-	s.Hasher = NewSpatialHasher(s.gridX, s.gridY, w)
+	s.w = w
+	if w.SpatialHasher == nil {
+		logWarning("SpatialHashSystem registered on a world whose spatialIndex is not a grid; using the world's index as-is")
+		return
+	}
+	if w.SpatialHasher.GridX != s.gridX || w.SpatialHasher.GridY != s.gridY {
+		w.SpatialHasher = NewSpatialHasher(s.gridX, s.gridY, w)
+		w.SpatialIndex = w.SpatialHasher
+	}
+	s.Hasher = w.SpatialHasher
 }
 
 func (s *SpatialHashSystem) Update(dt_ms float64) {
-	// clear any old data and run the computation
-	s.Hasher.Update()
+	s.w.RefreshSpatialIndex()
 }
 
 func (s *SpatialHashSystem) Expand(n int) {
-	s.Hasher.Expand(n)
+	// NOTE: the world expands its index along with the entity tables; this
+	// only grows the cells' preallocated capacity further
+	if s.Hasher != nil {
+		s.Hasher.Expand(n)
+	}
 }
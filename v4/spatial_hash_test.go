@@ -331,3 +331,126 @@ func TestSpatialHashExpand(t *testing.T) {
 		}
 	}
 }
+
+func TestSpatialHashCellsAlongRay(t *testing.T) {
+	w := NewWorld(map[string]any{
+		"width":  100,
+		"height": 100,
+	})
+	sh := NewSpatialHashSystem(10, 10)
+	w.RegisterSystems(sh)
+	cells := sh.Hasher.CellsAlongRay(Vec2D{5, 5}, Vec2D{1, 0}, 100)
+	if len(cells) != 10 {
+		t.Fatalf("horizontal ray across the world should cross 10 cells; got %d: %v", len(cells), cells)
+	}
+	for i, cell := range cells {
+		if cell != [2]int{i, 0} {
+			t.Fatalf("cells should be walked in order; got %v", cells)
+		}
+	}
+	cells = sh.Hasher.CellsAlongRay(Vec2D{5, 5}, Vec2D{1, 1}, 20)
+	if cells[0] != [2]int{0, 0} || cells[len(cells)-1] != [2]int{1, 1} {
+		t.Fatalf("diagonal ray should go from 0,0 to 1,1; got %v", cells)
+	}
+	// starting outside the world, we should begin at the cell of entry
+	cells = sh.Hasher.CellsAlongRay(Vec2D{-50, 55}, Vec2D{1, 0}, 65)
+	if len(cells) != 2 || cells[0] != [2]int{0, 5} {
+		t.Fatalf("ray from outside the world should enter at 0,5; got %v", cells)
+	}
+}
+
+func TestSpatialHashRaycast(t *testing.T) {
+	w := NewWorld(map[string]any{
+		"width":  100,
+		"height": 100,
+	})
+	sh := NewSpatialHashSystem(10, 10)
+	w.RegisterSystems(sh)
+	near := testingSpawnSpatial(w, Vec2D{30, 50}, Vec2D{4, 4})
+	far := testingSpawnSpatial(w, Vec2D{70, 50}, Vec2D{4, 4})
+	// large entity spanning many cells, in between
+	mid := testingSpawnSpatial(w, Vec2D{50, 50}, Vec2D{20, 20})
+	offAxis := testingSpawnSpatial(w, Vec2D{50, 90}, Vec2D{4, 4})
+	w.Update(FRAME_MS / 2)
+
+	hits := w.Raycast(Vec2D{0, 50}, Vec2D{1, 0}, 100, nil)
+	if len(hits) != 3 {
+		t.Fatalf("should have hit 3 entities; got %d", len(hits))
+	}
+	if hits[0].Entity != near || hits[1].Entity != mid || hits[2].Entity != far {
+		t.Fatal("hits should be ordered by distance")
+	}
+	if hits[0].Distance != 28 || hits[0].Normal != (Vec2D{-1, 0}) {
+		t.Fatalf("first hit should be at 28 with normal -x; got %f, %v",
+			hits[0].Distance, hits[0].Normal)
+	}
+	for _, hit := range hits {
+		if hit.Entity == offAxis {
+			t.Fatal("should not have hit entity off the ray's path")
+		}
+	}
+	// filter
+	hits = w.Raycast(Vec2D{0, 50}, Vec2D{1, 0}, 100,
+		func(e *Entity) bool { return e != mid })
+	if len(hits) != 2 {
+		t.Fatalf("filter should have excluded an entity; got %d hits", len(hits))
+	}
+	// maxDist
+	hits = w.Raycast(Vec2D{0, 50}, Vec2D{1, 0}, 35, nil)
+	if len(hits) != 1 || hits[0].Entity != near {
+		t.Fatal("maxDist should limit hits")
+	}
+	// first hit
+	first, ok := w.RaycastFirst(Vec2D{100, 50}, Vec2D{-1, 0}, 100, nil)
+	if !ok || first.Entity != far || first.Normal != (Vec2D{1, 0}) {
+		t.Fatal("RaycastFirst should return closest entity")
+	}
+	// segment
+	hits = w.SegmentCast(Vec2D{50, 100}, Vec2D{50, 70}, nil)
+	if len(hits) != 1 || hits[0].Entity != offAxis {
+		t.Fatal("SegmentCast should only hit entities on the segment")
+	}
+}
+
+func TestSpatialHashOverlapQueries(t *testing.T) {
+	w := NewWorld(map[string]any{
+		"width":  100,
+		"height": 100,
+	})
+	sh := NewSpatialHashSystem(10, 10)
+	w.RegisterSystems(sh)
+	inside := testingSpawnSpatial(w, Vec2D{50, 50}, Vec2D{2, 2})
+	edge := testingSpawnSpatial(w, Vec2D{58, 50}, Vec2D{2, 2})
+	// within the box's corner but outside the circle
+	corner := testingSpawnSpatial(w, Vec2D{58, 58}, Vec2D{2, 2})
+	outside := testingSpawnSpatial(w, Vec2D{80, 80}, Vec2D{2, 2})
+	w.Update(FRAME_MS / 2)
+
+	inBox := w.EntitiesOverlappingBox(Vec2D{50, 50}, Vec2D{16, 16})
+	if len(inBox) != 3 ||
+		indexOfEntityInSlice(&inBox, outside) != -1 {
+		t.Fatalf("box overlap should find 3 entities; got %d", len(inBox))
+	}
+	inCircle := w.EntitiesOverlappingCircle(Vec2D{50, 50}, 8)
+	if len(inCircle) != 2 ||
+		indexOfEntityInSlice(&inCircle, inside) == -1 ||
+		indexOfEntityInSlice(&inCircle, edge) == -1 ||
+		indexOfEntityInSlice(&inCircle, corner) != -1 {
+		t.Fatalf("circle overlap should find 2 entities; got %d", len(inCircle))
+	}
+	inCircle = w.EntitiesOverlappingCircleFilter(Vec2D{50, 50}, 8,
+		func(e *Entity) bool { return e != edge })
+	if len(inCircle) != 1 {
+		t.Fatalf("filter should have excluded an entity; got %d", len(inCircle))
+	}
+}
+
+func TestSpatialHashCellRangeNegative(t *testing.T) {
+	w := testingWorld()
+	h := NewSpatialHasher(10, 10, w)
+	// a rect hanging off the bottom-left corner starts in cell -1, not 0
+	x0, x1, y0, y1 := h.CellRangeOfRect(Vec2D{-5, -5}, Vec2D{10, 10})
+	if x0 != -1 || y0 != -1 || x1 != 0 || y1 != 0 {
+		t.Fatalf("expected cells [-1, 0] x [-1, 0], got [%d, %d] x [%d, %d]", x0, x1, y0, y1)
+	}
+}
@@ -41,9 +41,7 @@ func NewSpatialHasher(gridX, gridY int, w *World) *SpatialHasher {
 	h.allocTable()
 	h.allocTableMutexes()
 	// get spatial entities from world
-	h.SpatialEntities = w.em.GetSortedUpdatedEntityList(
-		EntityFilterFromComponentBitArray("spatial",
-			w.em.components.BitArrayFromIDs([]ComponentID{POSITION, BOX})))
+	h.SpatialEntities = spatialEntitiesList(w)
 
 	return h
 }
@@ -106,11 +104,18 @@ func (h *SpatialHasher) clearTable() {
 	}
 }
 
+// CellRangeOfRect gives the range of cells touched by the rect with
+// bottom-left pos and size box. Cells outside the grid may be returned
+// (including negative indexes, since we floor rather than truncate)
 func (h *SpatialHasher) CellRangeOfRect(pos, box Vec2D) (cellX0, cellX1, cellY0, cellY1 int) {
-	cellX0 = int(pos.X / h.CellSizeX)
-	cellX1 = int((pos.X + box.X) / h.CellSizeX)
-	cellY0 = int(pos.Y / h.CellSizeY)
-	cellY1 = int((pos.Y + box.Y) / h.CellSizeY)
+	return cellRangeOfRect(pos, box, Vec2D{h.CellSizeX, h.CellSizeY})
+}
+
+func cellRangeOfRect(pos, box, cellSize Vec2D) (cellX0, cellX1, cellY0, cellY1 int) {
+	cellX0 = int(math.Floor(pos.X / cellSize.X))
+	cellX1 = int(math.Floor((pos.X + box.X) / cellSize.X))
+	cellY0 = int(math.Floor(pos.Y / cellSize.Y))
+	cellY1 = int(math.Floor((pos.Y + box.Y) / cellSize.Y))
 	return cellX0, cellX1, cellY0, cellY1
 }
 
@@ -175,6 +180,31 @@ func (h *SpatialHasher) scanAndInsertEntitiesSingleThread() {
 	}
 }
 
+// CandidatePairs visits each pair of entities sharing a cell (pairs which
+// share more than one cell will be visited once per cell)
+func (h *SpatialHasher) CandidatePairs(visit func(i, j *Entity)) {
+	for x := 0; x < h.GridX; x++ {
+		for y := 0; y < h.GridY; y++ {
+			h.CellCandidatePairs(x, y, visit)
+		}
+	}
+}
+
+// CellCandidatePairs visits each pair of entities in the cell with a
+// handshake pattern, ordered so that i.ID < j.ID
+func (h *SpatialHasher) CellCandidatePairs(x, y int, visit func(i, j *Entity)) {
+	entities := h.Table[x][y]
+	for ix := 0; ix < len(entities); ix++ {
+		for jx := ix + 1; jx < len(entities); jx++ {
+			i, j := entities[ix], entities[jx]
+			if j.ID < i.ID {
+				i, j = j, i
+			}
+			visit(i, j)
+		}
+	}
+}
+
 // TableCopy gets a *copy* of the current table which is safe to hold onto, mutate, etc.
 func (h *SpatialHasher) TableCopy() [][][]*Entity {
 	t2 := make([][][]*Entity, h.GridX)
@@ -288,18 +318,7 @@ func (h *SpatialHasher) EntitiesWithinDistance(pos, box Vec2D, d float64) []*Ent
 func (h *SpatialHasher) EntitiesWithinDistanceFilter(
 	pos, box Vec2D, d float64, predicate func(*Entity) bool) []*Entity {
 	candidates := h.EntitiesWithinDistanceApprox(pos, box, d)
-	results := make([]*Entity, 0)
-	for _, e := range candidates {
-		ePos := *e.GetVec2D(POSITION)
-		eBox := *e.GetVec2D(BOX)
-		if predicate(e) && RectWithinDistanceOfRect(
-			pos.ShiftedCenterToBottomLeft(box), box,
-			ePos.ShiftedCenterToBottomLeft(eBox), eBox,
-			d) {
-			results = append(results, e)
-		}
-	}
-	return results
+	return filterWithinDistance(candidates, pos, box, d, predicate)
 }
 
 // String turns a SpatialHashTable into a String representation (NOTE: do *NOT* call
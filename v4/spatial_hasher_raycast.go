@@ -0,0 +1,245 @@
+package sameriver
+
+import (
+	"math"
+)
+
+// RaycastHit describes an entity struck by a ray
+type RaycastHit struct {
+	Entity *Entity
+	// distance along the ray from its origin to the point of entry
+	Distance float64
+	// the point of entry
+	Point Vec2D
+	// outward normal of the face of the entity's box which was struck
+	// (zero vector if the ray started inside the box)
+	Normal Vec2D
+}
+
+// CellsAlongRay walks the grid from origin in direction dir, up to maxDist,
+// using a DDA (Amanatides & Woo) traversal, returning the cells in the order
+// the ray passes through them. Cells outside the grid are not returned.
+func (h *SpatialHasher) CellsAlongRay(origin, dir Vec2D, maxDist float64) [][2]int {
+	cells := make([][2]int, 0)
+	h.walkRay(origin, dir, maxDist, func(x, y int, tEntry float64) bool {
+		cells = append(cells, [2]int{x, y})
+		return true
+	})
+	return cells
+}
+
+// walkRay calls visit for each cell the ray passes through, in order, along
+// with the distance at which the ray enters the cell. If visit returns false,
+// the walk stops.
+func (h *SpatialHasher) walkRay(
+	origin, dir Vec2D, maxDist float64, visit func(x, y int, tEntry float64) bool) {
+	walkCellsAlongRay(origin, dir, maxDist,
+		Vec2D{h.CellSizeX, h.CellSizeY}, [2]int{0, 0}, [2]int{h.GridX - 1, h.GridY - 1},
+		visit)
+}
+
+// walkCellsAlongRay walks the cells (of size cellSize, with cell (0, 0)
+// having its bottom-left corner at the origin) from minCell to maxCell
+// inclusive which the ray passes through, using a DDA (Amanatides & Woo)
+// traversal
+func walkCellsAlongRay(
+	origin, dir Vec2D, maxDist float64,
+	cellSize Vec2D, minCell, maxCell [2]int,
+	visit func(x, y int, tEntry float64) bool) {
+
+	if dir.Magnitude() == 0 {
+		return
+	}
+	dir = dir.Unit()
+	// clip the ray to the extent of the cells so that rays starting outside
+	// begin walking at the cell they enter
+	extent := AABB{
+		Vec2D{float64(minCell[0]) * cellSize.X, float64(minCell[1]) * cellSize.Y},
+		Vec2D{float64(maxCell[0]+1) * cellSize.X, float64(maxCell[1]+1) * cellSize.Y},
+	}
+	hit, tStart := extent.RayHit(origin, dir, maxDist)
+	if !hit {
+		return
+	}
+	start := origin.Add(dir.Scale(tStart))
+	x := int(math.Floor(start.X / cellSize.X))
+	y := int(math.Floor(start.Y / cellSize.Y))
+	// a ray entering exactly on the far edge belongs to the last cell
+	if x > maxCell[0] {
+		x = maxCell[0]
+	}
+	if y > maxCell[1] {
+		y = maxCell[1]
+	}
+	// the step direction and the distance along the ray to the next
+	// cell boundary in x and y
+	stepX, stepY := 0, 0
+	tMaxX, tMaxY := math.Inf(1), math.Inf(1)
+	tDeltaX, tDeltaY := math.Inf(1), math.Inf(1)
+	if dir.X > 0 {
+		stepX = 1
+		tMaxX = tStart + (float64(x+1)*cellSize.X-start.X)/dir.X
+		tDeltaX = cellSize.X / dir.X
+	} else if dir.X < 0 {
+		stepX = -1
+		tMaxX = tStart + (float64(x)*cellSize.X-start.X)/dir.X
+		tDeltaX = -cellSize.X / dir.X
+	}
+	if dir.Y > 0 {
+		stepY = 1
+		tMaxY = tStart + (float64(y+1)*cellSize.Y-start.Y)/dir.Y
+		tDeltaY = cellSize.Y / dir.Y
+	} else if dir.Y < 0 {
+		stepY = -1
+		tMaxY = tStart + (float64(y)*cellSize.Y-start.Y)/dir.Y
+		tDeltaY = -cellSize.Y / dir.Y
+	}
+	tEntry := tStart
+	for x >= minCell[0] && x <= maxCell[0] &&
+		y >= minCell[1] && y <= maxCell[1] &&
+		tEntry <= maxDist {
+		if !visit(x, y, tEntry) {
+			return
+		}
+		if tMaxX < tMaxY {
+			tEntry = tMaxX
+			tMaxX += tDeltaX
+			x += stepX
+		} else {
+			tEntry = tMaxY
+			tMaxY += tDeltaY
+			y += stepY
+		}
+	}
+}
+
+// Raycast returns every entity (passing filter, if non-nil) whose box is
+// struck by the ray from origin in direction dir within maxDist, ordered by
+// distance
+//
+// NOTE: can return inactive entities
+func (h *SpatialHasher) Raycast(
+	origin, dir Vec2D, maxDist float64, filter func(*Entity) bool) []RaycastHit {
+	return raycastCells(h.walkRay, h.Entities, origin, dir, maxDist, filter)
+}
+
+// RaycastFirst returns the closest entity (passing filter, if non-nil) struck
+// by the ray, stopping the grid walk as soon as no closer hit is possible
+//
+// NOTE: can return inactive entities
+func (h *SpatialHasher) RaycastFirst(
+	origin, dir Vec2D, maxDist float64, filter func(*Entity) bool) (RaycastHit, bool) {
+	return raycastFirstCells(h.walkRay, h.Entities, origin, dir, maxDist, filter)
+}
+
+// raycastCells tests the entities in each cell visited by walk, given a
+// function to get the entities in a cell (used by the grid-based indexes)
+func raycastCells(
+	walk func(origin, dir Vec2D, maxDist float64, visit func(x, y int, tEntry float64) bool),
+	cell func(x, y int) []*Entity,
+	origin, dir Vec2D, maxDist float64, filter func(*Entity) bool) []RaycastHit {
+	hits := make([]RaycastHit, 0)
+	if dir.Magnitude() == 0 {
+		return hits
+	}
+	dir = dir.Unit()
+	tested := make(map[int]bool)
+	walk(origin, dir, maxDist, func(x, y int, tEntry float64) bool {
+		for _, e := range cell(x, y) {
+			if tested[e.ID] {
+				continue
+			}
+			tested[e.ID] = true
+			if hit, ok := rayTestEntity(origin, dir, maxDist, e, filter); ok {
+				hits = append(hits, hit)
+			}
+		}
+		return true
+	})
+	sortRaycastHits(hits)
+	return hits
+}
+
+func raycastFirstCells(
+	walk func(origin, dir Vec2D, maxDist float64, visit func(x, y int, tEntry float64) bool),
+	cell func(x, y int) []*Entity,
+	origin, dir Vec2D, maxDist float64, filter func(*Entity) bool) (RaycastHit, bool) {
+	var closest RaycastHit
+	found := false
+	if dir.Magnitude() == 0 {
+		return closest, false
+	}
+	dir = dir.Unit()
+	tested := make(map[int]bool)
+	walk(origin, dir, maxDist, func(x, y int, tEntry float64) bool {
+		// any entity hit in this cell or beyond is at least tEntry away
+		if found && tEntry > closest.Distance {
+			return false
+		}
+		for _, e := range cell(x, y) {
+			if tested[e.ID] {
+				continue
+			}
+			tested[e.ID] = true
+			hit, ok := rayTestEntity(origin, dir, maxDist, e, filter)
+			if ok && (!found || hit.Distance < closest.Distance) {
+				closest = hit
+				found = true
+			}
+		}
+		return true
+	})
+	return closest, found
+}
+
+// SegmentCast is a Raycast from "from" to "to"
+//
+// NOTE: can return inactive entities
+func (h *SpatialHasher) SegmentCast(from, to Vec2D, filter func(*Entity) bool) []RaycastHit {
+	_, _, d := from.Distance(to)
+	return h.Raycast(from, to.Sub(from), d, filter)
+}
+
+// EntitiesOverlappingBox returns the entities whose box intersects the
+// rect given by pos (center) and box
+//
+// NOTE: can return inactive entities
+func (h *SpatialHasher) EntitiesOverlappingBox(pos, box Vec2D) []*Entity {
+	return h.EntitiesOverlappingBoxFilter(pos, box,
+		func(e *Entity) bool { return true })
+}
+
+// NOTE: can return inactive entities
+func (h *SpatialHasher) EntitiesOverlappingBoxFilter(
+	pos, box Vec2D, predicate func(*Entity) bool) []*Entity {
+	candidates := h.EntitiesWithinDistanceApproxFilter(pos, box, 0, predicate)
+	results := make([]*Entity, 0)
+	for _, e := range candidates {
+		if RectIntersectsRect(pos, box, *e.GetVec2D(POSITION), *e.GetVec2D(BOX)) {
+			results = append(results, e)
+		}
+	}
+	return results
+}
+
+// EntitiesOverlappingCircle returns the entities whose box intersects the
+// circle of the given radius around center
+//
+// NOTE: can return inactive entities
+func (h *SpatialHasher) EntitiesOverlappingCircle(center Vec2D, radius float64) []*Entity {
+	return h.EntitiesOverlappingCircleFilter(center, radius,
+		func(e *Entity) bool { return true })
+}
+
+// NOTE: can return inactive entities
+func (h *SpatialHasher) EntitiesOverlappingCircleFilter(
+	center Vec2D, radius float64, predicate func(*Entity) bool) []*Entity {
+	candidates := h.EntitiesWithinDistanceApproxFilter(center, Vec2D{0, 0}, radius, predicate)
+	results := make([]*Entity, 0)
+	for _, e := range candidates {
+		if RectWithinRadiusOfPoint(*e.GetVec2D(POSITION), *e.GetVec2D(BOX), radius, center) {
+			results = append(results, e)
+		}
+	}
+	return results
+}
@@ -0,0 +1,208 @@
+package sameriver
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SpatialIndex is implemented by the structures which can answer spatial
+// queries about entities having POSITION and BOX. The world's index is
+// chosen with the "spatialIndex" key of the world spec:
+//
+//	"grid"       - SpatialHasher, a fixed GridX x GridY uniform grid (default).
+//	               Rebuilt entirely on each Update(). Best when entities are
+//	               spread evenly over the world.
+//	"quadtree"   - LooseQuadTree. Entities are only moved when they leave the
+//	               loose bounds of their node. Adapts to dense clusters and
+//	               empty regions.
+//	"bvh"        - DynamicAABBTree, a balanced bounding volume hierarchy of
+//	               fattened boxes. Entities are only reinserted when they leave
+//	               their fat box.
+//	"sparsegrid" - SparseSpatialHasher, a uniform grid of cells of size
+//	               "sparseGridCellSize" stored in a map keyed by cell
+//	               coordinate, so it covers any coordinates (the default for
+//	               "unbounded" worlds). Rebuilt entirely on each Update().
+//
+// NOTE: "grid" and "quadtree" are sized to the world's Width x Height. The
+// grid ignores the parts of entities outside that rect; the quadtree keeps
+// entities outside it in its root node (correct, but slow if many are).
+type SpatialIndex interface {
+	// bring the index up to date with the current positions
+	Update()
+
+	// NOTE: queries can return inactive entities
+	EntitiesWithinDistance(pos, box Vec2D, d float64) []*Entity
+	EntitiesWithinDistanceFilter(pos, box Vec2D, d float64, predicate func(*Entity) bool) []*Entity
+	EntitiesWithinDistanceApprox(pos, box Vec2D, d float64) []*Entity
+	EntitiesWithinDistanceApproxFilter(pos, box Vec2D, d float64, predicate func(*Entity) bool) []*Entity
+	EntitiesOverlappingBox(pos, box Vec2D) []*Entity
+	EntitiesOverlappingBoxFilter(pos, box Vec2D, predicate func(*Entity) bool) []*Entity
+	EntitiesOverlappingCircle(center Vec2D, radius float64) []*Entity
+	EntitiesOverlappingCircleFilter(center Vec2D, radius float64, predicate func(*Entity) bool) []*Entity
+	Raycast(origin, dir Vec2D, maxDist float64, filter func(*Entity) bool) []RaycastHit
+	RaycastFirst(origin, dir Vec2D, maxDist float64, filter func(*Entity) bool) (RaycastHit, bool)
+	SegmentCast(from, to Vec2D, filter func(*Entity) bool) []RaycastHit
+	// calls visit for pairs of entities (i.ID < j.ID) whose boxes might
+	// overlap, for use in collision detection. A pair may be visited more
+	// than once.
+	CandidatePairs(visit func(i, j *Entity))
+
+	Expand(n int)
+}
+
+// NewSpatialIndex constructs a SpatialIndex of the given kind ("grid",
+// "quadtree", "bvh" or "sparsegrid") over the world's spatial entities
+func NewSpatialIndex(kind string, spec WorldSpec, w *World) SpatialIndex {
+	switch kind {
+	case "grid":
+		return NewSpatialHasher(spec.DistanceHasherGridX, spec.DistanceHasherGridY, w)
+	case "quadtree":
+		return NewLooseQuadTree(spec.QuadTreeMaxDepth, w)
+	case "bvh":
+		return NewDynamicAABBTree(w)
+	case "sparsegrid":
+		return NewSparseSpatialHasher(float64(spec.SparseGridCellSize), w)
+	default:
+		panic(fmt.Sprintf("unknown spatialIndex %s [valid: grid, quadtree, bvh, sparsegrid]", kind))
+	}
+}
+
+// the UpdatedEntityList of entities having POSITION and BOX, shared by
+// all spatial indexes
+func spatialEntitiesList(w *World) *UpdatedEntityList {
+	return w.em.GetSortedUpdatedEntityList(
+		EntityFilterFromComponentBitArray("spatial",
+			w.em.components.BitArrayFromIDs([]ComponentID{POSITION, BOX})))
+}
+
+// AABB is an axis-aligned bounding box given by its min (bottom-left) and
+// max (top-right) corners
+type AABB struct {
+	Min Vec2D
+	Max Vec2D
+}
+
+func AABBOfRect(pos, box Vec2D) AABB {
+	min := pos.ShiftedCenterToBottomLeft(box)
+	return AABB{min, min.Add(box)}
+}
+
+func entityAABB(e *Entity) AABB {
+	return AABBOfRect(*e.GetVec2D(POSITION), *e.GetVec2D(BOX))
+}
+
+func (a AABB) Center() Vec2D {
+	return Vec2D{(a.Min.X + a.Max.X) / 2, (a.Min.Y + a.Max.Y) / 2}
+}
+
+func (a AABB) Size() Vec2D {
+	return a.Max.Sub(a.Min)
+}
+
+func (a AABB) Perimeter() float64 {
+	return 2 * ((a.Max.X - a.Min.X) + (a.Max.Y - a.Min.Y))
+}
+
+func (a AABB) Union(b AABB) AABB {
+	return AABB{
+		Vec2D{minf(a.Min.X, b.Min.X), minf(a.Min.Y, b.Min.Y)},
+		Vec2D{maxf(a.Max.X, b.Max.X), maxf(a.Max.Y, b.Max.Y)},
+	}
+}
+
+func (a AABB) Expanded(d float64) AABB {
+	return AABB{a.Min.Sub(Vec2D{d, d}), a.Max.Add(Vec2D{d, d})}
+}
+
+func (a AABB) Contains(b AABB) bool {
+	return a.Min.X <= b.Min.X && a.Min.Y <= b.Min.Y &&
+		a.Max.X >= b.Max.X && a.Max.Y >= b.Max.Y
+}
+
+// NOTE: touching edges count as overlapping, so that queries are inclusive
+// (entities are tested precisely after the broad phase)
+func (a AABB) Overlaps(b AABB) bool {
+	return a.Min.X <= b.Max.X && b.Min.X <= a.Max.X &&
+		a.Min.Y <= b.Max.Y && b.Min.Y <= a.Max.Y
+}
+
+func (a AABB) RayHit(origin, dir Vec2D, maxDist float64) (bool, float64) {
+	hit, t, _ := RayIntersectsRect(origin, dir, maxDist, a.Center(), a.Size())
+	return hit, t
+}
+
+func minf(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxf(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func mini(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxi(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// the AABB covering a box at pos extended d in every direction, used for
+// the broad phase of distance queries
+func distanceQueryAABB(pos, box Vec2D, d float64) AABB {
+	return AABBOfRect(pos, box).Expanded(d)
+}
+
+// filters broad-phase candidates by exact rect distance
+func filterWithinDistance(
+	candidates []*Entity, pos, box Vec2D, d float64, predicate func(*Entity) bool) []*Entity {
+	results := make([]*Entity, 0)
+	for _, e := range candidates {
+		ePos := *e.GetVec2D(POSITION)
+		eBox := *e.GetVec2D(BOX)
+		if predicate(e) && RectWithinDistanceOfRect(
+			pos.ShiftedCenterToBottomLeft(box), box,
+			ePos.ShiftedCenterToBottomLeft(eBox), eBox,
+			d) {
+			results = append(results, e)
+		}
+	}
+	return results
+}
+
+func rayTestEntity(
+	origin, dir Vec2D, maxDist float64, e *Entity, filter func(*Entity) bool) (RaycastHit, bool) {
+	if filter != nil && !filter(e) {
+		return RaycastHit{}, false
+	}
+	pos := *e.GetVec2D(POSITION)
+	box := *e.GetVec2D(BOX)
+	hit, t, normal := RayIntersectsRect(origin, dir, maxDist, pos, box)
+	if !hit {
+		return RaycastHit{}, false
+	}
+	return RaycastHit{
+		Entity:   e,
+		Distance: t,
+		Point:    origin.Add(dir.Scale(t)),
+		Normal:   normal,
+	}, true
+}
+
+func sortRaycastHits(hits []RaycastHit) {
+	sort.Slice(hits, func(i, j int) bool {
+		return hits[i].Distance < hits[j].Distance
+	})
+}
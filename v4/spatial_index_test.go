@@ -0,0 +1,305 @@
+package sameriver
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var spatialIndexKinds = []string{"grid", "quadtree", "bvh", "sparsegrid"}
+
+func testingSpatialIndexWorld(kind string) *World {
+	return NewWorld(map[string]any{
+		"width":        100,
+		"height":       100,
+		"spatialIndex": kind,
+	})
+}
+
+func entityIDsSorted(entities []*Entity) []int {
+	ids := make([]int, len(entities))
+	for i, e := range entities {
+		ids[i] = e.ID
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func sameEntities(a, b []*Entity) bool {
+	aIDs, bIDs := entityIDsSorted(a), entityIDsSorted(b)
+	if len(aIDs) != len(bIDs) {
+		return false
+	}
+	for i := range aIDs {
+		if aIDs[i] != bIDs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// compare the index's answers to brute force over all entities
+func checkSpatialIndexQueries(t *testing.T, kind string, w *World) {
+	checkSpatialIndexQueriesIn(t, kind, w, AABB{Vec2D{0, 0}, Vec2D{100, 100}})
+}
+
+// compare the index's answers to brute force over all entities, for
+// queries positioned within the given region
+func checkSpatialIndexQueriesIn(t *testing.T, kind string, w *World, region AABB) {
+	size := region.Size()
+	for i := 0; i < 20; i++ {
+		pos := region.Min.Add(Vec2D{size.X * rand.Float64(), size.Y * rand.Float64()})
+		box := Vec2D{10 * rand.Float64(), 10 * rand.Float64()}
+		d := 20 * rand.Float64()
+
+		got := w.EntitiesWithinDistance(pos, box, d)
+		expected := w.FilterAllEntities(func(e *Entity) bool {
+			ePos, eBox := *e.GetVec2D(POSITION), *e.GetVec2D(BOX)
+			return RectWithinDistanceOfRect(
+				pos.ShiftedCenterToBottomLeft(box), box,
+				ePos.ShiftedCenterToBottomLeft(eBox), eBox, d)
+		})
+		if !sameEntities(got, expected) {
+			t.Fatalf("[%s] EntitiesWithinDistance found %d, expected %d",
+				kind, len(got), len(expected))
+		}
+
+		got = w.EntitiesOverlappingBox(pos, box)
+		expected = w.FilterAllEntities(func(e *Entity) bool {
+			return RectIntersectsRect(pos, box, *e.GetVec2D(POSITION), *e.GetVec2D(BOX))
+		})
+		if !sameEntities(got, expected) {
+			t.Fatalf("[%s] EntitiesOverlappingBox found %d, expected %d",
+				kind, len(got), len(expected))
+		}
+
+		got = w.EntitiesOverlappingCircle(pos, d)
+		expected = w.FilterAllEntities(func(e *Entity) bool {
+			return RectWithinRadiusOfPoint(*e.GetVec2D(POSITION), *e.GetVec2D(BOX), d, pos)
+		})
+		if !sameEntities(got, expected) {
+			t.Fatalf("[%s] EntitiesOverlappingCircle found %d, expected %d",
+				kind, len(got), len(expected))
+		}
+
+		dir := RandomUnitVec2D()
+		if rand.Float64() < 0.5 {
+			dir.X = -dir.X
+		}
+		hits := w.Raycast(pos, dir, 50, nil)
+		expected = w.FilterAllEntities(func(e *Entity) bool {
+			hit, _, _ := RayIntersectsRect(pos, dir, 50, *e.GetVec2D(POSITION), *e.GetVec2D(BOX))
+			return hit
+		})
+		hitEntities := make([]*Entity, len(hits))
+		for i, hit := range hits {
+			hitEntities[i] = hit.Entity
+			if i > 0 && hits[i-1].Distance > hit.Distance {
+				t.Fatalf("[%s] Raycast hits not ordered by distance", kind)
+			}
+		}
+		if !sameEntities(hitEntities, expected) {
+			t.Fatalf("[%s] Raycast hit %d, expected %d",
+				kind, len(hitEntities), len(expected))
+		}
+		first, ok := w.RaycastFirst(pos, dir, 50, nil)
+		if ok != (len(hits) > 0) || (ok && first.Distance != hits[0].Distance) {
+			t.Fatalf("[%s] RaycastFirst didn't return the closest hit", kind)
+		}
+	}
+}
+
+func TestSpatialIndexQueries(t *testing.T) {
+	for _, kind := range spatialIndexKinds {
+		w := testingSpatialIndexWorld(kind)
+		// NOTE: kept within the world, since the grid only knows about the
+		// parts of entities inside the world
+		for i := 0; i < 300; i++ {
+			testingSpawnSpatial(w,
+				Vec2D{6 + 88*rand.Float64(), 6 + 88*rand.Float64()},
+				Vec2D{1 + 10*rand.Float64(), 1 + 10*rand.Float64()})
+		}
+		// the others (unlike the grid) also track entities outside the world
+		if kind != "grid" {
+			testingSpawnSpatial(w, Vec2D{-5, 50}, Vec2D{4, 4})
+			testingSpawnSpatial(w, Vec2D{50, 120}, Vec2D{10, 10})
+		}
+		w.Update(FRAME_MS / 2)
+		checkSpatialIndexQueries(t, kind, w)
+	}
+}
+
+func TestSpatialIndexIncrementalUpdate(t *testing.T) {
+	for _, kind := range spatialIndexKinds {
+		w := testingSpatialIndexWorld(kind)
+		entities := make([]*Entity, 0)
+		for i := 0; i < 200; i++ {
+			entities = append(entities, testingSpawnSpatial(w,
+				Vec2D{5 + 90*rand.Float64(), 5 + 90*rand.Float64()},
+				Vec2D{5, 5}))
+		}
+		w.Update(FRAME_MS / 2)
+		for round := 0; round < 5; round++ {
+			// move some a little, some a lot, and despawn a few
+			for _, e := range entities {
+				if e.Despawned {
+					continue
+				}
+				pos := e.GetVec2D(POSITION)
+				switch rand.Intn(4) {
+				case 0:
+					pos.Inc(Vec2D{rand.Float64() - 0.5, rand.Float64() - 0.5})
+				case 1:
+					*pos = Vec2D{5 + 90*rand.Float64(), 5 + 90*rand.Float64()}
+				case 2:
+					if rand.Float64() < 0.1 {
+						w.Despawn(e)
+					}
+				}
+			}
+			for i := 0; i < 10; i++ {
+				entities = append(entities, testingSpawnSpatial(w,
+					Vec2D{5 + 90*rand.Float64(), 5 + 90*rand.Float64()},
+					Vec2D{5, 5}))
+			}
+			w.Update(FRAME_MS / 2)
+			checkSpatialIndexQueries(t, kind, w)
+		}
+	}
+}
+
+func TestSpatialIndexAABBTreeBalanced(t *testing.T) {
+	w := testingSpatialIndexWorld("bvh")
+	// insert in a sorted order, the worst case for an unbalanced tree
+	for i := 0; i < 256; i++ {
+		testingSpawnSpatial(w, Vec2D{float64(i%16) * 6, float64(i/16) * 6}, Vec2D{1, 1})
+	}
+	w.Update(FRAME_MS / 2)
+	tree := w.SpatialIndex.(*DynamicAABBTree)
+	if tree.Height() > 16 {
+		t.Fatalf("tree of 256 leaves should be balanced; height %d", tree.Height())
+	}
+}
+
+func TestSpatialIndexQuadTreeMovesOnlyMovedEntities(t *testing.T) {
+	w := testingSpatialIndexWorld("quadtree")
+	a := testingSpawnSpatial(w, Vec2D{10, 10}, Vec2D{1, 1})
+	b := testingSpawnSpatial(w, Vec2D{90, 90}, Vec2D{1, 1})
+	w.Update(FRAME_MS / 2)
+	tree := w.SpatialIndex.(*LooseQuadTree)
+	nodeB := tree.entityNodes[b.ID]
+	if tree.entityNodes[a.ID].depth != tree.MaxDepth {
+		t.Fatal("small entity should be placed at max depth")
+	}
+	*a.GetVec2D(POSITION) = Vec2D{80, 20}
+	w.Update(FRAME_MS / 2)
+	if tree.entityNodes[b.ID] != nodeB {
+		t.Fatal("unmoved entity should stay in its node")
+	}
+	if len(w.EntitiesOverlappingBox(Vec2D{80, 20}, Vec2D{2, 2})) != 1 {
+		t.Fatal("moved entity should be found at its new position")
+	}
+	// a large entity should live near the root
+	big := testingSpawnSpatial(w, Vec2D{50, 50}, Vec2D{60, 60})
+	w.Update(FRAME_MS / 2)
+	if tree.entityNodes[big.ID].depth != 0 {
+		t.Fatal("entity bigger than a quadrant should live in the root")
+	}
+}
+
+func TestSpatialIndexSharedAndRefreshedAfterPhysics(t *testing.T) {
+	for _, kind := range spatialIndexKinds {
+		w := testingSpatialIndexWorld(kind)
+		p := NewPhysicsSystem()
+		c := NewCollisionSystem(FRAME_DURATION / 2)
+		w.RegisterSystems(p, c)
+		e := testingSpawnPhysics(w)
+		*e.GetVec2D(POSITION) = Vec2D{20, 20}
+		*e.GetVec2D(VELOCITY) = Vec2D{1, 0}
+		w.Update(FRAME_MS / 2)
+		// a query after physics has moved the entity should see its new
+		// position without waiting for the next world Update()
+		pos := *e.GetVec2D(POSITION)
+		if pos.X == 20 {
+			t.Fatalf("[%s] physics should have moved the entity", kind)
+		}
+		*e.GetVec2D(POSITION) = Vec2D{60, 60}
+		w.MarkSpatialIndexStale()
+		found := w.EntitiesOverlappingBox(Vec2D{60, 60}, Vec2D{1, 1})
+		if len(found) != 1 || found[0] != e {
+			t.Fatalf("[%s] query after MarkSpatialIndexStale() should see the new position", kind)
+		}
+		if kind == "grid" && w.SpatialHasher != w.SpatialIndex {
+			t.Fatal("grid world should expose its index as SpatialHasher")
+		}
+	}
+}
+
+func TestSpatialIndexUnboundedNegativeCoords(t *testing.T) {
+	for _, kind := range []string{"sparsegrid", "bvh", "quadtree"} {
+		w := NewWorld(map[string]any{
+			"unbounded":    true,
+			"spatialIndex": kind,
+		})
+		for i := 0; i < 300; i++ {
+			testingSpawnSpatial(w,
+				Vec2D{-300 + 600*rand.Float64(), -300 + 600*rand.Float64()},
+				Vec2D{1 + 10*rand.Float64(), 1 + 10*rand.Float64()})
+		}
+		w.Update(FRAME_MS / 2)
+		checkSpatialIndexQueriesIn(t, kind, w, AABB{Vec2D{-300, -300}, Vec2D{300, 300}})
+	}
+}
+
+func TestSpatialIndexSparseGridCells(t *testing.T) {
+	w := NewWorld(map[string]any{
+		"unbounded":          true,
+		"sparseGridCellSize": 10,
+	})
+	h := w.SpatialIndex.(*SparseSpatialHasher)
+	// a box straddling the origin touches the 4 cells around it
+	e := testingSpawnSpatial(w, Vec2D{0, 0}, Vec2D{2, 2})
+	w.Update(FRAME_MS / 2)
+	for _, cell := range [][2]int{{-1, -1}, {-1, 0}, {0, -1}, {0, 0}} {
+		if len(h.Entities(cell[0], cell[1])) != 1 {
+			t.Fatalf("entity should be in cell %v", cell)
+		}
+	}
+	if h.CellOf(Vec2D{-0.5, 5}) != [2]int{-1, 0} {
+		t.Fatal("CellOf should floor negative coordinates")
+	}
+	// cells left empty are dropped
+	*e.GetVec2D(POSITION) = Vec2D{1e6 + 5, -1e6 - 5}
+	w.Update(FRAME_MS / 2)
+	if len(h.Cells) != 1 {
+		t.Fatalf("expected only the entity's new cell to remain, got %d cells", len(h.Cells))
+	}
+	// a ray of infinite length terminates and finds it
+	hit, ok := w.RaycastFirst(Vec2D{1e6 + 5, 0}, Vec2D{0, -1}, math.Inf(1), nil)
+	if !ok || hit.Entity != e {
+		t.Fatal("infinite ray should find the far entity")
+	}
+}
+
+func TestSpatialIndexCellsQueriesNeedGrid(t *testing.T) {
+	for _, kind := range spatialIndexKinds {
+		w := testingSpatialIndexWorld(kind)
+		func() {
+			defer func() {
+				r := recover()
+				if kind == "grid" && r != nil {
+					t.Fatalf("grid world shouldn't have panicked: %v", r)
+				}
+				if kind != "grid" && (r == nil || !strings.Contains(r.(string), kind)) {
+					t.Fatalf("%s world should have panicked naming its index, got %v", kind, r)
+				}
+			}()
+			cells := w.CellsWithinDistance(Vec2D{50, 50}, Vec2D{1, 1}, 5)
+			if len(cells) == 0 {
+				t.Fatal("should have found some cells")
+			}
+		}()
+	}
+}
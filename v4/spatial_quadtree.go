@@ -0,0 +1,318 @@
+package sameriver
+
+// LooseQuadTree is a SpatialIndex which recursively divides the world into
+// quadrants, but only as deep as the entities in a region require. Each node
+// has "loose" bounds extending half its size past its own bounds on each side,
+// so an entity can be stored in the deepest node whose size is at least as
+// big as the entity's box and which contains the entity's center. This means
+// each entity lives in exactly one node (no duplication across cells as
+// in the grid), and an entity only needs to move to another node when its
+// center crosses a node boundary or its box changes size.
+//
+// Entities whose center lies outside the world are kept in the root.
+type LooseQuadTree struct {
+	// SpatialEntities is an UpdatedEntityList of entities who have position
+	// and hitbox components
+	SpatialEntities *UpdatedEntityList
+	Width           float64
+	Height          float64
+	MaxDepth        int
+	root            *quadTreeNode
+	// the node each entity (by ID) is currently stored in (nil if none) and
+	// the AABB it had when it was last placed
+	entityNodes []*quadTreeNode
+	entityAABBs []AABB
+}
+
+type quadTreeNode struct {
+	bounds   AABB
+	loose    AABB
+	depth    int
+	entities []*Entity
+	children [4]*quadTreeNode
+}
+
+func NewLooseQuadTree(maxDepth int, w *World) *LooseQuadTree {
+	t := &LooseQuadTree{
+		Width:       w.Width,
+		Height:      w.Height,
+		MaxDepth:    maxDepth,
+		entityNodes: make([]*quadTreeNode, w.MaxEntities()),
+		entityAABBs: make([]AABB, w.MaxEntities()),
+	}
+	t.root = newQuadTreeNode(AABB{Vec2D{0, 0}, Vec2D{w.Width, w.Height}}, 0)
+	t.SpatialEntities = spatialEntitiesList(w)
+	// when an entity leaves the list (despawn / deactivate), take it out of
+	// the tree
+	t.SpatialEntities.AddCallback(func(signal EntitySignal) {
+		if signal.SignalType == ENTITY_REMOVE {
+			t.remove(signal.Entity)
+		}
+	})
+	return t
+}
+
+func newQuadTreeNode(bounds AABB, depth int) *quadTreeNode {
+	size := bounds.Size()
+	return &quadTreeNode{
+		bounds:   bounds,
+		loose:    AABB{bounds.Min.Sub(size.Scale(0.5)), bounds.Max.Add(size.Scale(0.5))},
+		depth:    depth,
+		entities: make([]*Entity, 0),
+	}
+}
+
+// child gets (creating if needed) the child quadrant containing point p
+func (n *quadTreeNode) child(p Vec2D) *quadTreeNode {
+	center := n.bounds.Center()
+	ix := 0
+	min := n.bounds.Min
+	max := center
+	if p.X >= center.X {
+		ix |= 1
+		min.X, max.X = center.X, n.bounds.Max.X
+	}
+	if p.Y >= center.Y {
+		ix |= 2
+		min.Y, max.Y = center.Y, n.bounds.Max.Y
+	}
+	if n.children[ix] == nil {
+		n.children[ix] = newQuadTreeNode(AABB{min, max}, n.depth+1)
+	}
+	return n.children[ix]
+}
+
+func (n *quadTreeNode) remove(e *Entity) {
+	for i, x := range n.entities {
+		if x == e {
+			last := len(n.entities) - 1
+			n.entities[i] = n.entities[last]
+			n.entities[last] = nil
+			n.entities = n.entities[:last]
+			return
+		}
+	}
+}
+
+// nodeFor finds the node an entity with the given AABB belongs in
+func (t *LooseQuadTree) nodeFor(aabb AABB) *quadTreeNode {
+	center := aabb.Center()
+	size := aabb.Size()
+	if !(AABB{center, center}).Overlaps(t.root.bounds) {
+		return t.root
+	}
+	n := t.root
+	for n.depth < t.MaxDepth {
+		childSize := n.bounds.Size().Scale(0.5)
+		if size.X > childSize.X || size.Y > childSize.Y {
+			break
+		}
+		n = n.child(center)
+	}
+	return n
+}
+
+func (t *LooseQuadTree) remove(e *Entity) {
+	if n := t.entityNodes[e.ID]; n != nil {
+		n.remove(e)
+		t.entityNodes[e.ID] = nil
+	}
+}
+
+// Update moves those entities whose box has changed since the last Update
+// to the node they now belong in
+func (t *LooseQuadTree) Update() {
+	for _, e := range t.SpatialEntities.entities {
+		aabb := entityAABB(e)
+		node := t.entityNodes[e.ID]
+		if node != nil && t.entityAABBs[e.ID] == aabb {
+			continue
+		}
+		target := t.nodeFor(aabb)
+		if target != node {
+			if node != nil {
+				node.remove(e)
+			}
+			target.entities = append(target.entities, e)
+			t.entityNodes[e.ID] = target
+		}
+		t.entityAABBs[e.ID] = aabb
+	}
+}
+
+// query calls visit for each entity whose AABB overlaps q
+func (t *LooseQuadTree) query(q AABB, visit func(e *Entity)) {
+	var walk func(n *quadTreeNode)
+	walk = func(n *quadTreeNode) {
+		for _, e := range n.entities {
+			if t.entityAABBs[e.ID].Overlaps(q) {
+				visit(e)
+			}
+		}
+		for _, c := range n.children {
+			if c != nil && c.loose.Overlaps(q) {
+				walk(c)
+			}
+		}
+	}
+	walk(t.root)
+}
+
+func (t *LooseQuadTree) EntitiesWithinDistanceApprox(pos, box Vec2D, d float64) []*Entity {
+	return t.EntitiesWithinDistanceApproxFilter(pos, box, d,
+		func(e *Entity) bool { return true })
+}
+
+// EntitiesWithinDistanceApproxFilter returns the entities whose box overlaps
+// the query box extended d on each side (overestimates diagonally)
+func (t *LooseQuadTree) EntitiesWithinDistanceApproxFilter(
+	pos, box Vec2D, d float64, predicate func(*Entity) bool) []*Entity {
+	results := make([]*Entity, 0)
+	t.query(distanceQueryAABB(pos, box, d), func(e *Entity) {
+		if predicate(e) {
+			results = append(results, e)
+		}
+	})
+	return results
+}
+
+func (t *LooseQuadTree) EntitiesWithinDistance(pos, box Vec2D, d float64) []*Entity {
+	return t.EntitiesWithinDistanceFilter(pos, box, d,
+		func(e *Entity) bool { return true })
+}
+
+func (t *LooseQuadTree) EntitiesWithinDistanceFilter(
+	pos, box Vec2D, d float64, predicate func(*Entity) bool) []*Entity {
+	candidates := t.EntitiesWithinDistanceApprox(pos, box, d)
+	return filterWithinDistance(candidates, pos, box, d, predicate)
+}
+
+func (t *LooseQuadTree) EntitiesOverlappingBox(pos, box Vec2D) []*Entity {
+	return t.EntitiesOverlappingBoxFilter(pos, box,
+		func(e *Entity) bool { return true })
+}
+
+func (t *LooseQuadTree) EntitiesOverlappingBoxFilter(
+	pos, box Vec2D, predicate func(*Entity) bool) []*Entity {
+	results := make([]*Entity, 0)
+	t.query(AABBOfRect(pos, box), func(e *Entity) {
+		if predicate(e) &&
+			RectIntersectsRect(pos, box, *e.GetVec2D(POSITION), *e.GetVec2D(BOX)) {
+			results = append(results, e)
+		}
+	})
+	return results
+}
+
+func (t *LooseQuadTree) EntitiesOverlappingCircle(center Vec2D, radius float64) []*Entity {
+	return t.EntitiesOverlappingCircleFilter(center, radius,
+		func(e *Entity) bool { return true })
+}
+
+func (t *LooseQuadTree) EntitiesOverlappingCircleFilter(
+	center Vec2D, radius float64, predicate func(*Entity) bool) []*Entity {
+	results := make([]*Entity, 0)
+	t.query(distanceQueryAABB(center, Vec2D{0, 0}, radius), func(e *Entity) {
+		if predicate(e) &&
+			RectWithinRadiusOfPoint(*e.GetVec2D(POSITION), *e.GetVec2D(BOX), radius, center) {
+			results = append(results, e)
+		}
+	})
+	return results
+}
+
+// raycast visits the nodes whose loose bounds the ray passes through within
+// maxDist, skipping any node whose entry point is farther than cutoff()
+func (t *LooseQuadTree) raycast(
+	origin, dir Vec2D, maxDist float64,
+	cutoff func() float64, visit func(e *Entity)) {
+	var walk func(n *quadTreeNode)
+	walk = func(n *quadTreeNode) {
+		for _, e := range n.entities {
+			visit(e)
+		}
+		for _, c := range n.children {
+			if c == nil {
+				continue
+			}
+			if hit, tEntry := c.loose.RayHit(origin, dir, maxDist); hit && tEntry <= cutoff() {
+				walk(c)
+			}
+		}
+	}
+	if hit, tEntry := t.root.loose.RayHit(origin, dir, maxDist); hit && tEntry <= cutoff() {
+		walk(t.root)
+	} else {
+		// out-of-world entities live in the root
+		for _, e := range t.root.entities {
+			visit(e)
+		}
+	}
+}
+
+func (t *LooseQuadTree) Raycast(
+	origin, dir Vec2D, maxDist float64, filter func(*Entity) bool) []RaycastHit {
+	hits := make([]RaycastHit, 0)
+	if dir.Magnitude() == 0 {
+		return hits
+	}
+	dir = dir.Unit()
+	t.raycast(origin, dir, maxDist,
+		func() float64 { return maxDist },
+		func(e *Entity) {
+			if hit, ok := rayTestEntity(origin, dir, maxDist, e, filter); ok {
+				hits = append(hits, hit)
+			}
+		})
+	sortRaycastHits(hits)
+	return hits
+}
+
+func (t *LooseQuadTree) RaycastFirst(
+	origin, dir Vec2D, maxDist float64, filter func(*Entity) bool) (RaycastHit, bool) {
+	var closest RaycastHit
+	found := false
+	if dir.Magnitude() == 0 {
+		return closest, false
+	}
+	dir = dir.Unit()
+	t.raycast(origin, dir, maxDist,
+		func() float64 {
+			if found {
+				return closest.Distance
+			}
+			return maxDist
+		},
+		func(e *Entity) {
+			hit, ok := rayTestEntity(origin, dir, maxDist, e, filter)
+			if ok && (!found || hit.Distance < closest.Distance) {
+				closest = hit
+				found = true
+			}
+		})
+	return closest, found
+}
+
+func (t *LooseQuadTree) SegmentCast(from, to Vec2D, filter func(*Entity) bool) []RaycastHit {
+	_, _, d := from.Distance(to)
+	return t.Raycast(from, to.Sub(from), d, filter)
+}
+
+// CandidatePairs visits each pair of entities whose boxes overlap
+func (t *LooseQuadTree) CandidatePairs(visit func(i, j *Entity)) {
+	for _, e := range t.SpatialEntities.entities {
+		if t.entityNodes[e.ID] == nil {
+			continue
+		}
+		t.query(t.entityAABBs[e.ID], func(other *Entity) {
+			if other.ID > e.ID {
+				visit(e, other)
+			}
+		})
+	}
+}
+
+func (t *LooseQuadTree) Expand(n int) {
+	t.entityNodes = append(t.entityNodes, make([]*quadTreeNode, n)...)
+	t.entityAABBs = append(t.entityAABBs, make([]AABB, n)...)
+}
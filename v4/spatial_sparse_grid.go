@@ -0,0 +1,233 @@
+package sameriver
+
+import (
+	"math"
+)
+
+// SparseSpatialHasher is a uniform grid like SpatialHasher, but its cells
+// are stored in a map keyed by cell coordinate and only exist while some
+// entity touches them, so it isn't limited to the world's Width x Height
+// and handles negative coordinates. Used for unbounded worlds.
+type SparseSpatialHasher struct {
+	// SpatialEntities is an UpdatedEntityList of entities who have position
+	// and hitbox components
+	SpatialEntities *UpdatedEntityList
+	CellSize        float64
+	Cells           map[[2]int][]*Entity
+	// the range of cells occupied as of the last Update() (used to bound
+	// raycasts); minCell > maxCell if there are none
+	minCell [2]int
+	maxCell [2]int
+}
+
+func NewSparseSpatialHasher(cellSize float64, w *World) *SparseSpatialHasher {
+	h := &SparseSpatialHasher{
+		CellSize: cellSize,
+		Cells:    make(map[[2]int][]*Entity),
+		minCell:  [2]int{0, 0},
+		maxCell:  [2]int{-1, -1},
+	}
+	h.SpatialEntities = spatialEntitiesList(w)
+	return h
+}
+
+func (h *SparseSpatialHasher) cellSize() Vec2D {
+	return Vec2D{h.CellSize, h.CellSize}
+}
+
+// CellOf gives the coordinate of the cell containing p
+func (h *SparseSpatialHasher) CellOf(p Vec2D) [2]int {
+	return [2]int{
+		int(math.Floor(p.X / h.CellSize)),
+		int(math.Floor(p.Y / h.CellSize)),
+	}
+}
+
+// CellRangeOfRect gives the range of cells touched by the rect with
+// bottom-left pos and size box
+func (h *SparseSpatialHasher) CellRangeOfRect(pos, box Vec2D) (cellX0, cellX1, cellY0, cellY1 int) {
+	return cellRangeOfRect(pos, box, h.cellSize())
+}
+
+func (h *SparseSpatialHasher) Entities(x, y int) []*Entity {
+	return h.Cells[[2]int{x, y}]
+}
+
+func (h *SparseSpatialHasher) Update() {
+	// NOTE: like SpatialHasher.clearTable(), we keep the capacity of cells
+	// which are reused, but cells left empty are deleted below so that
+	// entities wandering an infinite world don't leave a trail of them
+	for k, cell := range h.Cells {
+		h.Cells[k] = cell[:0]
+	}
+	h.minCell = [2]int{math.MaxInt, math.MaxInt}
+	h.maxCell = [2]int{math.MinInt, math.MinInt}
+	for _, e := range h.SpatialEntities.entities {
+		pos := e.GetVec2D(POSITION)
+		box := e.GetVec2D(BOX)
+		cellX0, cellX1, cellY0, cellY1 := h.CellRangeOfRect(pos.ShiftedCenterToBottomLeft(*box), *box)
+		for x := cellX0; x <= cellX1; x++ {
+			for y := cellY0; y <= cellY1; y++ {
+				k := [2]int{x, y}
+				h.Cells[k] = append(h.Cells[k], e)
+			}
+		}
+		h.minCell = [2]int{mini(h.minCell[0], cellX0), mini(h.minCell[1], cellY0)}
+		h.maxCell = [2]int{maxi(h.maxCell[0], cellX1), maxi(h.maxCell[1], cellY1)}
+	}
+	for k, cell := range h.Cells {
+		if len(cell) == 0 {
+			delete(h.Cells, k)
+		}
+	}
+}
+
+// visitCells calls visit for each occupied cell in the given range. If the
+// range is larger than the number of occupied cells, we iterate the
+// occupied cells instead, so that huge queries stay cheap
+func (h *SparseSpatialHasher) visitCells(
+	cellX0, cellX1, cellY0, cellY1 int, visit func(cell []*Entity)) {
+	area := (cellX1 - cellX0 + 1) * (cellY1 - cellY0 + 1)
+	if area <= 0 || area > len(h.Cells) {
+		for k, cell := range h.Cells {
+			if k[0] >= cellX0 && k[0] <= cellX1 && k[1] >= cellY0 && k[1] <= cellY1 {
+				visit(cell)
+			}
+		}
+		return
+	}
+	for x := cellX0; x <= cellX1; x++ {
+		for y := cellY0; y <= cellY1; y++ {
+			if cell, ok := h.Cells[[2]int{x, y}]; ok {
+				visit(cell)
+			}
+		}
+	}
+}
+
+func (h *SparseSpatialHasher) EntitiesWithinDistanceApprox(
+	pos, box Vec2D, d float64) []*Entity {
+	return h.EntitiesWithinDistanceApproxFilter(pos, box, d,
+		func(e *Entity) bool { return true })
+}
+
+// EntitiesWithinDistanceApproxFilter returns the entities in the cells
+// touched by the box extended d on each side (overestimates)
+func (h *SparseSpatialHasher) EntitiesWithinDistanceApproxFilter(
+	pos, box Vec2D, d float64, predicate func(*Entity) bool) []*Entity {
+	results := make([]*Entity, 0)
+	found := make(map[int]bool)
+	approximatorPos := pos.ShiftedCenterToBottomLeft(box).Sub(Vec2D{d, d})
+	approximatorBox := Vec2D{2*d + box.X, 2*d + box.Y}
+	cellX0, cellX1, cellY0, cellY1 := h.CellRangeOfRect(approximatorPos, approximatorBox)
+	h.visitCells(cellX0, cellX1, cellY0, cellY1, func(cell []*Entity) {
+		for _, e := range cell {
+			if !found[e.ID] {
+				found[e.ID] = true
+				if predicate(e) {
+					results = append(results, e)
+				}
+			}
+		}
+	})
+	return results
+}
+
+// NOTE: can return inactive entities
+func (h *SparseSpatialHasher) EntitiesWithinDistance(pos, box Vec2D, d float64) []*Entity {
+	return h.EntitiesWithinDistanceFilter(pos, box, d,
+		func(e *Entity) bool { return true })
+}
+
+// NOTE: can return inactive entities
+func (h *SparseSpatialHasher) EntitiesWithinDistanceFilter(
+	pos, box Vec2D, d float64, predicate func(*Entity) bool) []*Entity {
+	candidates := h.EntitiesWithinDistanceApprox(pos, box, d)
+	return filterWithinDistance(candidates, pos, box, d, predicate)
+}
+
+// NOTE: can return inactive entities
+func (h *SparseSpatialHasher) EntitiesOverlappingBox(pos, box Vec2D) []*Entity {
+	return h.EntitiesOverlappingBoxFilter(pos, box,
+		func(e *Entity) bool { return true })
+}
+
+// NOTE: can return inactive entities
+func (h *SparseSpatialHasher) EntitiesOverlappingBoxFilter(
+	pos, box Vec2D, predicate func(*Entity) bool) []*Entity {
+	candidates := h.EntitiesWithinDistanceApproxFilter(pos, box, 0, predicate)
+	results := make([]*Entity, 0)
+	for _, e := range candidates {
+		if RectIntersectsRect(pos, box, *e.GetVec2D(POSITION), *e.GetVec2D(BOX)) {
+			results = append(results, e)
+		}
+	}
+	return results
+}
+
+// NOTE: can return inactive entities
+func (h *SparseSpatialHasher) EntitiesOverlappingCircle(center Vec2D, radius float64) []*Entity {
+	return h.EntitiesOverlappingCircleFilter(center, radius,
+		func(e *Entity) bool { return true })
+}
+
+// NOTE: can return inactive entities
+func (h *SparseSpatialHasher) EntitiesOverlappingCircleFilter(
+	center Vec2D, radius float64, predicate func(*Entity) bool) []*Entity {
+	candidates := h.EntitiesWithinDistanceApproxFilter(center, Vec2D{0, 0}, radius, predicate)
+	results := make([]*Entity, 0)
+	for _, e := range candidates {
+		if RectWithinRadiusOfPoint(*e.GetVec2D(POSITION), *e.GetVec2D(BOX), radius, center) {
+			results = append(results, e)
+		}
+	}
+	return results
+}
+
+// walkRay walks the cells along the ray, limited to the range of occupied
+// cells (so that rays with infinite maxDist terminate)
+func (h *SparseSpatialHasher) walkRay(
+	origin, dir Vec2D, maxDist float64, visit func(x, y int, tEntry float64) bool) {
+	if h.minCell[0] > h.maxCell[0] {
+		return
+	}
+	walkCellsAlongRay(origin, dir, maxDist, h.cellSize(), h.minCell, h.maxCell, visit)
+}
+
+// NOTE: can return inactive entities
+func (h *SparseSpatialHasher) Raycast(
+	origin, dir Vec2D, maxDist float64, filter func(*Entity) bool) []RaycastHit {
+	return raycastCells(h.walkRay, h.Entities, origin, dir, maxDist, filter)
+}
+
+// NOTE: can return inactive entities
+func (h *SparseSpatialHasher) RaycastFirst(
+	origin, dir Vec2D, maxDist float64, filter func(*Entity) bool) (RaycastHit, bool) {
+	return raycastFirstCells(h.walkRay, h.Entities, origin, dir, maxDist, filter)
+}
+
+// NOTE: can return inactive entities
+func (h *SparseSpatialHasher) SegmentCast(from, to Vec2D, filter func(*Entity) bool) []RaycastHit {
+	_, _, d := from.Distance(to)
+	return h.Raycast(from, to.Sub(from), d, filter)
+}
+
+// CandidatePairs visits each pair of entities sharing a cell (pairs which
+// share more than one cell will be visited once per cell)
+func (h *SparseSpatialHasher) CandidatePairs(visit func(i, j *Entity)) {
+	for _, entities := range h.Cells {
+		for ix := 0; ix < len(entities); ix++ {
+			for jx := ix + 1; jx < len(entities); jx++ {
+				i, j := entities[ix], entities[jx]
+				if j.ID < i.ID {
+					i, j = j, i
+				}
+				visit(i, j)
+			}
+		}
+	}
+}
+
+func (h *SparseSpatialHasher) Expand(n int) {
+	// nil; cells are slices in a map and grow as needed
+}
@@ -0,0 +1,466 @@
+package sameriver
+
+import (
+	"math"
+	"math/rand"
+)
+
+// SteeringBehaviours is the STEERING_BEHAVIOURS component: a list of
+// weighted behaviours whose forces SteeringSystem combines each update.
+//
+// The forces are combined as a prioritized running sum: each behaviour's
+// weighted force is added in order until MaxForce is used up, so list the
+// most important behaviours (eg. ObstacleAvoidance, Separation) first and
+// they won't be drowned out by the others.
+//
+// NOTE: some behaviours (Wander, FollowPath) keep per-entity state, so give
+// each entity its own instances rather than sharing them.
+type SteeringBehaviours struct {
+	// the max magnitude of the combined steering force (if 0, the
+	// SteeringSystem's MaxSteerForce is used)
+	MaxForce   float64
+	Behaviours []WeightedSteeringBehaviour
+}
+
+type WeightedSteeringBehaviour struct {
+	Weight    float64
+	Behaviour SteeringBehaviour
+}
+
+// SteeringBehaviour computes a steering force for an entity (usually the
+// difference between a desired velocity and its current velocity)
+type SteeringBehaviour interface {
+	Steer(s *SteeringSystem, e *Entity) Vec2D
+}
+
+func NewSteeringBehaviours(maxForce float64) *SteeringBehaviours {
+	return &SteeringBehaviours{
+		MaxForce:   maxForce,
+		Behaviours: make([]WeightedSteeringBehaviour, 0),
+	}
+}
+
+// Add appends a behaviour with the given weight, returning the receiver so
+// calls can be chained
+func (sb *SteeringBehaviours) Add(weight float64, b SteeringBehaviour) *SteeringBehaviours {
+	sb.Behaviours = append(sb.Behaviours, WeightedSteeringBehaviour{weight, b})
+	return sb
+}
+
+// Remove removes all instances of a behaviour
+func (sb *SteeringBehaviours) Remove(b SteeringBehaviour) {
+	kept := sb.Behaviours[:0]
+	for _, wb := range sb.Behaviours {
+		if wb.Behaviour != b {
+			kept = append(kept, wb)
+		}
+	}
+	sb.Behaviours = kept
+}
+
+// combine computes the prioritized running sum of the behaviours' forces,
+// after that of lead (with weight 1) if it's non-nil. sb may be nil.
+func (sb *SteeringBehaviours) combine(
+	s *SteeringSystem, e *Entity, maxForce float64, lead SteeringBehaviour) Vec2D {
+	total := Vec2D{0, 0}
+	remaining := maxForce
+	// adds force to the total, returning false once maxForce is used up
+	accumulate := func(force Vec2D) bool {
+		magnitude := force.Magnitude()
+		if magnitude == 0 {
+			return true
+		}
+		if magnitude >= remaining {
+			total = total.Add(force.Unit().Scale(remaining))
+			return false
+		}
+		total = total.Add(force)
+		remaining -= magnitude
+		return true
+	}
+	if lead != nil && !accumulate(lead.Steer(s, e)) {
+		return total
+	}
+	if sb == nil {
+		return total
+	}
+	for _, wb := range sb.Behaviours {
+		if !accumulate(wb.Behaviour.Steer(s, e).Scale(wb.Weight)) {
+			break
+		}
+	}
+	return total
+}
+
+// seekForce steers toward a point at full speed
+func seekForce(s *SteeringSystem, e *Entity, target Vec2D) Vec2D {
+	desired := target.Sub(*e.GetVec2D(POSITION))
+	if desired.Magnitude() == 0 {
+		return Vec2D{0, 0}
+	}
+	desired = desired.Unit().Scale(s.maxSpeed(e))
+	return desired.Sub(*e.GetVec2D(VELOCITY))
+}
+
+// arriveForce steers toward a point, slowing linearly within slowingRadius
+func arriveForce(s *SteeringSystem, e *Entity, target Vec2D, slowingRadius float64) Vec2D {
+	desired := target.Sub(*e.GetVec2D(POSITION))
+	distance := desired.Magnitude()
+	if distance == 0 {
+		return e.GetVec2D(VELOCITY).Scale(-1)
+	}
+	speed := s.maxSpeed(e)
+	if distance <= slowingRadius {
+		speed *= distance / slowingRadius
+	}
+	desired = desired.Unit().Scale(speed)
+	return desired.Sub(*e.GetVec2D(VELOCITY))
+}
+
+// fleeForce steers directly away from a point at full speed, if within
+// panicDistance of it (or always, if panicDistance is 0)
+func fleeForce(s *SteeringSystem, e *Entity, from Vec2D, panicDistance float64) Vec2D {
+	desired := e.GetVec2D(POSITION).Sub(from)
+	distance := desired.Magnitude()
+	if panicDistance > 0 && distance > panicDistance {
+		return Vec2D{0, 0}
+	}
+	if distance == 0 {
+		desired = RandomUnitVec2D()
+	}
+	desired = desired.Unit().Scale(s.maxSpeed(e))
+	return desired.Sub(*e.GetVec2D(VELOCITY))
+}
+
+// predictPosition guesses where target will be by the time e could reach it
+// at its max speed
+func predictPosition(s *SteeringSystem, e *Entity, target *Entity) Vec2D {
+	targetPos := *target.GetVec2D(POSITION)
+	if !target.HasComponent(VELOCITY) {
+		return targetPos
+	}
+	_, _, d := e.GetVec2D(POSITION).Distance(targetPos)
+	speed := s.maxSpeed(e)
+	if speed == 0 {
+		return targetPos
+	}
+	lookAhead := d / speed
+	return targetPos.Add(target.GetVec2D(VELOCITY).Scale(lookAhead))
+}
+
+// Seek steers toward the entity's MOVEMENTTARGET at full speed
+type Seek struct{}
+
+func (b *Seek) Steer(s *SteeringSystem, e *Entity) Vec2D {
+	return seekForce(s, e, *e.GetVec2D(MOVEMENTTARGET))
+}
+
+// Arrive steers toward the entity's MOVEMENTTARGET, slowing to a stop
+// within SlowingRadius (if 0, the SteeringSystem's SlowingRadius)
+type Arrive struct {
+	SlowingRadius float64
+}
+
+func (b *Arrive) Steer(s *SteeringSystem, e *Entity) Vec2D {
+	radius := b.SlowingRadius
+	if radius == 0 {
+		radius = s.SlowingRadius
+	}
+	return arriveForce(s, e, *e.GetVec2D(MOVEMENTTARGET), radius)
+}
+
+// Flee steers away from From while within PanicDistance of it (0 for any
+// distance)
+type Flee struct {
+	From          Vec2D
+	PanicDistance float64
+}
+
+func (b *Flee) Steer(s *SteeringSystem, e *Entity) Vec2D {
+	return fleeForce(s, e, b.From, b.PanicDistance)
+}
+
+// Pursue seeks where Target is predicted to be
+type Pursue struct {
+	Target *Entity
+}
+
+func (b *Pursue) Steer(s *SteeringSystem, e *Entity) Vec2D {
+	if b.Target == nil || b.Target.Despawned {
+		return Vec2D{0, 0}
+	}
+	return seekForce(s, e, predictPosition(s, e, b.Target))
+}
+
+// Evade flees from where Target is predicted to be, while within
+// PanicDistance of it (0 for any distance)
+type Evade struct {
+	Target        *Entity
+	PanicDistance float64
+}
+
+func (b *Evade) Steer(s *SteeringSystem, e *Entity) Vec2D {
+	if b.Target == nil || b.Target.Despawned {
+		return Vec2D{0, 0}
+	}
+	_, _, d := e.GetVec2D(POSITION).Distance(*b.Target.GetVec2D(POSITION))
+	if b.PanicDistance > 0 && d > b.PanicDistance {
+		return Vec2D{0, 0}
+	}
+	return fleeForce(s, e, predictPosition(s, e, b.Target), 0)
+}
+
+// Wander steers toward a point moving randomly around a circle of Radius
+// projected Distance ahead of the entity, by at most Jitter each update
+type Wander struct {
+	Radius   float64
+	Distance float64
+	Jitter   float64
+	// the point on the circle, relative to its center
+	target Vec2D
+}
+
+func (b *Wander) Steer(s *SteeringSystem, e *Entity) Vec2D {
+	if b.target.Magnitude() == 0 {
+		b.target = RandomUnitVec2D().Scale(b.Radius)
+	}
+	jitter := Vec2D{
+		(rand.Float64()*2 - 1) * b.Jitter,
+		(rand.Float64()*2 - 1) * b.Jitter,
+	}
+	b.target = b.target.Add(jitter)
+	if b.target.Magnitude() == 0 {
+		b.target = RandomUnitVec2D()
+	}
+	b.target = b.target.Unit().Scale(b.Radius)
+	heading := s.heading(e)
+	center := e.GetVec2D(POSITION).Add(heading.Scale(b.Distance))
+	return seekForce(s, e, center.Add(b.target))
+}
+
+// ObstacleAvoidance casts a ray LookAhead units ahead along the entity's
+// heading (scaled by its speed relative to max), and steers away from
+// whatever it hits first: entities in the world's spatial index (which
+// must have BOX) and solid tiles of the world's TileMap
+type ObstacleAvoidance struct {
+	LookAhead float64
+	// optional; only avoid entities for which this is true
+	Filter func(*Entity) bool
+}
+
+func (b *ObstacleAvoidance) Steer(s *SteeringSystem, e *Entity) Vec2D {
+	vel := *e.GetVec2D(VELOCITY)
+	speed := vel.Magnitude()
+	maxSpeed := s.maxSpeed(e)
+	if speed == 0 || maxSpeed == 0 {
+		return Vec2D{0, 0}
+	}
+	pos := *e.GetVec2D(POSITION)
+	heading := vel.Unit()
+	length := b.LookAhead * math.Min(1, speed/maxSpeed)
+	if e.HasComponent(BOX) {
+		box := *e.GetVec2D(BOX)
+		length += math.Max(box.X, box.Y) / 2
+	}
+	found := false
+	var dist float64
+	var normal, obstacle Vec2D
+	hit, ok := s.w.RaycastFirst(pos, heading, length, func(o *Entity) bool {
+		return o != e && (b.Filter == nil || b.Filter(o))
+	})
+	if ok {
+		found = true
+		dist, normal, obstacle = hit.Distance, hit.Normal, *hit.Entity.GetVec2D(POSITION)
+	}
+	if s.w.TileMap != nil {
+		if tHit, t, tNormal, tx, ty := s.w.TileMap.RaycastSolid(pos, heading, length); tHit && (!found || t < dist) {
+			found = true
+			dist, normal, obstacle = t, tNormal, s.w.TileMap.TileCenter(tx, ty)
+		}
+	}
+	if !found {
+		return Vec2D{0, 0}
+	}
+	// push sideways, away from the obstacle's center, harder the closer it
+	// is, and brake
+	lateral := heading.PerpendicularUnit()
+	if obstacle.Sub(pos).Dot(lateral) > 0 {
+		lateral = lateral.Scale(-1)
+	}
+	urgency := 1 - dist/length
+	force := lateral.Scale(maxSpeed * urgency)
+	if normal.Magnitude() != 0 {
+		force = force.Add(normal.Scale(maxSpeed * urgency))
+	}
+	return force.Sub(heading.Scale(speed * urgency))
+}
+
+// flockNeighbours finds the other steering entities within radius of e
+// (which must have BOX to be found by the spatial index), optionally
+// limited to those having Tag
+func flockNeighbours(s *SteeringSystem, e *Entity, radius float64, tag string) []*Entity {
+	return s.w.EntitiesWithinDistanceFilter(*e.GetVec2D(POSITION), Vec2D{0, 0}, radius,
+		func(o *Entity) bool {
+			return o != e && o.Active && o.HasComponent(VELOCITY) &&
+				(tag == "" || o.HasTag(tag))
+		})
+}
+
+// Separation steers away from neighbours within Radius, more strongly the
+// closer they are
+type Separation struct {
+	Radius float64
+	Tag    string
+}
+
+func (b *Separation) Steer(s *SteeringSystem, e *Entity) Vec2D {
+	pos := *e.GetVec2D(POSITION)
+	force := Vec2D{0, 0}
+	for _, o := range flockNeighbours(s, e, b.Radius, b.Tag) {
+		away := pos.Sub(*o.GetVec2D(POSITION))
+		d := away.Magnitude()
+		if d == 0 {
+			away, d = RandomUnitVec2D(), 1
+		}
+		// inverse to the distance
+		force = force.Add(away.Unit().Scale(s.maxSpeed(e) / d))
+	}
+	return force
+}
+
+// Alignment steers to match the average heading of neighbours within Radius
+type Alignment struct {
+	Radius float64
+	Tag    string
+}
+
+func (b *Alignment) Steer(s *SteeringSystem, e *Entity) Vec2D {
+	neighbours := flockNeighbours(s, e, b.Radius, b.Tag)
+	if len(neighbours) == 0 {
+		return Vec2D{0, 0}
+	}
+	avg := Vec2D{0, 0}
+	for _, o := range neighbours {
+		avg = avg.Add(*o.GetVec2D(VELOCITY))
+	}
+	if avg.Magnitude() == 0 {
+		return Vec2D{0, 0}
+	}
+	desired := avg.Unit().Scale(s.maxSpeed(e))
+	return desired.Sub(*e.GetVec2D(VELOCITY))
+}
+
+// Cohesion steers toward the center of neighbours within Radius
+type Cohesion struct {
+	Radius float64
+	Tag    string
+}
+
+func (b *Cohesion) Steer(s *SteeringSystem, e *Entity) Vec2D {
+	neighbours := flockNeighbours(s, e, b.Radius, b.Tag)
+	if len(neighbours) == 0 {
+		return Vec2D{0, 0}
+	}
+	center := Vec2D{0, 0}
+	for _, o := range neighbours {
+		center = center.Add(*o.GetVec2D(POSITION))
+	}
+	center = center.Scale(1 / float64(len(neighbours)))
+	return seekForce(s, e, center)
+}
+
+// FollowPath seeks each point of Path in turn, moving on to the next once
+// within WaypointRadius of the current one, and arrives at the last (or
+// loops back to the first if Loop)
+type FollowPath struct {
+	Path           []Vec2D
+	WaypointRadius float64
+	Loop           bool
+	// the index of the point we're heading to
+	Current int
+	done    bool
+}
+
+func NewFollowPath(path []Vec2D, waypointRadius float64) *FollowPath {
+	return &FollowPath{Path: path, WaypointRadius: waypointRadius}
+}
+
+// SetPath starts following a new path from its beginning
+func (b *FollowPath) SetPath(path []Vec2D) {
+	b.Path = path
+	b.Current = 0
+	b.done = false
+}
+
+// Done is whether we've come within WaypointRadius of the last point
+// (never, if looping)
+func (b *FollowPath) Done() bool {
+	return b.done
+}
+
+func (b *FollowPath) Steer(s *SteeringSystem, e *Entity) Vec2D {
+	if len(b.Path) == 0 {
+		return Vec2D{0, 0}
+	}
+	pos := *e.GetVec2D(POSITION)
+	last := len(b.Path) - 1
+	// advance past the waypoints we've reached (at most once around, in
+	// case every point of a loop is within the radius)
+	for i := 0; i < len(b.Path); i++ {
+		_, _, d := pos.Distance(b.Path[b.Current])
+		if d > b.WaypointRadius {
+			break
+		}
+		if b.Current == last && !b.Loop {
+			b.done = true
+			break
+		}
+		b.Current = (b.Current + 1) % len(b.Path)
+	}
+	if b.Current == last && !b.Loop {
+		return arriveForce(s, e, b.Path[last], s.SlowingRadius)
+	}
+	return seekForce(s, e, b.Path[b.Current])
+}
+
+// FollowFlowField moves along a flow field toward Target, arriving once in
+// its cell. Many entities with the same Target share one field. If Field is
+// nil, the field is taken from the PathfindingSystem (which must be
+// registered along with the SteeringSystem) each update, so it follows
+// changes to static obstacles.
+type FollowFlowField struct {
+	Target Vec2D
+	Field  *FlowField
+}
+
+func NewFollowFlowField(target Vec2D) *FollowFlowField {
+	return &FollowFlowField{Target: target}
+}
+
+func (b *FollowFlowField) field(s *SteeringSystem) *FlowField {
+	if b.Field != nil {
+		return b.Field
+	}
+	if s.pathfinding == nil {
+		return nil
+	}
+	return s.pathfinding.FlowField(b.Target)
+}
+
+func (b *FollowFlowField) Steer(s *SteeringSystem, e *Entity) Vec2D {
+	pos := *e.GetVec2D(POSITION)
+	f := b.field(s)
+	if f == nil {
+		// no grid to navigate; head straight there
+		return arriveForce(s, e, b.Target, s.SlowingRadius)
+	}
+	if f.InGoal(pos) {
+		return arriveForce(s, e, b.Target, s.SlowingRadius)
+	}
+	dir := f.DirectionAt(pos)
+	if dir.Magnitude() == 0 {
+		// unreachable; stop
+		return e.GetVec2D(VELOCITY).Scale(-1)
+	}
+	return dir.Scale(s.maxSpeed(e)).Sub(*e.GetVec2D(VELOCITY))
+}
@@ -1,12 +1,37 @@
 package sameriver
 
+// SteeringSystem steers entities by setting their velocity each update,
+// according to their STEERING_BEHAVIOURS (see SteeringBehaviours). Entities
+// with a PATH (see PathfindingSystem) follow it before anything else, and
+// entities with neither STEERING_BEHAVIOURS nor a PATH to follow, but with a
+// MOVEMENTTARGET, Arrive at it. Entities with none of these are left alone.
+// Steering adds to STEER, so forces other systems put there are kept.
 type SteeringSystem struct {
 	w                *World
 	movementEntities *UpdatedEntityList
+	// used by FollowFlowField (if registered along with this system)
+	pathfinding *PathfindingSystem `sameriver-system-dependency:"optional"`
+
+	// default slowing radius for Arrive (and the last point of FollowPath)
+	SlowingRadius float64
+	// default max magnitude of the steering force, for entities whose
+	// SteeringBehaviours don't set MaxForce
+	MaxSteerForce float64
+	// if set, velocities are adjusted after steering to avoid collisions
+	// between agents (nil by default)
+	Avoidance *ORCAAvoidance
+
+	// the behaviour used for entities with only a MOVEMENTTARGET
+	defaultBehaviours *SteeringBehaviours
 }
 
 func NewSteeringSystem() *SteeringSystem {
-	return &SteeringSystem{}
+	return &SteeringSystem{
+		SlowingRadius: 30.0,
+		MaxSteerForce: 3.0,
+		defaultBehaviours: NewSteeringBehaviours(0).
+			Add(1, &Arrive{}),
+	}
 }
 
 func (s *SteeringSystem) GetComponentDeps() []any {
@@ -18,6 +43,8 @@ func (s *SteeringSystem) GetComponentDeps() []any {
 		MOVEMENTTARGET, VEC2D, "MOVEMENTTARGET",
 		STEER, VEC2D, "STEER",
 		MASS, FLOAT64, "MASS",
+		STEERING_BEHAVIOURS, GENERIC, "STEERING_BEHAVIOURS",
+		PATH, GENERIC, "PATH",
 	}
 }
 
@@ -29,36 +56,60 @@ func (s *SteeringSystem) LinkWorld(w *World) {
 			w.em.components.BitArrayFromIDs(
 				[]ComponentID{
 					POSITION, VELOCITY, ACCELERATION,
-					MAXVELOCITY, MOVEMENTTARGET, STEER, MASS,
+					MAXVELOCITY, STEER, MASS,
 				})))
 }
 
 func (s *SteeringSystem) Update(dt_ms float64) {
+	steered := make([]*Entity, 0, len(s.movementEntities.entities))
 	for _, e := range s.movementEntities.entities {
-		s.Seek(e)
+		// (those with nothing to steer them are left alone, whatever other
+		// systems do with their STEER and VELOCITY)
+		if !s.steered(e) {
+			continue
+		}
+		s.Steer(e)
 		s.Apply(e)
+		steered = append(steered, e)
+	}
+	if s.Avoidance != nil {
+		s.Avoidance.avoid(steered, dt_ms)
 	}
 }
 
-func (s *SteeringSystem) Seek(e *Entity) {
-	p0 := e.GetVec2D(POSITION)
-	p1 := e.GetVec2D(MOVEMENTTARGET)
-	v := e.GetVec2D(VELOCITY)
-	maxV := e.GetFloat64(MAXVELOCITY)
+// steered is whether the entity has something for this system to steer it
+// by: STEERING_BEHAVIOURS, a PATH or a MOVEMENTTARGET
+func (s *SteeringSystem) steered(e *Entity) bool {
+	return steeringBehavioursOf(e) != nil || pathOf(e) != nil || e.HasComponent(MOVEMENTTARGET)
+}
+
+// Steer adds to the entity's STEER the combined force of its behaviours,
+// with following its PATH (until done) taking priority
+func (s *SteeringSystem) Steer(e *Entity) {
 	st := e.GetVec2D(STEER)
-	desired := p1.Sub(*p0)
-	distance := desired.Magnitude()
-	desired = desired.Unit()
-	// do slowing for arrival behavior
-	// TODO: define this properly
-	slowingRadius := 30.0
-	if distance <= slowingRadius {
-		desired = desired.Scale(*maxV * distance / slowingRadius)
-	} else {
-		desired = desired.Scale(*maxV)
+	behaviours := steeringBehavioursOf(e)
+	var lead SteeringBehaviour
+	if path := pathOf(e); path != nil && !path.Done() {
+		lead = path
+	}
+	if behaviours == nil && lead == nil && e.HasComponent(MOVEMENTTARGET) {
+		behaviours = s.defaultBehaviours
 	}
-	force := desired.Sub(*v)
-	st.Inc(force)
+	if behaviours == nil && lead == nil {
+		return
+	}
+	maxForce := s.MaxSteerForce
+	if behaviours != nil && behaviours.MaxForce != 0 {
+		maxForce = behaviours.MaxForce
+	}
+	st.Inc(behaviours.combine(s, e, maxForce, lead))
+}
+
+// Seek steers toward MOVEMENTTARGET, slowing within SlowingRadius (kept for
+// compatibility; equivalent to an Arrive behaviour)
+func (s *SteeringSystem) Seek(e *Entity) {
+	st := e.GetVec2D(STEER)
+	st.Inc(arriveForce(s, e, *e.GetVec2D(MOVEMENTTARGET), s.SlowingRadius))
 }
 
 func (s *SteeringSystem) Apply(e *Entity) {
@@ -66,13 +117,44 @@ func (s *SteeringSystem) Apply(e *Entity) {
 	maxV := e.GetFloat64(MAXVELOCITY)
 	st := e.GetVec2D(STEER)
 	mass := e.GetFloat64(MASS)
-	// TODO: define this properly
-	maxSteerForce := 3.0
+	maxSteerForce := s.MaxSteerForce
+	if sb := steeringBehavioursOf(e); sb != nil && sb.MaxForce != 0 {
+		maxSteerForce = sb.MaxForce
+	}
 	*st = st.Truncate(maxSteerForce)
 	*st = st.Scale(1 / *mass)
 	*v = v.Add(*st).Truncate(*maxV)
 }
 
+// the entity's STEERING_BEHAVIOURS, or nil if it has none
+func steeringBehavioursOf(e *Entity) *SteeringBehaviours {
+	if !e.HasComponent(STEERING_BEHAVIOURS) {
+		return nil
+	}
+	sb, _ := e.GetGeneric(STEERING_BEHAVIOURS).(*SteeringBehaviours)
+	return sb
+}
+
+// maxSpeed is the speed an entity wants to move at when unhindered: its
+// MAXVELOCITY, slowed by costly terrain
+func (s *SteeringSystem) maxSpeed(e *Entity) float64 {
+	speed := *e.GetFloat64(MAXVELOCITY)
+	if s.w.TileMap != nil {
+		speed *= s.w.TileMap.SpeedFactorAt(*e.GetVec2D(POSITION))
+	}
+	return speed
+}
+
+// heading is the unit vector in the direction the entity is moving (or a
+// random one if it's stopped)
+func (s *SteeringSystem) heading(e *Entity) Vec2D {
+	v := *e.GetVec2D(VELOCITY)
+	if v.Magnitude() == 0 {
+		return RandomUnitVec2D()
+	}
+	return v.Unit()
+}
+
 func (s *SteeringSystem) Expand(n int) {
 	// nil?
 }
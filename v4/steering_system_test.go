@@ -2,6 +2,7 @@ package sameriver
 
 import (
 	"testing"
+	"time"
 )
 
 func TestSteeringSystem(t *testing.T) {
@@ -17,3 +18,224 @@ func TestSteeringSystem(t *testing.T) {
 		t.Fatal("failed to steer velocity")
 	}
 }
+
+func TestSteeringSystemLeavesUntargeted(t *testing.T) {
+	w := testingWorld()
+	ss := NewSteeringSystem()
+	w.RegisterSystems(ss)
+	// moving faster than its MAXVELOCITY, pushed by some other system, with
+	// nothing for steering to steer it by
+	e := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION:     Vec2D{100, 100},
+			VELOCITY:     Vec2D{5, 0},
+			ACCELERATION: Vec2D{0, 0},
+			MAXVELOCITY:  1.0,
+			STEER:        Vec2D{0, 2},
+			MASS:         1.0,
+			BOX:          Vec2D{2, 2},
+		}})
+	ss.Update(FRAME_MS)
+	if *e.GetVec2D(VELOCITY) != (Vec2D{5, 0}) || *e.GetVec2D(STEER) != (Vec2D{0, 2}) {
+		t.Fatalf("should have left the entity alone, got velocity %v and steer %v",
+			*e.GetVec2D(VELOCITY), *e.GetVec2D(STEER))
+	}
+
+	// a force another system put in STEER is added to, not replaced
+	steerOnce := func(external Vec2D) Vec2D {
+		e := testingSpawnSteering(w)
+		*e.GetVec2D(POSITION) = Vec2D{100, 100}
+		*e.GetVec2D(MOVEMENTTARGET) = Vec2D{500, 100}
+		*e.GetVec2D(VELOCITY) = Vec2D{0, 0}
+		*e.GetVec2D(STEER) = external
+		ss.Steer(e)
+		return *e.GetVec2D(STEER)
+	}
+	alone := steerOnce(Vec2D{0, 0})
+	if pushed := steerOnce(Vec2D{0, 2}); pushed != alone.Add(Vec2D{0, 2}) {
+		t.Fatalf("STEER should have been %v, got %v", alone.Add(Vec2D{0, 2}), pushed)
+	}
+}
+
+func TestSteeringSystemTerrainCost(t *testing.T) {
+	steerOnce := func(m *TileMap) float64 {
+		w := testingWorld()
+		w.RegisterSystems(NewSteeringSystem())
+		w.SetTileMap(m)
+		e := testingSpawnSteering(w)
+		*e.GetVec2D(POSITION) = Vec2D{5, 5}
+		*e.GetVec2D(MOVEMENTTARGET) = Vec2D{500, 5}
+		w.Update(1)
+		w.Update(FRAME_MS / 2)
+		return e.GetVec2D(VELOCITY).Magnitude()
+	}
+	mud := NewTileMap(10, 10, 10, 10)
+	mud.AddLayer("ground").SetTile(0, 0, 1)
+	mud.SetTileProperties(1, TileProperties{Cost: 3})
+	if !(steerOnce(mud) < steerOnce(nil)) {
+		t.Fatal("costly terrain should slow steering")
+	}
+}
+
+func testingSpawnSteeringBehaviours(w *World, pos Vec2D, sb *SteeringBehaviours) *Entity {
+	return w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION:            pos,
+			VELOCITY:            Vec2D{0, 0},
+			ACCELERATION:        Vec2D{0, 0},
+			MAXVELOCITY:         1.0,
+			MOVEMENTTARGET:      Vec2D{0, 0},
+			STEER:               Vec2D{0, 0},
+			MASS:                1.0,
+			BOX:                 Vec2D{2, 2},
+			STEERING_BEHAVIOURS: sb,
+		}})
+}
+
+func testingSteeringWorld() (*World, *SteeringSystem) {
+	w := testingWorld()
+	ss := NewSteeringSystem()
+	w.RegisterSystems(ss)
+	return w, ss
+}
+
+func TestSteeringBehavioursSeekFleeArrive(t *testing.T) {
+	w, ss := testingSteeringWorld()
+	e := testingSpawnSteeringBehaviours(w, Vec2D{100, 100}, nil)
+	*e.GetVec2D(MOVEMENTTARGET) = Vec2D{200, 100}
+	if f := (&Seek{}).Steer(ss, e); f.X <= 0 || f.Y != 0 {
+		t.Fatalf("seek should steer toward the target, got %v", f)
+	}
+	if f := (&Flee{From: Vec2D{200, 100}}).Steer(ss, e); f.X >= 0 {
+		t.Fatalf("flee should steer away, got %v", f)
+	}
+	if f := (&Flee{From: Vec2D{200, 100}, PanicDistance: 50}).Steer(ss, e); f.Magnitude() != 0 {
+		t.Fatal("flee shouldn't steer outside the panic distance")
+	}
+	// arrive: full speed outside the radius, slower inside it
+	far := (&Arrive{SlowingRadius: 10}).Steer(ss, e)
+	near := (&Arrive{SlowingRadius: 200}).Steer(ss, e)
+	if !(near.Magnitude() < far.Magnitude()) {
+		t.Fatalf("arrive should slow within its radius (%v vs %v)", near, far)
+	}
+}
+
+func TestSteeringBehavioursPursueEvade(t *testing.T) {
+	w, ss := testingSteeringWorld()
+	e := testingSpawnSteeringBehaviours(w, Vec2D{100, 100}, nil)
+	target := testingSpawnSteeringBehaviours(w, Vec2D{200, 100}, nil)
+	*target.GetVec2D(VELOCITY) = Vec2D{0, 1}
+	// the target is moving up, so we should lead it
+	if f := (&Pursue{Target: target}).Steer(ss, e); f.X <= 0 || f.Y <= 0 {
+		t.Fatalf("pursue should steer ahead of the target, got %v", f)
+	}
+	if f := (&Evade{Target: target}).Steer(ss, e); f.X >= 0 || f.Y >= 0 {
+		t.Fatalf("evade should steer away from where the target will be, got %v", f)
+	}
+	w.Despawn(target)
+	if f := (&Pursue{Target: target}).Steer(ss, e); f.Magnitude() != 0 {
+		t.Fatal("pursuing a despawned entity should do nothing")
+	}
+}
+
+func TestSteeringBehavioursWander(t *testing.T) {
+	w, _ := testingSteeringWorld()
+	wander := &Wander{Radius: 2, Distance: 4, Jitter: 0.5}
+	e := testingSpawnSteeringBehaviours(w, Vec2D{500, 500}, NewSteeringBehaviours(0).Add(1, wander))
+	headings := make(map[Vec2D]bool)
+	for i := 0; i < 10; i++ {
+		w.Update(FRAME_MS / 2)
+		v := *e.GetVec2D(VELOCITY)
+		if v.Magnitude() > *e.GetFloat64(MAXVELOCITY)+1e-9 {
+			t.Fatal("wander exceeded max velocity")
+		}
+		headings[v] = true
+	}
+	if len(headings) < 2 {
+		t.Fatal("wander should vary the velocity")
+	}
+}
+
+func TestSteeringBehavioursObstacleAvoidance(t *testing.T) {
+	w, ss := testingSteeringWorld()
+	e := testingSpawnSteeringBehaviours(w, Vec2D{100, 100}, nil)
+	// an obstacle ahead and slightly above
+	testingSpawnSpatial(w, Vec2D{110, 101}, Vec2D{4, 4})
+	w.Update(FRAME_MS / 2)
+	*e.GetVec2D(VELOCITY) = Vec2D{1, 0}
+	avoid := &ObstacleAvoidance{LookAhead: 20}
+	f := avoid.Steer(ss, e)
+	if f.Y >= 0 || f.X >= 0 {
+		t.Fatalf("should steer down and brake to avoid the obstacle, got %v", f)
+	}
+	// solid tiles are avoided too
+	w2, ss2 := testingSteeringWorld()
+	m := NewTileMap(20, 20, 10, 10)
+	walls := m.AddLayer("walls")
+	walls.SetSolid(true)
+	walls.SetTile(11, 9, 1)
+	w2.SetTileMap(m)
+	e2 := testingSpawnSteeringBehaviours(w2, Vec2D{100, 92}, nil)
+	*e2.GetVec2D(VELOCITY) = Vec2D{1, 0}
+	if f := avoid.Steer(ss2, e2); f.X >= 0 || f.Y >= 0 {
+		t.Fatalf("should steer away from the solid tile ahead, got %v", f)
+	}
+}
+
+func TestSteeringBehavioursFlocking(t *testing.T) {
+	w, ss := testingSteeringWorld()
+	e := testingSpawnSteeringBehaviours(w, Vec2D{100, 100}, nil)
+	a := testingSpawnSteeringBehaviours(w, Vec2D{105, 100}, nil)
+	b := testingSpawnSteeringBehaviours(w, Vec2D{105, 104}, nil)
+	// far away; not a neighbour
+	testingSpawnSteeringBehaviours(w, Vec2D{500, 500}, nil)
+	w.Update(FRAME_MS / 2)
+	for _, x := range []*Entity{e, a, b} {
+		*x.GetVec2D(VELOCITY) = Vec2D{0, 0}
+	}
+	*a.GetVec2D(VELOCITY) = Vec2D{0, 1}
+	*b.GetVec2D(VELOCITY) = Vec2D{0, 1}
+	if f := (&Separation{Radius: 10}).Steer(ss, e); f.X >= 0 {
+		t.Fatalf("separation should steer away from neighbours, got %v", f)
+	}
+	if f := (&Cohesion{Radius: 10}).Steer(ss, e); f.X <= 0 || f.Y <= 0 {
+		t.Fatalf("cohesion should steer toward neighbours' center, got %v", f)
+	}
+	if f := (&Alignment{Radius: 10}).Steer(ss, e); f.Y <= 0 || f.X != 0 {
+		t.Fatalf("alignment should steer to the neighbours' heading, got %v", f)
+	}
+	w.TagEntity(a, "flock")
+	if f := (&Cohesion{Radius: 10, Tag: "flock"}).Steer(ss, e); f.Y != 0 {
+		t.Fatalf("cohesion limited to the tag should only see a, got %v", f)
+	}
+}
+
+func TestSteeringBehavioursFollowPath(t *testing.T) {
+	w, _ := testingSteeringWorld()
+	w.RegisterSystems(NewPhysicsSystem())
+	path := NewFollowPath([]Vec2D{{120, 100}, {120, 120}, {100, 120}}, 2)
+	e := testingSpawnSteeringBehaviours(w, Vec2D{100, 100}, NewSteeringBehaviours(0).Add(1, path))
+	*e.GetFloat64(MAXVELOCITY) = 0.05
+	for i := 0; i < 400 && !path.Done(); i++ {
+		w.Update(FRAME_MS / 2)
+		time.Sleep(time.Millisecond)
+	}
+	if !path.Done() {
+		t.Fatalf("should have reached the end of the path, at %v heading to point %d",
+			*e.GetVec2D(POSITION), path.Current)
+	}
+}
+
+func TestSteeringBehavioursPriority(t *testing.T) {
+	w, ss := testingSteeringWorld()
+	e := testingSpawnSteeringBehaviours(w, Vec2D{100, 100}, nil)
+	*e.GetVec2D(MOVEMENTTARGET) = Vec2D{200, 100}
+	// the first behaviour uses up the whole budget, so the second is ignored
+	sb := NewSteeringBehaviours(0.5).
+		Add(1, &Flee{From: Vec2D{100, 0}}).
+		Add(1, &Seek{})
+	f := sb.combine(ss, e, sb.MaxForce, nil)
+	if f.X != 0 || f.Y <= 0 || f.Magnitude() > 0.5+1e-9 {
+		t.Fatalf("expected only the flee force, truncated to 0.5, got %v", f)
+	}
+}
@@ -0,0 +1,15 @@
+<?xml version="1.0" encoding="UTF-8"?>
+<tileset version="1.10" tiledversion="1.10.2" name="terrain" tilewidth="16" tileheight="16" tilecount="3" columns="3">
+ <image source="terrain.png" width="48" height="16"/>
+ <tile id="1">
+  <properties>
+   <property name="solid" type="bool" value="true"/>
+  </properties>
+ </tile>
+ <tile id="2">
+  <properties>
+   <property name="cost" type="float" value="3"/>
+   <property name="name" value="mud"/>
+  </properties>
+ </tile>
+</tileset>
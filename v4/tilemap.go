@@ -0,0 +1,374 @@
+package sameriver
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// TileMap is a grid of tiles in one or more layers, attached to a world with
+// World.SetTileMap(). Tiles are identified by a global tile ID (GID, as in
+// Tiled), with 0 meaning no tile. Each GID can have TileProperties saying
+// whether it's solid (blocks PhysicsSystem movement) and its terrain cost
+// (used by pathfinding, and to slow steering entities).
+//
+// Tile (0, 0) is the bottom-left tile, with its bottom-left corner at Origin,
+// and y increases upward as in world coordinates (the Tiled loaders flip
+// the rows accordingly).
+type TileMap struct {
+	// size in tiles
+	Width  int
+	Height int
+	// size of a tile in world units
+	TileWidth  float64
+	TileHeight float64
+	// world position of the bottom-left corner of tile (0, 0)
+	Origin Vec2D
+	// custom properties of the map
+	Props map[string]any
+
+	// in order from bottom (drawn first) to top
+	Layers     []*TileLayer
+	layerNames map[string]*TileLayer
+
+	Tilesets []*Tileset
+	// properties by GID
+	tileProps map[int]*TileProperties
+
+	// the combination of all layers, kept up to date by SetTile() etc.
+	solid []bool
+	cost  []float64
+}
+
+// TileProperties are the properties of a tile GID. In Tiled, set custom
+// properties "solid" (bool) and "cost" (float) on tiles; any other custom
+// properties are kept in Props.
+type TileProperties struct {
+	Solid bool
+	// terrain cost of moving through the tile; 1 is normal, 0 means unset
+	// (treated as 1)
+	Cost  float64
+	Props map[string]any
+}
+
+type TileLayer struct {
+	Name    string
+	Visible bool
+	// if true, every non-empty tile in the layer is solid regardless of its
+	// TileProperties (set with the "solid" custom property on a Tiled layer)
+	Solid bool
+	Props map[string]any
+	// Width*Height tile GIDs, row-major from the bottom row, possibly with
+	// the Tiled flip flags set in the high bits (see TileGID())
+	Tiles []uint32
+	m     *TileMap
+}
+
+// Tileset is an image of tiles, as in Tiled. A tile's GID minus FirstGID
+// gives its index in the image, left to right, top to bottom.
+type Tileset struct {
+	Name       string
+	FirstGID   int
+	TileCount  int
+	Columns    int
+	TileWidth  int
+	TileHeight int
+	Margin     int
+	Spacing    int
+	// path to the image, relative to the working directory
+	Image string
+	// set by TileMap.LoadTextures()
+	Texture *sdl.Texture
+}
+
+// the flip flags Tiled stores in the high bits of a GID
+const (
+	TILE_FLIPPED_HORIZONTALLY uint32 = 0x80000000
+	TILE_FLIPPED_VERTICALLY   uint32 = 0x40000000
+	TILE_FLIPPED_DIAGONALLY   uint32 = 0x20000000
+	TILE_ROTATED_HEXAGONAL    uint32 = 0x10000000
+	tileFlagsMask                    = TILE_FLIPPED_HORIZONTALLY |
+		TILE_FLIPPED_VERTICALLY | TILE_FLIPPED_DIAGONALLY | TILE_ROTATED_HEXAGONAL
+)
+
+// TileGID strips the flip flags from a tile as stored in a TileLayer
+func TileGID(tile uint32) int {
+	return int(tile &^ tileFlagsMask)
+}
+
+// SetTileMap attaches a TileMap to the world, whose solid tiles then block
+// movement in PhysicsSystem and whose costs slow SteeringSystem entities
+// (nil to detach)
+func (w *World) SetTileMap(m *TileMap) {
+	if m != nil && !w.Unbounded {
+		extent := Vec2D{float64(m.Width) * m.TileWidth, float64(m.Height) * m.TileHeight}
+		if m.Origin.X < 0 || m.Origin.Y < 0 ||
+			m.Origin.X+extent.X > w.Width || m.Origin.Y+extent.Y > w.Height {
+			logWarning("tilemap extends outside the world's Width x Height")
+		}
+	}
+	w.TileMap = m
+}
+
+func NewTileMap(width, height int, tileWidth, tileHeight float64) *TileMap {
+	m := &TileMap{
+		Width:      width,
+		Height:     height,
+		TileWidth:  tileWidth,
+		TileHeight: tileHeight,
+		Props:      make(map[string]any),
+		Layers:     make([]*TileLayer, 0),
+		layerNames: make(map[string]*TileLayer),
+		Tilesets:   make([]*Tileset, 0),
+		tileProps:  make(map[int]*TileProperties),
+		solid:      make([]bool, width*height),
+		cost:       make([]float64, width*height),
+	}
+	for i := range m.cost {
+		m.cost[i] = 1
+	}
+	return m
+}
+
+// AddLayer adds a layer on top of the existing layers
+func (m *TileMap) AddLayer(name string) *TileLayer {
+	if _, ok := m.layerNames[name]; ok {
+		panic(fmt.Sprintf("tilemap already has a layer named %s", name))
+	}
+	l := &TileLayer{
+		Name:    name,
+		Visible: true,
+		Props:   make(map[string]any),
+		Tiles:   make([]uint32, m.Width*m.Height),
+		m:       m,
+	}
+	m.Layers = append(m.Layers, l)
+	m.layerNames[name] = l
+	return l
+}
+
+func (m *TileMap) Layer(name string) *TileLayer {
+	if l, ok := m.layerNames[name]; ok {
+		return l
+	}
+	panic(fmt.Sprintf("tilemap has no layer named %s", name))
+}
+
+func (m *TileMap) AddTileset(ts *Tileset) {
+	m.Tilesets = append(m.Tilesets, ts)
+}
+
+// TilesetOf finds the tileset a GID belongs to (nil if none)
+func (m *TileMap) TilesetOf(gid int) *Tileset {
+	var found *Tileset
+	for _, ts := range m.Tilesets {
+		if gid >= ts.FirstGID && (found == nil || ts.FirstGID > found.FirstGID) {
+			found = ts
+		}
+	}
+	return found
+}
+
+func (m *TileMap) SetTileProperties(gid int, props TileProperties) {
+	if props.Props == nil {
+		props.Props = make(map[string]any)
+	}
+	m.tileProps[gid] = &props
+	m.refreshAll()
+}
+
+// TileProperties gets the properties of a GID (nil if none were set)
+func (m *TileMap) TileProperties(gid int) *TileProperties {
+	return m.tileProps[gid]
+}
+
+func (m *TileMap) InMap(x, y int) bool {
+	return x >= 0 && x < m.Width && y >= 0 && y < m.Height
+}
+
+// SetSolid marks the layer solid or not (see TileLayer.Solid)
+func (l *TileLayer) SetSolid(solid bool) {
+	l.Solid = solid
+	l.m.refreshAll()
+}
+
+func (l *TileLayer) SetTile(x, y int, tile uint32) {
+	if !l.m.InMap(x, y) {
+		panic(fmt.Sprintf("tile (%d, %d) is outside the %dx%d tilemap", x, y, l.m.Width, l.m.Height))
+	}
+	l.Tiles[y*l.m.Width+x] = tile
+	l.m.refresh(x, y)
+}
+
+// Tile gets the tile (with flip flags; see TileGID()) at x, y, or 0 if
+// empty or outside the map
+func (l *TileLayer) Tile(x, y int) uint32 {
+	if !l.m.InMap(x, y) {
+		return 0
+	}
+	return l.Tiles[y*l.m.Width+x]
+}
+
+// refresh recomputes the combined solidity and cost of a tile position:
+// solid if any layer's tile there is solid, and cost the highest cost of
+// any layer's tile there
+func (m *TileMap) refresh(x, y int) {
+	i := y*m.Width + x
+	solid := false
+	cost := 1.0
+	for _, l := range m.Layers {
+		gid := TileGID(l.Tiles[i])
+		if gid == 0 {
+			continue
+		}
+		if l.Solid {
+			solid = true
+		}
+		if props, ok := m.tileProps[gid]; ok {
+			solid = solid || props.Solid
+			if props.Cost > cost {
+				cost = props.Cost
+			}
+		}
+	}
+	m.solid[i] = solid
+	m.cost[i] = cost
+}
+
+func (m *TileMap) refreshAll() {
+	for y := 0; y < m.Height; y++ {
+		for x := 0; x < m.Width; x++ {
+			m.refresh(x, y)
+		}
+	}
+}
+
+// Solid is whether any layer has a solid tile at x, y. Outside the map is
+// not solid.
+func (m *TileMap) Solid(x, y int) bool {
+	if !m.InMap(x, y) {
+		return false
+	}
+	return m.solid[y*m.Width+x]
+}
+
+// Passable is whether an entity can move through x, y (in the map and not
+// solid)
+func (m *TileMap) Passable(x, y int) bool {
+	return m.InMap(x, y) && !m.solid[y*m.Width+x]
+}
+
+// Cost is the terrain cost of x, y: +Inf if not passable, else the highest
+// cost of the tiles there (at least 1)
+func (m *TileMap) Cost(x, y int) float64 {
+	if !m.Passable(x, y) {
+		return math.Inf(1)
+	}
+	return m.cost[y*m.Width+x]
+}
+
+// TileOf gives the tile position containing the world position pos, and
+// whether it's inside the map
+func (m *TileMap) TileOf(pos Vec2D) (x, y int, ok bool) {
+	x = int(math.Floor((pos.X - m.Origin.X) / m.TileWidth))
+	y = int(math.Floor((pos.Y - m.Origin.Y) / m.TileHeight))
+	return x, y, m.InMap(x, y)
+}
+
+// TileCenter gives the world position of the center of tile x, y
+func (m *TileMap) TileCenter(x, y int) Vec2D {
+	return Vec2D{
+		m.Origin.X + (float64(x)+0.5)*m.TileWidth,
+		m.Origin.Y + (float64(y)+0.5)*m.TileHeight,
+	}
+}
+
+// TileBox is the size of a tile as a box
+func (m *TileMap) TileBox() Vec2D {
+	return Vec2D{m.TileWidth, m.TileHeight}
+}
+
+// CostAt is the terrain cost at a world position (1 outside the map)
+func (m *TileMap) CostAt(pos Vec2D) float64 {
+	x, y, ok := m.TileOf(pos)
+	if !ok {
+		return 1
+	}
+	return m.Cost(x, y)
+}
+
+// SpeedFactorAt is the fraction of its max speed an entity can move at
+// over the terrain at pos (1 / cost)
+func (m *TileMap) SpeedFactorAt(pos Vec2D) float64 {
+	cost := m.CostAt(pos)
+	if math.IsInf(cost, 1) || cost <= 0 {
+		// standing on something solid (or misconfigured); don't get stuck
+		return 1
+	}
+	return 1 / cost
+}
+
+// tileRangeOfRect gives the tiles which the rect (pos in the center)
+// overlaps, not counting tiles it only touches at an edge, clipped to the
+// map
+func (m *TileMap) tileRangeOfRect(pos, box Vec2D) (x0, x1, y0, y1 int) {
+	aabb := AABBOfRect(pos, box)
+	x0 = maxi(0, int(math.Floor((aabb.Min.X-m.Origin.X)/m.TileWidth)))
+	y0 = maxi(0, int(math.Floor((aabb.Min.Y-m.Origin.Y)/m.TileHeight)))
+	x1 = mini(m.Width-1, int(math.Ceil((aabb.Max.X-m.Origin.X)/m.TileWidth))-1)
+	y1 = mini(m.Height-1, int(math.Ceil((aabb.Max.Y-m.Origin.Y)/m.TileHeight))-1)
+	return x0, x1, y0, y1
+}
+
+// BoxCollides is whether the rect (pos in the center) overlaps any solid
+// tile
+func (m *TileMap) BoxCollides(pos, box Vec2D) bool {
+	x0, x1, y0, y1 := m.tileRangeOfRect(pos, box)
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			if m.solid[y*m.Width+x] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SolidTilesOverlapping returns the positions of the solid tiles the rect
+// (pos in the center) overlaps
+func (m *TileMap) SolidTilesOverlapping(pos, box Vec2D) [][2]int {
+	tiles := make([][2]int, 0)
+	x0, x1, y0, y1 := m.tileRangeOfRect(pos, box)
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			if m.solid[y*m.Width+x] {
+				tiles = append(tiles, [2]int{x, y})
+			}
+		}
+	}
+	return tiles
+}
+
+// RaycastSolid finds the first solid tile struck by the ray from origin in
+// direction dir within maxDist, returning the distance along the ray to it,
+// the outward normal of the face struck, and its tile position
+func (m *TileMap) RaycastSolid(
+	origin, dir Vec2D, maxDist float64) (hit bool, t float64, normal Vec2D, x, y int) {
+	if dir.Magnitude() == 0 {
+		return false, 0, Vec2D{0, 0}, 0, 0
+	}
+	dir = dir.Unit()
+	walkCellsAlongRay(origin.Sub(m.Origin), dir, maxDist,
+		m.TileBox(), [2]int{0, 0}, [2]int{m.Width - 1, m.Height - 1},
+		func(cx, cy int, tEntry float64) bool {
+			if !m.solid[cy*m.Width+cx] {
+				return true
+			}
+			hit, t, normal = RayIntersectsRect(origin, dir, maxDist, m.TileCenter(cx, cy), m.TileBox())
+			x, y = cx, cy
+			// (the ray may only graze the tile's corner)
+			return !hit
+		})
+	return hit, t, normal, x, y
+}
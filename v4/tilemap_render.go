@@ -0,0 +1,93 @@
+package sameriver
+
+import (
+	"fmt"
+
+	"github.com/veandco/go-sdl2/img"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// LoadTextures loads the image of each tileset as its Texture
+func (m *TileMap) LoadTextures(renderer *sdl.Renderer) {
+	for _, ts := range m.Tilesets {
+		if ts.Image == "" || ts.Texture != nil {
+			continue
+		}
+		surface, err := img.Load(ts.Image)
+		if err != nil {
+			Logger.Printf("[TileMap] failed to load tileset image %s", ts.Image)
+			panic(err)
+		}
+		ts.Texture, err = renderer.CreateTextureFromSurface(surface)
+		if err != nil {
+			Logger.Printf("[TileMap] failed to create texture for %s", ts.Image)
+			panic(err)
+		}
+		surface.Free()
+	}
+}
+
+// srcRect is the rect of the tile with the given GID in the tileset image
+func (ts *Tileset) srcRect(gid int) *sdl.Rect {
+	ix := gid - ts.FirstGID
+	col := ix % ts.Columns
+	row := ix / ts.Columns
+	return &sdl.Rect{
+		X: int32(ts.Margin + col*(ts.TileWidth+ts.Spacing)),
+		Y: int32(ts.Margin + row*(ts.TileHeight+ts.Spacing)),
+		W: int32(ts.TileWidth),
+		H: int32(ts.TileHeight),
+	}
+}
+
+// RenderTileLayer draws the tiles of a layer which are on screen
+// NOTE: Tiled's diagonal flip (used for 90 degree rotations) is ignored
+func (m *TileMap) RenderTileLayer(l *TileLayer, r *sdl.Renderer, screen *GameScreen) {
+	if !l.Visible {
+		return
+	}
+	screenBox := Vec2D{float64(screen.W), float64(screen.H)}
+	x0, x1, y0, y1 := m.tileRangeOfRect(screenBox.Scale(0.5), screenBox)
+	box := m.TileBox()
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			tile := l.Tiles[y*m.Width+x]
+			gid := TileGID(tile)
+			if gid == 0 {
+				continue
+			}
+			ts := m.TilesetOf(gid)
+			if ts == nil || ts.Texture == nil || ts.Columns == 0 {
+				continue
+			}
+			flip := sdl.FLIP_NONE
+			if tile&TILE_FLIPPED_HORIZONTALLY != 0 {
+				flip |= sdl.FLIP_HORIZONTAL
+			}
+			if tile&TILE_FLIPPED_VERTICALLY != 0 {
+				flip |= sdl.FLIP_VERTICAL
+			}
+			pos := m.Origin.Add(Vec2D{float64(x) * m.TileWidth, float64(y) * m.TileHeight})
+			r.CopyEx(ts.Texture, ts.srcRect(gid), screen.ScreenSpaceRect(&pos, &box), 0, nil, flip)
+		}
+	}
+}
+
+// NewRenderLayer makes a RenderLayer drawing the named tile layer, to be
+// added to a LayeredRenderer
+func (m *TileMap) NewRenderLayer(layerName string, z int, screen *GameScreen) *RenderLayer {
+	l := m.Layer(layerName)
+	return NewRenderLayer(
+		fmt.Sprintf("tilemap.%s", layerName), z,
+		func(w *sdl.Window, r *sdl.Renderer) {
+			m.RenderTileLayer(l, r, screen)
+		})
+}
+
+// AddToRenderer adds a RenderLayer for each tile layer, in order, with z
+// counting up from z0 (so entities can be drawn between or above them)
+func (m *TileMap) AddToRenderer(lr *LayeredRenderer, screen *GameScreen, z0 int) {
+	for i, l := range m.Layers {
+		lr.AddLayer(m.NewRenderLayer(l.Name, z0+i, screen))
+	}
+}
@@ -0,0 +1,128 @@
+package sameriver
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// both test maps are 4x3 16px tiles: a solid wall along the top row and
+// mud (cost 3) in the third column
+func checkTestTileMap(t *testing.T, m *TileMap) {
+	if m.Width != 4 || m.Height != 3 || m.TileWidth != 16 || m.TileHeight != 16 {
+		t.Fatalf("wrong dimensions %dx%d of %vx%v", m.Width, m.Height, m.TileWidth, m.TileHeight)
+	}
+	if len(m.Layers) != 2 || m.Layers[1].Name != "obstacles/walls" {
+		t.Fatal("expected ground and obstacles/walls layers")
+	}
+	for x := 0; x < 4; x++ {
+		if !m.Solid(x, 2) {
+			t.Fatalf("top row (y=2) should be solid at x=%d", x)
+		}
+		if m.Solid(x, 0) || m.Solid(x, 1) {
+			t.Fatalf("lower rows should not be solid at x=%d", x)
+		}
+	}
+	if m.Cost(2, 1) != 3 || m.Cost(1, 1) != 1 {
+		t.Fatalf("expected mud cost 3, floor cost 1; got %v, %v", m.Cost(2, 1), m.Cost(1, 1))
+	}
+	if !math.IsInf(m.Cost(2, 2), 1) {
+		t.Fatal("solid tile should have infinite cost")
+	}
+	if m.TileProperties(3).Props["name"] != "mud" {
+		t.Fatal("custom tile properties should be kept")
+	}
+	ts := m.TilesetOf(3)
+	if ts == nil || ts.Columns != 3 || ts.Image != "test_data/terrain.png" {
+		t.Fatalf("tileset not loaded properly: %+v", ts)
+	}
+}
+
+func TestTileMapLoadTMX(t *testing.T) {
+	checkTestTileMap(t, LoadTileMapFile("test_data/tilemap.tmx"))
+}
+
+func TestTileMapLoadJSON(t *testing.T) {
+	m := LoadTileMapFile("test_data/tilemap.json")
+	checkTestTileMap(t, m)
+	if m.Props["title"] != "test" {
+		t.Fatal("map properties should be loaded")
+	}
+	tile := m.Layer("ground").Tile(0, 0)
+	if TileGID(tile) != 1 || tile&TILE_FLIPPED_HORIZONTALLY == 0 {
+		t.Fatal("flip flags should be kept, and stripped by TileGID()")
+	}
+}
+
+func TestTileMapCoords(t *testing.T) {
+	m := NewTileMap(10, 10, 8, 8)
+	m.Origin = Vec2D{-40, -40}
+	x, y, ok := m.TileOf(Vec2D{-39, -1})
+	if x != 0 || y != 4 || !ok {
+		t.Fatalf("expected tile (0, 4), got (%d, %d)", x, y)
+	}
+	if _, _, ok := m.TileOf(Vec2D{41, 0}); ok {
+		t.Fatal("position off the map should not be ok")
+	}
+	if m.TileCenter(0, 4) != (Vec2D{-36, -4}) {
+		t.Fatalf("wrong tile center %v", m.TileCenter(0, 4))
+	}
+}
+
+func TestTileMapBoxCollides(t *testing.T) {
+	m := NewTileMap(10, 10, 10, 10)
+	walls := m.AddLayer("walls")
+	walls.SetSolid(true)
+	walls.SetTile(5, 5, 1)
+	// overlapping
+	if !m.BoxCollides(Vec2D{50, 50}, Vec2D{4, 4}) {
+		t.Fatal("box inside a solid tile should collide")
+	}
+	if !m.BoxCollides(Vec2D{47, 47}, Vec2D{8, 8}) {
+		t.Fatal("box overlapping a solid tile's corner should collide")
+	}
+	// touching an edge isn't colliding
+	if m.BoxCollides(Vec2D{45, 55}, Vec2D{10, 10}) {
+		t.Fatal("box touching a solid tile's edge should not collide")
+	}
+	if len(m.SolidTilesOverlapping(Vec2D{50, 50}, Vec2D{30, 30})) != 1 {
+		t.Fatal("expected 1 solid tile")
+	}
+	// tile properties on a non-solid layer
+	floor := m.AddLayer("floor")
+	floor.SetTile(1, 1, 2)
+	if m.Solid(1, 1) {
+		t.Fatal("tile without properties should not be solid")
+	}
+	m.SetTileProperties(2, TileProperties{Solid: true})
+	if !m.Solid(1, 1) {
+		t.Fatal("setting tile properties should update solidity")
+	}
+}
+
+func TestTileMapPhysicsCollision(t *testing.T) {
+	w := testingWorld()
+	w.RegisterSystems(NewPhysicsSystem())
+	m := NewTileMap(10, 10, 10, 10)
+	walls := m.AddLayer("walls")
+	walls.SetSolid(true)
+	for y := 0; y < 10; y++ {
+		walls.SetTile(5, y, 1)
+	}
+	w.SetTileMap(m)
+	e := testingSpawnPhysics(w)
+	*e.GetVec2D(POSITION) = Vec2D{40, 40}
+	// (slow enough not to tunnel through the wall in one step)
+	*e.GetVec2D(VELOCITY) = Vec2D{0.1, 0}
+	for i := 0; i < 32; i++ {
+		w.Update(FRAME_MS / 2)
+		time.Sleep(FRAME_DURATION)
+	}
+	pos := e.GetVec2D(POSITION)
+	if pos.X+0.5 > 50 {
+		t.Fatalf("entity should have been stopped by the wall at x=50, at %v", *pos)
+	}
+	if pos.X <= 40 {
+		t.Fatal("entity should have moved up to the wall")
+	}
+}
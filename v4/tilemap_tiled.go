@@ -0,0 +1,532 @@
+package sameriver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Loading of maps made with the Tiled editor (https://www.mapeditor.org),
+// in either the TMX (XML) or JSON format. Only finite, orthogonal maps are
+// supported. Tile layers (including those nested in groups, named
+// "group/layer") become TileLayers; object and image layers are skipped.
+// Tilesets can be embedded or external (.tsx / .tsj / .json), and tile and
+// layer custom properties are read as described on TileProperties and
+// TileLayer.
+
+// LoadTileMapFile loads a Tiled map, choosing the format by extension
+// (.tmx, or .tmj / .json)
+func LoadTileMapFile(filename string) *TileMap {
+	Logger.Printf("Loading tilemap from %s...", filename)
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		panic(fmt.Sprintf("Trying to open %s - %s", filename, err))
+	}
+	dir := filepath.Dir(filename)
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".tmx":
+		return LoadTileMapTMX(contents, dir)
+	case ".tmj", ".json":
+		return LoadTileMapJSON(contents, dir)
+	default:
+		panic(fmt.Sprintf("unknown tilemap format for %s [valid: .tmx, .tmj, .json]", filename))
+	}
+}
+
+// the parts of a Tiled map common to both formats, which we build the
+// TileMap from
+type tiledMap struct {
+	width, height         int
+	tileWidth, tileHeight int
+	orientation           string
+	infinite              bool
+	props                 map[string]any
+	tilesets              []*Tileset
+	tileProps             map[int]TileProperties
+	layers                []tiledLayer
+}
+
+type tiledLayer struct {
+	name    string
+	visible bool
+	props   map[string]any
+	// as in the file: row-major from the top row
+	data []uint32
+}
+
+func (tm *tiledMap) build(source string) *TileMap {
+	if tm.orientation != "" && tm.orientation != "orthogonal" {
+		panic(fmt.Sprintf("%s: only orthogonal tilemaps are supported (got %s)", source, tm.orientation))
+	}
+	if tm.infinite {
+		panic(fmt.Sprintf("%s: infinite Tiled maps are not supported", source))
+	}
+	m := NewTileMap(tm.width, tm.height, float64(tm.tileWidth), float64(tm.tileHeight))
+	m.Props = tm.props
+	for _, ts := range tm.tilesets {
+		m.AddTileset(ts)
+	}
+	for _, tl := range tm.layers {
+		if len(tl.data) != tm.width*tm.height {
+			panic(fmt.Sprintf("%s: layer %s has %d tiles, expected %d",
+				source, tl.name, len(tl.data), tm.width*tm.height))
+		}
+		l := m.AddLayer(tl.name)
+		l.Visible = tl.visible
+		l.Props = tl.props
+		if solid, ok := tl.props["solid"].(bool); ok {
+			l.Solid = solid
+		}
+		// flip rows, since Tiled's y increases downward
+		for i, tile := range tl.data {
+			x := i % tm.width
+			y := tm.height - 1 - i/tm.width
+			l.Tiles[y*tm.width+x] = tile
+		}
+	}
+	for gid := range tm.tileProps {
+		props := tm.tileProps[gid]
+		m.tileProps[gid] = &props
+	}
+	m.refreshAll()
+	return m
+}
+
+// tilePropertiesFromTiled picks out the properties we give meaning to
+func tilePropertiesFromTiled(props map[string]any) TileProperties {
+	tp := TileProperties{Props: props}
+	if solid, ok := props["solid"].(bool); ok {
+		tp.Solid = solid
+	}
+	switch cost := props["cost"].(type) {
+	case float64:
+		tp.Cost = cost
+	case int:
+		tp.Cost = float64(cost)
+	}
+	return tp
+}
+
+// decodeTiledData decodes the tile data of a layer given as text, which is
+// either CSV or base64 (optionally zlib or gzip compressed) little-endian
+// uint32s
+func decodeTiledData(encoding, compression, text string) []uint32 {
+	switch encoding {
+	case "csv":
+		data := make([]uint32, 0)
+		for _, field := range strings.Split(text, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			gid, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				panic(fmt.Sprintf("bad tile in csv layer data: %s", field))
+			}
+			data = append(data, uint32(gid))
+		}
+		return data
+	case "base64":
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+		if err != nil {
+			panic(err)
+		}
+		var r io.Reader = bytes.NewReader(raw)
+		switch compression {
+		case "":
+		case "zlib":
+			r, err = zlib.NewReader(r)
+		case "gzip":
+			r, err = gzip.NewReader(r)
+		default:
+			panic(fmt.Sprintf("unsupported tile layer compression %s [valid: zlib, gzip]", compression))
+		}
+		if err != nil {
+			panic(err)
+		}
+		raw, err = io.ReadAll(r)
+		if err != nil {
+			panic(err)
+		}
+		data := make([]uint32, len(raw)/4)
+		for i := range data {
+			data[i] = binary.LittleEndian.Uint32(raw[4*i:])
+		}
+		return data
+	default:
+		panic(fmt.Sprintf("unsupported tile layer encoding %s [valid: csv, base64]", encoding))
+	}
+}
+
+// parseTiledPropertyValue converts a property value given as a string in
+// TMX according to its type
+func parseTiledPropertyValue(typ, value string) any {
+	switch typ {
+	case "bool":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			panic(fmt.Sprintf("bad bool property value %s", value))
+		}
+		return b
+	case "int":
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			panic(fmt.Sprintf("bad int property value %s", value))
+		}
+		return i
+	case "float":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			panic(fmt.Sprintf("bad float property value %s", value))
+		}
+		return f
+	default:
+		return value
+	}
+}
+
+//
+// TMX (XML)
+//
+
+type tmxProperty struct {
+	Name  string `xml:"name,attr"`
+	Type  string `xml:"type,attr"`
+	Value string `xml:"value,attr"`
+	// multiline string values are given as the element text
+	Text string `xml:",chardata"`
+}
+
+type tmxProperties struct {
+	Properties []tmxProperty `xml:"property"`
+}
+
+func (ps tmxProperties) toMap() map[string]any {
+	props := make(map[string]any)
+	for _, p := range ps.Properties {
+		value := p.Value
+		if value == "" {
+			value = p.Text
+		}
+		props[p.Name] = parseTiledPropertyValue(p.Type, value)
+	}
+	return props
+}
+
+type tmxTileset struct {
+	FirstGID   int           `xml:"firstgid,attr"`
+	Source     string        `xml:"source,attr"`
+	Name       string        `xml:"name,attr"`
+	TileWidth  int           `xml:"tilewidth,attr"`
+	TileHeight int           `xml:"tileheight,attr"`
+	TileCount  int           `xml:"tilecount,attr"`
+	Columns    int           `xml:"columns,attr"`
+	Margin     int           `xml:"margin,attr"`
+	Spacing    int           `xml:"spacing,attr"`
+	Image      tmxImage      `xml:"image"`
+	Tiles      []tmxTileInfo `xml:"tile"`
+}
+
+type tmxImage struct {
+	Source string `xml:"source,attr"`
+}
+
+type tmxTileInfo struct {
+	ID         int           `xml:"id,attr"`
+	Properties tmxProperties `xml:"properties"`
+}
+
+type tmxData struct {
+	Encoding    string `xml:"encoding,attr"`
+	Compression string `xml:"compression,attr"`
+	Text        string `xml:",chardata"`
+	Tiles       []struct {
+		GID uint32 `xml:"gid,attr"`
+	} `xml:"tile"`
+}
+
+type tmxLayer struct {
+	Name       string        `xml:"name,attr"`
+	Visible    *int          `xml:"visible,attr"`
+	Properties tmxProperties `xml:"properties"`
+	Data       tmxData       `xml:"data"`
+}
+
+type tmxGroup struct {
+	Name    string     `xml:"name,attr"`
+	Visible *int       `xml:"visible,attr"`
+	Layers  []tmxLayer `xml:"layer"`
+	Groups  []tmxGroup `xml:"group"`
+}
+
+type tmxMap struct {
+	Width       int           `xml:"width,attr"`
+	Height      int           `xml:"height,attr"`
+	TileWidth   int           `xml:"tilewidth,attr"`
+	TileHeight  int           `xml:"tileheight,attr"`
+	Orientation string        `xml:"orientation,attr"`
+	Infinite    int           `xml:"infinite,attr"`
+	Properties  tmxProperties `xml:"properties"`
+	Tilesets    []tmxTileset  `xml:"tileset"`
+	// NOTE: layers and groups are each kept in file order, but if they're
+	// interleaved, top-level layers all come before groups
+	Layers []tmxLayer `xml:"layer"`
+	Groups []tmxGroup `xml:"group"`
+}
+
+func tmxVisible(v *int) bool {
+	return v == nil || *v != 0
+}
+
+// LoadTileMapTMX loads a Tiled map in TMX format. External tilesets and
+// images are resolved relative to dir.
+func LoadTileMapTMX(xmlStr []byte, dir string) *TileMap {
+	var tmx tmxMap
+	if err := xml.Unmarshal(xmlStr, &tmx); err != nil {
+		panic(err)
+	}
+	tm := &tiledMap{
+		width:       tmx.Width,
+		height:      tmx.Height,
+		tileWidth:   tmx.TileWidth,
+		tileHeight:  tmx.TileHeight,
+		orientation: tmx.Orientation,
+		infinite:    tmx.Infinite != 0,
+		props:       tmx.Properties.toMap(),
+		tileProps:   make(map[int]TileProperties),
+	}
+	for _, ts := range tmx.Tilesets {
+		tm.addTMXTileset(ts, dir)
+	}
+	var addLayers func(prefix string, visible bool, layers []tmxLayer, groups []tmxGroup)
+	addLayers = func(prefix string, visible bool, layers []tmxLayer, groups []tmxGroup) {
+		for _, l := range layers {
+			var data []uint32
+			if l.Data.Encoding == "" {
+				data = make([]uint32, len(l.Data.Tiles))
+				for i, t := range l.Data.Tiles {
+					data[i] = t.GID
+				}
+			} else {
+				data = decodeTiledData(l.Data.Encoding, l.Data.Compression, l.Data.Text)
+			}
+			tm.layers = append(tm.layers, tiledLayer{
+				name:    prefix + l.Name,
+				visible: visible && tmxVisible(l.Visible),
+				props:   l.Properties.toMap(),
+				data:    data,
+			})
+		}
+		for _, g := range groups {
+			addLayers(prefix+g.Name+"/", visible && tmxVisible(g.Visible), g.Layers, g.Groups)
+		}
+	}
+	addLayers("", true, tmx.Layers, tmx.Groups)
+	return tm.build("tmx")
+}
+
+func (tm *tiledMap) addTMXTileset(ts tmxTileset, dir string) {
+	firstGID := ts.FirstGID
+	if ts.Source != "" {
+		// external tileset; the firstgid comes from the map
+		path := filepath.Join(dir, ts.Source)
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			panic(fmt.Sprintf("Trying to open tileset %s - %s", path, err))
+		}
+		dir = filepath.Dir(path)
+		if strings.ToLower(filepath.Ext(path)) != ".tsx" {
+			tm.addJSONTileset(jsonTileset{FirstGID: firstGID}, contents, dir)
+			return
+		}
+		ts = tmxTileset{}
+		if err := xml.Unmarshal(contents, &ts); err != nil {
+			panic(err)
+		}
+	}
+	tileset := &Tileset{
+		Name:       ts.Name,
+		FirstGID:   firstGID,
+		TileCount:  ts.TileCount,
+		Columns:    ts.Columns,
+		TileWidth:  ts.TileWidth,
+		TileHeight: ts.TileHeight,
+		Margin:     ts.Margin,
+		Spacing:    ts.Spacing,
+	}
+	if ts.Image.Source != "" {
+		tileset.Image = filepath.Join(dir, ts.Image.Source)
+	}
+	tm.tilesets = append(tm.tilesets, tileset)
+	for _, t := range ts.Tiles {
+		tm.tileProps[firstGID+t.ID] = tilePropertiesFromTiled(t.Properties.toMap())
+	}
+}
+
+//
+// JSON
+//
+
+type jsonProperty struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value any    `json:"value"`
+}
+
+func jsonPropertiesToMap(ps []jsonProperty) map[string]any {
+	props := make(map[string]any)
+	for _, p := range ps {
+		value := p.Value
+		// numbers are all float64 in JSON
+		if f, ok := value.(float64); ok && p.Type == "int" {
+			value = int(f)
+		}
+		props[p.Name] = value
+	}
+	return props
+}
+
+type jsonTileset struct {
+	FirstGID   int            `json:"firstgid"`
+	Source     string         `json:"source"`
+	Name       string         `json:"name"`
+	TileWidth  int            `json:"tilewidth"`
+	TileHeight int            `json:"tileheight"`
+	TileCount  int            `json:"tilecount"`
+	Columns    int            `json:"columns"`
+	Margin     int            `json:"margin"`
+	Spacing    int            `json:"spacing"`
+	Image      string         `json:"image"`
+	Tiles      []jsonTileInfo `json:"tiles"`
+}
+
+type jsonTileInfo struct {
+	ID         int            `json:"id"`
+	Properties []jsonProperty `json:"properties"`
+}
+
+type jsonLayer struct {
+	Type        string          `json:"type"`
+	Name        string          `json:"name"`
+	Visible     *bool           `json:"visible"`
+	Properties  []jsonProperty  `json:"properties"`
+	Encoding    string          `json:"encoding"`
+	Compression string          `json:"compression"`
+	Data        json.RawMessage `json:"data"`
+	Layers      []jsonLayer     `json:"layers"`
+}
+
+type jsonMap struct {
+	Width       int            `json:"width"`
+	Height      int            `json:"height"`
+	TileWidth   int            `json:"tilewidth"`
+	TileHeight  int            `json:"tileheight"`
+	Orientation string         `json:"orientation"`
+	Infinite    bool           `json:"infinite"`
+	Properties  []jsonProperty `json:"properties"`
+	Tilesets    []jsonTileset  `json:"tilesets"`
+	Layers      []jsonLayer    `json:"layers"`
+}
+
+// LoadTileMapJSON loads a Tiled map in JSON format. External tilesets and
+// images are resolved relative to dir.
+func LoadTileMapJSON(jsonStr []byte, dir string) *TileMap {
+	var jm jsonMap
+	if err := json.Unmarshal(jsonStr, &jm); err != nil {
+		panic(err)
+	}
+	tm := &tiledMap{
+		width:       jm.Width,
+		height:      jm.Height,
+		tileWidth:   jm.TileWidth,
+		tileHeight:  jm.TileHeight,
+		orientation: jm.Orientation,
+		infinite:    jm.Infinite,
+		props:       jsonPropertiesToMap(jm.Properties),
+		tileProps:   make(map[int]TileProperties),
+	}
+	for _, ts := range jm.Tilesets {
+		if ts.Source != "" {
+			path := filepath.Join(dir, ts.Source)
+			if strings.ToLower(filepath.Ext(path)) == ".tsx" {
+				tm.addTMXTileset(tmxTileset{FirstGID: ts.FirstGID, Source: ts.Source}, dir)
+				continue
+			}
+			contents, err := os.ReadFile(path)
+			if err != nil {
+				panic(fmt.Sprintf("Trying to open tileset %s - %s", path, err))
+			}
+			tm.addJSONTileset(ts, contents, filepath.Dir(path))
+			continue
+		}
+		tm.addJSONTileset(ts, nil, dir)
+	}
+	var addLayers func(prefix string, visible bool, layers []jsonLayer)
+	addLayers = func(prefix string, visible bool, layers []jsonLayer) {
+		for _, l := range layers {
+			layerVisible := visible && (l.Visible == nil || *l.Visible)
+			switch l.Type {
+			case "tilelayer":
+				var data []uint32
+				if l.Encoding == "base64" {
+					var text string
+					if err := json.Unmarshal(l.Data, &text); err != nil {
+						panic(err)
+					}
+					data = decodeTiledData(l.Encoding, l.Compression, text)
+				} else if err := json.Unmarshal(l.Data, &data); err != nil {
+					panic(err)
+				}
+				tm.layers = append(tm.layers, tiledLayer{
+					name:    prefix + l.Name,
+					visible: layerVisible,
+					props:   jsonPropertiesToMap(l.Properties),
+					data:    data,
+				})
+			case "group":
+				addLayers(prefix+l.Name+"/", layerVisible, l.Layers)
+			}
+		}
+	}
+	addLayers("", true, jm.Layers)
+	return tm.build("json")
+}
+
+// addJSONTileset adds an embedded tileset, or if contents is non-nil, the
+// external tileset they contain (with ts giving the firstgid)
+func (tm *tiledMap) addJSONTileset(ts jsonTileset, contents []byte, dir string) {
+	firstGID := ts.FirstGID
+	if contents != nil {
+		ts = jsonTileset{}
+		if err := json.Unmarshal(contents, &ts); err != nil {
+			panic(err)
+		}
+	}
+	tileset := &Tileset{
+		Name:       ts.Name,
+		FirstGID:   firstGID,
+		TileCount:  ts.TileCount,
+		Columns:    ts.Columns,
+		TileWidth:  ts.TileWidth,
+		TileHeight: ts.TileHeight,
+		Margin:     ts.Margin,
+		Spacing:    ts.Spacing,
+	}
+	if ts.Image != "" {
+		tileset.Image = filepath.Join(dir, ts.Image)
+	}
+	tm.tilesets = append(tm.tilesets, tileset)
+	for _, t := range ts.Tiles {
+		tm.tileProps[firstGID+t.ID] = tilePropertiesFromTiled(jsonPropertiesToMap(t.Properties))
+	}
+}
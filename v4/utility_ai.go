@@ -0,0 +1,213 @@
+package sameriver
+
+import (
+	"sort"
+)
+
+// UtilityConsideration scores one aspect of an entity's situation in [0, 1]:
+// its Input is normalized from [Min, Max] to [0, 1] (unless Min == Max) and
+// mapped through its Curve (eg. Curves.Sigmoid(0.5, 1))
+type UtilityConsideration struct {
+	Name  string
+	Input func(e *Entity) float64
+	Min   float64
+	Max   float64
+	// (nil for linear)
+	Curve CurveFunc
+}
+
+func (c *UtilityConsideration) Score(e *Entity) float64 {
+	x := c.Input(e)
+	if c.Max != c.Min {
+		x = (x - c.Min) / (c.Max - c.Min)
+	}
+	if c.Curve == nil {
+		return Curves.Lin(x)
+	}
+	return Curves.Clamped(c.Curve(x))
+}
+
+// UtilityStateInput reads key from the entity's STATE
+func UtilityStateInput(key string) func(e *Entity) float64 {
+	return func(e *Entity) float64 {
+		return float64(e.GetIntMap(STATE).Get(key))
+	}
+}
+
+// UtilityMindInput reads a number (int or float64) from the entity's mind
+// (0 if it's not set)
+func UtilityMindInput(name string) func(e *Entity) float64 {
+	return func(e *Entity) float64 {
+		return utilityNumber(e.GetMind(name))
+	}
+}
+
+// UtilityBlackboardInput reads a number (int or float64) from a world
+// blackboard (0 if it's not set)
+func UtilityBlackboardInput(bb, key string) func(e *Entity) float64 {
+	return func(e *Entity) float64 {
+		return utilityNumber(e.World.Blackboard(bb).Get(key))
+	}
+}
+
+func utilityNumber(v any) float64 {
+	switch x := v.(type) {
+	case int:
+		return float64(x)
+	case float64:
+		return x
+	case bool:
+		if x {
+			return 1
+		}
+	}
+	return 0
+}
+
+// UtilityOption is something an entity could decide to do, scored by its
+// considerations. When chosen, its Goal is handed to the entity's
+// GOAPExecutor (if it has one), and a BehaviourTree node using
+// UtilitySelector.BTSelector() descends to the child with its Name.
+type UtilityOption struct {
+	Name           string
+	Considerations []*UtilityConsideration
+	// multiplies the score (eg. to rank fleeing above eating when both are
+	// urgent); 0 is taken as 1
+	Weight float64
+	// a GOAP goal spec, as given to GOAPPlanner.Plan() (optional)
+	Goal any
+}
+
+// Score is the product of the considerations' scores (so that any one
+// scoring 0 vetoes the option), compensated for their number so that
+// options with many considerations aren't penalised, times the Weight. An
+// option with no considerations scores its Weight.
+func (o *UtilityOption) Score(e *Entity) float64 {
+	weight := o.Weight
+	if weight == 0 {
+		weight = 1
+	}
+	n := len(o.Considerations)
+	if n == 0 {
+		return weight
+	}
+	score := 1.0
+	for _, c := range o.Considerations {
+		score *= c.Score(e)
+		if score == 0 {
+			return 0
+		}
+	}
+	// (compensation factor as in Dave Mark's Infinite Axis Utility System)
+	modification := 1 - 1/float64(n)
+	makeUp := (1 - score) * modification
+	return weight * (score + makeUp*score)
+}
+
+// UtilitySelector chooses between options by their scores. To keep agents
+// from dithering between options scoring about the same, a challenger must
+// beat the current option's score by Hysteresis to replace it, and an option
+// is kept for at least InertiaMs once chosen (unless its score drops to 0).
+type UtilitySelector struct {
+	Options []*UtilityOption
+	// the margin by which an option must outscore the current one to
+	// replace it
+	Hysteresis float64
+	// how long (ms) an option is kept once chosen
+	InertiaMs float64
+	// how often (ms) options are rescored by Update()
+	PeriodMs float64
+
+	// the scores of the options when last scored, by name
+	Scores map[string]float64
+
+	current *UtilityOption
+	// the clock, when the current option was chosen, and when we last scored
+	t         float64
+	chosenAt  float64
+	scoredAt  float64
+	hasScored bool
+}
+
+func NewUtilitySelector(options ...*UtilityOption) *UtilitySelector {
+	return &UtilitySelector{
+		Options:    options,
+		Hysteresis: 0.1,
+		InertiaMs:  1000,
+		PeriodMs:   250,
+		Scores:     make(map[string]float64),
+	}
+}
+
+// Current is the option chosen (nil if none scored above 0)
+func (u *UtilitySelector) Current() *UtilityOption {
+	return u.current
+}
+
+// Update advances the clock and, every PeriodMs, rescores the options,
+// giving whether the choice changed
+func (u *UtilitySelector) Update(e *Entity, dt_ms float64) (changed bool) {
+	u.t += dt_ms
+	if u.hasScored && u.t-u.scoredAt < u.PeriodMs {
+		return false
+	}
+	return u.Select(e)
+}
+
+// Select rescores the options now, giving whether the choice changed
+func (u *UtilitySelector) Select(e *Entity) (changed bool) {
+	u.scoredAt = u.t
+	u.hasScored = true
+	var best *UtilityOption
+	bestScore := 0.0
+	for _, o := range u.Options {
+		score := o.Score(e)
+		u.Scores[o.Name] = score
+		if score > bestScore {
+			best, bestScore = o, score
+		}
+	}
+	if best == u.current {
+		return false
+	}
+	if u.current != nil {
+		currentScore := u.Scores[u.current.Name]
+		if currentScore > 0 {
+			if u.t-u.chosenAt < u.InertiaMs {
+				return false
+			}
+			if best != nil && bestScore < currentScore+u.Hysteresis {
+				return false
+			}
+		}
+	}
+	u.current = best
+	u.chosenAt = u.t
+	return true
+}
+
+// BTSelector gives a BTNode Selector which descends to the child named as
+// the current option (-1, failing, if there's none)
+func (u *UtilitySelector) BTSelector() func(self *BTNode) int {
+	return func(self *BTNode) int {
+		if u.current == nil {
+			return -1
+		}
+		for i, child := range self.Children {
+			if child.Name == u.current.Name {
+				return i
+			}
+		}
+		return -1
+	}
+}
+
+// Ranked gives the options' last scores from best to worst
+func (u *UtilitySelector) Ranked() []*UtilityOption {
+	ranked := make([]*UtilityOption, len(u.Options))
+	copy(ranked, u.Options)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return u.Scores[ranked[i].Name] > u.Scores[ranked[j].Name]
+	})
+	return ranked
+}
@@ -0,0 +1,207 @@
+package sameriver
+
+import (
+	"math"
+	"testing"
+)
+
+// options to eat (urgent as hunger rises) or farm (always somewhat worth
+// doing, unless there's bandits about)
+func testingUtilityOptions() (eat, farm *UtilityOption) {
+	eat = &UtilityOption{
+		Name: "eat",
+		Considerations: []*UtilityConsideration{
+			{
+				Name:  "hunger",
+				Input: UtilityStateInput("hunger"),
+				Min:   0,
+				Max:   100,
+			},
+		},
+		Goal: map[string]int{"self.hunger,=": 0},
+	}
+	farm = &UtilityOption{
+		Name:   "farm",
+		Weight: 0.5,
+		Considerations: []*UtilityConsideration{
+			{
+				Name:  "safety",
+				Input: UtilityBlackboardInput("village", "bandits"),
+				Min:   0,
+				Max:   1,
+				Curve: Curves.Lt(0.5),
+			},
+		},
+	}
+	return eat, farm
+}
+
+func TestUtilityOptionScore(t *testing.T) {
+	w := testingWorld()
+	e := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			STATE: map[string]int{"hunger": 50},
+		},
+	})
+	e.SetMind("fear", 0.5)
+	eat, farm := testingUtilityOptions()
+	if score := farm.Score(e); score != 0.5 {
+		t.Fatalf("farm should score its weight while safe, got %f", score)
+	}
+	w.Blackboard("village").Set("bandits", 1)
+	if score := farm.Score(e); score != 0 {
+		t.Fatalf("bandits should veto farming, got %f", score)
+	}
+	one := eat.Score(e)
+	// a second consideration scoring the same shouldn't halve the score, as
+	// an uncompensated product would
+	eat.Considerations = append(eat.Considerations, &UtilityConsideration{
+		Name:  "fear",
+		Input: UtilityMindInput("fear"),
+		Min:   0,
+		Max:   1,
+	})
+	two := eat.Score(e)
+	if two >= one || two <= one*one {
+		t.Fatalf("compensated score %f should be between %f and %f", two, one*one, one)
+	}
+	if math.Abs((&UtilityOption{Weight: 2}).Score(e)-2) > 1e-9 {
+		t.Fatal("option with no considerations should score its weight")
+	}
+}
+
+func TestUtilitySelectorHysteresisInertia(t *testing.T) {
+	w := testingWorld()
+	e := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			STATE: map[string]int{"hunger": 0},
+		},
+	})
+	eat, farm := testingUtilityOptions()
+	u := NewUtilitySelector(eat, farm)
+	u.Hysteresis = 0.4
+	u.InertiaMs = 1000
+	u.PeriodMs = 100
+	if !u.Update(e, FRAME_MS) || u.Current() != farm {
+		t.Fatal("should have chosen to farm")
+	}
+	// eat scores 0.8 against farm's 0.5: not enough to switch, however long
+	// we wait
+	e.GetIntMap(STATE).Set("hunger", 80)
+	for i := 0; i < 20; i++ {
+		if u.Update(e, 100) {
+			t.Fatalf("shouldn't have switched within the hysteresis, scores %v", u.Scores)
+		}
+	}
+	if u.Ranked()[0] != eat {
+		t.Fatal("eat should rank first though it wasn't chosen")
+	}
+	e.GetIntMap(STATE).Set("hunger", 100)
+	if !u.Update(e, 100) || u.Current() != eat {
+		t.Fatal("should have switched to eating")
+	}
+	// near sated, farming outscores eating, but we stick with eating a while
+	e.GetIntMap(STATE).Set("hunger", 5)
+	if u.Update(e, 100) {
+		t.Fatal("should have kept eating for the inertia period")
+	}
+	u.Update(e, 1000)
+	if u.Current() != farm {
+		t.Fatal("should have gone back to farming after the inertia period")
+	}
+	// an option vetoed (scoring 0) is dropped despite inertia
+	w.Blackboard("village").Set("bandits", 1)
+	e.GetIntMap(STATE).Set("hunger", 0)
+	if !u.Select(e) || u.Current() != nil {
+		t.Fatal("farming should have been dropped for the bandits")
+	}
+}
+
+func TestUtilityBTSelector(t *testing.T) {
+	w := testingWorld()
+	e := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			STATE: map[string]int{"hunger": 100},
+		},
+	})
+	eat, farm := testingUtilityOptions()
+	u := NewUtilitySelector(eat, farm)
+	bt := NewBehaviourTree("villager", &BTNode{
+		Name:     "Utility",
+		Selector: u.BTSelector(),
+		Children: []*BTNode{
+			{Name: "farm"},
+			{Name: "eat"},
+		},
+	})
+	btr := NewBTRunner()
+	if btr.ExecuteBT(e, bt) != nil {
+		t.Fatal("tree should fail with no option chosen")
+	}
+	u.Select(e)
+	state := btr.ExecuteBT(e, bt)
+	if state == nil || state.Action.Name != "eat" {
+		t.Fatal("tree should have descended to the chosen option")
+	}
+}
+
+func TestUtilitySystemSetsGOAPGoal(t *testing.T) {
+	w := testingWorld()
+	goapSystem := NewGOAPSystem()
+	s := NewUtilitySystem()
+	w.RegisterSystems(goapSystem, s)
+	e := w.Spawn(map[string]any{
+		"components": map[ComponentID]any{
+			POSITION: Vec2D{0, 0},
+			BOX:      Vec2D{1, 1},
+			STATE:    map[string]int{"hunger": 100},
+			GOAP:     nil,
+			UTILITY:  nil,
+		},
+	})
+	p := NewGOAPPlanner(e)
+	p.AddActions(NewGOAPAction(map[string]any{
+		"name": "eat",
+		"node": "self",
+		"cost": 1,
+		"pres": nil,
+		"effs": map[string]int{
+			"self.hunger,=": 0,
+		},
+	}))
+	actions := NewGOAPActionRegistry()
+	actions.Register("eat", &GOAPActionImpl{
+		Tick: func(ctx *GOAPActionContext, dt_ms float64) GOAPActionStatus {
+			ctx.Entity.GetIntMap(STATE).Set("hunger", 0)
+			return GOAP_ACTION_SUCCEEDED
+		},
+	})
+	x := NewGOAPExecutor(e, p, actions)
+	e.SetGeneric(GOAP, x)
+	eat, farm := testingUtilityOptions()
+	u := NewUtilitySelector(eat, farm)
+	e.SetGeneric(UTILITY, u)
+
+	ch := s.Events.Subscribe(SimpleEventFilter("utility-goal-changed"))
+	for i := 0; i < 10 && x.Status != GOAP_EXEC_SUCCEEDED; i++ {
+		w.Update(FRAME_MS / 2)
+	}
+	if len(ch.C) != 1 {
+		t.Fatal("should have published the decision")
+	}
+	decision := (<-ch.C).Data.(*UtilityDecision)
+	if decision.Option != eat || decision.Previous != nil || decision.Entity != e {
+		t.Fatal("decision should have been to eat")
+	}
+	if x.Status != GOAP_EXEC_SUCCEEDED || e.GetIntMap(STATE).Get("hunger") != 0 {
+		t.Fatalf("executor should have planned for and achieved the goal, got %d (%v)",
+			x.Status, x.Err)
+	}
+	// farming has no goal, so switching to it drops the executor's goal
+	u.InertiaMs = 0
+	u.PeriodMs = 0
+	w.Update(FRAME_MS / 2)
+	if u.Current() != farm || x.Goal != nil {
+		t.Fatal("switching to an option without a goal should have cancelled the executor's")
+	}
+}
@@ -0,0 +1,73 @@
+package sameriver
+
+// UtilityDecision is the data of a "utility-goal-changed" event
+type UtilityDecision struct {
+	Entity   *Entity
+	Selector *UtilitySelector
+	// the option now chosen (nil if none scores above 0) and the one it
+	// replaced
+	Option   *UtilityOption
+	Previous *UtilityOption
+}
+
+// UtilitySystem updates the UtilitySelector in the UTILITY component of each
+// entity. When an entity's choice changes, the chosen option's Goal (if any)
+// is handed to the GOAPExecutor in its GOAP component (if any), and a
+// "utility-goal-changed" event is published on Events.
+type UtilitySystem struct {
+	w               *World
+	utilityEntities *UpdatedEntityList
+	Events          *EventBus
+}
+
+func NewUtilitySystem() *UtilitySystem {
+	return &UtilitySystem{
+		Events: NewEventBus("utility"),
+	}
+}
+
+func (s *UtilitySystem) GetComponentDeps() []any {
+	return []any{
+		UTILITY, GENERIC, "UTILITY",
+		GOAP, GENERIC, "GOAP",
+	}
+}
+
+func (s *UtilitySystem) LinkWorld(w *World) {
+	s.w = w
+	s.utilityEntities = w.GetUpdatedEntityList(
+		EntityFilterFromComponentBitArray(
+			"utility",
+			w.em.components.BitArrayFromIDs([]ComponentID{UTILITY})))
+}
+
+func (s *UtilitySystem) Update(dt_ms float64) {
+	for _, e := range s.utilityEntities.entities {
+		u, _ := e.GetGeneric(UTILITY).(*UtilitySelector)
+		if u == nil {
+			continue
+		}
+		previous := u.Current()
+		if !u.Update(e, dt_ms) {
+			continue
+		}
+		option := u.Current()
+		if x := goapExecutorOf(e); x != nil {
+			if option != nil && option.Goal != nil {
+				x.SetGoal(option.Goal, nil)
+			} else {
+				x.Cancel()
+			}
+		}
+		s.Events.Publish("utility-goal-changed", &UtilityDecision{
+			Entity:   e,
+			Selector: u,
+			Option:   option,
+			Previous: previous,
+		})
+	}
+}
+
+func (s *UtilitySystem) Expand(n int) {
+	// nil?
+}
@@ -20,6 +20,11 @@ type World struct {
 
 	Width  float64
 	Height float64
+	// if Unbounded, Width and Height don't limit where entities can be, and
+	// only size the initial extent of structures like the quadtree
+	Unbounded bool
+	// what happens to entities which move past the edges (see WorldBorder)
+	Border WorldBorder
 
 	IdGen  *IDGenerator
 	Events *EventBus
@@ -43,6 +48,15 @@ type World struct {
 
 	// blackboards that entity's can join to share events and state
 	blackboards map[string]*Blackboard
+	// every blackboard whose clock the world advances (see AddBlackboard())
+	liveBlackboards map[*Blackboard]bool
+	// when Update() last advanced their clocks
+	blackboardsUpdatedAt time.Time
+
+	// the nodes claimed by GOAP agents (see GOAPReservations())
+	reservations *GOAPReservations
+	// GOAP plans shared among agents (see GOAPPlanCache())
+	planCache *GOAPPlanCache
 
 	// for sharing runtime among the various runtimelimiter kinds
 	// and contains the RuntimeLimiters to which we Add() LogicUnits
@@ -54,8 +68,18 @@ type World struct {
 	// for statistics tracking - the avg ms used to run World.Update()
 	totalRuntimeAvg_ms *float64
 
-	// used for entity distance queries
+	// used for entity distance queries (see SpatialIndex for the kinds
+	// selectable with the "spatialIndex" key of the world spec)
+	SpatialIndex SpatialIndex
+	// the kind of SpatialIndex ("grid", "quadtree", ...)
+	SpatialIndexKind string
+	// the same object as SpatialIndex if it's a "grid", else nil
 	SpatialHasher *SpatialHasher
+	// set by systems which move entities (see MarkSpatialIndexStale())
+	spatialIndexStale bool
+
+	// static terrain (optional; see SetTileMap())
+	TileMap *TileMap
 }
 
 type WorldSpec struct {
@@ -63,11 +87,21 @@ type WorldSpec struct {
 	Height              int
 	DistanceHasherGridX int
 	DistanceHasherGridY int
+	SpatialIndex        string
+	QuadTreeMaxDepth    int
+	SparseGridCellSize  int
+	Unbounded           bool
+	Border              string
 }
 
 func destructureWorldSpec(spec map[string]any) WorldSpec {
 	var width, height int
 	var distanceHasherGridX, distanceHasherGridY int
+	var spatialIndex string
+	var quadTreeMaxDepth int
+	var sparseGridCellSize int
+	var unbounded bool
+	var border string
 	if _, ok := spec["width"].(int); ok {
 		width = spec["width"].(int)
 	} else {
@@ -88,12 +122,51 @@ func destructureWorldSpec(spec map[string]any) WorldSpec {
 	} else {
 		distanceHasherGridY = 10
 	}
+	if _, ok := spec["unbounded"].(bool); ok {
+		unbounded = spec["unbounded"].(bool)
+	} else {
+		unbounded = false
+	}
+	// a fixed grid can't cover an unbounded world, so default to the sparse
+	// grid in that case
+	if _, ok := spec["spatialIndex"].(string); ok {
+		spatialIndex = spec["spatialIndex"].(string)
+	} else if unbounded {
+		spatialIndex = "sparsegrid"
+	} else {
+		spatialIndex = "grid"
+	}
+	if _, ok := spec["sparseGridCellSize"].(int); ok {
+		sparseGridCellSize = spec["sparseGridCellSize"].(int)
+	} else {
+		sparseGridCellSize = 10
+	}
+	if _, ok := spec["border"].(string); ok {
+		border = spec["border"].(string)
+	} else if unbounded {
+		border = "none"
+	} else {
+		border = "clamp"
+	}
+	if unbounded && border != "none" {
+		panic(fmt.Sprintf("unbounded world can't have border %s (only none)", border))
+	}
+	if _, ok := spec["quadTreeMaxDepth"].(int); ok {
+		quadTreeMaxDepth = spec["quadTreeMaxDepth"].(int)
+	} else {
+		quadTreeMaxDepth = 6
+	}
 
 	return WorldSpec{
 		Width:               width,
 		Height:              height,
 		DistanceHasherGridX: distanceHasherGridX,
 		DistanceHasherGridY: distanceHasherGridY,
+		SpatialIndex:        spatialIndex,
+		QuadTreeMaxDepth:    quadTreeMaxDepth,
+		SparseGridCellSize:  sparseGridCellSize,
+		Unbounded:           unbounded,
+		Border:              border,
 	}
 }
 
@@ -108,6 +181,8 @@ func NewWorld(spec map[string]any) *World {
 		Seed:          seed,
 		Width:         float64(destructured.Width),
 		Height:        float64(destructured.Height),
+		Unbounded:     destructured.Unbounded,
+		Border:        WorldBorderFromString(destructured.Border),
 		Events:        NewEventBus("world"),
 		IdGen:         NewIDGenerator(),
 		systems:       make(map[string]System),
@@ -117,6 +192,8 @@ func NewWorld(spec map[string]any) *World {
 		funcs:         NewFuncSet(nil),
 		blackboards:   make(map[string]*Blackboard),
 		RuntimeSharer: NewRuntimeLimitSharer(),
+
+		liveBlackboards: make(map[*Blackboard]bool),
 	}
 
 	// set up runtimesharer
@@ -139,12 +216,12 @@ func NewWorld(spec map[string]any) *World {
 		POSITION, VEC2D, "POSITION",
 		BOX, VEC2D, "BOX",
 	})
-	// set up distance spatial hasher
-	w.SpatialHasher = NewSpatialHasher(
-		destructured.DistanceHasherGridX,
-		destructured.DistanceHasherGridY,
-		w,
-	)
+	// set up distance spatial index
+	w.SpatialIndex = NewSpatialIndex(destructured.SpatialIndex, destructured, w)
+	w.SpatialIndexKind = destructured.SpatialIndex
+	if h, ok := w.SpatialIndex.(*SpatialHasher); ok {
+		w.SpatialHasher = h
+	}
 
 	return w
 }
@@ -153,7 +230,9 @@ func (w *World) Update(allowance_ms float64) (overunder_ms float64) {
 	t0 := time.Now()
 	// process entity manager and spatial hash before anything
 	w.em.Update(allowance_ms / 8)
-	w.SpatialHasher.Update()
+	w.UpdateSpatialIndex()
+	// advance the clocks of the blackboards, so their SetFor() entries expire
+	w.updateBlackboards()
 	remaining_ms := allowance_ms - float64(time.Since(t0).Nanoseconds())/1e6
 	w.RuntimeSharer.Share(remaining_ms)
 
@@ -167,6 +246,39 @@ func (w *World) Update(allowance_ms float64) (overunder_ms float64) {
 	return overunder_ms
 }
 
+// The world's SpatialIndex is shared by all systems and world queries. Its
+// consistency guarantees within a frame are:
+//
+//   - at the start of World.Update(), after spawns and despawns have been
+//     processed, the index is brought up to date with all positions.
+//   - systems which move entities (eg. PhysicsSystem) call
+//     MarkSpatialIndexStale() after they run, and the index is refreshed
+//     before the next system or world query which reads it (see
+//     RefreshSpatialIndex()). So readers see positions as of the last moving
+//     system to have run, and the index is rebuilt (grid) or incrementally
+//     updated (trees) at most once per moving system per frame.
+//   - positions written by a system *during* its own Update() aren't
+//     reflected in the index until it completes.
+//   - positions set directly by logics (not via a moving system) are only
+//     picked up at the next refresh.
+func (w *World) UpdateSpatialIndex() {
+	w.SpatialIndex.Update()
+	w.spatialIndexStale = false
+}
+
+// MarkSpatialIndexStale signals that entities have moved since the index was
+// last updated
+func (w *World) MarkSpatialIndexStale() {
+	w.spatialIndexStale = true
+}
+
+// RefreshSpatialIndex updates the index only if it's been marked stale
+func (w *World) RefreshSpatialIndex() {
+	if w.spatialIndexStale {
+		w.UpdateSpatialIndex()
+	}
+}
+
 func (w *World) RegisterComponents(components []any) {
 	if len(components)%3 != 0 {
 		panic("malformed components specification given to RegisterComponents()")
@@ -498,10 +610,36 @@ func (w *World) HasFunc(name string) bool {
 func (w *World) Blackboard(name string) *Blackboard {
 	if _, ok := w.blackboards[name]; !ok {
 		w.blackboards[name] = NewBlackboard(name)
+		w.AddBlackboard(w.blackboards[name])
 	}
 	return w.blackboards[name]
 }
 
+// AddBlackboard has the world advance b's clock (see Blackboard.Update())
+// as it updates, so that its SetFor() entries expire. The world's own,
+// entities' and GOAP squads' blackboards are added for you.
+func (w *World) AddBlackboard(b *Blackboard) {
+	w.liveBlackboards[b] = true
+}
+
+// RemoveBlackboard stops the world advancing b's clock
+func (w *World) RemoveBlackboard(b *Blackboard) {
+	delete(w.liveBlackboards, b)
+}
+
+// advances the blackboards' clocks by the wall time since the last Update()
+// (not at all on the first)
+func (w *World) updateBlackboards() {
+	now := time.Now()
+	if !w.blackboardsUpdatedAt.IsZero() {
+		dt_ms := float64(now.Sub(w.blackboardsUpdatedAt).Nanoseconds()) / 1e6
+		for b := range w.liveBlackboards {
+			b.Update(dt_ms)
+		}
+	}
+	w.blackboardsUpdatedAt = now
+}
+
 func (w *World) ApplyComponentSet(e *Entity, spec map[ComponentID]any) {
 	w.em.components.ApplyComponentSet(e, spec)
 }
@@ -519,6 +657,9 @@ func (w *World) DumpStats() map[string](map[string]float64) {
 	} else {
 		stats["__totals"]["World.Update()"] = 0.0
 	}
+	if w.planCache != nil {
+		stats["goap-plan-cache"] = w.planCache.Stats()
+	}
 	return stats
 }
 
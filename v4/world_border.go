@@ -0,0 +1,82 @@
+package sameriver
+
+import (
+	"fmt"
+	"math"
+)
+
+// WorldBorder is what happens to entities which move past the edges of the
+// world's Width x Height rect, set with the "border" key of the world spec
+type WorldBorder int
+
+const (
+	// stop at the edge (default for bounded worlds)
+	BORDER_CLAMP WorldBorder = iota
+	// leaving one edge enters from the opposite edge (a torus)
+	BORDER_WRAP
+	// entities entirely outside the world are despawned
+	BORDER_DESPAWN
+	// no border; entities move freely at any coordinate, including negative
+	// (the only border allowed for unbounded worlds)
+	BORDER_NONE
+)
+
+var worldBorderNames = map[string]WorldBorder{
+	"clamp":   BORDER_CLAMP,
+	"wrap":    BORDER_WRAP,
+	"despawn": BORDER_DESPAWN,
+	"none":    BORDER_NONE,
+}
+
+func WorldBorderFromString(s string) WorldBorder {
+	if b, ok := worldBorderNames[s]; ok {
+		return b
+	}
+	panic(fmt.Sprintf("unknown border %s [valid: clamp, wrap, despawn, none]", s))
+}
+
+func (b WorldBorder) String() string {
+	for name, x := range worldBorderNames {
+		if x == b {
+			return name
+		}
+	}
+	return fmt.Sprintf("WorldBorder(%d)", int(b))
+}
+
+// InBounds is whether the rect (pos in the center) lies entirely within the
+// world. Always true for unbounded worlds.
+func (w *World) InBounds(pos, box Vec2D) bool {
+	if w.Unbounded {
+		return true
+	}
+	return RectWithinRect(pos, box, Vec2D{w.Width / 2, w.Height / 2}, Vec2D{w.Width, w.Height})
+}
+
+// OutOfBounds is whether the rect (pos in the center) lies entirely outside
+// the world. Always false for unbounded worlds.
+func (w *World) OutOfBounds(pos, box Vec2D) bool {
+	if w.Unbounded {
+		return false
+	}
+	return !AABBOfRect(pos, box).Overlaps(AABB{Vec2D{0, 0}, Vec2D{w.Width, w.Height}})
+}
+
+// WrapPosition brings a position into [0, Width) x [0, Height), as for
+// BORDER_WRAP
+func (w *World) WrapPosition(pos Vec2D) Vec2D {
+	return Vec2D{wrapf(pos.X, w.Width), wrapf(pos.Y, w.Height)}
+}
+
+// like math.Mod, but always in [0, m) (also for negative x)
+func wrapf(x, m float64) float64 {
+	r := math.Mod(x, m)
+	if r < 0 {
+		r += m
+	}
+	// (-tiny + m) can round to m
+	if r >= m {
+		r = 0
+	}
+	return r
+}
@@ -1,6 +1,9 @@
 package sameriver
 
-import "math"
+import (
+	"fmt"
+	"math"
+)
 
 func (w *World) FilterAllEntities(filter func(*Entity) bool) []*Entity {
 	results := make([]*Entity, 0)
@@ -47,7 +50,8 @@ func (w *World) ActiveEntitiesWithTags(tags ...string) []*Entity {
 }
 
 func (w *World) EntitiesWithinDistance(pos, box Vec2D, d float64) []*Entity {
-	return w.SpatialHasher.EntitiesWithinDistance(pos, box, d)
+	w.RefreshSpatialIndex()
+	return w.SpatialIndex.EntitiesWithinDistance(pos, box, d)
 }
 
 func (w *World) ClosestEntityFilter(pos Vec2D, box Vec2D, filter func(*Entity) bool) *Entity {
@@ -67,22 +71,82 @@ func (w *World) ClosestEntityFilter(pos Vec2D, box Vec2D, filter func(*Entity) b
 
 func (w *World) EntitiesWithinDistanceFilter(
 	pos, box Vec2D, d float64, filter func(*Entity) bool) []*Entity {
-	return w.SpatialHasher.EntitiesWithinDistanceFilter(pos, box, d, filter)
+	w.RefreshSpatialIndex()
+	return w.SpatialIndex.EntitiesWithinDistanceFilter(pos, box, d, filter)
 }
 
 func (w *World) EntitiesWithinDistanceApprox(pos, box Vec2D, d float64) []*Entity {
-	return w.SpatialHasher.EntitiesWithinDistanceApprox(pos, box, d)
+	w.RefreshSpatialIndex()
+	return w.SpatialIndex.EntitiesWithinDistanceApprox(pos, box, d)
 }
 
 func (w *World) EntitiesWithinDistanceApproxFilter(
 	pos, box Vec2D, d float64, filter func(*Entity) bool) []*Entity {
-	return w.SpatialHasher.EntitiesWithinDistanceApproxFilter(pos, box, d, filter)
+	w.RefreshSpatialIndex()
+	return w.SpatialIndex.EntitiesWithinDistanceApproxFilter(pos, box, d, filter)
 }
 
+// CellsWithinDistance gives the grid cells within d of the box at pos.
+// It's only available if the world's spatialIndex is "grid", panicking
+// otherwise.
 func (w *World) CellsWithinDistance(pos, box Vec2D, d float64) [][2]int {
-	return w.SpatialHasher.CellsWithinDistance(pos, box, d)
+	w.RefreshSpatialIndex()
+	return w.gridSpatialHasher("CellsWithinDistance").CellsWithinDistance(pos, box, d)
 }
 
+// CellsWithinDistanceApprox is like CellsWithinDistance(), but approximate.
+// It's only available if the world's spatialIndex is "grid", panicking
+// otherwise.
 func (w *World) CellsWithinDistanceApprox(pos, box Vec2D, d float64) [][2]int {
-	return w.SpatialHasher.CellsWithinDistanceApprox(pos, box, d)
+	w.RefreshSpatialIndex()
+	return w.gridSpatialHasher("CellsWithinDistanceApprox").CellsWithinDistanceApprox(pos, box, d)
+}
+
+// the world's SpatialHasher, for query, which needs one
+func (w *World) gridSpatialHasher(query string) *SpatialHasher {
+	if w.SpatialHasher == nil {
+		panic(fmt.Sprintf("%s() needs the world's spatialIndex to be \"grid\"; it's \"%s\"", query, w.SpatialIndexKind))
+	}
+	return w.SpatialHasher
+}
+
+// Raycast returns the entities (passing filter, if non-nil) struck by the ray
+// from origin in direction dir within maxDist, ordered by distance
+func (w *World) Raycast(
+	origin, dir Vec2D, maxDist float64, filter func(*Entity) bool) []RaycastHit {
+	w.RefreshSpatialIndex()
+	return w.SpatialIndex.Raycast(origin, dir, maxDist, filter)
+}
+
+func (w *World) RaycastFirst(
+	origin, dir Vec2D, maxDist float64, filter func(*Entity) bool) (RaycastHit, bool) {
+	w.RefreshSpatialIndex()
+	return w.SpatialIndex.RaycastFirst(origin, dir, maxDist, filter)
+}
+
+func (w *World) SegmentCast(from, to Vec2D, filter func(*Entity) bool) []RaycastHit {
+	w.RefreshSpatialIndex()
+	return w.SpatialIndex.SegmentCast(from, to, filter)
+}
+
+func (w *World) EntitiesOverlappingBox(pos, box Vec2D) []*Entity {
+	w.RefreshSpatialIndex()
+	return w.SpatialIndex.EntitiesOverlappingBox(pos, box)
+}
+
+func (w *World) EntitiesOverlappingBoxFilter(
+	pos, box Vec2D, filter func(*Entity) bool) []*Entity {
+	w.RefreshSpatialIndex()
+	return w.SpatialIndex.EntitiesOverlappingBoxFilter(pos, box, filter)
+}
+
+func (w *World) EntitiesOverlappingCircle(center Vec2D, radius float64) []*Entity {
+	w.RefreshSpatialIndex()
+	return w.SpatialIndex.EntitiesOverlappingCircle(center, radius)
+}
+
+func (w *World) EntitiesOverlappingCircleFilter(
+	center Vec2D, radius float64, filter func(*Entity) bool) []*Entity {
+	w.RefreshSpatialIndex()
+	return w.SpatialIndex.EntitiesOverlappingCircleFilter(center, radius, filter)
 }
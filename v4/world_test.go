@@ -30,6 +30,49 @@ func TestWorldRegisterSystemsDuplicate(t *testing.T) {
 	w.RegisterSystems(newTestSystem(), newTestSystem())
 }
 
+func TestWorldUnboundedSpec(t *testing.T) {
+	w := NewWorld(map[string]any{
+		"unbounded": true,
+	})
+	if w.Border != BORDER_NONE {
+		t.Fatalf("unbounded world should default to border none, got %s", w.Border)
+	}
+	if _, ok := w.SpatialIndex.(*SparseSpatialHasher); !ok {
+		t.Fatal("unbounded world should default to the sparse grid")
+	}
+	if w.OutOfBounds(Vec2D{-1e9, -1e9}, Vec2D{1, 1}) {
+		t.Fatal("nothing is out of bounds in an unbounded world")
+	}
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("Should have panic'd for an unbounded world with a border")
+		}
+	}()
+	NewWorld(map[string]any{
+		"unbounded": true,
+		"border":    "clamp",
+	})
+}
+
+func TestWorldWrapPosition(t *testing.T) {
+	w := NewWorld(map[string]any{
+		"width":  100,
+		"height": 50,
+		"border": "wrap",
+	})
+	cases := map[Vec2D]Vec2D{
+		{10, 10}:   {10, 10},
+		{110, 60}:  {10, 10},
+		{-10, -10}: {90, 40},
+		{-200, 0}:  {0, 0},
+	}
+	for pos, expected := range cases {
+		if got := w.WrapPosition(pos); got != expected {
+			t.Fatalf("WrapPosition(%v) should be %v, got %v", pos, expected, got)
+		}
+	}
+}
+
 func TestWorldAddDependentSystems(t *testing.T) {
 	w := testingWorld()
 	dep := newTestDependentSystem()